@@ -0,0 +1,417 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// AMQP binding names the attribute application properties cloudEvents_<name> and maps content-type to the property,
+	// see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/amqp-protocol-binding.md
+	AMQP_PROPERTY_PREFIX = "cloudEvents_"
+
+	// Message annotation Event Hubs picks the partition of the message by
+	AMQP_ANNOTATION_PARTITION_KEY = "x-opt-partition-key"
+
+	// Condition Event Hubs and Service Bus reject the messages with when they're throttling
+	AMQP_COND_SERVER_BUSY amqp.ErrCond = "com.microsoft:server-busy"
+
+	// Keys of the Azure connection strings
+	AZURE_CONN_ENDPOINT          = "Endpoint"
+	AZURE_CONN_SHARED_KEY_NAME   = "SharedAccessKeyName"
+	AZURE_CONN_SHARED_ACCESS_KEY = "SharedAccessKey"
+	AZURE_CONN_ENTITY_PATH       = "EntityPath"
+
+	// Claims-based security node the AAD token of the target is put to before the link opens, see
+	// https://learn.microsoft.com/en-us/azure/service-bus-messaging/service-bus-amqp-protocol-guide#claims-based-authorization
+	AMQP_CBS_ADDRESS      = "$cbs"
+	AMQP_CBS_PUT_TOKEN    = "put-token"
+	AMQP_CBS_TOKEN_JWT    = "jwt"
+	AMQP_CBS_STATUS_CODE  = "status-code"
+	AMQP_CBS_STATUS_DESCR = "status-description"
+
+	// Tokens are put again on the open connection after this long, AAD tokens are valid for an hour at least
+	AMQP_CBS_REFRESH = 30 * time.Minute
+)
+
+// Gives the AAD token put to the $cbs node, from the auth extension of the exporter
+type amqpTokenSource func(ctx context.Context) (string, error)
+
+/*
+Tokens of the auth extension (like oauth2client with the client credentials of an app registration and the
+https://eventhubs.azure.net/.default scope), taken from the authorization it adds to gRPC requests.
+*/
+func amqpTokens(creds credentials.PerRPCCredentials) amqpTokenSource {
+	return func(ctx context.Context) (string, error) {
+		md, err := creds.GetRequestMetadata(ctx)
+		if err != nil {
+			return "", err
+		}
+		for key, val := range md {
+			if strings.EqualFold(key, HEADER_AUTHORIZATION) {
+				return strings.TrimPrefix(val, "Bearer "), nil
+			}
+		}
+		return "", errors.New("the auth extension didn't give any authorization")
+	}
+}
+
+/*
+Puts the token of the audience (amqp://<host>/<target>) to the $cbs node of the connection, over a session of its
+own with a sender to the node and a receiver for its reply.
+*/
+func putAMQPToken(ctx context.Context, conn *amqp.Conn, audience string, tokens amqpTokenSource) error {
+	token, err := tokens(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get a token from the auth extension: %w", err)
+	}
+
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer session.Close(ctx)
+
+	var id [8]byte
+	if _, err = rand.Read(id[:]); err != nil {
+		return err
+	}
+	replyTo := AMQP_CBS_ADDRESS + "-" + hex.EncodeToString(id[:])
+
+	sender, err := session.NewSender(ctx, AMQP_CBS_ADDRESS, nil)
+	if err != nil {
+		return err
+	}
+	receiver, err := session.NewReceiver(ctx, AMQP_CBS_ADDRESS, &amqp.ReceiverOptions{TargetAddress: replyTo})
+	if err != nil {
+		return err
+	}
+
+	err = sender.Send(ctx, &amqp.Message{
+		Value:      token,
+		Properties: &amqp.MessageProperties{MessageID: replyTo, ReplyTo: &replyTo},
+		ApplicationProperties: map[string]interface{}{
+			"operation": AMQP_CBS_PUT_TOKEN,
+			"type":      AMQP_CBS_TOKEN_JWT,
+			"name":      audience,
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	reply, err := receiver.Receive(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_ = receiver.AcceptMessage(ctx, reply)
+	return cbsStatus(reply)
+}
+
+// Error of the reply to put-token, nil when the token was taken (200 or 202)
+func cbsStatus(reply *amqp.Message) error {
+	var code int64
+	switch status := reply.ApplicationProperties[AMQP_CBS_STATUS_CODE].(type) {
+	case int32:
+		code = int64(status)
+	case int64:
+		code = status
+	case int:
+		code = int64(status)
+	}
+	if code == http.StatusOK || code == http.StatusAccepted {
+		return nil
+	}
+	return fmt.Errorf("%s refused the token with %d: %v", AMQP_CBS_ADDRESS, code, reply.ApplicationProperties[AMQP_CBS_STATUS_DESCR])
+}
+
+// Where the amqp transport sends the events and how it authenticates, from amqp or its connection_string
+type amqpTarget struct {
+	address  string
+	target   string
+	username string
+	password string
+}
+
+/*
+Parses the connection string of an Event Hubs or Service Bus namespace, like
+Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=<name>;SharedAccessKey=<key>;EntityPath=<event hub>
+The shared access key authenticates with SASL PLAIN, the way the namespaces take it on AMQP. It can be left out
+with auth, the AAD tokens authenticate instead.
+*/
+func parseAzureConnectionString(connStr string) (amqpTarget, error) {
+	var target amqpTarget
+	for _, part := range strings.Split(connStr, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case AZURE_CONN_ENDPOINT:
+			endpoint, err := url.Parse(val)
+			if err != nil || endpoint.Host == "" {
+				return target, fmt.Errorf("%s must be a valid URL, provided: %s", AZURE_CONN_ENDPOINT, val)
+			}
+			target.address = "amqps://" + endpoint.Host
+		case AZURE_CONN_SHARED_KEY_NAME:
+			target.username = val
+		case AZURE_CONN_SHARED_ACCESS_KEY:
+			target.password = val
+		case AZURE_CONN_ENTITY_PATH:
+			target.target = val
+		}
+	}
+
+	if target.address == "" {
+		return target, fmt.Errorf("%s is missing", AZURE_CONN_ENDPOINT)
+	}
+	if (target.username == "") != (target.password == "") {
+		return target, fmt.Errorf("%s and %s go together", AZURE_CONN_SHARED_KEY_NAME, AZURE_CONN_SHARED_ACCESS_KEY)
+	}
+	return target, nil
+}
+
+// Target of the amqp transport, the settings of amqp take over the ones of the connection string
+func amqpTargetOf(cfg *AMQPSettings) (amqpTarget, error) {
+	var target amqpTarget
+	if cfg.ConnectionString != "" {
+		var err error
+		if target, err = parseAzureConnectionString(string(cfg.ConnectionString)); err != nil {
+			return target, err
+		}
+	}
+	if cfg.Address != "" {
+		target.address = cfg.Address
+	}
+	if cfg.Target != "" {
+		target.target = cfg.Target
+	}
+	if cfg.Username != "" {
+		target.username = cfg.Username
+		target.password = string(cfg.Password)
+	}
+	return target, nil
+}
+
+// Opening the link failed, the broker is out of reach or refused the connection
+type amqpOpenError struct {
+	err error
+}
+
+func (e *amqpOpenError) Error() string {
+	return "couldn't open the link: " + e.err.Error()
+}
+
+func (e *amqpOpenError) Unwrap() error {
+	return e.err
+}
+
+type amqpSender interface {
+	Send(ctx context.Context, msg *amqp.Message, opts *amqp.SendOptions) error
+}
+
+// Sender link of the amqp transport, it's opened again on the next event once the link or its connection is lost
+type amqpLink struct {
+	target string // address of the link, like the event hub
+	mu     sync.Mutex
+	open   func(ctx context.Context) (amqpSender, io.Closer, error)
+	sender amqpSender
+	conn   io.Closer // closes the sender along with its session
+
+	// Puts the AAD token again on the open connection, nil without auth
+	renew     func(ctx context.Context) error
+	renewedAt time.Time
+}
+
+/*
+Link to the target over a connection of its own, the sender waits for the link credit the broker grants. With tokens
+the connection is anonymous and the token of the target is put to its $cbs node before the link opens, then again
+every AMQP_CBS_REFRESH while it stays open.
+*/
+func newAMQPLink(cfg *AMQPSettings, tokens amqpTokenSource) (*amqpLink, error) {
+	target, err := amqpTargetOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &amqp.ConnOptions{SASLType: amqp.SASLTypeAnonymous()}
+	if target.username != "" {
+		opts.SASLType = amqp.SASLTypePlain(target.username, target.password)
+	}
+	if cfg.TLS != nil {
+		if opts.TLSConfig, err = cfg.TLS.LoadTLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	audience, err := amqpAudience(target)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &amqpLink{target: target.target}
+	link.open = func(ctx context.Context) (amqpSender, io.Closer, error) {
+		conn, err := amqp.Dial(ctx, target.address, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tokens != nil {
+			if err = putAMQPToken(ctx, conn, audience, tokens); err != nil {
+				conn.Close()
+				return nil, nil, err
+			}
+			link.renew = func(ctx context.Context) error {
+				return putAMQPToken(ctx, conn, audience, tokens)
+			}
+			link.renewedAt = time.Now()
+		}
+		session, err := conn.NewSession(ctx, nil)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		sender, err := session.NewSender(ctx, target.target, nil)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+		return sender, conn, nil
+	}
+	return link, nil
+}
+
+// Audience of the token, the target on the host of the address like amqp://<namespace>.servicebus.windows.net/<event hub>
+func amqpAudience(target amqpTarget) (string, error) {
+	address, err := url.Parse(target.address)
+	if err != nil {
+		return "", err
+	}
+	return "amqp://" + address.Hostname() + "/" + target.target, nil
+}
+
+// Sender of the link, opened unless it's already open
+func (l *amqpLink) current(ctx context.Context) (amqpSender, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sender != nil {
+		// The token expires while the link stays open, it's put again before it does
+		if l.renew != nil && time.Since(l.renewedAt) >= AMQP_CBS_REFRESH {
+			if err := l.renew(ctx); err != nil {
+				return nil, err
+			}
+			l.renewedAt = time.Now()
+		}
+		return l.sender, nil
+	}
+	sender, conn, err := l.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l.sender, l.conn = sender, conn
+	return sender, nil
+}
+
+// Drops the sender after its link or connection is lost, unless another send already replaced it
+func (l *amqpLink) reset(sender amqpSender) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.sender != sender {
+		return
+	}
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.sender, l.conn, l.renew = nil, nil, nil
+}
+
+func (l *amqpLink) send(ctx context.Context, msg *amqp.Message) error {
+	sender, err := l.current(ctx)
+	if err != nil {
+		return &amqpOpenError{err: err}
+	}
+
+	err = sender.Send(ctx, msg, nil)
+	var connErr *amqp.ConnError
+	var linkErr *amqp.LinkError
+	if errors.As(err, &connErr) || errors.As(err, &linkErr) {
+		l.reset(sender)
+	}
+	return err
+}
+
+func (l *amqpLink) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	err := l.conn.Close()
+	l.sender, l.conn, l.renew = nil, nil, nil
+	return err
+}
+
+// AMQP message of the cloud-event in the content mode, the Ce-* headers of binary mode become cloudEvents_<name> properties
+func amqpMessage(headers http.Header, body []byte) *amqp.Message {
+	msg := &amqp.Message{Data: [][]byte{body}, Properties: &amqp.MessageProperties{}}
+	for key := range headers {
+		if strings.EqualFold(key, HEADER_CONTENT_TYPE) {
+			contentType := headers.Get(key)
+			msg.Properties.ContentType = &contentType
+			continue
+		}
+		if msg.ApplicationProperties == nil {
+			msg.ApplicationProperties = make(map[string]interface{}, len(headers))
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, HEADER_CE_PREFIX))
+		msg.ApplicationProperties[AMQP_PROPERTY_PREFIX+name] = headers.Get(key)
+	}
+	return msg
+}
+
+/*
+Sends the cloud-event to amqp.target in the configured content mode, the send waits for link credit and for the broker
+to take the message, bound by the timeout of the exporter. A lost connection or link is opened again by the next event,
+the events sent meanwhile along with the ones the broker rejects as busy are throttled like 429/503 do with http.
+*/
+func (e *cloudeventTransformExporter) sendAMQP(ce *cloudeventdata) error {
+	headers, body, err := ce.encodeFor(e.config.ContentMode, e.config)
+	if err != nil {
+		return err
+	}
+
+	msg := amqpMessage(headers, body)
+	msg.Annotations = amqp.Annotations{AMQP_ANNOTATION_PARTITION_KEY: ce.recordKey()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+	defer cancel()
+	if err = e.amqp.send(ctx, msg); err == nil {
+		return nil
+	}
+
+	formattedErr := fmt.Errorf("error exporting items, sending to %s failed: %w", e.amqp.target, err)
+	var amqpErr *amqp.Error
+	var openErr *amqpOpenError
+	var connErr *amqp.ConnError
+	var linkErr *amqp.LinkError
+	busy := errors.As(err, &amqpErr) && (amqpErr.Condition == AMQP_COND_SERVER_BUSY || amqpErr.Condition == amqp.ErrCondResourceLimitExceeded)
+	lost := errors.As(err, &openErr) || errors.As(err, &connErr) || errors.As(err, &linkErr)
+	if busy || lost || errors.Is(err, context.DeadlineExceeded) {
+		return &throttledError{err: formattedErr, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return formattedErr
+}
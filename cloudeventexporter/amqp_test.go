@@ -0,0 +1,279 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configauth"
+)
+
+const testConnectionString = "Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=secret;EntityPath=k8s-events"
+
+// Sender taking the messages, or failing them with the next of fails
+type fakeAMQPSender struct {
+	mu       sync.Mutex
+	messages []*amqp.Message
+	fails    []error
+}
+
+func (s *fakeAMQPSender) Send(_ context.Context, msg *amqp.Message, _ *amqp.SendOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.fails) > 0 {
+		err := s.fails[0]
+		s.fails = s.fails[1:]
+		return err
+	}
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+type fakeAMQPConn struct {
+	closed bool
+}
+
+func (c *fakeAMQPConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// Starts the exporter with a link opening the senders one after the other
+func startAMQPExporter(t *testing.T, cfg *Config, senders ...*fakeAMQPSender) (*cloudeventTransformExporter, *[]*fakeAMQPConn) {
+	var conns []*fakeAMQPConn
+	e, _ := newTestExporter(t, cfg)
+	e.amqp = &amqpLink{target: "k8s-events", open: func(context.Context) (amqpSender, io.Closer, error) {
+		require.Less(t, len(conns), len(senders), "too many links opened")
+		conn := &fakeAMQPConn{}
+		conns = append(conns, conn)
+		return senders[len(conns)-1], conn, nil
+	}}
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	return e, &conns
+}
+
+func amqpConfig() *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_AMQP
+	cfg.AMQP = AMQPSettings{ConnectionString: testConnectionString}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func TestAMQPTransportBinary(t *testing.T) {
+	cfg := amqpConfig()
+	cfg.AMQP.PartitionKeyAttribute = ATTR_EVENT_NS
+	require.NoError(t, cfg.Validate())
+
+	sender := &fakeAMQPSender{}
+	e, _ := startAMQPExporter(t, cfg, sender)
+
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "2023-04-01T10:00:00Z")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	require.Len(t, sender.messages, 1)
+	msg := sender.messages[0]
+	assert.Equal(t, map[string]interface{}{
+		"cloudEvents_id":          "uid-pod",
+		"cloudEvents_source":      "test-source",
+		"cloudEvents_specversion": "1.0",
+		"cloudEvents_type":        "com.test.event.v1.Created",
+		"cloudEvents_time":        "2023-04-01T10:00:00Z",
+	}, msg.ApplicationProperties)
+	assert.Equal(t, CONTENT_TYPE, *msg.Properties.ContentType)
+	assert.Equal(t, "testns", msg.Annotations[AMQP_ANNOTATION_PARTITION_KEY])
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.GetData(), &data))
+	assert.Equal(t, "Created", data["reason"])
+}
+
+func TestAMQPTransportStructured(t *testing.T) {
+	cfg := amqpConfig()
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+
+	sender := &fakeAMQPSender{}
+	e, _ := startAMQPExporter(t, cfg, sender)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	require.Len(t, sender.messages, 1)
+	msg := sender.messages[0]
+	assert.Nil(t, msg.ApplicationProperties)
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, *msg.Properties.ContentType)
+	// Partitioned by the uid without a partition key attribute
+	assert.Equal(t, "uid-pod", msg.Annotations[AMQP_ANNOTATION_PARTITION_KEY])
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.GetData(), &event))
+	assert.Equal(t, "uid-pod", event["id"])
+}
+
+func TestAMQPTransportLinkLost(t *testing.T) {
+	lost := &fakeAMQPSender{fails: []error{&amqp.LinkError{}}}
+	reopened := &fakeAMQPSender{}
+	e, conns := startAMQPExporter(t, amqpConfig(), lost, reopened)
+
+	var throttled *throttledError
+	require.ErrorAs(t, e.sendAMQP(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+	assert.Contains(t, throttled.Error(), "k8s-events")
+	require.Len(t, *conns, 1)
+	assert.True(t, (*conns)[0].closed)
+
+	// The next event opens the link again
+	require.NoError(t, e.sendAMQP(&cloudeventdata{uid: "uid", reason: "Created"}))
+	assert.Len(t, reopened.messages, 1)
+	assert.Len(t, *conns, 2)
+}
+
+func TestAMQPTransportRejected(t *testing.T) {
+	sender := &fakeAMQPSender{fails: []error{
+		&amqp.Error{Condition: AMQP_COND_SERVER_BUSY},
+		&amqp.Error{Condition: amqp.ErrCondMessageSizeExceeded},
+	}}
+	e, conns := startAMQPExporter(t, amqpConfig(), sender)
+
+	var throttled *throttledError
+	assert.ErrorAs(t, e.sendAMQP(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+
+	// Too large messages are rejected for good
+	err := e.sendAMQP(&cloudeventdata{uid: "uid", reason: "Created"})
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &throttled))
+
+	// A rejected message doesn't lose the link
+	assert.False(t, (*conns)[0].closed)
+}
+
+func TestParseAzureConnectionString(t *testing.T) {
+	target, err := parseAzureConnectionString(testConnectionString)
+	require.NoError(t, err)
+	assert.Equal(t, amqpTarget{address: "amqps://test.servicebus.windows.net", target: "k8s-events", username: "send", password: "secret"}, target)
+
+	_, err = parseAzureConnectionString("SharedAccessKeyName=send;SharedAccessKey=secret")
+	assert.Error(t, err)
+	_, err = parseAzureConnectionString("Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=send")
+	assert.Error(t, err)
+
+	// Without the shared access key for auth
+	target, err = parseAzureConnectionString("Endpoint=sb://test.servicebus.windows.net/;EntityPath=k8s-events")
+	require.NoError(t, err)
+	assert.Equal(t, amqpTarget{address: "amqps://test.servicebus.windows.net", target: "k8s-events"}, target)
+	audience, err := amqpAudience(target)
+	require.NoError(t, err)
+	assert.Equal(t, "amqp://test.servicebus.windows.net/k8s-events", audience)
+}
+
+// Credentials of an auth extension like oauth2client
+type fakePerRPCCredentials struct {
+	metadata map[string]string
+	err      error
+}
+
+func (c *fakePerRPCCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return c.metadata, c.err
+}
+
+func (c *fakePerRPCCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+func TestAMQPTokens(t *testing.T) {
+	token, err := amqpTokens(&fakePerRPCCredentials{metadata: map[string]string{"authorization": "Bearer aad-token"}})(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "aad-token", token)
+
+	_, err = amqpTokens(&fakePerRPCCredentials{metadata: map[string]string{}})(context.Background())
+	assert.Error(t, err)
+	_, err = amqpTokens(&fakePerRPCCredentials{err: errors.New("no token")})(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCBSStatus(t *testing.T) {
+	assert.NoError(t, cbsStatus(&amqp.Message{ApplicationProperties: map[string]interface{}{AMQP_CBS_STATUS_CODE: int32(202)}}))
+	assert.NoError(t, cbsStatus(&amqp.Message{ApplicationProperties: map[string]interface{}{AMQP_CBS_STATUS_CODE: int32(200)}}))
+
+	err := cbsStatus(&amqp.Message{ApplicationProperties: map[string]interface{}{
+		AMQP_CBS_STATUS_CODE: int32(401), AMQP_CBS_STATUS_DESCR: "InvalidSignature"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InvalidSignature")
+	assert.Error(t, cbsStatus(&amqp.Message{}))
+}
+
+func TestAMQPTokenRenewed(t *testing.T) {
+	sender := &fakeAMQPSender{}
+	renewals := 0
+	link := &amqpLink{target: "k8s-events"}
+	link.open = func(context.Context) (amqpSender, io.Closer, error) {
+		link.renew = func(context.Context) error {
+			renewals++
+			return nil
+		}
+		link.renewedAt = time.Now()
+		return sender, &fakeAMQPConn{}, nil
+	}
+
+	_, err := link.current(context.Background())
+	require.NoError(t, err)
+	_, err = link.current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, renewals)
+
+	// The token is put again once it's as old as AMQP_CBS_REFRESH
+	link.renewedAt = time.Now().Add(-AMQP_CBS_REFRESH)
+	_, err = link.current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, renewals)
+	_, err = link.current(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, renewals)
+
+	link.reset(sender)
+	assert.Nil(t, link.renew)
+}
+
+func TestValidateAMQP(t *testing.T) {
+	cfg := amqpConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AMQP.ConnectionString = "Endpoint=sb://test.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=secret"
+	assert.Error(t, cfg.Validate())
+	cfg.AMQP.Target = "k8s-events"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AMQP = AMQPSettings{Address: "amqp://localhost:5672", Target: "k8s-events"}
+	assert.NoError(t, cfg.Validate())
+	cfg.AMQP.Address = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = amqpConfig()
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+
+	// The shared access key or auth authenticates, not both
+	cfg = amqpConfig()
+	cfg.Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+	cfg.AMQP.ConnectionString = "Endpoint=sb://test.servicebus.windows.net/;EntityPath=k8s-events"
+	assert.NoError(t, cfg.Validate())
+	cfg.Auth = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg.AMQP = AMQPSettings{Address: "amqps://test.servicebus.windows.net", Target: "k8s-events", Username: "send", Password: "secret"}
+	assert.NoError(t, cfg.Validate())
+	cfg.Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,214 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.uber.org/zap"
+)
+
+/*
+Worker which collects the cloud-events from ceChan and sends them in batches of batch.max_size.
+A batch which doesn't fill up is sent anyway on every batch.flush_interval tick, so an event never
+waits longer than flush_interval even when there's no traffic to fill the batch.
+*/
+func (e *cloudeventTransformExporter) exportBatches(logger *zap.Logger, client *http.Client) {
+	batch := make([]*cloudeventdata, 0, e.config.Batch.MaxSize)
+
+	ticker := time.NewTicker(e.config.Batch.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			// Best effort to not lose what's already collected
+			if len(batch) > 0 {
+				e.flushBatch(logger, client, batch)
+			}
+			return
+		case ce := <-e.ceChan:
+			batch = append(batch, ce)
+			if len(batch) < e.config.Batch.MaxSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		e.flushBatch(logger, client, batch)
+
+		// Retries hold on to the events of the flushed batch, so it can't be re-used
+		batch = make([]*cloudeventdata, 0, e.config.Batch.MaxSize)
+	}
+}
+
+// Sends the batch, events of a throttled batch are retried one by one if retry is enabled
+func (e *cloudeventTransformExporter) flushBatch(logger *zap.Logger, client *http.Client, batch []*cloudeventdata) {
+	// Events could have expired while waiting for the batch to fill up
+	live := batch[:0]
+	for _, ce := range batch {
+		if e.expired(logger, ce) {
+			e.dequeued(ce)
+			continue
+		}
+		live = append(live, ce)
+	}
+	if batch = live; len(batch) == 0 {
+		return
+	}
+
+	err := e.sendBatch(client, batch)
+	for _, ce := range batch {
+		e.dequeued(ce)
+	}
+
+	if err == nil {
+		logger.Debug("Cloud-event batch sent", zap.Int("events", len(batch)))
+		for _, ce := range batch {
+			e.recordDelivered(ce)
+		}
+		return
+	}
+
+	logger.Error(err.Error(), zap.Int("events", len(batch)))
+
+	// The delivered events of a partly failed batch are done, the others fail with their own error
+	var partial *partialBatchError
+	if errors.As(err, &partial) {
+		for _, ce := range deliveredOf(batch, err) {
+			e.recordDelivered(ce)
+		}
+	}
+
+	// Retried one by one, the events which can't be retried anymore are dropped for good
+	for _, ce := range batch {
+		ceErr := err
+		if partial != nil {
+			var failed bool
+			if ceErr, failed = partial.failed[ce]; !failed {
+				continue
+			}
+		}
+		if throttled, ok := e.retryable(ce, ceErr); ok {
+			logger.Debug(exporterhelper.NewThrottleRetry(throttled.err, throttled.retryAfter).Error(), zap.String("id", ce.uid))
+			e.requeue(logger, ce, throttled.retryAfter)
+			continue
+		}
+		e.deadLetter(logger, ce, ceErr)
+	}
+}
+
+// Only some events of the batch failed, like the entries EventBridge rejected, the others were delivered
+type partialBatchError struct {
+	failed map[*cloudeventdata]error
+}
+
+func (e *partialBatchError) Error() string {
+	return fmt.Sprintf("error exporting items, %d events of the batch failed", len(e.failed))
+}
+
+// Events of the batch which were delivered despite err, none unless it's a partialBatchError
+func deliveredOf(batch []*cloudeventdata, err error) []*cloudeventdata {
+	var partial *partialBatchError
+	if err == nil {
+		return batch
+	}
+	if !errors.As(err, &partial) {
+		return nil
+	}
+
+	delivered := make([]*cloudeventdata, 0, len(batch)-len(partial.failed))
+	for _, ce := range batch {
+		if _, failed := partial.failed[ce]; !failed {
+			delivered = append(delivered, ce)
+		}
+	}
+	return delivered
+}
+
+/*
+Sends the events in a single request as JSON batch of structured cloud-events, whatever the content mode
+of the endpoints is. The eventbridge transport sends them as the entries of a PutEvents request instead. Batches whose data adds up to
+more than batch.chunked_threshold are encoded while they're sent, with chunked transfer encoding as the length
+isn't known upfront, instead of holding the whole body in memory to set Content-Length.
+*/
+func (e *cloudeventTransformExporter) sendBatch(client *http.Client, batch []*cloudeventdata) error {
+	if e.config.Transport == TRANSPORT_EVENTBRIDGE {
+		return e.sendEventBridgeBatch(client, batch)
+	}
+
+	events := make([]*structuredCloudEvent, 0, len(batch))
+	dataSize := 0
+	for _, ce := range batch {
+		event, err := ce.structured(e.config)
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		dataSize += len(event.Data)
+	}
+
+	// Marshalled once for every endpoint, unless it's streamed
+	chunked := e.config.Batch.ChunkedThreshold > 0 && dataSize > e.config.Batch.ChunkedThreshold
+	var buf []byte
+	if !chunked {
+		var err error
+		if buf, err = json.Marshal(events); err != nil {
+			return err
+		}
+	}
+
+	return e.deliver(batch, func(target endpointTarget) error {
+		var body io.Reader = bytes.NewReader(buf)
+		if chunked {
+			// The client closes the body on failure, which stops the encoding as well
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(writeBatch(pw, events))
+			}()
+			body = pr
+		}
+
+		req, err := http.NewRequest(http.MethodPost, target.url, body)
+		if err != nil {
+			return err
+		}
+		req.Header.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE_BATCH)
+
+		return e.doRequest(target.authorize(client, req), req)
+	})
+}
+
+// Writes the events as JSON array an event at a time, the same output json.Marshal gives for all of them
+func writeBatch(w io.Writer, events []*structuredCloudEvent) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+
+		buf, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "]")
+	return err
+}
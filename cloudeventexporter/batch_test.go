@@ -0,0 +1,146 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchFlushInterval(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 100, FlushInterval: 100 * time.Millisecond}
+
+	e, _ := startTestExporter(t, cfg)
+
+	pushed := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// A single event never fills the batch, the ticker has to flush it
+	req := nextRequest(t, requests)
+	assert.Less(t, time.Since(pushed), time.Second)
+	assert.Equal(t, CONTENT_TYPE_BATCH, req.header.Get(HEADER_CONTENT_TYPE))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, "1.0", events[0]["specversion"])
+	assert.Equal(t, "uid-pod", events[0]["id"])
+	assert.Equal(t, "test-source", events[0]["source"])
+	assert.Equal(t, "com.test.event.v1.Created", events[0]["type"])
+	assert.Equal(t, "Created", events[0]["data"].(map[string]interface{})["reason"])
+}
+
+func TestBatchMaxSize(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 3, FlushInterval: time.Hour}
+
+	// Single worker so that all of the events end up in the same batch
+	e, _ := newTestExporter(t, cfg)
+	e.client = server.Client()
+	e.workers.Add(1)
+	go func() {
+		defer e.workers.Done()
+		e.exportBatches(e.logger, e.client)
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(3, "Created")))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &events))
+	assert.Len(t, events, 3)
+}
+
+func TestBatchFlushedOnShutdown(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 100, FlushInterval: time.Hour}
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// Let a worker pick the event before shutting down
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, e.shutdown(context.Background()))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &events))
+	assert.Len(t, events, 1)
+}
+
+func TestBatchChunkedThreshold(t *testing.T) {
+	type received struct {
+		transferEncoding []string
+		contentLength    int64
+		events           []map[string]interface{}
+	}
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+		requests <- received{transferEncoding: r.TransferEncoding, contentLength: r.ContentLength, events: events}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 100, FlushInterval: time.Hour, ChunkedThreshold: 64 * 1024}
+
+	e, _ := startTestExporter(t, cfg)
+
+	// Small batch keeps Content-Length
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(2, "Created")))
+	req := <-requests
+	assert.Empty(t, req.transferEncoding)
+	assert.Greater(t, req.contentLength, int64(0))
+	assert.Len(t, req.events, 2)
+
+	// Large one is streamed
+	require.NoError(t, e.pushLogs(context.Background(), largeEvents(20, 8*1024)))
+	req = <-requests
+	assert.Equal(t, []string{"chunked"}, req.transferEncoding)
+	assert.Equal(t, int64(-1), req.contentLength)
+	require.Len(t, req.events, 20)
+	assert.Equal(t, "com.test.event.v1.Created", req.events[19]["type"])
+}
+
+func TestWriteBatchMatchesMarshal(t *testing.T) {
+	cfg := testConfig()
+	cfg.SequenceExtension = true
+
+	var events []*structuredCloudEvent
+	for i := 0; i < 3; i++ {
+		ce := &cloudeventdata{uid: "uid", reason: "Created", message: `"quoted"`}
+		ce.setExtension(EXTENSION_SEQUENCE, strconv.Itoa(i))
+		event, err := ce.structured(cfg)
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+
+	expected, err := json.Marshal(events)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeBatch(&buf, events))
+	assert.Equal(t, string(expected), buf.String())
+}
@@ -2,17 +2,240 @@ package cloudeventexporter
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
 	"unicode"
 
+	"github.com/Shopify/sarama"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configauth"
+	"go.opentelemetry.io/collector/config/configgrpc"
 	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
 )
 
 type Config struct {
-	Ce                            CloudEventSpec `mapstructure:"ce"`
-	Filter                        string         `mapstructure:"filter"`
+	Ce                 CloudEventSpec `mapstructure:"ce"`
+	Filter             string         `mapstructure:"filter"`
+	LogFilteredSamples int            `mapstructure:"log_filtered_samples"` // log one of every N events dropped by filter, 0 disables it
+	RequireFilter      bool           `mapstructure:"require_filter"`       // an empty or * filter fails the validation
+	NamespaceFilter    string         `mapstructure:"namespace_filter"`     // k8s.event.namespace values separated by |, empty or * for all
+
+	// Predicates on attributes deciding if an event is exported, see Match for how they're combined
+	AttributeFilters []AttributeFilter `mapstructure:"attribute_filters"`
+
+	// When the filters are applied, filter_then_convert (default) or convert_then_filter to filter on derived fields
+	FilterOrder string `mapstructure:"filter_order"`
+
+	// How overlapping attribute_filters decide, all (default) evaluates every one of them, first stops at the first match
+	Match string `mapstructure:"match"`
+
+	// Adds all of the log record attributes under otel.attributes in the data
+	IncludeOtelAttributes bool `mapstructure:"include_otel_attributes"`
+
+	// Resource attributes added under resource in the data, like k8s.cluster.name, * adds all of them
+	IncludeResourceAttributes []string `mapstructure:"include_resource_attributes"`
+
+	// Precision of Ce-Time and data's start_time, rfc3339 (seconds) or rfc3339nano
+	TimeFormat string `mapstructure:"time_format"` // start_time is left as the record has it when empty
+
+	// An unparseable k8s.event.start_time falls back to the record's observed timestamp instead of going without Ce-Time
+	ObservedTimeFallback bool `mapstructure:"observed_time_fallback"`
+
+	// Renames the data keys, like namespace: ns
+	FieldNames map[string]string `mapstructure:"field_names"`
+
+	// Nests the data object under this key, like {"event": {...}}, empty sends it as is
+	DataRootKey string `mapstructure:"data_root_key"`
+
+	// Fixed Ce-Type of some reasons instead of deriving it from the reason, like OOMKilling: com.example.oom
+	TypeOverrides map[string]string `mapstructure:"type_overrides"`
+
+	// Longest Ce-Type, longer ones get their reason truncated with a hash suffix (0 doesn't truncate)
+	MaxTypeLength int `mapstructure:"max_type_length"`
+
+	// How Ce-Id is formed, uid (default) or uid_seq appending a sequence number increasing with every event
+	IdStrategy string `mapstructure:"id_strategy"`
+
+	// Where the message comes from, body (default) or the message_attribute attribute of the record
+	MessageSource    string `mapstructure:"message_source"`
+	MessageAttribute string `mapstructure:"message_attribute"`
+
+	// A message which is a map or slice (in the body or message_attribute) goes in the data as JSON object or array
+	StructuredMessage bool `mapstructure:"structured_message"`
+
+	// What's sent when the record doesn't have a message at all, empty (default), fallback (message_fallback) or fail
+	MissingMessage  string `mapstructure:"missing_message"`
+	MessageFallback string `mapstructure:"message_fallback"`
+
+	// What's done with a reason which is empty or only white space, placeholder (default) sends reason_placeholder or fail
+	EmptyReason       string `mapstructure:"empty_reason"`
+	ReasonPlaceholder string `mapstructure:"reason_placeholder"`
+
+	// Removes leading and trailing white space of the message
+	TrimMessage bool `mapstructure:"trim_message"`
+
+	// Collapses the message to a single line, line breaks are replaced by single_line_separator
+	SingleLineMessage   bool   `mapstructure:"single_line_message"`
+	SingleLineSeparator string `mapstructure:"single_line_separator"`
+
+	// Invalid events are appended to this file and skipped instead of failing the logs
+	QuarantineFile string `mapstructure:"quarantine_file"`
+
+	// Don't fail the events missing k8s.event.count, their count is 1
+	OptionalCount bool `mapstructure:"optional_count"`
+
+	// With optional_count, the events missing k8s.event.count are sent without count instead of count 1
+	OmitMissingCount bool `mapstructure:"omit_missing_count"`
+
+	// pushLogs returns only after the events are delivered, errors go back to the pipeline
+	SyncSend bool `mapstructure:"sync_send"`
+
+	// Drops the records of a batch whose uid was already seen in the same batch, the first one is sent
+	DedupBatch bool `mapstructure:"dedup_batch"`
+
+	// The converted events of a batch are handed over in order of their time rather than the order of the records
+	SortByTime bool `mapstructure:"sort_by_time"`
+
+	// With sync_send the events are sent every stream_size converted events instead of after converting
+	// the whole batch, so huge batches aren't held in memory all at once (0 sends them all at once)
+	StreamSize int `mapstructure:"stream_size"`
+
+	// Adds the sequence extension, an integer increasing with every event of the exporter
+	SequenceExtension bool `mapstructure:"sequence_extension"`
+
+	// Adds the SHA-256 of the data as datadigest extension so consumers can detect corruption
+	DataDigest bool `mapstructure:"data_digest"`
+
+	// Sends the count as JSON string ("5") instead of number (5) for consumers expecting it
+	CountAsString bool `mapstructure:"count_as_string"`
+
+	// Extension attribute carrying the collector's pod name (POD_NAME) or hostname, empty doesn't send it
+	HostnameExtension string `mapstructure:"hostname_extension"`
+
+	// Extension attribute carrying the schema URL of the record's resource, empty doesn't send it
+	SchemaUrlExtension string `mapstructure:"schema_url_extension"`
+
+	// Attribute with the deadline of the event (RFC3339 or unix seconds), expired events are skipped instead of sent
+	DeadlineAttribute string `mapstructure:"deadline_attribute"`
+
+	// Extensions taken from attributes, coerced to their extension type
+	AttributeExtensions []AttributeExtension `mapstructure:"attribute_extensions"`
+
+	// Extension name -> attribute its string value comes from, like namespace: k8s.namespace.name
+	ExtensionsFromAttributes map[string]string `mapstructure:"extensions_from_attributes"`
+
+	// Integer extensions brokers act on, like knativebrokerttl, with a fixed value or one decremented from an attribute
+	BrokerExtensions []BrokerExtension `mapstructure:"broker_extensions"`
+
+	// Attribute (like k8s.event.involved_object.uid) sent as correlationid extension, empty doesn't send it
+	CorrelationAttribute string `mapstructure:"correlation_attribute"`
+
+	// Attribute (like k8s.event.involved_object.uid) sent as partitionkey extension, empty doesn't send it
+	PartitioningAttribute string `mapstructure:"partitioning_attribute"`
+
+	// Knative Broker whose address becomes the endpoint, resolved at start
+	KnativeBroker KnativeBrokerSettings `mapstructure:"knative_broker"`
+
+	// Splits the records carrying an array of events in their body into an event each
+	SplitEvents SplitEventsSettings `mapstructure:"split_events"`
+
+	// Attributes (or body fields) the fields of the k8s events come from, the k8s.event.* ones by default
+	Mapping MappingSettings `mapstructure:"mapping"`
+
+	// k8s_events (default) converts k8s event records, generic converts any log record with its body as the data
+	Mode    string          `mapstructure:"mode"`
+	Generic GenericSettings `mapstructure:"generic"`
+
+	// What of the spans a traces pipeline exports as cloud-events
+	Traces TracesSettings `mapstructure:"traces"`
+
+	// Threshold rules of a metrics pipeline, a datapoint crossing one of them is exported as cloud-event
+	Metrics MetricsSettings `mapstructure:"metrics"`
+
+	// Counts (and logs at debug) the pushed logs without any record, to spot misrouted pipelines
+	CountEmptyBatches bool `mapstructure:"count_empty_batches"`
+
+	// Counts (and logs at debug) how many records of every pushed logs were received, filtered, converted and enqueued
+	BatchSummary bool `mapstructure:"batch_summary"`
+
+	// Every worker gets a client (and connection pool) of its own instead of sharing one
+	ClientPerWorker bool `mapstructure:"client_per_worker"`
+
+	// Requests (HTTP/2 streams) in flight at a time, 0 leaves it to the workers and the server's limit
+	MaxConcurrentStreams int `mapstructure:"max_concurrent_streams"`
+
+	// The client's connections are replaced with fresh ones after this many failed requests in a row, 0 never does
+	ResetConnectionsAfter int `mapstructure:"reset_connections_after"`
+
+	// Bounds the serialized bytes of the events waiting for the workers, 0 only bounds the number of events
+	MaxQueueBytes int `mapstructure:"max_queue_bytes"`
+
+	// Caps the events per second across every reason
+	RateLimit RateLimitSettings `mapstructure:"rate_limit"`
+
+	// Once an event of a uid is emitted, the next ones of the uid are dropped till this long passes (0 doesn't)
+	UidMinInterval time.Duration `mapstructure:"uid_min_interval"`
+
+	// What happens to the events when max_queue_bytes or rate_limit is reached, block (default) waits and drop drops them
+	OnFull string `mapstructure:"on_full"`
+
+	// Nothing is sent till this long after start, for endpoints which aren't ready as soon as the collector
+	StartupDelay time.Duration `mapstructure:"startup_delay"`
+
+	// Sends the events in batches instead of a request per event
+	Batch BatchSettings `mapstructure:"batch"`
+
+	// binary (default) sends the attributes in Ce-* headers, structured sends them with the data in the body
+	ContentMode string `mapstructure:"content_mode"`
+
+	// Event format of structured mode, json (default) or protobuf
+	Format string `mapstructure:"format"`
+
+	// Endpoints of the http transport instead of endpoint, each one can have its own content mode
+	Endpoints []EndpointSettings `mapstructure:"endpoints"`
+
+	// Query parameters appended to the endpoint's own ones for every event, from the attribute they map to
+	QueryAttributes map[string]string `mapstructure:"query_attributes"`
+
+	// Content mode of the endpoints comes from the Accept-Post of an OPTIONS request at start, content_mode is the fallback
+	NegotiateContentMode bool `mapstructure:"negotiate_content_mode"`
+
+	// How the events go to the endpoints, fanout sends to every one of them and failover to the first one taking it.
+	// Required with more than one endpoint
+	Delivery string `mapstructure:"delivery"`
+
+	// On 413 Payload Too Large the message is truncated to this many bytes and the event sent once more, 0 doesn't
+	TruncateTooLarge int `mapstructure:"truncate_too_large"`
+
+	// Stores data above the threshold out of band, the events carry a reference to it in the dataref extension
+	DataRef DataRefSettings `mapstructure:"dataref"`
+
+	// Where a dead-letter event goes for the events dropped for good, for alerting on them
+	DeadLetter DeadLetterSettings `mapstructure:"dead_letter"`
+
+	// Where the reply events of the endpoints (like the ones of a Knative sink answering an event) go
+	Reply ReplySettings `mapstructure:"reply"`
+
+	// Where the cloud-events go, http (default), eventbridge, eventgrid, syslog, pubsub, grpc, kafka, nats, mqtt or amqp
+	Transport   string                        `mapstructure:"transport"`
+	EventBridge EventBridgeSettings           `mapstructure:"eventbridge"`
+	EventGrid   EventGridSettings             `mapstructure:"eventgrid"`
+	Syslog      SyslogSettings                `mapstructure:"syslog"`
+	PubSub      PubSubSettings                `mapstructure:"pubsub"`
+	GRPC        configgrpc.GRPCClientSettings `mapstructure:"grpc"`
+	Kafka       KafkaSettings                 `mapstructure:"kafka"`
+	NATS        NATSSettings                  `mapstructure:"nats"`
+	MQTT        MQTTSettings                  `mapstructure:"mqtt"`
+	AMQP        AMQPSettings                  `mapstructure:"amqp"`
+
 	//Endpoint                      string         `mapstructure:"endpoint"`
 	confighttp.HTTPClientSettings `mapstructure:",squash"` // squash ensures fields are correctly decoded in embedded struct.
 	exporterhelper.QueueSettings  `mapstructure:"sending_queue"`
@@ -23,6 +246,292 @@ type CloudEventSpec struct {
 	SpecVersion string `mapstructure:"spec_version"`
 	AppendType  string `mapstructure:"append_type"`
 	Source      string `mapstructure:"source"`
+
+	// Resource attribute (like k8s.cluster.name) used as source of the events, source is the fallback
+	SourceAttribute string `mapstructure:"source_attribute"`
+
+	// Extensions with a fixed value sent on every event, like env: prod
+	Extensions map[string]string `mapstructure:"extensions"`
+}
+
+const (
+	// CloudEvents spec versions the events can be sent as
+	SPEC_VERSION_1_0 = "1.0"
+	SPEC_VERSION_0_3 = "0.3"
+)
+
+// Version part of Ce-Type of every supported spec version
+var specTypeVersions = map[string]string{
+	SPEC_VERSION_1_0: "v1",
+	SPEC_VERSION_0_3: "v0",
+}
+
+const (
+	TRANSPORT_HTTP        = "http"
+	TRANSPORT_EVENTBRIDGE = "eventbridge"
+	TRANSPORT_EVENTGRID   = "eventgrid"
+	TRANSPORT_SYSLOG      = "syslog"
+	TRANSPORT_PUBSUB      = "pubsub"
+	TRANSPORT_GRPC        = "grpc"
+	TRANSPORT_KAFKA       = "kafka"
+	TRANSPORT_NATS        = "nats"
+	TRANSPORT_MQTT        = "mqtt"
+	TRANSPORT_AMQP        = "amqp"
+
+	ID_STRATEGY_UID     = "uid"
+	ID_STRATEGY_UID_SEQ = "uid_seq"
+
+	MESSAGE_SOURCE_BODY      = "body"
+	MESSAGE_SOURCE_ATTRIBUTE = "attribute"
+
+	MISSING_MESSAGE_EMPTY    = "empty"
+	MISSING_MESSAGE_FALLBACK = "fallback"
+	MISSING_MESSAGE_FAIL     = "fail"
+
+	EMPTY_REASON_PLACEHOLDER = "placeholder"
+	EMPTY_REASON_FAIL        = "fail"
+
+	FILTER_ORDER_FILTER_THEN_CONVERT = "filter_then_convert"
+	FILTER_ORDER_CONVERT_THEN_FILTER = "convert_then_filter"
+
+	MATCH_ALL   = "all"
+	MATCH_FIRST = "first"
+
+	TIME_FORMAT_RFC3339      = "rfc3339"
+	TIME_FORMAT_RFC3339_NANO = "rfc3339nano"
+
+	MODE_K8S_EVENTS = "k8s_events"
+	MODE_GENERIC    = "generic"
+
+	TRACES_SOURCE_SPAN_EVENTS = "span_events"
+	TRACES_SOURCE_SPANS       = "spans"
+
+	THRESHOLD_OP_GT  = "gt"
+	THRESHOLD_OP_GTE = "gte"
+	THRESHOLD_OP_LT  = "lt"
+	THRESHOLD_OP_LTE = "lte"
+)
+
+// Predicate on an attribute of the log record, scope or resource, value isn't used by exists
+type AttributeFilter struct {
+	Attribute string `mapstructure:"attribute"`
+	Op        string `mapstructure:"op"` // equals, contains, regex or exists
+	Value     string `mapstructure:"value"`
+	Action    string `mapstructure:"action"` // keep (default) or drop the matching events
+}
+
+// Settings for records batching several events in an array body, every element is a map of attributes
+type SplitEventsSettings struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	MessageKey string `mapstructure:"message_key"` // key of the element holding the event's message
+}
+
+// Attributes of the k8s event fields, body.<path> takes a field of the record's body instead like body.object.reason
+type MappingSettings struct {
+	Reason    string `mapstructure:"reason"`
+	StartTime string `mapstructure:"start_time"`
+	Name      string `mapstructure:"name"`
+	Namespace string `mapstructure:"namespace"`
+	Count     string `mapstructure:"count"`
+	UID       string `mapstructure:"uid"`
+}
+
+// Settings for mode generic, the attributes are looked up in the log record, then its scope and then its resource
+type GenericSettings struct {
+	ReasonAttribute string   `mapstructure:"reason_attribute"` // reason of the events, the severity text when empty or missing
+	Attributes      []string `mapstructure:"attributes"`       // copied into the data along with the body
+}
+
+// Settings for the traces pipeline, every span event (or span) becomes a cloud-event
+type TracesSettings struct {
+	Source     string   `mapstructure:"source"`      // span_events (default) or spans
+	EventNames []string `mapstructure:"event_names"` // names of the span events exported with span_events, empty exports all of them
+}
+
+// Settings for the metrics pipeline, only the datapoints crossing the threshold of a rule are exported
+type MetricsSettings struct {
+	Rules []ThresholdRule `mapstructure:"rules"`
+}
+
+// Threshold on the gauge or sum datapoints of a metric, like k8s.pod.memory.usage gt 1e9
+type ThresholdRule struct {
+	Metric string  `mapstructure:"metric"`
+	Op     string  `mapstructure:"op"` // gt, gte, lt or lte
+	Value  float64 `mapstructure:"value"`
+	Reason string  `mapstructure:"reason"` // reason of the events, like MemoryHigh, the metric's name when empty
+}
+
+// Token bucket settings, events_per_second 0 doesn't limit
+type RateLimitSettings struct {
+	EventsPerSecond float64 `mapstructure:"events_per_second"`
+	Burst           int     `mapstructure:"burst"` // events let through at once, events_per_second rounded up when 0
+}
+
+// Settings for sending the events as application/cloudevents-batch+json
+type BatchSettings struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	MaxSize       int           `mapstructure:"max_size"`       // events in a batch, it's sent as soon as it fills up
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // longest an event waits for the batch to fill up
+
+	// Batches whose data adds up to more than this many bytes are streamed with chunked transfer encoding, 0 disables it
+	ChunkedThreshold int `mapstructure:"chunked_threshold"`
+}
+
+// Extension attribute whose value comes from a log attribute, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md#type-system
+type AttributeExtension struct {
+	Name      string `mapstructure:"name"`
+	Attribute string `mapstructure:"attribute"`
+	Type      string `mapstructure:"type"` // string (default), integer or boolean
+}
+
+/*
+Integer extension of a broker, value unless the attribute has one. decrement sends the attribute's value minus one,
+like a hop count or TTL of an event which came through the broker before, and drops the event once it runs out.
+*/
+type BrokerExtension struct {
+	Name      string `mapstructure:"name"`
+	Value     int64  `mapstructure:"value"`
+	Attribute string `mapstructure:"attribute"`
+	Decrement bool   `mapstructure:"decrement"`
+}
+
+// Endpoint of the http transport, content_mode falls back to the top level one
+type EndpointSettings struct {
+	Endpoint    string `mapstructure:"endpoint"`
+	ContentMode string `mapstructure:"content_mode"`
+
+	// Credentials of the endpoint, instead of the top level auth when the endpoints need different ones
+	Auth        *configauth.Authentication     `mapstructure:"auth"`
+	BearerToken configopaque.String            `mapstructure:"bearer_token"`
+	Headers     map[string]configopaque.String `mapstructure:"headers"`
+}
+
+// Settings of the reply events, empty endpoint drops them
+type ReplySettings struct {
+	Endpoint string                         `mapstructure:"endpoint"`
+	Headers  map[string]configopaque.String `mapstructure:"headers"` // the headers and auth of the sink aren't sent to it
+}
+
+// Settings of the dead-letter events, empty endpoint doesn't send them
+type DeadLetterSettings struct {
+	Endpoint string                         `mapstructure:"endpoint"`
+	Headers  map[string]configopaque.String `mapstructure:"headers"` // the headers and auth of the sink aren't sent to it
+}
+
+// Blob store the data above threshold goes to, see EXTENSION_DATAREF
+type DataRefSettings struct {
+	Endpoint  string `mapstructure:"endpoint"`   // the data is PUT to <endpoint>/<id>.json
+	URLPrefix string `mapstructure:"url_prefix"` // replaces endpoint in the dataref the consumers get
+	Threshold int    `mapstructure:"threshold"`  // bytes of data above which it's stored out of band, 0 never does
+
+	Headers map[string]configopaque.String `mapstructure:"headers"` // the headers and auth of the sink aren't sent to it
+}
+
+// Knative Broker the events are sent to, its ingress URL is read from its Addressable status
+type KnativeBrokerSettings struct {
+	Namespace string `mapstructure:"namespace"`
+	Name      string `mapstructure:"name"`
+	APIServer string `mapstructure:"api_server"` // overrides https://kubernetes.default.svc, like for kubectl proxy
+}
+
+// Settings for the AWS EventBridge transport, credentials fall back to AWS_* environment variables
+type EventBridgeSettings struct {
+	Region          string              `mapstructure:"region"`
+	EventBusName    string              `mapstructure:"event_bus_name"`
+	Endpoint        string              `mapstructure:"endpoint"` // overrides https://events.<region>.amazonaws.com/
+	AccessKeyID     string              `mapstructure:"access_key_id"`
+	SecretAccessKey configopaque.String `mapstructure:"secret_access_key"`
+	SessionToken    configopaque.String `mapstructure:"session_token"`
+
+	// Role assumed with the credentials above, the events are signed with its temporary credentials
+	RoleARN         string `mapstructure:"role_arn"`
+	ExternalID      string `mapstructure:"external_id"`
+	RoleSessionName string `mapstructure:"role_session_name"` // defaults to cloudeventexporter
+	STSEndpoint     string `mapstructure:"sts_endpoint"`      // overrides https://sts.<region>.amazonaws.com/
+}
+
+// Settings for the Azure Event Grid transport, without sas_key the requests are authenticated with the auth extension
+type EventGridSettings struct {
+	Endpoint string              `mapstructure:"endpoint"` // of the topic, like https://<topic>.<region>-1.eventgrid.azure.net/api/events
+	SASKey   configopaque.String `mapstructure:"sas_key"`  // access key of the topic
+}
+
+// Settings for the syslog transport, the cloud-events are sent as RFC5424 messages
+type SyslogSettings struct {
+	Endpoint string `mapstructure:"endpoint"` // host:port
+	Network  string `mapstructure:"network"`  // tcp (default) or udp
+	Facility int    `mapstructure:"facility"`
+	AppName  string `mapstructure:"app_name"`
+}
+
+// Settings for the Google Pub/Sub transport, requests are authenticated with the auth extension (like oauth2client)
+type PubSubSettings struct {
+	Project  string `mapstructure:"project"`
+	Topic    string `mapstructure:"topic"`
+	Endpoint string `mapstructure:"endpoint"` // overrides https://pubsub.googleapis.com, like for the emulator
+
+	// Messages carry the uid, or the ordering_key_attribute, as ordering key so a subscription with ordering gets them in order
+	OrderingKey          bool   `mapstructure:"ordering_key"`
+	OrderingKeyAttribute string `mapstructure:"ordering_key_attribute"`
+
+	// Authenticates with the GCP Application Default Credentials, like the workload identity on GKE, instead of the auth extension
+	DefaultCredentials bool `mapstructure:"default_credentials"`
+}
+
+// Settings for the kafka transport, the cloud-events are records of the topic as per the Kafka binding
+type KafkaSettings struct {
+	Brokers               []string                    `mapstructure:"brokers"`
+	Topic                 string                      `mapstructure:"topic"`
+	PartitionKeyAttribute string                      `mapstructure:"partition_key_attribute"` // key of the records, the event's uid when it's empty
+	ProtocolVersion       string                      `mapstructure:"protocol_version"`        // like 2.0.0, 1.0.0 when empty
+	TLS                   *configtls.TLSClientSetting `mapstructure:"tls"`                     // plaintext connections when nil
+	SASL                  *KafkaSASLSettings          `mapstructure:"sasl"`
+}
+
+type KafkaSASLSettings struct {
+	Mechanism string              `mapstructure:"mechanism"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	Username  string              `mapstructure:"username"`
+	Password  configopaque.String `mapstructure:"password"`
+}
+
+// Settings for the nats transport, the cloud-events are messages of the subject as per the NATS binding
+type NATSSettings struct {
+	URL       string                      `mapstructure:"url"` // nats://host:4222, several servers separated by commas
+	Subject   string                      `mapstructure:"subject"`
+	Username  string                      `mapstructure:"username"`
+	Password  configopaque.String         `mapstructure:"password"`
+	Token     configopaque.String         `mapstructure:"token"`
+	TLS       *configtls.TLSClientSetting `mapstructure:"tls"` // TLS only when the servers require it when nil
+	JetStream NATSJetStreamSettings       `mapstructure:"jetstream"`
+}
+
+type NATSJetStreamSettings struct {
+	Enabled bool          `mapstructure:"enabled"` // every message waits for the ack of the stream
+	Stream  string        `mapstructure:"stream"`  // stream created at start capturing the subject unless it's there, none when empty
+	MaxAge  time.Duration `mapstructure:"max_age"` // of the messages of the created stream, 0 keeps them for good
+}
+
+// Settings for the mqtt transport, the cloud-events are MQTT 3.1.1 or 5 messages as per the MQTT binding
+type MQTTSettings struct {
+	Broker   string                      `mapstructure:"broker"`    // tcp://host:1883, ssl://host:8883 or ws://host/mqtt
+	Version  string                      `mapstructure:"version"`   // 3.1.1 (default) or 5, binary mode needs the user properties of 5
+	Topic    string                      `mapstructure:"topic"`     // with {namespace}, {name} and {reason} placeholders
+	QoS      byte                        `mapstructure:"qos"`       // 0, 1 or 2
+	ClientID string                      `mapstructure:"client_id"` // cloudeventexporter-<hostname> when empty
+	Username string                      `mapstructure:"username"`
+	Password configopaque.String         `mapstructure:"password"`
+	TLS      *configtls.TLSClientSetting `mapstructure:"tls"` // client certificates with cert_file and key_file
+}
+
+// Settings for the amqp transport, the cloud-events are AMQP 1.0 messages as per the AMQP binding
+type AMQPSettings struct {
+	ConnectionString      configopaque.String         `mapstructure:"connection_string"` // of an Event Hubs or Service Bus namespace
+	Address               string                      `mapstructure:"address"`           // amqps://host:5671, overrides the Endpoint of connection_string
+	Target                string                      `mapstructure:"target"`            // event hub, queue or topic, overrides the EntityPath of connection_string
+	Username              string                      `mapstructure:"username"`          // SASL PLAIN, overrides the shared access key of connection_string
+	Password              configopaque.String         `mapstructure:"password"`
+	PartitionKeyAttribute string                      `mapstructure:"partition_key_attribute"` // partition key of the messages, the event's uid when it's empty
+	TLS                   *configtls.TLSClientSetting `mapstructure:"tls"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -40,11 +549,495 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	// Spec version goes in every event and its Ce-Type
+	if len(cfg.Ce.SpecVersion) == 0 {
+		return errors.New("spec_version field can not be empty")
+	}
+	if _, ok := specTypeVersions[cfg.Ce.SpecVersion]; !ok {
+		return fmt.Errorf("spec_version must be %s or %s, provided: %s", SPEC_VERSION_1_0, SPEC_VERSION_0_3, cfg.Ce.SpecVersion)
+	}
+
 	// Check if source is present in the configuration
 	if len(cfg.Ce.Source) == 0 {
 		return errors.New("source field can not be empty")
 	}
 
+	// Fixed extensions can't take the name of the ones with a value of their own
+	computed := cfg.computedExtensions()
+	for name := range cfg.Ce.Extensions {
+		if err := validateExtensionName(name); err != nil {
+			return fmt.Errorf("ce.extensions.%s: %w", name, err)
+		}
+		if option, ok := computed[name]; ok {
+			return fmt.Errorf("ce.extensions.%s is already used by %s", name, option)
+		}
+	}
+
+	// Forwarding every event is taken as a misconfiguration when asked for
+	if cfg.RequireFilter {
+		if filter := strings.TrimSpace(cfg.Filter); filter == "" || filter == "*" {
+			return fmt.Errorf("filter must have the reasons to export with require_filter, provided: '%s'", cfg.Filter)
+		}
+	}
+
+	// Sampling rate can't be negative, 0 disables the sampling
+	if cfg.LogFilteredSamples < 0 {
+		return errors.New("log_filtered_samples can not be negative")
+	}
+
+	for i, f := range cfg.AttributeFilters {
+		if len(f.Attribute) == 0 {
+			return fmt.Errorf("attribute_filters[%d].attribute field can not be empty", i)
+		}
+
+		switch f.Op {
+		case FILTER_OP_EQUALS, FILTER_OP_EXISTS:
+		case FILTER_OP_CONTAINS:
+			if len(f.Value) == 0 {
+				return fmt.Errorf("attribute_filters[%d].value field can not be empty for %s", i, FILTER_OP_CONTAINS)
+			}
+		case FILTER_OP_REGEX:
+			if _, err := regexp.Compile(f.Value); err != nil {
+				return fmt.Errorf("attribute_filters[%d].value isn't a valid regex: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("attribute_filters[%d].op must be %s, %s, %s or %s, provided: %s",
+				i, FILTER_OP_EQUALS, FILTER_OP_CONTAINS, FILTER_OP_REGEX, FILTER_OP_EXISTS, f.Op)
+		}
+
+		switch f.Action {
+		case "", FILTER_ACTION_KEEP, FILTER_ACTION_DROP:
+		default:
+			return fmt.Errorf("attribute_filters[%d].action must be %s or %s, provided: %s",
+				i, FILTER_ACTION_KEEP, FILTER_ACTION_DROP, f.Action)
+		}
+	}
+
+	switch cfg.FilterOrder {
+	case "", FILTER_ORDER_FILTER_THEN_CONVERT, FILTER_ORDER_CONVERT_THEN_FILTER:
+	default:
+		return fmt.Errorf("filter_order must be %s or %s, provided: %s",
+			FILTER_ORDER_FILTER_THEN_CONVERT, FILTER_ORDER_CONVERT_THEN_FILTER, cfg.FilterOrder)
+	}
+
+	switch cfg.Match {
+	case "", MATCH_ALL, MATCH_FIRST:
+	default:
+		return fmt.Errorf("match must be %s or %s, provided: %s", MATCH_ALL, MATCH_FIRST, cfg.Match)
+	}
+
+	switch cfg.IdStrategy {
+	case "", ID_STRATEGY_UID, ID_STRATEGY_UID_SEQ:
+	default:
+		return fmt.Errorf("id_strategy must be %s or %s, provided: %s", ID_STRATEGY_UID, ID_STRATEGY_UID_SEQ, cfg.IdStrategy)
+	}
+
+	switch cfg.MessageSource {
+	case "", MESSAGE_SOURCE_BODY:
+	case MESSAGE_SOURCE_ATTRIBUTE:
+		if len(cfg.MessageAttribute) == 0 {
+			return fmt.Errorf("message_attribute field can not be empty with message_source %s", MESSAGE_SOURCE_ATTRIBUTE)
+		}
+	default:
+		return fmt.Errorf("message_source must be %s or %s, provided: %s",
+			MESSAGE_SOURCE_BODY, MESSAGE_SOURCE_ATTRIBUTE, cfg.MessageSource)
+	}
+
+	switch cfg.MissingMessage {
+	case "", MISSING_MESSAGE_EMPTY, MISSING_MESSAGE_FALLBACK, MISSING_MESSAGE_FAIL:
+	default:
+		return fmt.Errorf("missing_message must be %s, %s or %s, provided: %s",
+			MISSING_MESSAGE_EMPTY, MISSING_MESSAGE_FALLBACK, MISSING_MESSAGE_FAIL, cfg.MissingMessage)
+	}
+
+	switch cfg.EmptyReason {
+	case "", EMPTY_REASON_PLACEHOLDER:
+		if len(strings.TrimSpace(cfg.ReasonPlaceholder)) == 0 {
+			return errors.New("reason_placeholder field can not be empty")
+		}
+	case EMPTY_REASON_FAIL:
+	default:
+		return fmt.Errorf("empty_reason must be %s or %s, provided: %s",
+			EMPTY_REASON_PLACEHOLDER, EMPTY_REASON_FAIL, cfg.EmptyReason)
+	}
+
+	// Only the RFC3339 renderings are valid CloudEvents time
+	switch cfg.TimeFormat {
+	case "", TIME_FORMAT_RFC3339, TIME_FORMAT_RFC3339_NANO:
+	default:
+		return fmt.Errorf("time_format must be %s or %s, provided: %s",
+			TIME_FORMAT_RFC3339, TIME_FORMAT_RFC3339_NANO, cfg.TimeFormat)
+	}
+
+	// Truncated type has to fit `<append_type>.vN.` with at least a character of reason and `-hash`
+	if cfg.MaxTypeLength < 0 {
+		return errors.New("max_type_length can not be negative")
+	} else if minLength := len(cfg.Ce.AppendType) + 4 + TYPE_HASH_LEN + 2; cfg.MaxTypeLength > 0 && cfg.MaxTypeLength < minLength {
+		return fmt.Errorf("max_type_length must be at least %d for append_type %s", minLength, cfg.Ce.AppendType)
+	}
+
+	for reason, ceType := range cfg.TypeOverrides {
+		if len(ceType) == 0 || strings.IndexFunc(ceType, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("type_overrides.%s must be a non empty type without spaces", reason)
+		}
+		if cfg.MaxTypeLength > 0 && len(ceType) > cfg.MaxTypeLength {
+			return fmt.Errorf("type_overrides.%s is longer than max_type_length", reason)
+		}
+	}
+
+	// Only the data fields can be renamed and two fields can't end up with the same key
+	if err := validateFieldNames(cfg.FieldNames); err != nil {
+		return err
+	}
+
+	if cfg.HostnameExtension != "" {
+		if err := validateExtensionName(cfg.HostnameExtension); err != nil {
+			return fmt.Errorf("hostname_extension: %w", err)
+		}
+	}
+
+	for i, ext := range cfg.AttributeExtensions {
+		if err := validateExtensionName(ext.Name); err != nil {
+			return fmt.Errorf("attribute_extensions[%d].name: %w", i, err)
+		}
+		if len(ext.Attribute) == 0 {
+			return fmt.Errorf("attribute_extensions[%d].attribute field can not be empty", i)
+		}
+		switch ext.Type {
+		case "", EXTENSION_TYPE_STRING, EXTENSION_TYPE_INTEGER, EXTENSION_TYPE_BOOLEAN:
+		default:
+			return fmt.Errorf("attribute_extensions[%d].type must be %s, %s or %s, provided: %s",
+				i, EXTENSION_TYPE_STRING, EXTENSION_TYPE_INTEGER, EXTENSION_TYPE_BOOLEAN, ext.Type)
+		}
+	}
+
+	for name, attribute := range cfg.ExtensionsFromAttributes {
+		if err := validateExtensionName(name); err != nil {
+			return fmt.Errorf("extensions_from_attributes.%s: %w", name, err)
+		}
+		if len(attribute) == 0 {
+			return fmt.Errorf("extensions_from_attributes.%s field can not be empty", name)
+		}
+		for _, ext := range cfg.AttributeExtensions {
+			if ext.Name == name {
+				return fmt.Errorf("extensions_from_attributes.%s is already used by attribute_extensions", name)
+			}
+		}
+	}
+
+	for i, ext := range cfg.BrokerExtensions {
+		if err := validateExtensionName(ext.Name); err != nil {
+			return fmt.Errorf("broker_extensions[%d].name: %w", i, err)
+		}
+		if ext.Value < math.MinInt32 || ext.Value > math.MaxInt32 {
+			return fmt.Errorf("broker_extensions[%d].value must be a 32 bit integer, provided: %d", i, ext.Value)
+		}
+		if ext.Decrement && len(ext.Attribute) == 0 {
+			return fmt.Errorf("broker_extensions[%d].attribute field can not be empty with decrement", i)
+		}
+	}
+
+	if cfg.SchemaUrlExtension != "" {
+		if err := validateExtensionName(cfg.SchemaUrlExtension); err != nil {
+			return fmt.Errorf("schema_url_extension: %w", err)
+		}
+	}
+
+	if cfg.SplitEvents.Enabled && len(cfg.SplitEvents.MessageKey) == 0 {
+		return errors.New("split_events.message_key field can not be empty")
+	}
+
+	// Every field of the k8s events needs to come from somewhere
+	for _, mapped := range []struct{ field, attribute string }{
+		{DATA_FIELD_REASON, cfg.Mapping.Reason},
+		{DATA_FIELD_START_TIME, cfg.Mapping.StartTime},
+		{DATA_FIELD_NAME, cfg.Mapping.Name},
+		{DATA_FIELD_NAMESPACE, cfg.Mapping.Namespace},
+		{DATA_FIELD_COUNT, cfg.Mapping.Count},
+		{"uid", cfg.Mapping.UID},
+	} {
+		if len(mapped.attribute) == 0 || mapped.attribute == MAPPING_BODY_PREFIX {
+			return fmt.Errorf("mapping.%s field can not be empty", mapped.field)
+		}
+	}
+
+	for _, attribute := range cfg.IncludeResourceAttributes {
+		if len(attribute) == 0 {
+			return errors.New("include_resource_attributes can not have empty attributes")
+		}
+		if attribute == "*" && len(cfg.IncludeResourceAttributes) > 1 {
+			return errors.New("include_resource_attributes can not have other attributes along with *")
+		}
+	}
+
+	switch cfg.Mode {
+	case MODE_K8S_EVENTS:
+	case MODE_GENERIC:
+		for _, attribute := range cfg.Generic.Attributes {
+			if len(attribute) == 0 {
+				return errors.New("generic.attributes can not have empty attributes")
+			}
+		}
+	default:
+		return fmt.Errorf("mode must be %s or %s, provided: %s", MODE_K8S_EVENTS, MODE_GENERIC, cfg.Mode)
+	}
+
+	switch cfg.Traces.Source {
+	case TRACES_SOURCE_SPAN_EVENTS:
+	case TRACES_SOURCE_SPANS:
+		if len(cfg.Traces.EventNames) > 0 {
+			return fmt.Errorf("traces.event_names is only supported with traces.source %s", TRACES_SOURCE_SPAN_EVENTS)
+		}
+	default:
+		return fmt.Errorf("traces.source must be %s or %s, provided: %s", TRACES_SOURCE_SPAN_EVENTS, TRACES_SOURCE_SPANS, cfg.Traces.Source)
+	}
+	for _, name := range cfg.Traces.EventNames {
+		if len(name) == 0 {
+			return errors.New("traces.event_names can not have empty names")
+		}
+	}
+
+	for i, rule := range cfg.Metrics.Rules {
+		if len(rule.Metric) == 0 {
+			return fmt.Errorf("metrics.rules[%d].metric field can not be empty", i)
+		}
+		switch rule.Op {
+		case THRESHOLD_OP_GT, THRESHOLD_OP_GTE, THRESHOLD_OP_LT, THRESHOLD_OP_LTE:
+		default:
+			return fmt.Errorf("metrics.rules[%d].op must be %s, %s, %s or %s, provided: %s",
+				i, THRESHOLD_OP_GT, THRESHOLD_OP_GTE, THRESHOLD_OP_LT, THRESHOLD_OP_LTE, rule.Op)
+		}
+	}
+
+	if cfg.MaxConcurrentStreams < 0 {
+		return errors.New("max_concurrent_streams can not be negative")
+	}
+
+	if cfg.ResetConnectionsAfter < 0 {
+		return errors.New("reset_connections_after can not be negative")
+	}
+
+	if cfg.MaxQueueBytes < 0 {
+		return errors.New("max_queue_bytes can not be negative")
+	}
+
+	if cfg.RateLimit.EventsPerSecond < 0 {
+		return errors.New("rate_limit.events_per_second can not be negative")
+	}
+	if cfg.RateLimit.Burst < 0 {
+		return errors.New("rate_limit.burst can not be negative")
+	}
+
+	switch cfg.OnFull {
+	case "", ON_FULL_BLOCK, ON_FULL_DROP:
+	default:
+		return fmt.Errorf("on_full must be %s or %s, provided: %s", ON_FULL_BLOCK, ON_FULL_DROP, cfg.OnFull)
+	}
+
+	if cfg.StreamSize < 0 {
+		return errors.New("stream_size can not be negative")
+	}
+
+	if cfg.OmitMissingCount && !cfg.OptionalCount {
+		return errors.New("omit_missing_count needs optional_count, events missing the count fail otherwise")
+	}
+
+	if cfg.StartupDelay < 0 {
+		return errors.New("startup_delay can not be negative")
+	}
+
+	if cfg.UidMinInterval < 0 {
+		return errors.New("uid_min_interval can not be negative")
+	}
+
+	// Batch needs a size and a flush interval, otherwise events could wait forever
+	if cfg.Batch.Enabled {
+		if cfg.Batch.MaxSize <= 0 {
+			return errors.New("batch.max_size must be greater than 0")
+		}
+		if cfg.Batch.FlushInterval <= 0 {
+			return errors.New("batch.flush_interval must be greater than 0")
+		}
+		if cfg.Batch.ChunkedThreshold < 0 {
+			return errors.New("batch.chunked_threshold can not be negative")
+		}
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP && cfg.Transport != TRANSPORT_EVENTBRIDGE && cfg.Transport != TRANSPORT_EVENTGRID {
+			return errors.New("batch is only supported with http, eventbridge and eventgrid transports")
+		}
+		if cfg.Transport == TRANSPORT_EVENTBRIDGE && cfg.Batch.MaxSize > EVENTBRIDGE_MAX_ENTRIES {
+			return fmt.Errorf("batch.max_size can not be more than %d with eventbridge transport, provided: %d",
+				EVENTBRIDGE_MAX_ENTRIES, cfg.Batch.MaxSize)
+		}
+	}
+
+	// Check the transport and its required settings
+	switch cfg.Transport {
+	case "", TRANSPORT_HTTP:
+	case TRANSPORT_EVENTBRIDGE:
+		if len(cfg.EventBridge.Region) == 0 {
+			return errors.New("eventbridge.region field can not be empty")
+		}
+		if len(cfg.EventBridge.AccessKeyID) > 0 && len(cfg.EventBridge.SecretAccessKey) == 0 {
+			return errors.New("eventbridge.secret_access_key field can not be empty when access_key_id is set")
+		}
+		if len(cfg.EventBridge.RoleARN) == 0 && (len(cfg.EventBridge.ExternalID) > 0 || len(cfg.EventBridge.RoleSessionName) > 0) {
+			return errors.New("eventbridge.external_id and role_session_name need role_arn")
+		}
+	case TRANSPORT_EVENTGRID:
+		if len(cfg.EventGrid.Endpoint) == 0 {
+			return errors.New("eventgrid.endpoint field can not be empty")
+		}
+		if _, err := url.Parse(cfg.EventGrid.Endpoint); err != nil {
+			return errors.New("eventgrid.endpoint must be a valid URL")
+		}
+		if len(cfg.Endpoint) > 0 {
+			return errors.New("endpoint can not be set with eventgrid transport, the events go to eventgrid.endpoint")
+		}
+		if len(cfg.EventGrid.SASKey) > 0 && cfg.Auth != nil {
+			return errors.New("eventgrid.sas_key can not be set with auth")
+		}
+	case TRANSPORT_SYSLOG:
+		if len(cfg.Syslog.Endpoint) == 0 {
+			return errors.New("syslog.endpoint field can not be empty")
+		}
+		if _, _, err := net.SplitHostPort(cfg.Syslog.Endpoint); err != nil {
+			return fmt.Errorf("syslog.endpoint must be host:port, provided: %s", cfg.Syslog.Endpoint)
+		}
+		switch cfg.Syslog.Network {
+		case "", SYSLOG_NETWORK_TCP, SYSLOG_NETWORK_UDP:
+		default:
+			return fmt.Errorf("syslog.network must be %s or %s, provided: %s", SYSLOG_NETWORK_TCP, SYSLOG_NETWORK_UDP, cfg.Syslog.Network)
+		}
+		// PRI is facility*8+severity, facilities go from 0 (kern) till 23 (local7)
+		if cfg.Syslog.Facility < 0 || cfg.Syslog.Facility > 23 {
+			return fmt.Errorf("syslog.facility must be between 0 and 23, provided: %d", cfg.Syslog.Facility)
+		}
+		if strings.ContainsAny(cfg.Syslog.AppName, " \t") {
+			return errors.New("syslog.app_name value can't have spaces")
+		}
+	case TRANSPORT_PUBSUB:
+		if len(cfg.PubSub.Project) == 0 {
+			return errors.New("pubsub.project field can not be empty")
+		}
+		if len(cfg.PubSub.Topic) == 0 {
+			return errors.New("pubsub.topic field can not be empty")
+		}
+		if len(cfg.PubSub.OrderingKeyAttribute) > 0 && !cfg.PubSub.OrderingKey {
+			return errors.New("pubsub.ordering_key_attribute needs ordering_key")
+		}
+		if cfg.PubSub.DefaultCredentials && cfg.Auth != nil {
+			return errors.New("pubsub.default_credentials can not be set with auth")
+		}
+	case TRANSPORT_GRPC:
+		if len(cfg.GRPC.Endpoint) == 0 {
+			return errors.New("grpc.endpoint field can not be empty")
+		}
+	case TRANSPORT_KAFKA:
+		if len(cfg.Kafka.Brokers) == 0 {
+			return errors.New("kafka.brokers field can not be empty")
+		}
+		if len(cfg.Kafka.Topic) == 0 {
+			return errors.New("kafka.topic field can not be empty")
+		}
+		if cfg.Kafka.ProtocolVersion != "" {
+			if _, err := sarama.ParseKafkaVersion(cfg.Kafka.ProtocolVersion); err != nil {
+				return fmt.Errorf("kafka.protocol_version must be a valid Kafka version, provided: %s", cfg.Kafka.ProtocolVersion)
+			}
+		}
+		if cfg.Kafka.SASL != nil {
+			switch cfg.Kafka.SASL.Mechanism {
+			case KAFKA_SASL_PLAIN, KAFKA_SASL_SCRAM_SHA_256, KAFKA_SASL_SCRAM_SHA_512:
+			default:
+				return fmt.Errorf("kafka.sasl.mechanism must be %s, %s or %s, provided: %s",
+					KAFKA_SASL_PLAIN, KAFKA_SASL_SCRAM_SHA_256, KAFKA_SASL_SCRAM_SHA_512, cfg.Kafka.SASL.Mechanism)
+			}
+			if len(cfg.Kafka.SASL.Username) == 0 {
+				return errors.New("kafka.sasl.username field can not be empty")
+			}
+		}
+	case TRANSPORT_NATS:
+		if len(cfg.NATS.URL) == 0 {
+			return errors.New("nats.url field can not be empty")
+		}
+		if len(cfg.NATS.Subject) == 0 {
+			return errors.New("nats.subject field can not be empty")
+		}
+		// Messages go to a single subject, wildcards only make sense for subscribers
+		if strings.ContainsAny(cfg.NATS.Subject, "*> \t") {
+			return fmt.Errorf("nats.subject can't have wildcards or spaces, provided: %s", cfg.NATS.Subject)
+		}
+		if cfg.NATS.Username != "" && cfg.NATS.Token != "" {
+			return errors.New("nats.username and nats.token can not be both set")
+		}
+		if cfg.NATS.JetStream.Stream != "" && !cfg.NATS.JetStream.Enabled {
+			return errors.New("nats.jetstream.stream needs nats.jetstream.enabled")
+		}
+		if cfg.NATS.JetStream.MaxAge < 0 {
+			return errors.New("nats.jetstream.max_age can not be negative")
+		}
+	case TRANSPORT_MQTT:
+		if len(cfg.MQTT.Broker) == 0 {
+			return errors.New("mqtt.broker field can not be empty")
+		}
+		if len(cfg.MQTT.Topic) == 0 {
+			return errors.New("mqtt.topic field can not be empty")
+		}
+		// Messages go to a single topic, wildcards only make sense for subscribers
+		if strings.ContainsAny(cfg.MQTT.Topic, "+#") {
+			return fmt.Errorf("mqtt.topic can't have wildcards, provided: %s", cfg.MQTT.Topic)
+		}
+		if cfg.MQTT.QoS > 2 {
+			return fmt.Errorf("mqtt.qos must be 0, 1 or 2, provided: %d", cfg.MQTT.QoS)
+		}
+		if cfg.MQTT.Version != "" && cfg.MQTT.Version != MQTT_VERSION_311 && cfg.MQTT.Version != MQTT_VERSION_5 {
+			return fmt.Errorf("mqtt.version must be %s or %s, provided: %s", MQTT_VERSION_311, MQTT_VERSION_5, cfg.MQTT.Version)
+		}
+		if cfg.MQTT.Version == MQTT_VERSION_5 {
+			if _, err := url.Parse(cfg.MQTT.Broker); err != nil {
+				return errors.New("mqtt.broker must be a valid URL")
+			}
+		}
+	case TRANSPORT_AMQP:
+		target, err := amqpTargetOf(&cfg.AMQP)
+		if err != nil {
+			return fmt.Errorf("amqp.connection_string is invalid: %w", err)
+		}
+		if len(target.address) == 0 {
+			return errors.New("amqp.address field can not be empty without connection_string")
+		}
+		if _, err = url.Parse(target.address); err != nil {
+			return errors.New("amqp.address must be a valid URL")
+		}
+		if len(target.target) == 0 {
+			return errors.New("amqp.target field can not be empty without an EntityPath in connection_string")
+		}
+		// The shared access key goes with SASL PLAIN, auth with AAD tokens put to the $cbs node
+		if len(target.username) > 0 && cfg.Auth != nil {
+			return errors.New("amqp credentials (username or the shared access key of connection_string) can not be set with auth")
+		}
+		if len(cfg.AMQP.ConnectionString) > 0 && len(target.username) == 0 && cfg.Auth == nil {
+			return fmt.Errorf("amqp.connection_string is invalid: %s and %s are missing without auth",
+				AZURE_CONN_SHARED_KEY_NAME, AZURE_CONN_SHARED_ACCESS_KEY)
+		}
+	default:
+		return fmt.Errorf("transport must be %s, %s, %s, %s, %s, %s, %s, %s, %s or %s, provided: %s",
+			TRANSPORT_HTTP, TRANSPORT_EVENTBRIDGE, TRANSPORT_EVENTGRID, TRANSPORT_SYSLOG, TRANSPORT_PUBSUB, TRANSPORT_GRPC,
+			TRANSPORT_KAFKA, TRANSPORT_NATS, TRANSPORT_MQTT, TRANSPORT_AMQP, cfg.Transport)
+	}
+
+	// The endpoint is the broker's address then
+	if cfg.KnativeBroker.Name != "" || cfg.KnativeBroker.Namespace != "" {
+		if len(cfg.KnativeBroker.Name) == 0 || len(cfg.KnativeBroker.Namespace) == 0 {
+			return errors.New("knative_broker.namespace and knative_broker.name fields can not be empty")
+		}
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("knative_broker is only supported with http transport")
+		}
+		if cfg.Endpoint != "" || len(cfg.Endpoints) > 0 {
+			return errors.New("endpoint and endpoints can not be set with knative_broker")
+		}
+	}
+
 	// Check if the endpoint format is right
 	if cfg.Endpoint != "" {
 		_, err := url.Parse(cfg.Endpoint)
@@ -53,5 +1046,239 @@ func (cfg *Config) Validate() error {
 		}
 	}
 
+	if cfg.TruncateTooLarge < 0 {
+		return errors.New("truncate_too_large can not be negative")
+	}
+
+	if cfg.DataRef.Threshold < 0 {
+		return errors.New("dataref.threshold can not be negative")
+	}
+	if cfg.DataRef.Threshold > 0 {
+		if len(cfg.DataRef.Endpoint) == 0 {
+			return errors.New("dataref.endpoint field can not be empty")
+		}
+		if _, err := url.Parse(cfg.DataRef.Endpoint); err != nil {
+			return errors.New("dataref.endpoint must be a valid URL")
+		}
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("dataref is only supported with http transport")
+		}
+		if cfg.Batch.Enabled {
+			return errors.New("dataref is not supported with batch")
+		}
+	}
+
+	if cfg.DeadLetter.Endpoint != "" {
+		if _, err := url.Parse(cfg.DeadLetter.Endpoint); err != nil {
+			return errors.New("dead_letter.endpoint must be a valid URL")
+		}
+	}
+	if cfg.Reply.Endpoint != "" {
+		if _, err := url.Parse(cfg.Reply.Endpoint); err != nil {
+			return errors.New("reply.endpoint must be a valid URL")
+		}
+	}
+
+	if err := validateContentMode(cfg.ContentMode); err != nil {
+		return fmt.Errorf("content_mode %w", err)
+	}
+
+	switch cfg.Format {
+	case "", FORMAT_JSON:
+	case FORMAT_PROTOBUF:
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("format protobuf is only supported with http transport")
+		}
+		if cfg.Batch.Enabled {
+			return errors.New("format protobuf is not supported with batch")
+		}
+		if !cfg.anyStructured() {
+			return errors.New("format protobuf needs structured content_mode, binary mode sends only the data")
+		}
+	default:
+		return fmt.Errorf("format must be %s or %s, provided: %s", FORMAT_JSON, FORMAT_PROTOBUF, cfg.Format)
+	}
+
+	switch cfg.Delivery {
+	case "", DELIVERY_FANOUT, DELIVERY_FAILOVER:
+	default:
+		return fmt.Errorf("delivery must be %s or %s, provided: %s", DELIVERY_FANOUT, DELIVERY_FAILOVER, cfg.Delivery)
+	}
+
+	// Either endpoint or endpoints, it isn't clear where the events should go otherwise
+	if len(cfg.Endpoints) > 0 {
+		if cfg.Endpoint != "" {
+			return errors.New("endpoint and endpoints can not be both set")
+		}
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("endpoints are only supported with http transport")
+		}
+		// Sending to every endpoint and to one of them are too different to pick one silently
+		if len(cfg.Endpoints) > 1 && cfg.Delivery == "" {
+			return fmt.Errorf("delivery field can not be empty with more than one endpoint, set it to %s or %s", DELIVERY_FANOUT, DELIVERY_FAILOVER)
+		}
+	}
+
+	// Batches have a content type of their own whatever the endpoint takes
+	if cfg.NegotiateContentMode {
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("negotiate_content_mode is only supported with http transport")
+		}
+		if cfg.Batch.Enabled {
+			return errors.New("negotiate_content_mode is not supported with batch")
+		}
+	}
+
+	// Every event has its own parameters, so they can't be sent with the others of a batch
+	if len(cfg.QueryAttributes) > 0 {
+		if cfg.Transport != "" && cfg.Transport != TRANSPORT_HTTP {
+			return errors.New("query_attributes are only supported with http transport")
+		}
+		if cfg.Batch.Enabled {
+			return errors.New("query_attributes are not supported with batch")
+		}
+	}
+	for param, attribute := range cfg.QueryAttributes {
+		if len(param) == 0 {
+			return errors.New("query_attributes parameter can not be empty")
+		}
+		if len(attribute) == 0 {
+			return fmt.Errorf("query_attributes.%s field can not be empty", param)
+		}
+	}
+
+	for i, ep := range cfg.Endpoints {
+		if len(ep.Endpoint) == 0 {
+			return fmt.Errorf("endpoints[%d].endpoint field can not be empty", i)
+		}
+		if _, err := url.Parse(ep.Endpoint); err != nil {
+			return fmt.Errorf("endpoints[%d].endpoint must be a valid URL", i)
+		}
+		if err := validateContentMode(ep.ContentMode); err != nil {
+			return fmt.Errorf("endpoints[%d].content_mode %w", i, err)
+		}
+
+		// Both would set the Authorization header and the top level auth would override the endpoint's
+		if ep.Auth != nil && ep.BearerToken != "" {
+			return fmt.Errorf("endpoints[%d].auth and endpoints[%d].bearer_token can not be both set", i, i)
+		}
+		if (ep.Auth != nil || ep.BearerToken != "") && cfg.Auth != nil {
+			return fmt.Errorf("endpoints[%d] credentials can not be combined with the top level auth", i)
+		}
+	}
+
 	return nil
 }
+
+// Extensions the exporter sets a value of its own for, mapped to the option sending them
+func (cfg *Config) computedExtensions() map[string]string {
+	// Span events (spans) of a traces pipeline always carry the trace context
+	computed := map[string]string{
+		EXTENSION_TRACE_PARENT: "traces",
+		EXTENSION_TRACE_STATE:  "traces",
+		EXTENSION_TRACE_ID:     "traces",
+		EXTENSION_SPAN_ID:      "traces",
+	}
+	if cfg.SequenceExtension {
+		computed[EXTENSION_SEQUENCE] = "sequence_extension"
+		computed[EXTENSION_SEQUENCE_TYPE] = "sequence_extension"
+	}
+	if cfg.DataDigest {
+		computed[EXTENSION_DATA_DIGEST] = "data_digest"
+	}
+	if cfg.DataRef.Threshold > 0 {
+		computed[EXTENSION_DATAREF] = "dataref"
+	}
+	if cfg.CorrelationAttribute != "" {
+		computed[EXTENSION_CORRELATION_ID] = "correlation_attribute"
+	}
+	if cfg.PartitioningAttribute != "" {
+		computed[EXTENSION_PARTITION_KEY] = "partitioning_attribute"
+	}
+	if cfg.HostnameExtension != "" {
+		computed[cfg.HostnameExtension] = "hostname_extension"
+	}
+	if cfg.SchemaUrlExtension != "" {
+		computed[cfg.SchemaUrlExtension] = "schema_url_extension"
+	}
+	for _, ext := range cfg.AttributeExtensions {
+		computed[ext.Name] = "attribute_extensions"
+	}
+	for _, ext := range cfg.BrokerExtensions {
+		computed[ext.Name] = "broker_extensions"
+	}
+	for name := range cfg.ExtensionsFromAttributes {
+		computed[name] = "extensions_from_attributes"
+	}
+	return computed
+}
+
+// Attribute the partition key of the events comes from, for the transports with partitions or ordering keys
+func (cfg *Config) partitionKeyAttribute() string {
+	switch cfg.Transport {
+	case TRANSPORT_KAFKA:
+		return cfg.Kafka.PartitionKeyAttribute
+	case TRANSPORT_AMQP:
+		return cfg.AMQP.PartitionKeyAttribute
+	case TRANSPORT_PUBSUB:
+		return cfg.PubSub.OrderingKeyAttribute
+	}
+	return ""
+}
+
+// Whether any of the endpoints gets the events in structured mode
+func (cfg *Config) anyStructured() bool {
+	if len(cfg.Endpoints) == 0 {
+		return cfg.ContentMode == CONTENT_MODE_STRUCTURED
+	}
+	for _, ep := range cfg.Endpoints {
+		if ep.ContentMode == CONTENT_MODE_STRUCTURED || (ep.ContentMode == "" && cfg.ContentMode == CONTENT_MODE_STRUCTURED) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateContentMode(contentMode string) error {
+	switch contentMode {
+	case "", CONTENT_MODE_BINARY, CONTENT_MODE_STRUCTURED:
+		return nil
+	}
+	return fmt.Errorf("must be %s or %s, provided: %s", CONTENT_MODE_BINARY, CONTENT_MODE_STRUCTURED, contentMode)
+}
+
+func validateFieldNames(fieldNames map[string]string) error {
+	for field, key := range fieldNames {
+		if !isDataField(field) {
+			return fmt.Errorf("field_names.%s is not a data field, valid fields are %v", field, dataFields)
+		}
+		if len(key) == 0 {
+			return fmt.Errorf("field_names.%s can not be empty", field)
+		}
+	}
+
+	// Key -> field using it, otel and resource are always taken by include_otel_attributes and include_resource_attributes
+	keys := map[string]string{DATA_FIELD_OTEL: DATA_FIELD_OTEL, DATA_FIELD_RESOURCE: DATA_FIELD_RESOURCE}
+	for _, field := range dataFields {
+		key, ok := fieldNames[field]
+		if !ok {
+			key = field
+		}
+
+		if other, ok := keys[key]; ok {
+			return fmt.Errorf("field_names.%s renames to %s which is already used by %s", field, key, other)
+		}
+		keys[key] = field
+	}
+
+	return nil
+}
+
+func isDataField(field string) bool {
+	for _, f := range dataFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,17 @@
 package cloudeventexporter
 
 import (
+	"context"
 	"log"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/confmap/confmaptest"
+	"go.opentelemetry.io/collector/exporter/exportertest"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -21,7 +24,7 @@ func TestLoadConfig(t *testing.T) {
 			AppendType:  "test_again_again",
 			Source:      "test_again_again_again",
 		},
-		Filter: "*",
+		Filter:             "*",
 		HTTPClientSettings: confighttp.HTTPClientSettings{Endpoint: "http://some_test_url.com:1234"},
 	}
 
@@ -34,3 +37,397 @@ func TestLoadConfig(t *testing.T) {
 
 	assert.Equal(t, unmarsheledConf, cloudEventConfig)
 }
+
+func TestValidateEmptyAppendType(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ce.AppendType = ""
+	assert.EqualError(t, cfg.Validate(), "append_type field can not be empty")
+}
+
+func TestValidateSpecVersion(t *testing.T) {
+	cfg := testConfig()
+	assert.NoError(t, cfg.Validate())
+
+	for version, typeVersion := range map[string]string{SPEC_VERSION_1_0: "v1", SPEC_VERSION_0_3: "v0"} {
+		cfg.Ce.SpecVersion = version
+		assert.NoError(t, cfg.Validate(), version)
+		assert.Equal(t, "com.test.event."+typeVersion+".Created", cfg.ceType("Created"))
+	}
+
+	cfg.Ce.SpecVersion = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg.Ce.SpecVersion = "2.0"
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec_version must be 1.0 or 0.3")
+}
+
+func TestValidateTimeFormat(t *testing.T) {
+	cfg := testConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TimeFormat = TIME_FORMAT_RFC3339_NANO
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TimeFormat = "unix"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateFieldNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		fieldNames map[string]string
+		valid      bool
+	}{
+		{name: "not set", fieldNames: nil, valid: true},
+		{name: "renamed", fieldNames: map[string]string{"namespace": "ns", "start_time": "startTime"}, valid: true},
+		{name: "swapped", fieldNames: map[string]string{"name": "reason", "reason": "name"}, valid: true},
+		{name: "unknown field", fieldNames: map[string]string{"uid": "id"}, valid: false},
+		{name: "empty key", fieldNames: map[string]string{"name": ""}, valid: false},
+		{name: "duplicate key", fieldNames: map[string]string{"name": "reason"}, valid: false},
+		{name: "otel key", fieldNames: map[string]string{"message": "otel"}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FieldNames = tt.fieldNames
+
+			if tt.valid {
+				assert.NoError(t, cfg.Validate())
+			} else {
+				assert.Error(t, cfg.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	cfg := testConfig()
+	cfg.Batch.Enabled = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch.MaxSize = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Batch.Enabled = true
+	cfg.Batch.FlushInterval = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Batch.Enabled = true
+	cfg.Batch.ChunkedThreshold = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateMaxTypeLength(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxTypeLength = 64
+	assert.NoError(t, cfg.Validate())
+
+	// com.test.event.v1. with a reason character and -hash doesn't fit
+	cfg.MaxTypeLength = 20
+	assert.Error(t, cfg.Validate())
+
+	cfg.MaxTypeLength = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateMaxQueueBytes(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxQueueBytes = 1 << 20
+	cfg.OnFull = ON_FULL_DROP
+	assert.NoError(t, cfg.Validate())
+
+	cfg.OnFull = "spill"
+	assert.Error(t, cfg.Validate())
+
+	cfg.OnFull = ON_FULL_BLOCK
+	cfg.MaxQueueBytes = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateRequireFilter(t *testing.T) {
+	cfg := testConfig()
+	cfg.RequireFilter = true
+	assert.Error(t, cfg.Validate())
+
+	cfg.Filter = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg.Filter = "Created|Deleted"
+	assert.NoError(t, cfg.Validate())
+
+	// Without it everything can be forwarded
+	cfg.RequireFilter = false
+	cfg.Filter = "*"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestRequireFilterFailsStartup(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = ""
+	cfg.RequireFilter = true
+
+	_, err := createLogsExporter(context.Background(), exportertest.NewNopCreateSettings(), cfg)
+	assert.Error(t, err)
+
+	cfg.Filter = "Created"
+	_, err = createLogsExporter(context.Background(), exportertest.NewNopCreateSettings(), cfg)
+	assert.NoError(t, err)
+}
+
+func TestValidateSchemaUrlExtension(t *testing.T) {
+	cfg := testConfig()
+	cfg.SchemaUrlExtension = "schemaurl"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SchemaUrlExtension = "schema_url"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateAttributeExtensions(t *testing.T) {
+	cfg := testConfig()
+	cfg.AttributeExtensions = []AttributeExtension{
+		{Name: "priority", Attribute: "priority", Type: EXTENSION_TYPE_INTEGER},
+		{Name: "team", Attribute: "team"},
+	}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AttributeExtensions[0].Type = "double"
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeExtensions[0].Type = EXTENSION_TYPE_BOOLEAN
+	cfg.AttributeExtensions[1].Name = "Team"
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeExtensions[1].Name = "team"
+	cfg.AttributeExtensions[1].Attribute = ""
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateExtensionsFromAttributes(t *testing.T) {
+	cfg := testConfig()
+	cfg.ExtensionsFromAttributes = map[string]string{"cluster": "k8s.cluster.name"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ExtensionsFromAttributes = map[string]string{"Cluster": "k8s.cluster.name"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.ExtensionsFromAttributes = map[string]string{"cluster": ""}
+	assert.Error(t, cfg.Validate())
+
+	cfg.ExtensionsFromAttributes = map[string]string{"team": "team"}
+	cfg.AttributeExtensions = []AttributeExtension{{Name: "team", Attribute: "owner"}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateStaticExtensions(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ce.Extensions = map[string]string{"env": "prod"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Ce.Extensions = map[string]string{"source": "prod"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Ce.Extensions = map[string]string{"collectorhost": "prod"}
+	cfg.HostnameExtension = "collectorhost"
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Ce.Extensions = map[string]string{"team": "platform"}
+	cfg.ExtensionsFromAttributes = map[string]string{"team": "team"}
+	assert.Error(t, cfg.Validate())
+
+	// The trace context is always computed, the other built-in extensions only when they're enabled
+	cfg = testConfig()
+	cfg.Ce.Extensions = map[string]string{EXTENSION_TRACE_PARENT: "00-1-2-01"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Ce.Extensions = map[string]string{EXTENSION_SEQUENCE: "1", EXTENSION_PARTITION_KEY: "a"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.SequenceExtension = true
+	assert.Error(t, cfg.Validate())
+
+	cfg.SequenceExtension = false
+	cfg.PartitioningAttribute = "k8s.namespace.name"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateBrokerExtensions(t *testing.T) {
+	cfg := testConfig()
+	cfg.BrokerExtensions = []BrokerExtension{{Name: "knativebrokerttl", Value: 255, Attribute: "ttl", Decrement: true}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.BrokerExtensions[0].Attribute = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg.BrokerExtensions[0].Decrement = false
+	assert.NoError(t, cfg.Validate())
+
+	cfg.BrokerExtensions[0].Value = 1 << 32
+	assert.Error(t, cfg.Validate())
+
+	cfg.BrokerExtensions[0].Value = 1
+	cfg.BrokerExtensions[0].Name = "ttl-hops"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateSyslog(t *testing.T) {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_SYSLOG
+	assert.Error(t, cfg.Validate())
+
+	cfg.Syslog.Endpoint = "siem.local:514"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Syslog.Network = "tls"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Syslog.Network = SYSLOG_NETWORK_UDP
+	cfg.Syslog.Facility = 24
+	assert.Error(t, cfg.Validate())
+
+	cfg.Syslog.Facility = 23
+	cfg.Syslog.Endpoint = "siem.local"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateStreamSize(t *testing.T) {
+	cfg := testConfig()
+	cfg.SyncSend = true
+	cfg.StreamSize = 100
+	assert.NoError(t, cfg.Validate())
+
+	cfg.StreamSize = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateStartupDelay(t *testing.T) {
+	cfg := testConfig()
+	cfg.StartupDelay = 10 * time.Second
+	assert.NoError(t, cfg.Validate())
+
+	cfg.StartupDelay = -time.Second
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateMessageSource(t *testing.T) {
+	cfg := testConfig()
+	cfg.MessageSource = MESSAGE_SOURCE_ATTRIBUTE
+	assert.Error(t, cfg.Validate())
+
+	cfg.MessageAttribute = "k8s.event.note"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.MessageSource = "resource"
+	assert.Error(t, cfg.Validate())
+
+	cfg.MessageSource = MESSAGE_SOURCE_BODY
+	cfg.MissingMessage = "skip"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateTypeOverrides(t *testing.T) {
+	cfg := testConfig()
+	cfg.TypeOverrides = map[string]string{"OOMKilling": "com.example.oom"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TypeOverrides = map[string]string{"OOMKilling": "com.example oom"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.TypeOverrides = map[string]string{"OOMKilling": ""}
+	assert.Error(t, cfg.Validate())
+
+	cfg.TypeOverrides = map[string]string{"OOMKilling": "com.example.out-of-memory-killing-the-container"}
+	cfg.MaxTypeLength = 40
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateAttributeFilters(t *testing.T) {
+	cfg := testConfig()
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "equals", Value: ""}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "contains"}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "matches", Value: "prod"}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Op: "exists"}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "regex", Value: "^prod-(eu|us)$"}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "regex", Value: "prod("}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "exists", Action: "drop"}}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: "k8s.namespace.name", Op: "exists", Action: "skip"}}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateMatch(t *testing.T) {
+	cfg := testConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.FilterOrder = FILTER_ORDER_CONVERT_THEN_FILTER
+	assert.NoError(t, cfg.Validate())
+
+	cfg.FilterOrder = "parallel"
+	assert.Error(t, cfg.Validate())
+	cfg.FilterOrder = ""
+
+	cfg.Match = MATCH_FIRST
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Match = "any"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateEmptyReason(t *testing.T) {
+	cfg := testConfig()
+	cfg.ReasonPlaceholder = " "
+	assert.Error(t, cfg.Validate())
+
+	cfg.EmptyReason = EMPTY_REASON_FAIL
+	assert.NoError(t, cfg.Validate())
+
+	cfg.EmptyReason = "drop"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateTruncateTooLarge(t *testing.T) {
+	cfg := testConfig()
+	cfg.TruncateTooLarge = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateIncludeResourceAttributes(t *testing.T) {
+	cfg := testConfig()
+	cfg.IncludeResourceAttributes = []string{"*"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.IncludeResourceAttributes = []string{"*", "k8s.cluster.name"}
+	assert.Error(t, cfg.Validate())
+
+	cfg.IncludeResourceAttributes = []string{""}
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.FieldNames = map[string]string{DATA_FIELD_NAMESPACE: DATA_FIELD_RESOURCE}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateResetConnectionsAfter(t *testing.T) {
+	cfg := testConfig()
+	cfg.ResetConnectionsAfter = -1
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,446 @@
+package cloudeventexporter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Returned by toCloudEvent for a record without message with missing_message fail
+var errMissingMessage = errors.New("Couldn't find the message in the log")
+
+// Returned by toCloudEvent for a reason which is empty or only white space with empty_reason fail
+var errEmptyReason = errors.New("Reason of the event is empty")
+
+// Reason sent by default instead of an empty one, Ce-Type would end with the dot otherwise
+const REASON_PLACEHOLDER = "Unknown"
+
+/*
+Converts the log record into a cloud-event, its fields come from the attributes (or body fields) of mapping. The
+reason is looked up in the record, then its scope and then its resource, everything else comes from the record.
+Fails reporting every missing attribute at once.
+It doesn't depend on the exporter's state, so the conversion can be tested and reused on its own.
+*/
+func toCloudEvent(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs, cfg *Config) (*cloudeventdata, error) {
+
+	if cfg.Mode == MODE_GENERIC {
+		return toGenericCloudEvent(lr, sl, rl, cfg)
+	}
+
+	// Useful case for testing but this can be totally removed
+	// Though it can be utilized if expansion is required later
+	if !FETCH_ATTR {
+		return &cloudeventdata{
+			count:     0,
+			message:   lr.Body().AsString(),
+			name:      "name",
+			namespace: "ns",
+			reason:    "TestReason",
+			startTime: "",
+			uid:       "fhapohnea-afj-ajfa",
+		}, nil
+	}
+
+	// Check if the required things are present,
+	// if not fail at the earliest reporting missing things
+	mapping := &cfg.Mapping
+	eventCount, eventCountOk := recordField(mapping.Count, lr)
+	eventName, eventNameOk := recordField(mapping.Name, lr)
+	eventNs, eventNsOk := recordField(mapping.Namespace, lr)
+	eventUid, eventUidOk := recordField(mapping.UID, lr)
+	reason, reasonOk := lookupField(mapping.Reason, lr, sl, rl)
+	startTime, startTimeOk := recordField(mapping.StartTime, lr)
+
+	// Synthetic events may not have any count, they happened once
+	count := 1
+	countMissing := !eventCountOk
+	if eventCountOk {
+		count = int(eventCount.Int())
+	} else if cfg.OptionalCount {
+		eventCountOk = true
+	}
+
+	anyError := !(reasonOk && startTimeOk && eventNameOk && eventUidOk && eventNsOk && eventCountOk)
+
+	if anyError {
+		overAllErrStr := ""
+
+		if !reasonOk {
+			overAllErrStr += "{" + mapping.Reason + "} "
+		}
+
+		if !startTimeOk {
+			overAllErrStr += "{" + mapping.StartTime + "} "
+		}
+
+		if !eventNameOk {
+			overAllErrStr += "{" + mapping.Name + "} "
+		}
+
+		if !eventUidOk {
+			overAllErrStr += "{" + mapping.UID + "} "
+		}
+
+		if !eventNsOk {
+			overAllErrStr += "{" + mapping.Namespace + "} "
+		}
+
+		if !eventCountOk {
+			overAllErrStr += "{" + mapping.Count + "} "
+		}
+
+		return nil, errors.New(fmt.Sprintf("Couldn't find %sattributes in the log", overAllErrStr))
+	}
+
+	// Ce-Type drops the white space of the reason, nothing would be left of this one
+	eventReason := reason.AsString()
+	if strings.TrimSpace(eventReason) == "" {
+		if cfg.EmptyReason == EMPTY_REASON_FAIL {
+			return nil, fmt.Errorf("%w, reason: %q", errEmptyReason, eventReason)
+		}
+		eventReason = cfg.ReasonPlaceholder
+	}
+
+	// An empty message is sent as is, a missing one is handled as per missing_message
+	messageVal, messageOk := messageOf(lr, cfg)
+	message := ""
+	if messageOk {
+		message = messageVal.AsString()
+	} else {
+		switch cfg.MissingMessage {
+		case MISSING_MESSAGE_FAIL:
+			return nil, fmt.Errorf("%w, message_source: %s", errMissingMessage, cfg.MessageSource)
+		case MISSING_MESSAGE_FALLBACK:
+			message = cfg.MessageFallback
+		}
+	}
+
+	// Invalid sequences become the replacement character, before anything else looks at the message
+	if !utf8.ValidString(message) {
+		message = strings.ToValidUTF8(message, string(utf8.RuneError))
+	}
+
+	ce := &cloudeventdata{
+		count:     count,
+		message:   message,
+		name:      eventName.AsString(),
+		namespace: eventNs.AsString(),
+		reason:    eventReason,
+		startTime: startTime.AsString(),
+		uid:       normalizeUid(eventUid),
+
+		messageMissing: !messageOk,
+		countMissing:   countMissing,
+	}
+
+	// message keeps the string form (JSON) for the filters and the rest, only the data gets the object or array
+	if cfg.StructuredMessage && messageOk {
+		switch messageVal.Type() {
+		case pcommon.ValueTypeMap, pcommon.ValueTypeSlice:
+			ce.messageRaw = messageVal.AsRaw()
+		}
+	}
+
+	ce.applyRecordOptions(lr, sl, rl, cfg)
+	return ce, nil
+}
+
+// Options of the configuration applying to the events of every mode, the extensions, keys and message clean up
+func (ce *cloudeventdata) applyRecordOptions(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs, cfg *Config) {
+	// Resources of a multi-tenant batch can come from different clusters
+	if cfg.Ce.SourceAttribute != "" {
+		if source, ok := rl.Resource().Attributes().Get(cfg.Ce.SourceAttribute); ok && source.AsString() != "" {
+			ce.source = source.AsString()
+		}
+	}
+
+	// Semantic conventions version the resource attributes follow, resources without one don't get the extension
+	if cfg.SchemaUrlExtension != "" && rl.SchemaUrl() != "" {
+		ce.setExtension(cfg.SchemaUrlExtension, rl.SchemaUrl())
+	}
+
+	// An event without a deadline (or with one that can't be parsed) is always sent
+	if cfg.DeadlineAttribute != "" {
+		if deadline, ok := lookupAttr(cfg.DeadlineAttribute, lr, sl, rl); ok {
+			ce.deadline = parseDeadline(deadline)
+		}
+	}
+
+	for name, attribute := range cfg.ExtensionsFromAttributes {
+		if val, ok := lookupAttr(attribute, lr, sl, rl); ok {
+			ce.setExtension(name, val.AsString())
+		}
+	}
+
+	// Attributes which are missing or can't be coerced to the extension type are left out
+	for _, ext := range cfg.AttributeExtensions {
+		if val, ok := lookupAttr(ext.Attribute, lr, sl, rl); ok {
+			if coerced, ok := coerceExtension(val, ext.Type); ok {
+				ce.setExtension(ext.Name, coerced)
+			}
+		}
+	}
+
+	for _, ext := range cfg.BrokerExtensions {
+		val := ext.Value
+		if attr, ok := lookupAttr(ext.Attribute, lr, sl, rl); ext.Attribute != "" && ok {
+			if coerced, ok := coerceExtension(attr, EXTENSION_TYPE_INTEGER); ok {
+				val = coerced.(int64)
+				if ext.Decrement {
+					val--
+					ce.ttlExpired = ce.ttlExpired || val <= 0
+				}
+			}
+		}
+		ce.setExtension(ext.Name, val)
+	}
+
+	// Events without the attribute don't get the parameter
+	for param, attribute := range cfg.QueryAttributes {
+		if val, ok := lookupAttr(attribute, lr, sl, rl); ok {
+			if ce.query == nil {
+				ce.query = url.Values{}
+			}
+			ce.query.Set(param, val.AsString())
+		}
+	}
+
+	// Events without the attribute are keyed by their uid
+	if attribute := cfg.partitionKeyAttribute(); attribute != "" {
+		if key, ok := lookupAttr(attribute, lr, sl, rl); ok {
+			ce.partitionKey = key.AsString()
+		}
+	}
+
+	// Events without the attribute (or with an empty one) don't get the extension
+	if cfg.CorrelationAttribute != "" {
+		if correlationId, ok := lookupAttr(cfg.CorrelationAttribute, lr, sl, rl); ok && correlationId.AsString() != "" {
+			ce.setExtension(EXTENSION_CORRELATION_ID, correlationId.AsString())
+		}
+	}
+
+	// Brokers keying their records by partitionkey keep the events of an object in order, events with no (or an
+	// empty) attribute go without it and are spread by the broker like any unkeyed event
+	if cfg.PartitioningAttribute != "" {
+		if partitionKey, ok := lookupAttr(cfg.PartitioningAttribute, lr, sl, rl); ok && partitionKey.AsString() != "" {
+			ce.setExtension(EXTENSION_PARTITION_KEY, partitionKey.AsString())
+		}
+	}
+
+	// Receivers often keep the trailing new line of the event message
+	if cfg.TrimMessage {
+		ce.message = strings.TrimSpace(ce.message)
+	}
+
+	// Log based sinks (syslog, stdout aggregators) take every line as an entry of its own
+	if cfg.SingleLineMessage {
+		ce.message = singleLine(ce.message, cfg.SingleLineSeparator)
+	}
+
+	// Render the time as per time_format, unknown formats are passed as is without Ce-Time. Without time_format
+	// the start_time of the record is kept as it is, only one taken from observed_time_fallback is rendered
+	if eventTime, ok := resolveEventTime(ce.startTime, lr, cfg); ok {
+		ce.time = eventTime
+		if _, parsed := parseEventTime(ce.startTime); cfg.TimeFormat != "" || !parsed {
+			ce.startTime = eventTime.Format(timeLayout(cfg.TimeFormat))
+		}
+	}
+
+	// Copy every attribute with its type intact (ints stay numbers, maps stay objects)
+	if cfg.IncludeOtelAttributes {
+		attrMap := lr.Attributes()
+		ce.attributes = make(map[string]interface{}, attrMap.Len())
+		attrMap.Range(func(k string, v pcommon.Value) bool {
+			ce.attributes[k] = v.AsRaw()
+			return true
+		})
+	}
+
+	ce.resource = cfg.resourceAttributes(rl.Resource().Attributes())
+}
+
+// Resource attributes of include_resource_attributes, nil without any of them so the data goes without resource
+func (cfg *Config) resourceAttributes(resource pcommon.Map) map[string]interface{} {
+	if len(cfg.IncludeResourceAttributes) == 0 {
+		return nil
+	}
+	if cfg.IncludeResourceAttributes[0] == "*" {
+		if resource.Len() == 0 {
+			return nil
+		}
+		return resource.AsRaw()
+	}
+
+	var picked map[string]interface{}
+	for _, attribute := range cfg.IncludeResourceAttributes {
+		if val, ok := resource.Get(attribute); ok {
+			if picked == nil {
+				picked = make(map[string]interface{}, len(cfg.IncludeResourceAttributes))
+			}
+			picked[attribute] = val.AsRaw()
+		}
+	}
+	return picked
+}
+
+/*
+Canonical string of the uid whatever the type receivers used for it. k8s uids are UUIDs, 16 bytes are
+formatted as one (8-4-4-4-12 lower case hex) and other bytes as hex rather than AsString's base64.
+Numbers are in decimal, everything else is AsString's JSON which is stable as the map keys are sorted.
+*/
+func normalizeUid(uid pcommon.Value) string {
+	switch uid.Type() {
+	case pcommon.ValueTypeStr:
+		return uid.Str()
+	case pcommon.ValueTypeBytes:
+		b := uid.Bytes().AsRaw()
+		if len(b) != 16 {
+			return hex.EncodeToString(b)
+		}
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	case pcommon.ValueTypeInt:
+		return strconv.FormatInt(uid.Int(), 10)
+	}
+	return uid.AsString()
+}
+
+// Deadline as unix seconds or a timestamp like k8s.event.start_time, zero when it's neither
+func parseDeadline(val pcommon.Value) time.Time {
+	switch val.Type() {
+	case pcommon.ValueTypeInt:
+		return time.Unix(val.Int(), 0)
+	case pcommon.ValueTypeStr:
+		if deadline, ok := parseEventTime(val.Str()); ok {
+			return deadline
+		}
+	}
+	return time.Time{}
+}
+
+// Truncates the message to maxBytes, without splitting a character. Returns false if there's nothing to truncate,
+// a structured message (or the body of a generic event) can't be truncated without breaking it
+func (ce *cloudeventdata) truncateMessage(maxBytes int) bool {
+	if maxBytes == 0 || len(ce.message) <= maxBytes || ce.messageRaw != nil || ce.generic {
+		return false
+	}
+
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(ce.message[cut]) {
+		cut--
+	}
+	ce.message = ce.message[:cut]
+	return true
+}
+
+// Replaces every line break (\r\n, \n or \r) of the message with the separator
+func singleLine(message string, separator string) string {
+	if !strings.ContainsAny(message, "\r\n") {
+		return message
+	}
+	return strings.NewReplacer("\r\n", separator, "\n", separator, "\r", separator).Replace(message)
+}
+
+// Message of the record as per message_source, ok is false when the record doesn't have any
+// (an empty body or attribute is still a message, just an empty one)
+func messageOf(lr plog.LogRecord, cfg *Config) (pcommon.Value, bool) {
+	if cfg.MessageSource == MESSAGE_SOURCE_ATTRIBUTE {
+		val, ok := lr.Attributes().Get(cfg.MessageAttribute)
+		return val, ok && val.Type() != pcommon.ValueTypeEmpty
+	}
+
+	body := lr.Body()
+	return body, body.Type() != pcommon.ValueTypeEmpty
+}
+
+// Encodes the cloud-event in binary mode, the attributes go in Ce-* headers and the data in body
+func (ce *cloudeventdata) encode(cfg *Config) (headers http.Header, body []byte, err error) {
+	// Data stored out of band isn't sent, the dataref extension points to it
+	if ce.dataRef == "" {
+		if body, err = ce.dataBody(cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	headers = make(http.Header)
+	headers.Add(HEADER_CE_ID, ce.id(cfg))
+	headers.Add(HEADER_CE_TYPE, cfg.ceType(ce.reason))
+	headers.Add(HEADER_CE_SOURCE, ce.sourceOf(cfg))
+	headers.Add(HEADER_CE_SPECVERSION, cfg.specVersion())
+	if body != nil {
+		headers.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+	}
+	if !ce.time.IsZero() {
+		headers.Add(HEADER_CE_TIME, ce.time.Format(timeLayout(cfg.TimeFormat)))
+	}
+	for name, val := range ce.extensions {
+		headers.Add(HEADER_CE_PREFIX+name, fmt.Sprint(val))
+	}
+	if cfg.DataDigest && body != nil {
+		headers.Add(HEADER_CE_PREFIX+EXTENSION_DATA_DIGEST, dataDigest(body))
+	}
+
+	return headers, body, nil
+}
+
+/*
+Encodes the cloud-event in the content mode, structured mode has the attributes and the data in the body
+encoded as per format
+*/
+func (ce *cloudeventdata) encodeFor(contentMode string, cfg *Config) (http.Header, []byte, error) {
+	if contentMode != CONTENT_MODE_STRUCTURED {
+		return ce.encode(cfg)
+	}
+
+	event, err := ce.structured(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers := make(http.Header)
+	if cfg.Format == FORMAT_PROTOBUF {
+		headers.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE_PROTOBUF)
+		return headers, event.protobuf(ce.time), nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headers.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE_STRUCTURED)
+	return headers, body, nil
+}
+
+// Ce-Id of the event as per id_strategy, the uid or the uid with its sequence number (uid-42)
+func (ce *cloudeventdata) id(cfg *Config) string {
+	if cfg.IdStrategy == ID_STRATEGY_UID_SEQ {
+		return ce.uid + "-" + strconv.FormatUint(ce.seq, 10)
+	}
+	return ce.uid
+}
+
+// Key of the event's kafka record, amqp message or pubsub ordering key, the partition key attribute or its uid so the updates of an event keep their order
+func (ce *cloudeventdata) recordKey() string {
+	if ce.partitionKey != "" {
+		return ce.partitionKey
+	}
+	return ce.uid
+}
+
+// Ce-Source of the event, the one resolved from its resource or the configured one
+func (ce *cloudeventdata) sourceOf(cfg *Config) string {
+	if ce.source != "" {
+		return ce.source
+	}
+	return cfg.Ce.Source
+}
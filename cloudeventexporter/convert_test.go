@@ -0,0 +1,489 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Log record of an event which started at the given time, along with its scope and resource
+func testRecord(startTime time.Time) (plog.LogRecord, plog.ScopeLogs, plog.ResourceLogs) {
+	rl := plog.NewResourceLogs()
+	sl := rl.ScopeLogs().AppendEmpty()
+	lr := sl.LogRecords().AppendEmpty()
+	fillEvent(lr, "Created", "pod")
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, pcommon.NewTimestampFromTime(startTime).String())
+	return lr, sl, rl
+}
+
+func TestToCloudEvent(t *testing.T) {
+	startTime := time.Date(2023, 4, 5, 6, 7, 8, 123456789, time.UTC)
+	lr, sl, rl := testRecord(startTime)
+	lr.Attributes().PutInt(ATTR_EVENT_COUNT, 3)
+
+	ce, err := toCloudEvent(lr, sl, rl, testConfig())
+	require.NoError(t, err)
+
+	assert.Equal(t, &cloudeventdata{
+		count:     3,
+		message:   "Test event message",
+		name:      "pod",
+		namespace: "testns",
+		reason:    "Created",
+		startTime: "2023-04-05 06:07:08.123456789 +0000 UTC", // as the record has it without time_format
+		time:      startTime,
+		uid:       "uid-pod",
+	}, ce)
+}
+
+func TestToCloudEventMissingAttributes(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Attributes().Remove(ATTR_EVENT_REASON)
+	lr.Attributes().Remove(ATTR_EVENT_UID)
+
+	_, err := toCloudEvent(lr, sl, rl, testConfig())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "{"+ATTR_EVENT_REASON+"} {"+ATTR_EVENT_UID+"}")
+}
+
+func TestToCloudEventReasonFromResource(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Attributes().Remove(ATTR_EVENT_REASON)
+	rl.Resource().Attributes().PutStr(ATTR_EVENT_REASON, "Scheduled")
+
+	ce, err := toCloudEvent(lr, sl, rl, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "Scheduled", ce.reason)
+}
+
+func TestToCloudEventOtelAttributes(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Attributes().PutInt("restarts", 4)
+
+	cfg := testConfig()
+	cfg.IncludeOtelAttributes = true
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), ce.attributes["restarts"])
+	assert.Equal(t, "pod", ce.attributes[ATTR_EVENT_NAME])
+}
+
+func TestToCloudEventResourceAttributes(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	rl.Resource().Attributes().PutStr("k8s.cluster.name", "prod-eu")
+	rl.Resource().Attributes().PutStr("k8s.node.name", "node-1")
+
+	cfg := testConfig()
+	cfg.IncludeResourceAttributes = []string{"k8s.cluster.name", "missing"}
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	data, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, map[string]interface{}{"k8s.cluster.name": "prod-eu"}, decoded[DATA_FIELD_RESOURCE])
+
+	cfg.IncludeResourceAttributes = []string{"*"}
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"k8s.cluster.name": "prod-eu", "k8s.node.name": "node-1"}, ce.resource)
+
+	// None of them in the resource, the data goes without resource
+	cfg.IncludeResourceAttributes = []string{"missing"}
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	data, err = ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), DATA_FIELD_RESOURCE)
+}
+
+func TestEncode(t *testing.T) {
+	startTime := time.Date(2023, 4, 5, 6, 7, 8, 123456789, time.UTC)
+	lr, sl, rl := testRecord(startTime)
+
+	cfg := testConfig()
+	cfg.TimeFormat = TIME_FORMAT_RFC3339_NANO
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+
+	headers, body, err := ce.encode(cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "uid-pod", headers.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.test.event.v1.Created", headers.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "test-source", headers.Get(HEADER_CE_SOURCE))
+	assert.Equal(t, "1.0", headers.Get(HEADER_CE_SPECVERSION))
+	assert.Equal(t, CONTENT_TYPE, headers.Get(HEADER_CONTENT_TYPE))
+	assert.Equal(t, "2023-04-05T06:07:08.123456789Z", headers.Get(HEADER_CE_TIME))
+	assert.JSONEq(t, `{"reason":"Created","start_time":"2023-04-05T06:07:08.123456789Z","name":"pod",
+		"namespace":"testns","count":1,"message":"Test event message"}`, string(body))
+}
+
+func TestDataRootKey(t *testing.T) {
+	lr, sl, rl := testRecord(time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC))
+
+	cfg := testConfig()
+	cfg.DataRootKey = "event"
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+
+	// Binary mode sends the nested data as the body
+	headers, body, err := ce.encode(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "uid-pod", headers.Get(HEADER_CE_ID))
+	assert.JSONEq(t, `{"event":{"reason":"Created","start_time":"2023-04-05 06:07:08 +0000 UTC","name":"pod",
+		"namespace":"testns","count":1,"message":"Test event message"}}`, string(body))
+
+	// Structured mode has it as data
+	_, body, err = ce.encodeFor(CONTENT_MODE_STRUCTURED, cfg)
+	require.NoError(t, err)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, "Created", event["data"].(map[string]interface{})["event"].(map[string]interface{})[DATA_FIELD_REASON])
+}
+
+func TestCountAsString(t *testing.T) {
+	ce := &cloudeventdata{reason: "Created", uid: "uid-pod", count: 5}
+	cfg := testConfig()
+
+	body, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"count":5,`)
+
+	cfg.CountAsString = true
+	cfg.FieldNames = map[string]string{DATA_FIELD_COUNT: "occurrences"}
+	body, err = ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"occurrences":"5",`)
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &data))
+	assert.Equal(t, "5", data["occurrences"])
+}
+
+func TestToCloudEventInvalidUTF8(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Body().SetStr("Pulling \xff\xfeimage \xc3\x28nginx")
+
+	cfg := testConfig()
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Pulling \uFFFDimage \uFFFD(nginx", ce.message)
+
+	_, body, err := ce.encode(cfg)
+	require.NoError(t, err)
+	assert.True(t, utf8.Valid(body))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &data))
+	assert.Equal(t, "Pulling \uFFFDimage \uFFFD(nginx", data[DATA_FIELD_MESSAGE])
+}
+
+func TestEncodeWithoutTime(t *testing.T) {
+	ce := &cloudeventdata{reason: "Created", uid: "uid-pod", startTime: "yesterday"}
+
+	headers, body, err := ce.encode(testConfig())
+	require.NoError(t, err)
+
+	_, ok := headers[HEADER_CE_TIME]
+	assert.False(t, ok)
+	assert.Contains(t, string(body), `"start_time":"yesterday"`)
+}
+
+func TestToCloudEventTrimMessage(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Body().SetStr("\n\t Back-off pulling image \"nginx:latest\"\n  in pod\r\n")
+
+	ce, err := toCloudEvent(lr, sl, rl, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, "\n\t Back-off pulling image \"nginx:latest\"\n  in pod\r\n", ce.message)
+
+	cfg := testConfig()
+	cfg.TrimMessage = true
+
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Back-off pulling image \"nginx:latest\"\n  in pod", ce.message)
+}
+
+func TestToCloudEventSingleLineMessage(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Body().SetStr("Back-off pulling image\n  in pod\r\nattempt 3\rgiving up\n")
+
+	cfg := testConfig()
+	cfg.SingleLineMessage = true
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Back-off pulling image   in pod attempt 3 giving up ", ce.message)
+
+	// Literal \n keeps where the lines were
+	cfg.SingleLineSeparator = `\n`
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, `Back-off pulling image\n  in pod\nattempt 3\ngiving up\n`, ce.message)
+
+	// The trailing new line is trimmed before collapsing
+	cfg.SingleLineSeparator = " | "
+	cfg.TrimMessage = true
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Back-off pulling image |   in pod | attempt 3 | giving up", ce.message)
+}
+
+func TestToCloudEventEmptyReason(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+	lr.Attributes().PutStr(ATTR_EVENT_REASON, " \t\n")
+
+	// The placeholder stands in for the reason, in the type as well as the data
+	cfg := testConfig()
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, REASON_PLACEHOLDER, ce.reason)
+	assert.Equal(t, "com.test.event.v1.Unknown", cfg.ceType(ce.reason))
+
+	cfg.ReasonPlaceholder = "NoReason"
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "com.test.event.v1.NoReason", cfg.ceType(ce.reason))
+
+	cfg.EmptyReason = EMPTY_REASON_FAIL
+	_, err = toCloudEvent(lr, sl, rl, cfg)
+	assert.ErrorIs(t, err, errEmptyReason)
+
+	// Reasons with something left after dropping the white space aren't affected
+	lr.Attributes().PutStr(ATTR_EVENT_REASON, " Back Off ")
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "com.test.event.v1.BackOff", cfg.ceType(ce.reason))
+}
+
+func TestSpecVersionSameInBothModes(t *testing.T) {
+	lr, sl, rl := testRecord(time.Now())
+
+	for _, specVersion := range []string{"1.0", "0.3"} {
+		cfg := testConfig()
+		cfg.Ce.SpecVersion = specVersion
+
+		ce, err := toCloudEvent(lr, sl, rl, cfg)
+		require.NoError(t, err)
+
+		headers, _, err := ce.encode(cfg)
+		require.NoError(t, err)
+		event, err := ce.structured(cfg)
+		require.NoError(t, err)
+
+		assert.Equal(t, specVersion, headers.Get(HEADER_CE_SPECVERSION))
+		assert.Equal(t, headers.Get(HEADER_CE_SPECVERSION), event.SpecVersion)
+		assert.Equal(t, headers.Get(HEADER_CE_TYPE), event.Type)
+	}
+}
+
+func TestSourceAttribute(t *testing.T) {
+	cfg := testConfig()
+	cfg.Ce.SourceAttribute = "k8s.cluster.name"
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	ld := plog.NewLogs()
+	for _, cluster := range []string{"cluster-eu", "cluster-us", ""} {
+		rl := ld.ResourceLogs().AppendEmpty()
+		if cluster != "" {
+			rl.Resource().Attributes().PutStr("k8s.cluster.name", cluster)
+		}
+		fillEvent(rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty(), "Created", "pod")
+	}
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	require.Len(t, e.ceChan, 3)
+
+	for _, source := range []string{"cluster-eu", "cluster-us", "test-source"} {
+		headers, _, err := (<-e.ceChan).encode(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, source, headers.Get(HEADER_CE_SOURCE))
+	}
+}
+
+func TestToCloudEventMissingMessage(t *testing.T) {
+	// Record with an empty body, or none at all
+	record := func(empty bool) (plog.LogRecord, plog.ScopeLogs, plog.ResourceLogs) {
+		lr, sl, rl := testRecord(time.Now())
+		if empty {
+			lr.Body().SetStr("")
+		} else {
+			pcommon.NewValueEmpty().CopyTo(lr.Body())
+		}
+		return lr, sl, rl
+	}
+
+	tests := []struct {
+		name           string
+		missingMessage string
+		emptyBody      bool
+		message        string
+		missing        bool
+		fails          bool
+	}{
+		{name: "empty body", missingMessage: MISSING_MESSAGE_FALLBACK, emptyBody: true, message: ""},
+		{name: "no body", missingMessage: MISSING_MESSAGE_EMPTY, message: "", missing: true},
+		{name: "no body with fallback", missingMessage: MISSING_MESSAGE_FALLBACK, message: "no message", missing: true},
+		{name: "no body failing", missingMessage: MISSING_MESSAGE_FAIL, fails: true},
+		{name: "empty body not failing", missingMessage: MISSING_MESSAGE_FAIL, emptyBody: true, message: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.MissingMessage = tt.missingMessage
+			cfg.MessageFallback = "no message"
+
+			lr, sl, rl := record(tt.emptyBody)
+			ce, err := toCloudEvent(lr, sl, rl, cfg)
+			if tt.fails {
+				assert.ErrorIs(t, err, errMissingMessage)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.message, ce.message)
+			assert.Equal(t, tt.missing, ce.messageMissing)
+		})
+	}
+}
+
+func TestToCloudEventMessageAttribute(t *testing.T) {
+	cfg := testConfig()
+	cfg.MessageSource = MESSAGE_SOURCE_ATTRIBUTE
+	cfg.MessageAttribute = "k8s.event.note"
+	cfg.MissingMessage = MISSING_MESSAGE_FALLBACK
+	cfg.MessageFallback = "no message"
+
+	lr, sl, rl := testRecord(time.Now())
+	lr.Attributes().PutStr("k8s.event.note", "")
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "", ce.message)
+	assert.False(t, ce.messageMissing)
+
+	lr.Attributes().Remove("k8s.event.note")
+	ce, err = toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "no message", ce.message)
+	assert.True(t, ce.messageMissing)
+}
+
+func TestToCloudEventStructuredMessage(t *testing.T) {
+	cfg := testConfig()
+	cfg.MessageSource = MESSAGE_SOURCE_ATTRIBUTE
+	cfg.MessageAttribute = "k8s.event.note"
+
+	lr, sl, rl := testRecord(time.Now())
+	note := lr.Attributes().PutEmptyMap("k8s.event.note")
+	note.PutStr("container", "app")
+	note.PutInt("exit_code", 137)
+
+	dataOf := func() map[string]interface{} {
+		ce, err := toCloudEvent(lr, sl, rl, cfg)
+		require.NoError(t, err)
+		body, err := ce.dataBody(cfg)
+		require.NoError(t, err)
+		var data map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &data))
+		return data
+	}
+
+	// The string of its JSON by default
+	assert.JSONEq(t, `{"container":"app","exit_code":137}`, dataOf()[DATA_FIELD_MESSAGE].(string))
+
+	cfg.StructuredMessage = true
+	assert.Equal(t, map[string]interface{}{"container": "app", "exit_code": float64(137)}, dataOf()[DATA_FIELD_MESSAGE])
+
+	// The body goes the same way
+	cfg.MessageSource = MESSAGE_SOURCE_BODY
+	lines := lr.Body().SetEmptySlice()
+	lines.AppendEmpty().SetStr("first")
+	lines.AppendEmpty().SetBool(true)
+	assert.Equal(t, []interface{}{"first", true}, dataOf()[DATA_FIELD_MESSAGE])
+
+	// Strings stay strings
+	lr.Body().SetStr("Test event message")
+	assert.Equal(t, "Test event message", dataOf()[DATA_FIELD_MESSAGE])
+}
+
+func TestToCloudEventUidTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		set  func(v pcommon.Value)
+		uid  string
+	}{
+		{
+			name: "string",
+			set:  func(v pcommon.Value) { v.SetStr("0d1e2f30-4a5b-6c7d-8e9f-a0b1c2d3e4f5") },
+			uid:  "0d1e2f30-4a5b-6c7d-8e9f-a0b1c2d3e4f5",
+		},
+		{
+			name: "uuid bytes",
+			set: func(v pcommon.Value) {
+				v.SetEmptyBytes().FromRaw([]byte{0x0d, 0x1e, 0x2f, 0x30, 0x4a, 0x5b, 0x6c, 0x7d,
+					0x8e, 0x9f, 0xa0, 0xb1, 0xc2, 0xd3, 0xe4, 0xf5})
+			},
+			uid: "0d1e2f30-4a5b-6c7d-8e9f-a0b1c2d3e4f5",
+		},
+		{
+			name: "other bytes",
+			set:  func(v pcommon.Value) { v.SetEmptyBytes().FromRaw([]byte{0xca, 0xfe}) },
+			uid:  "cafe",
+		},
+		{
+			name: "int",
+			set:  func(v pcommon.Value) { v.SetInt(1234567890123) },
+			uid:  "1234567890123",
+		},
+		{
+			name: "map",
+			set: func(v pcommon.Value) {
+				m := v.SetEmptyMap()
+				m.PutStr("uid", "abc")
+				m.PutStr("namespace", "testns")
+			},
+			uid: `{"namespace":"testns","uid":"abc"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr, sl, rl := testRecord(time.Now())
+			tt.set(lr.Attributes().PutEmpty(ATTR_EVENT_UID))
+
+			// Converting twice gives the same id
+			for i := 0; i < 2; i++ {
+				ce, err := toCloudEvent(lr, sl, rl, testConfig())
+				require.NoError(t, err)
+				assert.Equal(t, tt.uid, ce.uid)
+			}
+		})
+	}
+}
+
+func TestParseDeadline(t *testing.T) {
+	deadline := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+	assert.True(t, deadline.Equal(parseDeadline(pcommon.NewValueInt(deadline.Unix()))))
+	assert.True(t, deadline.Equal(parseDeadline(pcommon.NewValueStr(deadline.Format(time.RFC3339)))))
+	assert.True(t, parseDeadline(pcommon.NewValueStr("tomorrow")).IsZero())
+	assert.True(t, parseDeadline(pcommon.NewValueBool(true)).IsZero())
+}
@@ -0,0 +1,240 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+const (
+	// Keys of the cloud-event data, they can be renamed with field_names
+	DATA_FIELD_REASON     = "reason"
+	DATA_FIELD_START_TIME = "start_time"
+	DATA_FIELD_NAME       = "name"
+	DATA_FIELD_NAMESPACE  = "namespace"
+	DATA_FIELD_COUNT      = "count"
+	DATA_FIELD_MESSAGE    = "message"
+
+	// Key holding the log record attributes with include_otel_attributes
+	DATA_FIELD_OTEL = "otel"
+
+	// Key holding the resource attributes with include_resource_attributes
+	DATA_FIELD_RESOURCE = "resource"
+
+	// Key holding the datapoint which crossed a threshold of metrics.rules
+	DATA_FIELD_METRIC = "metric"
+
+	// Keys of the data of mode generic when it has attributes
+	DATA_FIELD_BODY       = "body"
+	DATA_FIELD_ATTRIBUTES = "attributes"
+)
+
+// Data fields in the order they get marshalled
+var dataFields = []string{
+	DATA_FIELD_REASON,
+	DATA_FIELD_START_TIME,
+	DATA_FIELD_NAME,
+	DATA_FIELD_NAMESPACE,
+	DATA_FIELD_COUNT,
+	DATA_FIELD_MESSAGE,
+}
+
+// Structured mode cloud-event, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+type structuredCloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"` // left out when it's stored out of band with dataref
+
+	Extensions map[string]interface{} `json:"-"` // marshalled as top level attributes
+}
+
+type cloudeventotel struct {
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+/*
+Marshals the cloud-event data, field_names renames the keys (`namespace` -> `ns`) and the rest keep their name.
+The message gets escaped so quotes or new lines in it don't break the JSON, count_as_string quotes the count. Output looks like
+{"reason":"","start_time":"","name":"","namespace":"","count":0,"message":"","otel":{"attributes":{}},"resource":{}}
+with "metric":{"name":"","value":0,...} after them for the datapoints crossing a threshold,
+nested under data_root_key when it's set, {"event":{"reason":"",...}}
+*/
+func (ce *cloudeventdata) dataBody(cfg *Config) ([]byte, error) {
+	if ce.generic {
+		return ce.genericDataBody(cfg)
+	}
+
+	var count interface{} = ce.count
+	if cfg.CountAsString {
+		count = strconv.Itoa(ce.count)
+	}
+
+	values := map[string]interface{}{
+		DATA_FIELD_REASON:     ce.reason,
+		DATA_FIELD_START_TIME: ce.startTime,
+		DATA_FIELD_NAME:       ce.name,
+		DATA_FIELD_NAMESPACE:  ce.namespace,
+		DATA_FIELD_COUNT:      count,
+		DATA_FIELD_MESSAGE:    ce.message,
+	}
+	if ce.messageRaw != nil {
+		values[DATA_FIELD_MESSAGE] = ce.messageRaw
+	}
+
+	// One-off events which didn't have any count go without it with omit_missing_count
+	omitCount := ce.countMissing && cfg.OmitMissingCount
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	first := true
+	for _, field := range dataFields {
+		if field == DATA_FIELD_COUNT && omitCount {
+			continue
+		}
+
+		key := field
+		if renamed, ok := cfg.FieldNames[field]; ok {
+			key = renamed
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if err := writeJsonField(&buf, key, values[field]); err != nil {
+			return nil, err
+		}
+	}
+
+	if ce.attributes != nil {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, DATA_FIELD_OTEL, &cloudeventotel{Attributes: ce.attributes}); err != nil {
+			return nil, err
+		}
+	}
+
+	if ce.resource != nil {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, DATA_FIELD_RESOURCE, ce.resource); err != nil {
+			return nil, err
+		}
+	}
+
+	if ce.metric != nil {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, DATA_FIELD_METRIC, ce.metric); err != nil {
+			return nil, err
+		}
+	}
+
+	buf.WriteByte('}')
+	return wrapDataRoot(buf.Bytes(), cfg)
+}
+
+/*
+Marshals the data of a generic event, its body as is (a string body is a JSON string, a map an object). With
+attributes (or resource attributes) the body is nested, {"body":...,"attributes":{...},"resource":{...}}. Nested
+under data_root_key as well when it's set.
+*/
+func (ce *cloudeventdata) genericDataBody(cfg *Config) ([]byte, error) {
+	if ce.attributes == nil && ce.resource == nil {
+		data, err := json.Marshal(ce.body)
+		if err != nil {
+			return nil, err
+		}
+		return wrapDataRoot(data, cfg)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if err := writeJsonField(&buf, DATA_FIELD_BODY, ce.body); err != nil {
+		return nil, err
+	}
+	if ce.attributes != nil {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, DATA_FIELD_ATTRIBUTES, ce.attributes); err != nil {
+			return nil, err
+		}
+	}
+	if ce.resource != nil {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, DATA_FIELD_RESOURCE, ce.resource); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return wrapDataRoot(buf.Bytes(), cfg)
+}
+
+// Nests the data under data_root_key when it's set
+func wrapDataRoot(data []byte, cfg *Config) ([]byte, error) {
+	if cfg.DataRootKey == "" {
+		return data, nil
+	}
+
+	var wrapped bytes.Buffer
+	wrapped.WriteByte('{')
+	if err := writeJsonField(&wrapped, cfg.DataRootKey, json.RawMessage(data)); err != nil {
+		return nil, err
+	}
+	wrapped.WriteByte('}')
+	return wrapped.Bytes(), nil
+}
+
+// Writes `"key":value` with value marshalled as JSON
+func writeJsonField(buf *bytes.Buffer, key string, val interface{}) error {
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	valBytes, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	buf.Write(keyBytes)
+	buf.WriteByte(':')
+	buf.Write(valBytes)
+	return nil
+}
+
+// Wraps the cloud-event data with its attributes, the same values binary mode sends in Ce-* headers
+func (ce *cloudeventdata) structured(cfg *Config) (*structuredCloudEvent, error) {
+	var data []byte
+	if ce.dataRef == "" {
+		var err error
+		if data, err = ce.dataBody(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	event := &structuredCloudEvent{
+		SpecVersion:     cfg.specVersion(),
+		ID:              ce.id(cfg),
+		Source:          ce.sourceOf(cfg),
+		Type:            cfg.ceType(ce.reason),
+		DataContentType: CONTENT_TYPE,
+		Data:            data,
+		Extensions:      ce.extensions,
+	}
+	if !ce.time.IsZero() {
+		event.Time = ce.time.Format(timeLayout(cfg.TimeFormat))
+	}
+
+	// Copied as the event's extensions are shared by its retries
+	if cfg.DataDigest && data != nil {
+		event.Extensions = make(map[string]interface{}, len(ce.extensions)+1)
+		for name, val := range ce.extensions {
+			event.Extensions[name] = val
+		}
+		event.Extensions[EXTENSION_DATA_DIGEST] = dataDigest(data)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,61 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Claim check extension, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/extensions/dataref.md
+const EXTENSION_DATAREF = "dataref"
+
+/*
+Stores the data of the event in dataref.endpoint when it's above dataref.threshold, the event is sent with
+the URL of the data in the dataref extension instead of the data. The data is PUT as <endpoint>/<id>.json,
+dataref.url_prefix replaces the endpoint in the URL the consumers get (like one without a write token).
+It's stored once, the retries of the event reuse it. The blob store doesn't get the headers and auth of the sink,
+only dataref.headers.
+*/
+func (e *cloudeventTransformExporter) offloadData(ce *cloudeventdata) error {
+	cfg := &e.config.DataRef
+	if cfg.Threshold == 0 || ce.dataRef != "" {
+		return nil
+	}
+
+	data, err := ce.dataBody(e.config)
+	if err != nil || len(data) <= cfg.Threshold {
+		return err
+	}
+
+	// Path has the id as it is and RawPath the escaped one, so String() escapes it once and a '/' of the id
+	// stays in the key instead of adding a level
+	id := ce.id(e.config)
+	key := url.PathEscape(id) + ".json"
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return err
+	}
+	rawPath := strings.TrimSuffix(endpoint.EscapedPath(), "/") + "/" + key
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/" + id + ".json"
+	endpoint.RawPath = rawPath
+
+	req, err := http.NewRequest(http.MethodPut, endpoint.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+
+	if err = e.doRequest(e.dataRefClient, req); err != nil {
+		return fmt.Errorf("couldn't store the data of the event for dataref: %w", err)
+	}
+
+	ref := endpoint.String()
+	if cfg.URLPrefix != "" {
+		ref = strings.TrimSuffix(cfg.URLPrefix, "/") + "/" + key
+	}
+	ce.dataRef = ref
+	ce.setExtension(EXTENSION_DATAREF, ref)
+	return nil
+}
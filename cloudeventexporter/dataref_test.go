@@ -0,0 +1,191 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Data stored in the fake blob store, by its path
+type blobUpload struct {
+	method  string
+	path    string
+	rawPath string // path as it was sent, escaped
+	body    []byte
+}
+
+func newBlobServer(t *testing.T) (*httptest.Server, chan blobUpload) {
+	uploads := make(chan blobUpload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		uploads <- blobUpload{method: r.Method, path: r.URL.Path, rawPath: r.URL.EscapedPath(), body: body}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+	return server, uploads
+}
+
+func largeEvent(size int) plog.Logs {
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().SetStr(strings.Repeat("x", size))
+	return ld
+}
+
+func TestDataRef(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	blobs, uploads := newBlobServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.DataRef = DataRefSettings{Endpoint: blobs.URL + "/events/", Threshold: 512}
+	cfg.DataDigest = true
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	// Small events stay inline
+	require.NoError(t, e.pushLogs(context.Background(), largeEvent(10)))
+	req := nextRequest(t, requests)
+	assert.Empty(t, req.header.Get("Ce-Dataref"))
+	assert.Equal(t, CONTENT_TYPE, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.NotEmpty(t, req.body)
+	assert.Len(t, uploads, 0)
+
+	// Large ones are stored in the blob store and sent without the data
+	require.NoError(t, e.pushLogs(context.Background(), largeEvent(1000)))
+	upload := <-uploads
+	assert.Equal(t, http.MethodPut, upload.method)
+	assert.Equal(t, "/events/uid-pod.json", upload.path)
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(upload.body, &data))
+	assert.Equal(t, strings.Repeat("x", 1000), data[DATA_FIELD_MESSAGE])
+
+	req = nextRequest(t, requests)
+	assert.Equal(t, blobs.URL+"/events/uid-pod.json", req.header.Get("Ce-Dataref"))
+	assert.Equal(t, "uid-pod", req.header.Get(HEADER_CE_ID))
+	assert.Empty(t, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.Empty(t, req.header.Get(HEADER_CE_PREFIX+EXTENSION_DATA_DIGEST))
+	assert.Empty(t, req.body)
+}
+
+func TestDataRefEscapedId(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	blobs, uploads := newBlobServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.DataRef = DataRefSettings{Endpoint: blobs.URL + "/events/", Threshold: 512}
+	cfg.SyncSend = true
+	e, _ := startTestExporter(t, cfg)
+
+	ld := largeEvent(1000)
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr(ATTR_EVENT_UID, "a b/c")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	// Escaped once, the stored object is the one the dataref points to
+	upload := <-uploads
+	assert.Equal(t, "/events/a b/c.json", upload.path)
+	assert.Equal(t, "/events/a%20b%2Fc.json", upload.rawPath)
+	req := nextRequest(t, requests)
+	assert.Equal(t, blobs.URL+"/events/a%20b%2Fc.json", req.header.Get("Ce-Dataref"))
+
+	// And so is the key after url_prefix
+	cfg.DataRef.URLPrefix = "https://read.example.com/events"
+	ld = largeEvent(1000)
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr(ATTR_EVENT_UID, "d e")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	upload = <-uploads
+	assert.Equal(t, "/events/d%20e.json", upload.rawPath)
+	req = nextRequest(t, requests)
+	assert.Equal(t, "https://read.example.com/events/d%20e.json", req.header.Get("Ce-Dataref"))
+}
+
+func TestDataRefWithoutSinkHeaders(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	blobs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		assert.Equal(t, "blob-key", r.Header.Get("X-Blob-Key"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer blobs.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Headers = map[string]configopaque.String{"Authorization": "Bearer sink-token"}
+	cfg.DataRef = DataRefSettings{Endpoint: blobs.URL, Threshold: 512, Headers: map[string]configopaque.String{"X-Blob-Key": "blob-key"}}
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), largeEvent(1000)))
+
+	// Only the sink gets its credentials
+	req := nextRequest(t, requests)
+	assert.Equal(t, "Bearer sink-token", req.header.Get("Authorization"))
+	assert.Empty(t, req.header.Get("X-Blob-Key"))
+}
+
+func TestDataRefStructured(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	blobs, uploads := newBlobServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	cfg.DataRef = DataRefSettings{Endpoint: blobs.URL, URLPrefix: "https://cdn.example.com/events/", Threshold: 512}
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), largeEvent(1000)))
+	assert.Equal(t, "/uid-pod.json", (<-uploads).path)
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &event))
+	assert.Equal(t, "https://cdn.example.com/events/uid-pod.json", event[EXTENSION_DATAREF])
+	assert.NotContains(t, event, "data")
+	assert.Equal(t, "uid-pod", event["id"])
+}
+
+func TestDataRefStoreFailure(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	blobs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer blobs.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.DataRef = DataRefSettings{Endpoint: blobs.URL, Threshold: 512}
+	cfg.SyncSend = true
+
+	// The event isn't sent without its data
+	e, _ := startTestExporter(t, cfg)
+	err := e.pushLogs(context.Background(), largeEvent(1000))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dataref")
+	assert.Len(t, requests, 0)
+}
+
+func TestValidateDataRef(t *testing.T) {
+	cfg := testConfig()
+	cfg.DataRef.Threshold = -1
+	assert.Error(t, cfg.Validate())
+
+	cfg.DataRef.Threshold = 1024
+	assert.Error(t, cfg.Validate())
+
+	cfg.DataRef.Endpoint = "http://blobs.local/events"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch.Enabled = true
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,92 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Appended to append_type and to the id of the failed event for its dead-letter event
+	DEAD_LETTER_TYPE_SUFFIX = ".deadletter"
+	DEAD_LETTER_ID_SUFFIX   = "-deadletter"
+)
+
+// Data of the dead-letter event, the failed event's id, type and data with the reason it failed
+type deadLetterData struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type"`
+	Error string          `json:"error"`
+	Data  json.RawMessage `json:"data"`
+}
+
+/*
+Returns the throttle if the event should be retried, retry_on_failure.enabled retries the throttled events
+till retry_on_failure.max_elapsed_time passes since their first failure (0 retries them till shutdown).
+*/
+func (e *cloudeventTransformExporter) retryable(ce *cloudeventdata, err error) (*throttledError, bool) {
+	var throttled *throttledError
+	if !e.config.RetrySettings.Enabled || !errors.As(err, &throttled) {
+		return nil, false
+	}
+
+	if ce.firstFailure.IsZero() {
+		ce.firstFailure = time.Now()
+	}
+	maxElapsed := e.config.RetrySettings.MaxElapsedTime
+	if maxElapsed > 0 && time.Since(ce.firstFailure)+throttled.retryAfter > maxElapsed {
+		return nil, false
+	}
+	return throttled, true
+}
+
+/*
+Sends a dead-letter event for the event which is dropped for good to dead_letter.endpoint, so the failure
+can be alerted on. It's a binary mode cloud-event of type <append_type>.deadletter whose data has the id,
+type and data of the failed event with the error. The dead-letter event itself isn't retried.
+*/
+func (e *cloudeventTransformExporter) deadLetter(logger *zap.Logger, ce *cloudeventdata, failure error) {
+	if e.config.DeadLetter.Endpoint == "" {
+		return
+	}
+
+	if err := e.sendDeadLetter(ce, failure); err != nil {
+		logger.Error("Couldn't send the dead-letter event", zap.String("id", ce.uid), zap.Error(err))
+		return
+	}
+	logger.Debug("Dead-letter event sent", zap.String("id", ce.uid))
+}
+
+func (e *cloudeventTransformExporter) sendDeadLetter(ce *cloudeventdata, failure error) error {
+	data, err := ce.dataBody(e.config)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(&deadLetterData{
+		ID:    ce.id(e.config),
+		Type:  e.config.ceType(ce.reason),
+		Error: failure.Error(),
+		Data:  data,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.config.DeadLetter.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add(HEADER_CE_ID, ce.id(e.config)+DEAD_LETTER_ID_SUFFIX)
+	req.Header.Add(HEADER_CE_TYPE, e.config.Ce.AppendType+DEAD_LETTER_TYPE_SUFFIX)
+	req.Header.Add(HEADER_CE_SOURCE, ce.sourceOf(e.config))
+	req.Header.Add(HEADER_CE_SPECVERSION, e.config.specVersion())
+	req.Header.Add(HEADER_CE_TIME, time.Now().UTC().Format(time.RFC3339Nano))
+	req.Header.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+
+	return e.doRequest(e.deadLetterClient, req)
+}
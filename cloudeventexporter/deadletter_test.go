@@ -0,0 +1,107 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configopaque"
+)
+
+func TestDeadLetterOnPermanentFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "schema mismatch", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	deadLetters, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = failing.URL
+	cfg.DeadLetter.Endpoint = deadLetters.URL
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "uid-pod"+DEAD_LETTER_ID_SUFFIX, req.header.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.test.event"+DEAD_LETTER_TYPE_SUFFIX, req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "test-source", req.header.Get(HEADER_CE_SOURCE))
+
+	var data deadLetterData
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "uid-pod", data.ID)
+	assert.Equal(t, "com.test.event.v1.Created", data.Type)
+	assert.Contains(t, data.Error, "HTTP Status Code 400: schema mismatch")
+	assert.Contains(t, string(data.Data), `"reason":"Created"`)
+}
+
+func TestDeadLetterWithoutSinkHeaders(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer sink-token", r.Header.Get("Authorization"))
+		http.Error(w, "schema mismatch", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	deadLetters, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = failing.URL
+	cfg.Headers = map[string]configopaque.String{"Authorization": "Bearer sink-token", "X-Api-Key": "sink-key"}
+	cfg.DeadLetter = DeadLetterSettings{Endpoint: deadLetters.URL, Headers: map[string]configopaque.String{"X-Dlq-Key": "dlq-key"}}
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// The credentials of the sink don't leak to the dead-letter endpoint, it gets its own headers
+	req := nextRequest(t, requests)
+	assert.Equal(t, "uid-pod"+DEAD_LETTER_ID_SUFFIX, req.header.Get(HEADER_CE_ID))
+	assert.Empty(t, req.header.Get("Authorization"))
+	assert.Empty(t, req.header.Get("X-Api-Key"))
+	assert.Equal(t, "dlq-key", req.header.Get("X-Dlq-Key"))
+}
+
+func TestDeadLetterAfterRetriesExhausted(t *testing.T) {
+	throttling := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_RETRY_AFTER, "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer throttling.Close()
+	deadLetters, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = throttling.URL
+	cfg.DeadLetter.Endpoint = deadLetters.URL
+	cfg.RetrySettings.Enabled = true
+	cfg.RetrySettings.MaxElapsedTime = 200 * time.Millisecond
+
+	e, _ := startTestExporter(t, cfg)
+	pushed := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// Retried till max_elapsed_time, only then it's dropped for good
+	req := nextRequest(t, requests)
+	assert.GreaterOrEqual(t, time.Since(pushed), cfg.RetrySettings.MaxElapsedTime)
+	var data deadLetterData
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Contains(t, data.Error, "HTTP Status Code 429")
+}
+
+func TestNoDeadLetterOnSuccess(t *testing.T) {
+	server, _ := newCaptureServer(t)
+	deadLetters, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.DeadLetter.Endpoint = deadLetters.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Len(t, requests, 0)
+}
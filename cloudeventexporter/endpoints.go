@@ -0,0 +1,317 @@
+package cloudeventexporter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+const (
+	// How the cloud-events are encoded for an endpoint, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md#3-http-message-mapping
+	CONTENT_MODE_BINARY     = "binary"
+	CONTENT_MODE_STRUCTURED = "structured"
+
+	// How the cloud-events are sent when several endpoints are configured
+	DELIVERY_FANOUT   = "fanout"
+	DELIVERY_FAILOVER = "failover"
+
+	// Content types the endpoint takes in POST requests, asked with negotiate_content_mode
+	HEADER_ACCEPT_POST = "Accept-Post"
+)
+
+// Endpoint the http transport sends the cloud-events to, resolved from endpoint or endpoints
+type endpointTarget struct {
+	url         string
+	contentMode string
+	backoff     *endpointBackoff // Shared by the workers, every endpoint backs off on its own
+
+	settings *EndpointSettings             // Where the credentials come from, nil for endpoint
+	headers  map[string]string             // Headers of the endpoint, bearer_token as Authorization
+	clients  map[*http.Client]*http.Client // Clients with the auth extension of the endpoint in place of the exporter's ones
+}
+
+// Backoff of an endpoint which throttled, it isn't sent anything till the wait it asked for passes
+type endpointBackoff struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// How long the endpoint is still backing off, 0 if it isn't
+func (b *endpointBackoff) remaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Until(b.until)
+}
+
+func (b *endpointBackoff) pause(wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(b.until) {
+		b.until = until
+	}
+}
+
+// The configured endpoints, endpoint on its own when endpoints isn't set and the topic with the eventgrid transport
+func newEndpointTargets(cfg *Config) []endpointTarget {
+	if cfg.Transport == TRANSPORT_EVENTGRID {
+		return []endpointTarget{eventGridTarget(&cfg.EventGrid)}
+	}
+	if len(cfg.Endpoints) == 0 {
+		return []endpointTarget{{url: cfg.Endpoint, contentMode: contentModeOf(cfg.ContentMode), backoff: &endpointBackoff{}}}
+	}
+
+	targets := make([]endpointTarget, 0, len(cfg.Endpoints))
+	for i, ep := range cfg.Endpoints {
+		contentMode := cfg.ContentMode
+		if ep.ContentMode != "" {
+			contentMode = ep.ContentMode
+		}
+		targets = append(targets, endpointTarget{
+			url:         ep.Endpoint,
+			contentMode: contentModeOf(contentMode),
+			backoff:     &endpointBackoff{},
+			settings:    &cfg.Endpoints[i],
+			headers:     endpointHeaders(&cfg.Endpoints[i]),
+		})
+	}
+	return targets
+}
+
+func endpointHeaders(ep *EndpointSettings) map[string]string {
+	if len(ep.Headers) == 0 && ep.BearerToken == "" {
+		return nil
+	}
+
+	headers := make(map[string]string, len(ep.Headers)+1)
+	for key, val := range ep.Headers {
+		headers[key] = string(val)
+	}
+	if ep.BearerToken != "" {
+		headers[HEADER_AUTHORIZATION] = "Bearer " + string(ep.BearerToken)
+	}
+	return headers
+}
+
+/*
+Wraps the clients with the auth extension of every endpoint which has one, so the extension (like oauth2client)
+keeps its tokens across the requests. Called by start once the clients are created, they don't change after.
+*/
+func (e *cloudeventTransformExporter) authenticateEndpoints(host component.Host, clients []*http.Client) error {
+	for i := range e.endpoints {
+		target := &e.endpoints[i]
+		if target.settings == nil || target.settings.Auth == nil {
+			continue
+		}
+
+		authenticator, err := target.settings.Auth.GetClientAuthenticator(host.GetExtensions())
+		if err != nil {
+			return fmt.Errorf("endpoints[%d].auth: %w", i, err)
+		}
+
+		target.clients = make(map[*http.Client]*http.Client, len(clients))
+		for _, client := range clients {
+			transport, err := authenticator.RoundTripper(client.Transport)
+			if err != nil {
+				return fmt.Errorf("endpoints[%d].auth: %w", i, err)
+			}
+			authenticated := *client
+			authenticated.Transport = transport
+			target.clients[client] = &authenticated
+		}
+	}
+	return nil
+}
+
+/*
+Asks every endpoint without a content_mode of its own for the content types it takes with an OPTIONS request, from
+its Accept-Post header. An endpoint taking only structured cloud-events gets them in structured mode and one taking
+only their data in binary mode. Anything else (no such header, both or neither of them, a failed request) keeps the
+configured content mode. Called by start once the clients are created.
+*/
+func (e *cloudeventTransformExporter) negotiateContentModes() {
+	for i := range e.endpoints {
+		target := &e.endpoints[i]
+		if target.settings != nil && target.settings.ContentMode != "" {
+			continue
+		}
+
+		contentMode, err := e.negotiateContentMode(target)
+		if err != nil {
+			e.logger.Warn("Couldn't negotiate the content mode of the endpoint, the configured one is used",
+				zap.String("endpoint", target.url), zap.String("content_mode", target.contentMode), zap.Error(err))
+			continue
+		}
+		if contentMode != "" {
+			target.contentMode = contentMode
+		}
+		e.logger.Info("Content mode of the endpoint negotiated",
+			zap.String("endpoint", target.url), zap.String("content_mode", target.contentMode))
+	}
+}
+
+func (e *cloudeventTransformExporter) negotiateContentMode(target *endpointTarget) (string, error) {
+	req, err := http.NewRequest(http.MethodOptions, target.url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := target.authorize(e.client, req).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("OPTIONS request to %s responded with HTTP Status Code %d", target.url, res.StatusCode)
+	}
+
+	structuredType := CONTENT_TYPE_STRUCTURED
+	if e.config.Format == FORMAT_PROTOBUF {
+		structuredType = CONTENT_TYPE_PROTOBUF
+	}
+	return acceptedContentMode(res.Header.Values(HEADER_ACCEPT_POST), structuredType), nil
+}
+
+// Content mode of the media types in Accept-Post, empty unless only one of the content modes is there
+func acceptedContentMode(acceptPost []string, structuredType string) string {
+	var binary, structured bool
+	for _, val := range acceptPost {
+		for _, mediaType := range strings.Split(val, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaType))
+			if err != nil {
+				continue
+			}
+			switch mediaType {
+			case structuredType:
+				structured = true
+			case CONTENT_TYPE:
+				binary = true
+			}
+		}
+	}
+
+	switch {
+	case structured && !binary:
+		return CONTENT_MODE_STRUCTURED
+	case binary && !structured:
+		return CONTENT_MODE_BINARY
+	}
+	return ""
+}
+
+// Adds the endpoint's headers to the request and returns the client to send it with
+func (target *endpointTarget) authorize(client *http.Client, req *http.Request) *http.Client {
+	for key, val := range target.headers {
+		req.Header.Set(key, val)
+	}
+	if authenticated, ok := target.clients[client]; ok {
+		return authenticated
+	}
+	return client
+}
+
+// Appends the query parameters to the endpoint's own ones (like an auth token), a parameter it already has is kept
+func withQuery(endpoint string, query url.Values) (string, error) {
+	if len(query) == 0 {
+		return endpoint, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	values := u.Query()
+	for param, vals := range query {
+		for _, val := range vals {
+			values.Add(param, val)
+		}
+	}
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+func contentModeOf(contentMode string) string {
+	if contentMode == "" {
+		return CONTENT_MODE_BINARY
+	}
+	return contentMode
+}
+
+/*
+Sends the events to the endpoints as per delivery. fanout sends to every one of them and fails if any
+of them failed, failover tries them in order till one of them succeeds and fails with the last error.
+
+Every endpoint keeps its own backoff, a throttled endpoint isn't sent anything till the wait it asked for passes,
+so it doesn't hold back the healthy ones. failover moves on to the next endpoint then, fanout sends to the others
+and fails with a throttledError so the events are retried. The endpoints which got the events are remembered in
+them and skipped on the retry.
+*/
+func (e *cloudeventTransformExporter) deliver(events []*cloudeventdata, send func(target endpointTarget) error) error {
+	if e.config.Delivery == DELIVERY_FAILOVER {
+		var err error
+		for i, target := range e.endpoints {
+			if err = e.sendTo(events, i, target, send); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+
+	var errs error
+	for i, target := range e.endpoints {
+		if !delivered(events, i) {
+			errs = multierr.Append(errs, e.sendTo(events, i, target, send))
+		}
+	}
+	return errs
+}
+
+// Sends to the endpoint unless it's backing off, a throttled endpoint backs off for the wait it asked for
+func (e *cloudeventTransformExporter) sendTo(events []*cloudeventdata, index int, target endpointTarget, send func(target endpointTarget) error) error {
+	if wait := target.backoff.remaining(); wait > 0 {
+		return &throttledError{err: fmt.Errorf("endpoint %s is backing off", target.url), retryAfter: wait}
+	}
+
+	err := send(target)
+	var throttled *throttledError
+	if errors.As(err, &throttled) {
+		target.backoff.pause(throttled.retryAfter)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only worth remembering with several endpoints, a single one is never skipped
+	if len(e.endpoints) > 1 {
+		for _, ce := range events {
+			if ce.deliveredTo == nil {
+				ce.deliveredTo = make([]bool, len(e.endpoints))
+			}
+			ce.deliveredTo[index] = true
+		}
+	}
+	return nil
+}
+
+// Whether every one of the events already got to the endpoint
+func delivered(events []*cloudeventdata, index int) bool {
+	for _, ce := range events {
+		if index >= len(ce.deliveredTo) || !ce.deliveredTo[index] {
+			return false
+		}
+	}
+	return len(events) > 0
+}
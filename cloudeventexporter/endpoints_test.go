@@ -0,0 +1,415 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configauth"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/extension/auth"
+)
+
+func TestEndpointsContentModes(t *testing.T) {
+	binaryServer, binaryRequests := newCaptureServer(t)
+	structuredServer, structuredRequests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{
+		{Endpoint: binaryServer.URL},
+		{Endpoint: structuredServer.URL, ContentMode: CONTENT_MODE_STRUCTURED},
+	}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// Binary mode has the attributes in Ce-* headers and only the data in the body
+	req := nextRequest(t, binaryRequests)
+	assert.Equal(t, CONTENT_TYPE, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.Equal(t, "uid-pod", req.header.Get(HEADER_CE_ID))
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+
+	// Structured mode has all of them in the body
+	req = nextRequest(t, structuredRequests)
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.Empty(t, req.header.Get(HEADER_CE_ID))
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "com.test.event.v1.Created", event["type"])
+	assert.Equal(t, "Created", event["data"].(map[string]interface{})[DATA_FIELD_REASON])
+}
+
+func TestStructuredContentMode(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, req.header.Get(HEADER_CONTENT_TYPE))
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+}
+
+func TestEndpointsFailover(t *testing.T) {
+	var failed atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy, requests := newCaptureServer(t)
+	standby, standbyRequests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: failing.URL}, {Endpoint: healthy.URL}, {Endpoint: standby.URL}}
+	cfg.Delivery = DELIVERY_FAILOVER
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	assert.Equal(t, int32(1), failed.Load())
+	assert.Len(t, requests, 1)
+	assert.Len(t, standbyRequests, 0)
+}
+
+func TestEndpointsFanoutFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: failing.URL}, {Endpoint: healthy.URL}}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), failing.URL)
+	assert.Len(t, requests, 1)
+}
+
+// Server throttling every request for a minute, counting them
+func newThrottlingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var throttled atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		throttled.Add(1)
+		w.Header().Set(HEADER_RETRY_AFTER, "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+	return server, &throttled
+}
+
+func TestEndpointsFanoutIndependentBackoff(t *testing.T) {
+	throttling, throttled := newThrottlingServer(t)
+	healthy, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: throttling.URL}, {Endpoint: healthy.URL}}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.RetrySettings.Enabled = true
+
+	e, _ := startTestExporter(t, cfg)
+	start := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Equal(t, "uid-pod", nextRequest(t, requests).header.Get(HEADER_CE_ID))
+
+	// The throttling endpoint backs off for a minute, the healthy one keeps getting the events meanwhile
+	ld := testEvents(1, "Created")
+	fillEvent(ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty(), "Created", "second")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	ids := []string{nextRequest(t, requests).header.Get(HEADER_CE_ID), nextRequest(t, requests).header.Get(HEADER_CE_ID)}
+	assert.ElementsMatch(t, []string{"uid-pod", "uid-second"}, ids)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Neither is the throttling endpoint sent anything while it backs off, nor are the retries sent to the healthy one
+	select {
+	case req := <-requests:
+		t.Fatalf("event %s shouldn't be sent again", req.header.Get(HEADER_CE_ID))
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.Equal(t, int32(1), throttled.Load())
+}
+
+func TestEndpointsFailoverSkipsBackingOff(t *testing.T) {
+	throttling, throttled := newThrottlingServer(t)
+	healthy, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: throttling.URL}, {Endpoint: healthy.URL}}
+	cfg.Delivery = DELIVERY_FAILOVER
+	cfg.RetrySettings.Enabled = true
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+		nextRequest(t, requests)
+	}
+	assert.Equal(t, int32(1), throttled.Load())
+}
+
+func TestQueryAttributes(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL + "/ingest?token=s3cret&tag=k8s"
+	cfg.QueryAttributes = map[string]string{"routing_key": "k8s.namespace.name", "tag": "team"}
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	attrs := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes()
+	attrs.PutStr("k8s.namespace.name", "payments")
+	attrs.PutStr("team", "a&b")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	// Parameters of the endpoint are kept, even the ones with the same name
+	req := nextRequest(t, requests)
+	assert.Equal(t, "s3cret", req.query.Get("token"))
+	assert.Equal(t, "payments", req.query.Get("routing_key"))
+	assert.Equal(t, []string{"k8s", "a&b"}, req.query["tag"])
+
+	// Events without the attribute don't get the parameter
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	req = nextRequest(t, requests)
+	assert.Equal(t, url.Values{"token": {"s3cret"}, "tag": {"k8s"}, "routing_key": {"testns"}}, req.query)
+}
+
+func TestValidateQueryAttributes(t *testing.T) {
+	cfg := testConfig()
+	cfg.QueryAttributes = map[string]string{"routing_key": ""}
+	assert.Error(t, cfg.Validate())
+
+	cfg.QueryAttributes = map[string]string{"routing_key": "k8s.namespace.name"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch.Enabled = true
+	assert.Error(t, cfg.Validate())
+
+	cfg.Batch.Enabled = false
+	cfg.Transport = TRANSPORT_SYSLOG
+	cfg.Syslog.Endpoint = "localhost:514"
+	assert.Error(t, cfg.Validate())
+}
+
+// Capture server answering OPTIONS requests with the Accept-Post, or 405 Method Not Allowed when it's empty
+func newNegotiatingServer(t *testing.T, acceptPost string) (*httptest.Server, chan capturedRequest) {
+	capture, requests := newCaptureServer(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			capture.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		if acceptPost == "" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set(HEADER_ACCEPT_POST, acceptPost)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestNegotiateContentMode(t *testing.T) {
+	structuredServer, structuredRequests := newNegotiatingServer(t, "application/cloudevents+json; charset=utf-8")
+	unknownServer, unknownRequests := newNegotiatingServer(t, "")
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: structuredServer.URL}, {Endpoint: unknownServer.URL}}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.NegotiateContentMode = true
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, structuredRequests)
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, req.header.Get(HEADER_CONTENT_TYPE))
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+
+	// The endpoint which can't tell falls back to content_mode
+	req = nextRequest(t, unknownRequests)
+	assert.Equal(t, CONTENT_TYPE, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.Equal(t, "uid-pod", req.header.Get(HEADER_CE_ID))
+	assert.Equal(t, 1, logs.FilterMessage("Couldn't negotiate the content mode of the endpoint, the configured one is used").Len())
+}
+
+func TestAcceptedContentMode(t *testing.T) {
+	tests := []struct {
+		acceptPost []string
+		expected   string
+	}{
+		{acceptPost: []string{"application/cloudevents+json"}, expected: CONTENT_MODE_STRUCTURED},
+		{acceptPost: []string{"text/plain, application/json"}, expected: CONTENT_MODE_BINARY},
+		{acceptPost: []string{"application/json", "application/cloudevents+json"}, expected: ""},
+		{acceptPost: []string{"text/plain"}, expected: ""},
+		{acceptPost: []string{"not a media type"}, expected: ""},
+		{acceptPost: nil, expected: ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, acceptedContentMode(tt.acceptPost, CONTENT_TYPE_STRUCTURED), tt.acceptPost)
+	}
+	assert.Equal(t, CONTENT_MODE_STRUCTURED, acceptedContentMode([]string{CONTENT_TYPE_PROTOBUF}, CONTENT_TYPE_PROTOBUF))
+}
+
+// Host with the given extensions, for the auth extensions of the endpoints
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h *extensionsHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// Client auth extension setting the Authorization header
+type authRoundTripper struct {
+	base          http.RoundTripper
+	authorization string
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(HEADER_AUTHORIZATION, rt.authorization)
+	return rt.base.RoundTrip(req)
+}
+
+func TestEndpointsAuth(t *testing.T) {
+	tokenServer, tokenRequests := newCaptureServer(t)
+	extensionServer, extensionRequests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{
+		{Endpoint: tokenServer.URL, BearerToken: "token-a", Headers: map[string]configopaque.String{"X-Tenant": "a"}},
+		{Endpoint: extensionServer.URL, Auth: &configauth.Authentication{AuthenticatorID: component.NewID("basicauth")}},
+	}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	host := &extensionsHost{Host: componenttest.NewNopHost(), extensions: map[component.ID]component.Component{
+		component.NewID("basicauth"): auth.NewClient(auth.WithClientRoundTripper(func(base http.RoundTripper) (http.RoundTripper, error) {
+			return &authRoundTripper{base: base, authorization: "Basic Yjpi"}, nil
+		})),
+	}}
+
+	e, _ := newTestExporter(t, cfg)
+	require.NoError(t, e.start(context.Background(), host))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, tokenRequests)
+	assert.Equal(t, "Bearer token-a", req.header.Get(HEADER_AUTHORIZATION))
+	assert.Equal(t, "a", req.header.Get("X-Tenant"))
+
+	req = nextRequest(t, extensionRequests)
+	assert.Equal(t, "Basic Yjpi", req.header.Get(HEADER_AUTHORIZATION))
+	assert.Empty(t, req.header.Get("X-Tenant"))
+}
+
+func TestEndpointsAuthMissingExtension(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: "http://a.local", Auth: &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}}}
+
+	e, _ := newTestExporter(t, cfg)
+	assert.Error(t, e.start(context.Background(), componenttest.NewNopHost()))
+	require.NoError(t, e.shutdown(context.Background()))
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: "http://a.local"}, {Endpoint: "http://b.local", ContentMode: CONTENT_MODE_STRUCTURED}}
+	cfg.Delivery = DELIVERY_FAILOVER
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Endpoints[1].ContentMode = "batched"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Endpoints[1] = EndpointSettings{}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Endpoints[1] = EndpointSettings{Endpoint: "http://b.local"}
+	cfg.Endpoint = "http://c.local"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Endpoint = ""
+	cfg.Delivery = "roundrobin"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.Endpoints[1].BearerToken = "token"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Endpoints[1].Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Endpoints[1].BearerToken = ""
+	cfg.Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.ContentMode = "batched"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateNegotiateContentMode(t *testing.T) {
+	cfg := testConfig()
+	cfg.NegotiateContentMode = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateDeliveryRequired(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoints = []EndpointSettings{{Endpoint: "http://a.local"}, {Endpoint: "http://b.local"}}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Delivery = DELIVERY_FANOUT
+	assert.NoError(t, cfg.Validate())
+
+	// A single endpoint goes to that one endpoint whatever delivery is
+	cfg.Delivery = ""
+	cfg.Endpoints = cfg.Endpoints[:1]
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Endpoints = nil
+	cfg.Endpoint = "http://a.local"
+	assert.NoError(t, cfg.Validate())
+}
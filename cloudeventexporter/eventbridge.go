@@ -0,0 +1,247 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// AWS EventBridge PutEvents API, see https://docs.aws.amazon.com/eventbridge/latest/APIReference/API_PutEvents.html
+	EVENTBRIDGE_SERVICE      = "events"
+	EVENTBRIDGE_TARGET       = "AWSEvents.PutEvents"
+	EVENTBRIDGE_CONTENT_TYPE = "application/x-amz-json-1.1"
+	HEADER_AMZ_TARGET        = "X-Amz-Target"
+	EVENTBRIDGE_MAX_ENTRIES  = 10 // entries PutEvents takes in a request
+
+	// Bytes of a PutEvents response read at most, the results of MAX_ENTRIES entries with their error messages
+	EVENTBRIDGE_MAX_RESPONSE = EVENTBRIDGE_MAX_ENTRIES * MAX_ERROR_BODY
+
+	// Error codes of the rejected entries which are worth another try
+	EVENTBRIDGE_ERR_THROTTLING = "ThrottlingException"
+	EVENTBRIDGE_ERR_INTERNAL   = "InternalFailure"
+
+	// Environment variables used for credentials when they aren't present in the configuration
+	ENV_AWS_ACCESS_KEY_ID     = "AWS_ACCESS_KEY_ID"
+	ENV_AWS_SECRET_ACCESS_KEY = "AWS_SECRET_ACCESS_KEY"
+	ENV_AWS_SESSION_TOKEN     = "AWS_SESSION_TOKEN"
+)
+
+type putEventsEntry struct {
+	Source       string `json:"Source"`
+	DetailType   string `json:"DetailType"`
+	Detail       string `json:"Detail"`
+	EventBusName string `json:"EventBusName,omitempty"`
+	Time         int64  `json:"Time,omitempty"`
+}
+
+type putEventsRequest struct {
+	Entries []putEventsEntry `json:"Entries"`
+}
+
+// Result of an entry, in the order of the request's entries
+type putEventsResultEntry struct {
+	EventId      string `json:"EventId"`
+	ErrorCode    string `json:"ErrorCode"`
+	ErrorMessage string `json:"ErrorMessage"`
+}
+
+type putEventsResponse struct {
+	FailedEntryCount int                    `json:"FailedEntryCount"`
+	Entries          []putEventsResultEntry `json:"Entries"`
+}
+
+// Credentials from the configuration, falls back to the standard AWS environment variables
+func eventBridgeCredentials(cfg *EventBridgeSettings) awsCredentials {
+	if cfg.AccessKeyID != "" {
+		return awsCredentials{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: string(cfg.SecretAccessKey),
+			sessionToken:    string(cfg.SessionToken),
+		}
+	}
+
+	return awsCredentials{
+		accessKeyID:     os.Getenv(ENV_AWS_ACCESS_KEY_ID),
+		secretAccessKey: os.Getenv(ENV_AWS_SECRET_ACCESS_KEY),
+		sessionToken:    os.Getenv(ENV_AWS_SESSION_TOKEN),
+	}
+}
+
+// EventBridge endpoint for the configured region unless it's overridden
+func eventBridgeEndpoint(cfg *EventBridgeSettings) string {
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return fmt.Sprintf("https://events.%s.amazonaws.com/", cfg.Region)
+}
+
+// Credentials the requests are signed with, the ones of eventbridge.role_arn when it's set
+func (e *cloudeventTransformExporter) eventBridgeSigningCredentials(client *http.Client) (awsCredentials, error) {
+	if e.awsRole != nil {
+		return e.awsRole.get(client, time.Now())
+	}
+	return e.awsCreds, nil
+}
+
+// Maps the cloud-event to a PutEvents entry, ce.source as Source, the type as DetailType and the data as Detail
+func (e *cloudeventTransformExporter) eventBridgeEntry(ce *cloudeventdata) (putEventsEntry, error) {
+	detail, err := ce.dataBody(e.config)
+	if err != nil {
+		return putEventsEntry{}, err
+	}
+
+	entry := putEventsEntry{
+		Source:       ce.sourceOf(e.config),
+		DetailType:   e.config.ceType(ce.reason),
+		Detail:       string(detail),
+		EventBusName: e.config.EventBridge.EventBusName,
+	}
+	if !ce.time.IsZero() {
+		entry.Time = ce.time.Unix()
+	}
+	return entry, nil
+}
+
+// Maps the cloud-event to a PutEvents entry and sends it signed to EventBridge
+func (e *cloudeventTransformExporter) sendEventBridge(client *http.Client, ce *cloudeventdata) error {
+	entry, err := e.eventBridgeEntry(ce)
+	if err != nil {
+		return err
+	}
+
+	rejected, err := e.putEvents(client, []putEventsEntry{entry})
+	if err != nil {
+		return err
+	}
+	if rejected[0] != nil {
+		return e.eventBridgeRejected(ce, rejected[0])
+	}
+	return nil
+}
+
+/*
+Sends the batch of at most EVENTBRIDGE_MAX_ENTRIES events in a single PutEvents request. EventBridge takes or
+rejects every entry on its own, so only the rejected events fail with a partialBatchError, the others are delivered.
+*/
+func (e *cloudeventTransformExporter) sendEventBridgeBatch(client *http.Client, batch []*cloudeventdata) error {
+	entries := make([]putEventsEntry, 0, len(batch))
+	for _, ce := range batch {
+		entry, err := e.eventBridgeEntry(ce)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+
+	rejected, err := e.putEvents(client, entries)
+	if err != nil {
+		return err
+	}
+
+	var partial *partialBatchError
+	for i, ce := range batch {
+		if rejected[i] == nil {
+			continue
+		}
+		if partial == nil {
+			partial = &partialBatchError{failed: make(map[*cloudeventdata]error)}
+		}
+		partial.failed[ce] = e.eventBridgeRejected(ce, rejected[i])
+	}
+	if partial != nil {
+		return partial
+	}
+	return nil
+}
+
+// Error of the rejected entry, throttled like 429/503 do with http when EventBridge tells to try again
+func (e *cloudeventTransformExporter) eventBridgeRejected(ce *cloudeventdata, entry *putEventsResultEntry) error {
+	err := fmt.Errorf("EventBridge rejected the event %s: %s %s", ce.uid, entry.ErrorCode, entry.ErrorMessage)
+	if entry.ErrorCode == EVENTBRIDGE_ERR_THROTTLING || entry.ErrorCode == EVENTBRIDGE_ERR_INTERNAL {
+		return &throttledError{err: err, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return err
+}
+
+/*
+Sends the entries signed in a single PutEvents request, it responds with 200 even when entries are rejected
+so the result of every entry is returned in their order, nil for the ones which were taken.
+*/
+func (e *cloudeventTransformExporter) putEvents(client *http.Client, entries []putEventsEntry) ([]*putEventsResultEntry, error) {
+	cfg := &e.config.EventBridge
+
+	body, err := json.Marshal(&putEventsRequest{Entries: entries})
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := e.eventBridgeSigningCredentials(client)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := eventBridgeEndpoint(cfg)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(HEADER_CONTENT_TYPE, EVENTBRIDGE_CONTENT_TYPE)
+	req.Header.Set(HEADER_AMZ_TARGET, EVENTBRIDGE_TARGET)
+	signV4(req, body, creds, cfg.Region, EVENTBRIDGE_SERVICE, time.Now())
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain the body so that the connection can be re-used
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	// Throttled requests as a whole are retried like the throttled entries
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, e.throttledResponse(res, fmt.Errorf("error exporting items, request to %s responded with HTTP Status Code %d: %s",
+			endpoint, res.StatusCode, readErrorBody(res)))
+	}
+
+	// One byte past the limit tells a response which got cut apart from one which fits exactly
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, EVENTBRIDGE_MAX_RESPONSE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(resBody) > EVENTBRIDGE_MAX_RESPONSE {
+		return nil, fmt.Errorf("PutEvents response of %s is larger than %d bytes", endpoint, EVENTBRIDGE_MAX_RESPONSE)
+	}
+
+	// The request was taken, without the results of the entries they're all taken as delivered
+	rejected := make([]*putEventsResultEntry, len(entries))
+	var putRes putEventsResponse
+	if err = json.Unmarshal(resBody, &putRes); err != nil {
+		e.logger.Warn("Couldn't parse PutEvents response, events taken as delivered",
+			zap.String("endpoint", endpoint), zap.Int("events", len(entries)), zap.Error(err))
+		return rejected, nil
+	}
+
+	if putRes.FailedEntryCount == 0 {
+		return rejected, nil
+	}
+	if len(putRes.Entries) != len(entries) {
+		return nil, fmt.Errorf("EventBridge rejected %d of the %d events", putRes.FailedEntryCount, len(entries))
+	}
+	for i := range putRes.Entries {
+		if putRes.Entries[i].ErrorCode != "" {
+			rejected[i] = &putRes.Entries[i]
+		}
+	}
+	return rejected, nil
+}
@@ -0,0 +1,294 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock EventBridge which hands over the received requests to the test, failedEntries
+// decides whether the entries get rejected the way PutEvents does it (HTTP 200 with FailedEntryCount)
+func newEventBridgeServer(t *testing.T, failedEntries bool) (*httptest.Server, chan capturedRequest) {
+	requests := make(chan capturedRequest, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- capturedRequest{header: r.Header.Clone(), body: body}
+
+		if failedEntries {
+			_, _ = w.Write([]byte(`{"FailedEntryCount":1,"Entries":[{"ErrorCode":"InternalFailure","ErrorMessage":"boom"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"FailedEntryCount":0,"Entries":[{"EventId":"11710aed-b79e-4468-a20b-bb3c0c3b4860"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func eventBridgeConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_EVENTBRIDGE
+	cfg.EventBridge = EventBridgeSettings{
+		Region:          "eu-west-1",
+		EventBusName:    "k8s-events",
+		Endpoint:        endpoint,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		SessionToken:    "session",
+	}
+	return cfg
+}
+
+func TestEventBridgePutEvents(t *testing.T) {
+	server, requests := newEventBridgeServer(t, false)
+
+	e, _ := startTestExporter(t, eventBridgeConfig(server.URL))
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+
+	// Request shape of PutEvents
+	assert.Equal(t, EVENTBRIDGE_TARGET, req.header.Get(HEADER_AMZ_TARGET))
+	assert.Equal(t, EVENTBRIDGE_CONTENT_TYPE, req.header.Get(HEADER_CONTENT_TYPE))
+
+	var putReq putEventsRequest
+	require.NoError(t, json.Unmarshal(req.body, &putReq))
+	require.Len(t, putReq.Entries, 1)
+
+	entry := putReq.Entries[0]
+	assert.Equal(t, "test-source", entry.Source)
+	assert.Equal(t, "com.test.event.v1.Created", entry.DetailType)
+	assert.Equal(t, "k8s-events", entry.EventBusName)
+	assert.NotZero(t, entry.Time)
+
+	var detail map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(entry.Detail), &detail))
+	assert.Equal(t, "Created", detail["reason"])
+	assert.Equal(t, "pod", detail["name"])
+
+	// Signing headers
+	assert.NotEmpty(t, req.header.Get(HEADER_AMZ_DATE))
+	assert.Equal(t, "session", req.header.Get(HEADER_AMZ_SECURITY_TOKEN))
+
+	auth := req.header.Get(HEADER_AUTHORIZATION)
+	assert.True(t, strings.HasPrefix(auth, SIGV4_ALGORITHM+" Credential=AKIDEXAMPLE/"), auth)
+	assert.Contains(t, auth, "/eu-west-1/events/aws4_request")
+	assert.Contains(t, auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target")
+	assert.Contains(t, auth, "Signature=")
+}
+
+func TestEventBridgeFailedEntry(t *testing.T) {
+	server, _ := newEventBridgeServer(t, true)
+
+	e, _ := newTestExporter(t, eventBridgeConfig(server.URL))
+	e.client = server.Client()
+	e.awsCreds = eventBridgeCredentials(&e.config.EventBridge)
+
+	ce := &cloudeventdata{reason: "Created", uid: "abc"}
+	err := e.sendEventBridge(e.client, ce)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InternalFailure")
+}
+
+func TestEventBridgeThrottledRequest(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(HEADER_RETRY_AFTER, "7")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(strings.Repeat("x", 2*MAX_ERROR_BODY)))
+		}))
+
+		e, _ := newTestExporter(t, eventBridgeConfig(server.URL))
+		e.client = server.Client()
+		e.awsCreds = eventBridgeCredentials(&e.config.EventBridge)
+
+		// Retried after Retry-After instead of going to the dead letter, the body in the error is bounded
+		err := e.sendEventBridge(e.client, &cloudeventdata{reason: "Created", uid: "abc"})
+		var throttled *throttledError
+		require.ErrorAs(t, err, &throttled, "status %d", status)
+		assert.Equal(t, 7*time.Second, throttled.retryAfter)
+		assert.Less(t, len(err.Error()), 2*MAX_ERROR_BODY)
+		server.Close()
+	}
+}
+
+func TestEventBridgeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+		warned  int
+	}{
+		{
+			name:    "too large",
+			body:    `{"FailedEntryCount":0,"Entries":[{"EventId":"` + strings.Repeat("x", EVENTBRIDGE_MAX_RESPONSE) + `"}]}`,
+			wantErr: fmt.Sprintf("larger than %d bytes", EVENTBRIDGE_MAX_RESPONSE),
+		},
+		{
+			// The request was taken, so the events aren't sent again or dead-lettered
+			name:   "unparsable",
+			body:   `<html>ok</html>`,
+			warned: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			e, logs := newTestExporter(t, eventBridgeConfig(server.URL))
+			e.client = server.Client()
+			e.awsCreds = eventBridgeCredentials(&e.config.EventBridge)
+
+			err := e.sendEventBridge(e.client, &cloudeventdata{reason: "Created", uid: "abc"})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.warned, logs.FilterMessage("Couldn't parse PutEvents response, events taken as delivered").Len())
+		})
+	}
+}
+
+func TestEventBridgeCredentialsFromEnv(t *testing.T) {
+	t.Setenv(ENV_AWS_ACCESS_KEY_ID, "AKIDENV")
+	t.Setenv(ENV_AWS_SECRET_ACCESS_KEY, "secret")
+	t.Setenv(ENV_AWS_SESSION_TOKEN, "")
+
+	creds := eventBridgeCredentials(&EventBridgeSettings{Region: "eu-west-1"})
+	assert.Equal(t, awsCredentials{accessKeyID: "AKIDENV", secretAccessKey: "secret"}, creds)
+}
+
+func TestEventBridgeAssumeRole(t *testing.T) {
+	var assumed []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sts/" {
+			require.NoError(t, r.ParseForm())
+			assumed = append(assumed, r.PostForm)
+			assert.Contains(t, r.Header.Get(HEADER_AUTHORIZATION), "Credential=AKIDEXAMPLE/")
+			assert.Contains(t, r.Header.Get(HEADER_AUTHORIZATION), "/eu-west-1/sts/aws4_request")
+			_, _ = fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult><Credentials>`+
+				`<AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>rolesecret</SecretAccessKey><SessionToken>rolesession</SessionToken>`+
+				`<Expiration>%s</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			return
+		}
+
+		// Signed with the credentials of the role
+		assert.Contains(t, r.Header.Get(HEADER_AUTHORIZATION), "Credential=ASIAROLE/")
+		assert.Equal(t, "rolesession", r.Header.Get(HEADER_AMZ_SECURITY_TOKEN))
+		_, _ = w.Write([]byte(`{"FailedEntryCount":0,"Entries":[{"EventId":"11710aed-b79e-4468-a20b-bb3c0c3b4860"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := eventBridgeConfig(server.URL)
+	cfg.EventBridge.RoleARN = "arn:aws:iam::123456789012:role/events"
+	cfg.EventBridge.ExternalID = "external"
+	cfg.EventBridge.STSEndpoint = server.URL + "/sts/"
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.sendEventBridge(e.client, &cloudeventdata{reason: "Created", uid: "abc"}))
+	require.NoError(t, e.sendEventBridge(e.client, &cloudeventdata{reason: "Created", uid: "def"}))
+
+	// Assumed once, the credentials are good for another hour
+	require.Len(t, assumed, 1)
+	assert.Equal(t, STS_ACTION, assumed[0].Get("Action"))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/events", assumed[0].Get("RoleArn"))
+	assert.Equal(t, STS_SESSION_NAME, assumed[0].Get("RoleSessionName"))
+	assert.Equal(t, "external", assumed[0].Get("ExternalId"))
+}
+
+func TestEventBridgeAssumeRoleLargeResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 2*STS_MAX_RESPONSE)))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := eventBridgeConfig(server.URL)
+	cfg.EventBridge.RoleARN = "arn:aws:iam::123456789012:role/events"
+	cfg.EventBridge.STSEndpoint = server.URL + "/sts/"
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	err := e.sendEventBridge(e.client, &cloudeventdata{reason: "Created", uid: "abc"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("AssumeRole response of %s/sts/ is larger than %d bytes", server.URL, STS_MAX_RESPONSE))
+}
+
+func TestEventBridgeBatch(t *testing.T) {
+	requests := make(chan capturedRequest, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- capturedRequest{header: r.Header.Clone(), body: body}
+
+		// The second entry is throttled, the third one is rejected for good
+		_, _ = w.Write([]byte(`{"FailedEntryCount":2,"Entries":[{"EventId":"1"},` +
+			`{"ErrorCode":"ThrottlingException","ErrorMessage":"slow down"},` +
+			`{"ErrorCode":"MalformedDetail","ErrorMessage":"bad detail"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := eventBridgeConfig(server.URL)
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: EVENTBRIDGE_MAX_ENTRIES, FlushInterval: time.Second}
+	require.NoError(t, cfg.Validate())
+
+	e, _ := newTestExporter(t, cfg)
+	e.client = server.Client()
+	e.awsCreds = eventBridgeCredentials(&e.config.EventBridge)
+
+	batch := []*cloudeventdata{
+		{reason: "Created", uid: "a"},
+		{reason: "Killing", uid: "b"},
+		{reason: "Pulled", uid: "c"},
+	}
+	err := e.sendBatch(e.client, batch)
+
+	var putReq putEventsRequest
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &putReq))
+	require.Len(t, putReq.Entries, 3)
+	assert.Equal(t, "com.test.event.v1.Killing", putReq.Entries[1].DetailType)
+
+	var partial *partialBatchError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, []*cloudeventdata{batch[0]}, deliveredOf(batch, err))
+
+	var throttled *throttledError
+	require.Len(t, partial.failed, 2)
+	assert.ErrorAs(t, partial.failed[batch[1]], &throttled)
+	assert.False(t, errors.As(partial.failed[batch[2]], &throttled))
+	assert.Contains(t, partial.failed[batch[2]].Error(), "MalformedDetail")
+}
+
+func TestValidateEventBridge(t *testing.T) {
+	cfg := eventBridgeConfig("")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.EventBridge.ExternalID = "external"
+	assert.Error(t, cfg.Validate())
+	cfg.EventBridge.RoleARN = "arn:aws:iam::123456789012:role/events"
+	assert.NoError(t, cfg.Validate())
+
+	// PutEvents takes at most 10 entries
+	cfg = eventBridgeConfig("")
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: EVENTBRIDGE_MAX_ENTRIES + 1, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+	cfg.Batch.MaxSize = EVENTBRIDGE_MAX_ENTRIES
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,21 @@
+package cloudeventexporter
+
+const (
+	// Event Grid topics take the events in the CloudEvents v1.0 schema, authenticated with an access key of the
+	// topic in this header or with a Microsoft Entra ID (AAD) token,
+	// see https://learn.microsoft.com/en-us/azure/event-grid/post-to-custom-topic
+	HEADER_AEG_SAS_KEY = "aeg-sas-key"
+)
+
+/*
+Endpoint of the eventgrid transport, the topic gets structured mode cloud-events (batches with batch) so they're
+sent like the http transport does it. The AAD tokens come from the auth extension of the exporter, like oauth2client
+with the client credentials of an app registration and the https://eventgrid.azure.net/.default scope.
+*/
+func eventGridTarget(cfg *EventGridSettings) endpointTarget {
+	target := endpointTarget{url: cfg.Endpoint, contentMode: CONTENT_MODE_STRUCTURED, backoff: &endpointBackoff{}}
+	if cfg.SASKey != "" {
+		target.headers = map[string]string{HEADER_AEG_SAS_KEY: string(cfg.SASKey)}
+	}
+	return target
+}
@@ -0,0 +1,83 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configauth"
+)
+
+func eventGridConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_EVENTGRID
+	cfg.EventGrid = EventGridSettings{Endpoint: endpoint, SASKey: "topic-key"}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func TestEventGridTransport(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	// Structured mode whatever content_mode is
+	cfg := eventGridConfig(server.URL)
+	cfg.ContentMode = CONTENT_MODE_BINARY
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "topic-key", req.header.Get(HEADER_AEG_SAS_KEY))
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, req.header.Get(HEADER_CONTENT_TYPE))
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "test-source", event["source"])
+	assert.Equal(t, "com.test.event.v1.Created", event["type"])
+	assert.Equal(t, "1.0", event["specversion"])
+	assert.Equal(t, "Created", event["data"].(map[string]interface{})["reason"])
+}
+
+func TestEventGridTransportBatch(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := eventGridConfig(server.URL)
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(3, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "topic-key", req.header.Get(HEADER_AEG_SAS_KEY))
+	assert.Equal(t, CONTENT_TYPE_BATCH, req.header.Get(HEADER_CONTENT_TYPE))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &events))
+	assert.Len(t, events, 3)
+}
+
+func TestValidateEventGrid(t *testing.T) {
+	cfg := eventGridConfig("https://k8s-events.westeurope-1.eventgrid.azure.net/api/events")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.EventGrid.Endpoint = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = eventGridConfig("https://k8s-events.westeurope-1.eventgrid.azure.net/api/events")
+	cfg.Endpoint = "http://localhost:8080"
+	assert.Error(t, cfg.Validate())
+
+	// AAD tokens of the auth extension instead of the key
+	cfg = eventGridConfig("https://k8s-events.westeurope-1.eventgrid.azure.net/api/events")
+	cfg.Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+	cfg.EventGrid.SASKey = ""
+	assert.NoError(t, cfg.Validate())
+}
@@ -2,46 +2,65 @@ package cloudeventexporter
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/Shopify/sarama"
+	"github.com/eclipse/paho.golang/autopaho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
 	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
-)
-
-var (
-	filters        []string         // k8s.event.reason filters
-	filterAllowAll bool     = false // if configuration changes this to true, it'll let pass all of the logs
-
-	typeVersion string // typeverson will define the body type of CloudEvent (right now it's v1 specific)
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/grpc"
 )
 
 const (
-	// Cloud-event body skeleton
-	CE_DATA_META_BODY = `{"reason":"%s","start_time":"%s","name":"%s","namespace":"%s","count":%d,"message":"%s"}`
-
 	// Cloud-event required headers
 	HEADER_CE_ID          = "Ce-Id"
 	HEADER_CE_TYPE        = "Ce-Type"
 	HEADER_CE_SOURCE      = "Ce-Source"
 	HEADER_CE_SPECVERSION = "Ce-Specversion"
+	HEADER_CE_TIME        = "Ce-Time"
 	HEADER_CONTENT_TYPE   = "Content-Type"
 
 	// Other required HTTP headers
-	HEADER_RETRY_AFTER = "Retry-After"
-	CONTENT_TYPE       = "application/json"
+	HEADER_RETRY_AFTER      = "Retry-After"
+	HEADER_ACCEPT_ENCODING  = "Accept-Encoding"
+	HEADER_CONTENT_ENCODING = "Content-Encoding"
+	CONTENT_TYPE            = "application/json"
+	CONTENT_TYPE_BATCH      = "application/cloudevents-batch+json"
+	CONTENT_TYPE_STRUCTURED = "application/cloudevents+json"
+	ENCODING_GZIP           = "gzip"
+
+	// Longest part of an error response kept in the error
+	MAX_ERROR_BODY = 1024
 
-	// Open-telemetry required resources to look for in logs
+	// Open-telemetry required resources to look for in logs, the defaults of mapping
 	ATTR_EVENT_COUNT      = "k8s.event.count"
 	ATTR_EVENT_NAME       = "k8s.event.name"
 	ATTR_EVENT_NS         = "k8s.namespace.name"
@@ -49,17 +68,26 @@ const (
 	ATTR_EVENT_START_TIME = "k8s.event.start_time"
 	ATTR_EVENT_UID        = "k8s.event.uid"
 
+	// Length of the reason hash appended to types truncated with max_type_length
+	TYPE_HASH_LEN = 8
+
+	// Layout of k8s.event.start_time, receivers fill it with time.Time's String()
+	EVENT_TIME_LAYOUT = "2006-01-02 15:04:05.999999999 -0700 MST"
+
 	// Channel size and also the concurrent go thread counts which
 	// reads gets the cloud-event and sends HTTP request
 	CHAN_SZ = 2
 
 	// To avoid fetching attribute from OTel use FETCH_ATTR = false
-	FETCH_ATTR    = true
-
-	// Enable retry for failed messages
-	RETRY_ENABLED = false
+	FETCH_ATTR = true
 )
 
+// Timeout of the requests when the configuration doesn't have any
+var defaultClientTimeout = 30 * time.Second
+
+// Permanent so that exporterhelper doesn't retry pushing logs to an exporter that's going away
+var errShuttingDown = consumererror.NewPermanent(errors.New("cloud-event exporter is shutting down"))
+
 type cloudeventTransformExporter struct {
 	config      *Config
 	client      *http.Client
@@ -69,31 +97,105 @@ type cloudeventTransformExporter struct {
 	source      string
 	specversion string
 	ceChan      chan *cloudeventdata
+
+	done         chan struct{}  // closed on shutdown, anything waiting on ceChan should give up
+	ready        chan struct{}  // closed once startup_delay elapses, nothing is sent before
+	shutdownOnce sync.Once      // shutdown can be called more than once by the collector
+	workers      sync.WaitGroup // workers started in start, shutdown waits for them
+
+	endpoints    []endpointTarget            // Where the http transport sends the events, endpoint or endpoints
+	awsCreds     awsCredentials              // Signing credentials for eventbridge transport, resolved in start
+	awsRole      *awsAssumedRole             // Role of eventbridge.role_arn assumed with awsCreds, nil signs with awsCreds
+	syslog       *syslogConn                 // Connection of the syslog transport, dialled on the first event
+	pubSubTokens oauth2.TokenSource          // Tokens of the Application Default Credentials with pubsub.default_credentials
+	grpcConn     *grpc.ClientConn            // Connection of the grpc transport
+	kafka        sarama.SyncProducer         // Producer of the kafka transport, created in start unless it's set already like a mock one in tests
+	natsConn     *nats.Conn                  // Connection of the nats transport
+	natsJS       nats.JetStreamContext       // JetStream of natsConn with nats.jetstream, nil publishes without acks
+	mqtt         mqtt.Client                 // Client of the mqtt transport
+	mqtt5        *autopaho.ConnectionManager // Client of the mqtt transport with mqtt.version 5
+	amqp         *amqpLink                   // Link of the amqp transport, created in start unless it's set already like one with a fake sender in tests
+
+	workerClients    []*http.Client // Client of every worker with client_per_worker, nil when they share client
+	deadLetterClient *http.Client   // Client of dead_letter.endpoint, without the headers and auth of the sink
+	dataRefClient    *http.Client   // Client of dataref.endpoint, without the headers and auth of the sink
+	replyClient      *http.Client   // Client of reply.endpoint, without the headers and auth of the sink
+	sender           Sender         // Sends the events instead of the transport when set, like a fake one in tests
+
+	hostname string // Collector's pod or host name for hostname_extension, resolved in start
+
+	quarantine *quarantine // Where invalid events go with quarantine_file, opened in start
+
+	queueBytes *byteLimiter // Bounds the bytes of the queued events with max_queue_bytes, nil without it
+	rateLimit  *tokenBucket // Caps the events per second with rate_limit, nil without it
+	uidLimit   *uidThrottle // Suppresses re-emission of a uid with uid_min_interval, nil without it
+
+	filters          []string          // k8s.event.reason filters
+	filterAllowAll   bool              // if configuration changes this to true, it'll let pass all of the logs
+	namespaces       map[string]bool   // k8s.event.namespace filters, nil lets every namespace pass
+	attributeFilters []attributeFilter // attribute_filters with their regexes compiled
+
+	filteredCount atomic.Uint64 // events dropped by filter so far, used to sample the drop logs
+	filterChecks  atomic.Uint64 // records run through the filters, the ones letting everything pass are skipped
+	sequence      atomic.Uint64 // last sequence number given to an event with id_strategy uid_seq or sequence_extension
+
+	thresholds *thresholdState // Series which are beyond the threshold of their rule, so only crossing it sends an event
+
+	metrics *exporterMetrics
 }
 
 type cloudeventdata struct {
-	count     int
-	message   string
-	name      string
-	namespace string
-	reason    string
-	startTime string
-	uid       string // This field will be converted and passed to cloudeventTransformExporter.id
+	count      int
+	message    string
+	messageRaw interface{} // Map or slice message with structured_message, sent as is in the data instead of message
+	name       string
+	namespace  string
+	reason     string
+	startTime  string
+	time       time.Time // Parsed startTime, zero if it couldn't be parsed
+	uid        string    // This field will be converted and passed to cloudeventTransformExporter.id
+	seq        uint64    // Sequence number of the event in the exporter, only with id_strategy uid_seq or sequence_extension
+	size       int       // Bytes counted against max_queue_bytes while it's queued
+	source     string    // Source resolved from the resource with source_attribute, empty uses the configured one
+	deadline   time.Time // Sending is pointless after it, zero if the event doesn't have any (see deadline_attribute)
+
+	firstFailure time.Time // When its first throttled send failed, retries stop after retry_on_failure.max_elapsed_time
+	deliveredTo  []bool    // Endpoints which already got the event, by their index, so a retry skips them
+
+	query   url.Values // Query parameters of the event from query_attributes, appended to the endpoint's ones
+	dataRef string     // Where the data is stored out of band with dataref, the event is sent without its data then
+
+	partitionKey string // Key of the kafka record, amqp message or pubsub ordering key from their attribute, empty uses the uid
+
+	messageMissing bool // The record didn't have any message in message_source, not even an empty one
+	countMissing   bool // The record didn't have k8s.event.count, its count is 1 with optional_count
+	ttlExpired     bool // A decremented broker_extensions ran out, the event would loop through the broker
+
+	attributes map[string]interface{} // All of the log record attributes, only filled with include_otel_attributes
+	resource   map[string]interface{} // Resource attributes picked by include_resource_attributes
+	extensions map[string]interface{} // Extension attributes, sent as Ce-<name> headers
+	metric     *thresholdCrossing     // Datapoint which crossed a threshold, only for the events of a metrics pipeline
+
+	generic bool        // Converted with mode generic, the data is the body instead of the k8s event fields
+	body    interface{} // Body of the record with mode generic
 }
 
 // Create new exporter.
 func newExporter(cf component.Config, set exporter.CreateSettings) (*cloudeventTransformExporter, error) {
+	return newSignalExporter(cf, set, SIGNAL_LOGS)
+}
+
+// Create new exporter of the signal's pipeline, its metrics carry the signal
+func newSignalExporter(cf component.Config, set exporter.CreateSettings, signal string) (*cloudeventTransformExporter, error) {
 	conf := cf.(*Config)
 	var err error = nil
+	var filters []string
+	filterAllowAll := false
 
 	if err = conf.Validate(); err != nil {
 		return nil, err
 	}
 
-	if len(conf.Ce.SpecVersion) > 0 {
-		typeVersion = "v" + string(conf.Ce.SpecVersion[0])
-	}
-
 	if len(conf.Filter) > 0 {
 		filters = strings.Split(conf.Filter, "|")
 		filtersLen := len(filters)
@@ -109,6 +211,44 @@ func newExporter(cf component.Config, set exporter.CreateSettings) (*cloudeventT
 		}
 	}
 
+	// Empty or * lets every namespace pass, same as not filtering them at all
+	var namespaces map[string]bool
+	if ns := strings.TrimSpace(conf.NamespaceFilter); ns != "" && ns != "*" {
+		namespaces = make(map[string]bool)
+		for _, namespace := range strings.Split(ns, "|") {
+			namespaces[strings.TrimSpace(namespace)] = true
+		}
+	}
+
+	attributeFilters, err := newAttributeFilters(conf.AttributeFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	var queueBytes *byteLimiter
+	if conf.MaxQueueBytes > 0 {
+		queueBytes = newByteLimiter(conf.MaxQueueBytes)
+	}
+
+	var rateLimit *tokenBucket
+	if conf.RateLimit.EventsPerSecond > 0 {
+		burst := conf.RateLimit.Burst
+		if burst == 0 {
+			burst = int(math.Ceil(conf.RateLimit.EventsPerSecond))
+		}
+		rateLimit = newTokenBucket(conf.RateLimit.EventsPerSecond, burst)
+	}
+
+	var uidLimit *uidThrottle
+	if conf.UidMinInterval > 0 {
+		uidLimit = newUidThrottle(conf.UidMinInterval)
+	}
+
+	metrics, err := newExporterMetrics(set.MeterProvider, signal)
+	if err != nil {
+		return nil, err
+	}
+
 	userAgent := fmt.Sprintf("%s/%s (%s/%s)",
 		set.BuildInfo.Description, set.BuildInfo.Version, runtime.GOOS, runtime.GOARCH)
 
@@ -119,226 +259,934 @@ func newExporter(cf component.Config, set exporter.CreateSettings) (*cloudeventT
 		useragent: userAgent,
 		source:    conf.Ce.Source,
 		ceChan:    make(chan *cloudeventdata, CHAN_SZ),
+		done:      make(chan struct{}),
+		ready:     make(chan struct{}),
 		settings:  set.TelemetrySettings,
+		endpoints: newEndpointTargets(conf),
+
+		filters:          filters,
+		filterAllowAll:   filterAllowAll,
+		namespaces:       namespaces,
+		attributeFilters: attributeFilters,
+
+		queueBytes: queueBytes,
+		rateLimit:  rateLimit,
+		uidLimit:   uidLimit,
+
+		metrics:    metrics,
+		thresholds: newThresholdState(),
 	}, nil
 }
 
 // start actually creates the HTTP client. The client construction is deferred till this point as this
 // is the only place we get hold of Extensions which are required to construct auth round tripper.
 func (e *cloudeventTransformExporter) start(_ context.Context, host component.Host) error {
-	client, err := e.config.HTTPClientSettings.ToClient(host, e.settings)
-	if err != nil {
+	var err error
+
+	var limiter *streamLimiter
+	if e.config.MaxConcurrentStreams > 0 {
+		limiter = newStreamLimiter(nil, e.config.MaxConcurrentStreams)
+	}
+
+	if e.client, err = e.newClient(host, limiter); err != nil {
+		return err
+	}
+	if e.config.DeadLetter.Endpoint != "" {
+		if e.deadLetterClient, err = e.newEndpointClient(host, e.config.DeadLetter.Headers); err != nil {
+			return err
+		}
+	}
+	if e.config.Reply.Endpoint != "" {
+		if e.replyClient, err = e.newEndpointClient(host, e.config.Reply.Headers); err != nil {
+			return err
+		}
+	}
+	if e.config.DataRef.Threshold > 0 {
+		if e.dataRefClient, err = e.newEndpointClient(host, e.config.DataRef.Headers); err != nil {
+			return err
+		}
+	}
+
+	// Without an overall timeout a hung endpoint keeps a worker blocked forever
+	if e.config.Timeout == 0 {
+		e.logger.Info("No timeout configured for the endpoint, using the default",
+			zap.Duration("timeout", defaultClientTimeout))
+	}
+
+	// Workers get a client (and connection pool) of their own, the streams are still bounded across all of them
+	if e.config.ClientPerWorker && !e.config.SyncSend {
+		e.workerClients = make([]*http.Client, CHAN_SZ)
+		for i := range e.workerClients {
+			if e.workerClients[i], err = e.newClient(host, limiter); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.config.KnativeBroker.Name != "" {
+		brokerURL, err := resolveKnativeBroker(&e.config.KnativeBroker, KUBERNETES_SERVICE_ACCOUNT)
+		if err != nil {
+			return fmt.Errorf("couldn't resolve the address of knative_broker: %w", err)
+		}
+		e.endpoints[0].url = brokerURL
+		e.logger.Info("Address of the Knative Broker resolved", zap.String("endpoint", brokerURL))
+	}
+
+	if err = e.authenticateEndpoints(host, append([]*http.Client{e.client}, e.workerClients...)); err != nil {
 		return err
 	}
-	e.client = client
+	if e.config.NegotiateContentMode {
+		e.negotiateContentModes()
+	}
+
+	if e.config.Transport == TRANSPORT_EVENTBRIDGE {
+		e.awsCreds = eventBridgeCredentials(&e.config.EventBridge)
+		if e.awsCreds.accessKeyID == "" || e.awsCreds.secretAccessKey == "" {
+			return errors.New("no AWS credentials found for eventbridge transport in configuration or environment")
+		}
+		if e.config.EventBridge.RoleARN != "" {
+			e.awsRole = &awsAssumedRole{cfg: &e.config.EventBridge, base: e.awsCreds}
+		}
+	}
+
+	// Resolved once, the token source caches the tokens and refreshes them before they expire
+	if e.config.Transport == TRANSPORT_PUBSUB && e.config.PubSub.DefaultCredentials && e.pubSubTokens == nil {
+		if e.pubSubTokens, err = google.DefaultTokenSource(context.Background(), PUBSUB_SCOPE); err != nil {
+			return fmt.Errorf("couldn't find the default credentials for pubsub transport: %w", err)
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_GRPC {
+		if e.grpcConn, err = e.config.GRPC.ToClientConn(context.Background(), host, e.settings); err != nil {
+			return err
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_KAFKA && e.kafka == nil {
+		if e.kafka, err = newKafkaProducer(&e.config.Kafka, e.client.Timeout); err != nil {
+			return fmt.Errorf("couldn't create the producer of kafka transport: %w", err)
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_NATS {
+		if e.natsConn, err = newNATSConn(&e.config.NATS, e.client.Timeout); err != nil {
+			return fmt.Errorf("couldn't connect to the servers of nats transport: %w", err)
+		}
+		if e.config.NATS.JetStream.Enabled {
+			if e.natsJS, err = e.natsConn.JetStream(nats.MaxWait(e.client.Timeout)); err != nil {
+				return err
+			}
+		}
+		if e.config.NATS.JetStream.Stream != "" {
+			if err = ensureNATSStream(e.natsJS, &e.config.NATS); err != nil {
+				return fmt.Errorf("couldn't create the stream of nats transport: %w", err)
+			}
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_MQTT && e.config.MQTT.Version == MQTT_VERSION_5 {
+		if e.mqtt5, err = newMQTT5Client(&e.config.MQTT, e.client.Timeout); err != nil {
+			return fmt.Errorf("couldn't connect to the broker of mqtt transport: %w", err)
+		}
+	} else if e.config.Transport == TRANSPORT_MQTT {
+		if e.mqtt, err = newMQTTClient(&e.config.MQTT, e.client.Timeout); err != nil {
+			return fmt.Errorf("couldn't connect to the broker of mqtt transport: %w", err)
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_AMQP && e.amqp == nil {
+		var tokens amqpTokenSource
+		if e.config.Auth != nil {
+			authenticator, err := e.config.Auth.GetClientAuthenticator(host.GetExtensions())
+			if err != nil {
+				return fmt.Errorf("auth: %w", err)
+			}
+			creds, err := authenticator.PerRPCCredentials()
+			if err != nil {
+				return fmt.Errorf("auth: %w", err)
+			}
+			tokens = amqpTokens(creds)
+		}
+		if e.amqp, err = newAMQPLink(&e.config.AMQP, tokens); err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+		defer cancel()
+		if _, err = e.amqp.current(ctx); err != nil {
+			return fmt.Errorf("couldn't open the link of amqp transport: %w", err)
+		}
+	}
+
+	if e.config.Transport == TRANSPORT_SYSLOG {
+		e.syslog = &syslogConn{
+			network: e.config.Syslog.Network,
+			address: e.config.Syslog.Endpoint,
+			timeout: e.client.Timeout,
+		}
+		if e.syslog.network == "" {
+			e.syslog.network = SYSLOG_NETWORK_TCP
+		}
+		// The message goes without HOSTNAME if it can't be found
+		if e.syslog.hostname, err = collectorHostname(); err != nil {
+			e.logger.Warn("Couldn't get the hostname for syslog messages", zap.Error(err))
+		}
+	}
+
+	if e.config.HostnameExtension != "" {
+		if e.hostname, err = collectorHostname(); err != nil {
+			return fmt.Errorf("couldn't get the hostname for hostname_extension: %w", err)
+		}
+	}
+
+	if e.config.QuarantineFile != "" {
+		if e.quarantine, err = openQuarantine(e.config.QuarantineFile); err != nil {
+			return err
+		}
+	}
+
+	// Give the endpoint some time to come up, events wait in the meantime
+	if e.config.StartupDelay > 0 {
+		e.logger.Info("Holding the events till the startup delay elapses", zap.Duration("startup_delay", e.config.StartupDelay))
+		e.workers.Add(1)
+		go func() {
+			defer e.workers.Done()
+			timer := time.NewTimer(e.config.StartupDelay)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				close(e.ready)
+			case <-e.done:
+			}
+		}()
+	} else {
+		close(e.ready)
+	}
 
 	// Spin the go-routines which will listen to messages dropped in ceChan channel
+	// pushLogs sends the events itself with sync_send, there's nothing for the workers to do
+	if e.config.SyncSend {
+		return nil
+	}
+
+	// Every worker logs with its index, so a stalled one can be told apart
 	for i := 0; i < CHAN_SZ; i++ {
-		go e.exportMessage()
+		logger := e.logger.With(zap.Int("worker_id", i))
+		client := e.client
+		if e.workerClients != nil {
+			client = e.workerClients[i]
+		}
+
+		e.workers.Add(1)
+		go func() {
+			defer e.workers.Done()
+
+			select {
+			case <-e.ready:
+			case <-e.done:
+				return
+			}
+
+			if e.config.Batch.Enabled {
+				e.exportBatches(logger, client)
+			} else {
+				e.exportMessage(logger, e.senderFor(client))
+			}
+		}()
 	}
 	return nil
 }
 
+// Creates a client from the HTTP settings, bounded by the shared limiter with max_concurrent_streams
+func (e *cloudeventTransformExporter) newClient(host component.Host, limiter *streamLimiter) (*http.Client, error) {
+	// The headers are added by configuredHeaders instead, the Ce-* headers of the event win over them
+	settings := e.config.HTTPClientSettings
+	settings.Headers = nil
+
+	client, err := settings.ToClient(host, e.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.config.ResetConnectionsAfter > 0 {
+		client.Transport = newReconnectingTransport(client.Transport, e.config.ResetConnectionsAfter, func() (http.RoundTripper, error) {
+			fresh, err := settings.ToClient(host, e.settings)
+			if err != nil {
+				return nil, err
+			}
+			return fresh.Transport, nil
+		})
+	}
+
+	if len(e.config.Headers) > 0 {
+		client.Transport = newConfiguredHeaders(client.Transport, e.config.Headers, e.logger)
+	}
+	if limiter != nil {
+		client.Transport = limiter.wrap(client.Transport)
+	}
+	if client.Timeout == 0 {
+		client.Timeout = defaultClientTimeout
+	}
+	return client, nil
+}
+
+/*
+Creates a client for an endpoint other than the sink, like dead_letter.endpoint, from the HTTP settings (timeout,
+TLS...) but without the headers and auth of the sink, so its credentials don't leak to it. The endpoint's own
+headers are added instead.
+*/
+func (e *cloudeventTransformExporter) newEndpointClient(host component.Host, headers map[string]configopaque.String) (*http.Client, error) {
+	settings := e.config.HTTPClientSettings
+	settings.Headers = nil
+	settings.Auth = nil
+
+	client, err := settings.ToClient(host, e.settings)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) > 0 {
+		client.Transport = newConfiguredHeaders(client.Transport, headers, e.logger)
+	}
+	if client.Timeout == 0 {
+		client.Timeout = defaultClientTimeout
+	}
+	return client, nil
+}
+
+// shutdown signals the workers to stop and waits for them. ceChan is never closed as workers
+// re-enqueue retries onto it and a send on a closed channel panics, done is closed instead.
+// It's safe whether start ran, failed half way or not at all, and only the first call does anything.
 func (e *cloudeventTransformExporter) shutdown(_ context.Context) error {
-	// Close the channel to receive messages further
-	close(e.ceChan)
-	return nil
+	var err error
+	e.shutdownOnce.Do(func() {
+		close(e.done)
+		e.workers.Wait()
+
+		if e.syslog != nil {
+			err = multierr.Append(err, e.syslog.close())
+		}
+		if e.grpcConn != nil {
+			err = multierr.Append(err, e.grpcConn.Close())
+		}
+		if e.kafka != nil {
+			err = multierr.Append(err, e.kafka.Close())
+		}
+		// Publishes still buffered by the client are flushed before closing
+		if e.natsConn != nil {
+			err = multierr.Append(err, e.natsConn.FlushTimeout(e.client.Timeout))
+			e.natsConn.Close()
+		}
+		if e.mqtt != nil {
+			e.mqtt.Disconnect(uint(e.client.Timeout / time.Millisecond))
+		}
+		if e.mqtt5 != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+			err = multierr.Append(err, e.mqtt5.Disconnect(ctx))
+			cancel()
+		}
+		if e.amqp != nil {
+			err = multierr.Append(err, e.amqp.close())
+		}
+		if e.quarantine != nil {
+			err = multierr.Append(err, e.quarantine.close())
+		}
+	})
+	return err
+}
+
+// Puts the cloud-event in ceChan for the workers, returns errShuttingDown instead of
+// blocking forever if the exporter is shutting down and nobody will read from ceChan.
+// With max_queue_bytes the event waits for space, or gets dropped with on_full drop.
+func (e *cloudeventTransformExporter) enqueue(ce *cloudeventdata) error {
+	select {
+	case <-e.done:
+		return errShuttingDown
+	default:
+	}
+
+	if e.queueBytes != nil {
+		if ce.size == 0 {
+			ce.size = ce.queuedSize(e.config)
+		}
+
+		if !e.queueBytes.acquire(ce.size, e.config.OnFull == ON_FULL_BLOCK, e.done) {
+			select {
+			case <-e.done:
+				return errShuttingDown
+			default:
+			}
+
+			e.logger.Warn("Event dropped, max_queue_bytes reached", zap.String("id", ce.uid), zap.Int("bytes", ce.size))
+			return nil
+		}
+	}
+
+	select {
+	case e.ceChan <- ce:
+		return nil
+	case <-e.done:
+		e.dequeued(ce)
+		return errShuttingDown
+	}
+}
+
+// Gives back the bytes of the event taken in enqueue, called once a worker is done with it
+func (e *cloudeventTransformExporter) dequeued(ce *cloudeventdata) {
+	if e.queueBytes != nil {
+		e.queueBytes.release(ce.size)
+	}
 }
 
 func (e *cloudeventTransformExporter) pushLogs(ctx context.Context, ld plog.Logs) error {
-	// Body that can be re-used for all the messages present in loop
-	// to avoid extra allocation/s
-	var ce cloudeventdata
+	// Nothing to do, though upstream filtering everything out may as well be a misrouted pipeline
+	if ld.LogRecordCount() == 0 {
+		if e.config.CountEmptyBatches {
+			e.logger.Debug("Received logs without any record")
+			e.metrics.addEmptyBatch(ctx)
+		}
+		return nil
+	}
 
-	// Remove anything not required from logs
-	if !filterAllowAll {
+	// Recorded however pushLogs returns, the records split_events splits count as received
+	var summary batchSummary
+	defer e.recordBatchSummary(ctx, &summary)
+
+	// Split before filtering, so the filters see the attributes of every event
+	if e.config.SplitEvents.Enabled {
+		for i := 0; i < ld.ResourceLogs().Len(); i++ {
+			scopeLogs := ld.ResourceLogs().At(i).ScopeLogs()
+			for j := 0; j < scopeLogs.Len(); j++ {
+				if err := splitRecords(scopeLogs.At(j), &e.config.SplitEvents); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	summary.received = ld.LogRecordCount()
+
+	// Remove anything not required from logs, with convert_then_filter it's done on the converted events.
+	// With filter and namespace_filter letting everything pass and no attribute_filters the records aren't even looked at
+	filtering := !e.filterAllowAll || e.namespaces != nil || len(e.attributeFilters) > 0
+	convertFirst := e.config.FilterOrder == FILTER_ORDER_CONVERT_THEN_FILTER
+	if filtering && !convertFirst {
 		ld.ResourceLogs().RemoveIf(func(rl plog.ResourceLogs) bool {
 			rl.ScopeLogs().RemoveIf(func(sl plog.ScopeLogs) bool {
 				sl.LogRecords().RemoveIf(func(lr plog.LogRecord) bool {
-					reason, reasonOk := lr.Attributes().Get(ATTR_EVENT_REASON)
-					if !reasonOk {
-						return false
-					}
-
-					reasonFound := false
-					for _, r := range filters {
-						if r == reason.AsString() {
-							reasonFound = true
-							break
-						}
-					}
-
-					return !reasonFound
+					return !e.keepRecord(lr, sl, rl, nil)
 				})
 				return sl.LogRecords().Len() == 0
 			})
 			return rl.ScopeLogs().Len() == 0
 		})
+		summary.filtered = summary.received - ld.LogRecordCount()
 	}
 
+	// Uids converted so far with dedup_batch
+	var seenUids map[string]struct{}
+	if e.config.DedupBatch {
+		seenUids = make(map[string]struct{})
+	}
+
+	emit, flush := e.newEmitter(ctx, &summary)
+	var pending []*cloudeventdata
+
 	// Convert the log/s
 	for i := 0; i < ld.ResourceLogs().Len(); i++ {
-		scopeLogs := ld.ResourceLogs().At(i).ScopeLogs()
+		resourceLogs := ld.ResourceLogs().At(i)
+		scopeLogs := resourceLogs.ScopeLogs()
 
 		for j := 0; j < scopeLogs.Len(); j++ {
 			logRecord := scopeLogs.At(j)
 			records := logRecord.LogRecords()
 
 			for k := 0; k < records.Len(); k++ {
-				//var cloudEventMetaData string
-				currentMessage := records.At(k).Body()
+				ce, err := toCloudEvent(records.At(k), logRecord, resourceLogs, e.config)
+				// With convert_then_filter a record the filters drop anyway doesn't fail the push
+				if err != nil && filtering && convertFirst && e.droppedWithoutConversion(records.At(k), logRecord, resourceLogs) {
+					summary.filtered++
+					continue
+				}
+				if (err == nil && ce.messageMissing) || errors.Is(err, errMissingMessage) {
+					e.metrics.addMissingMessage(ctx)
+				}
 
-				// Get all the required attributes
-				if FETCH_ATTR {
-					attrMap := records.At(k).Attributes()
+				if err != nil && e.quarantine != nil {
+					e.quarantineRecord(records.At(k), err)
+					continue
+				} else if err != nil {
+					return err
+				}
 
-					// Check if the required things are present,
-					// if not fail at the earliest reporting missing things
-					eventCount, eventCountOk := attrMap.Get(ATTR_EVENT_COUNT)
-					eventName, eventNameOk := attrMap.Get(ATTR_EVENT_NAME)
-					eventNs, eventNsOk := attrMap.Get(ATTR_EVENT_NS)
-					eventUid, eventUidOk := attrMap.Get(ATTR_EVENT_UID)
-					reason, reasonOk := attrMap.Get(ATTR_EVENT_REASON)
-					startTime, startTimeOk := attrMap.Get(ATTR_EVENT_START_TIME)
+				summary.converted++
 
-					anyError := !(reasonOk && startTimeOk && eventNameOk && eventUidOk && eventNsOk && eventCountOk)
+				if ce.ttlExpired {
+					e.logger.Debug("Event dropped, decremented broker_extensions ran out", zap.String("id", ce.uid))
+					continue
+				}
 
-					if anyError {
-						overAllErrStr := ""
+				if filtering && convertFirst && !e.keepRecord(records.At(k), logRecord, resourceLogs, ce) {
+					summary.filtered++
+					continue
+				}
 
-						if !reasonOk {
-							overAllErrStr += "{" + ATTR_EVENT_REASON + "} "
-						}
+				// Fan-in upstream can put the same event more than once in a batch
+				if e.config.DedupBatch {
+					if _, seen := seenUids[ce.uid]; seen {
+						e.logger.Debug("Event dropped, duplicate uid in the batch", zap.String("id", ce.uid))
+						continue
+					}
+					seenUids[ce.uid] = struct{}{}
+				}
 
-						if !startTimeOk {
-							overAllErrStr += "{" + ATTR_EVENT_START_TIME + "} "
-						}
+				// With sort_by_time they're emitted once the whole batch is converted
+				if e.config.SortByTime {
+					pending = append(pending, ce)
+					continue
+				}
+				if err := emit(ce); err != nil {
+					return err
+				}
+			}
+		}
+	}
 
-						if !eventNameOk {
-							overAllErrStr += "{" + ATTR_EVENT_NAME + "} "
-						}
+	sortByTime(pending)
+	for _, ce := range pending {
+		if err := emit(ce); err != nil {
+			return err
+		}
+	}
 
-						if !eventUidOk {
-							overAllErrStr += "{" + ATTR_EVENT_UID + "} "
-						}
+	return flush()
+}
 
-						if !eventNsOk {
-							overAllErrStr += "{" + ATTR_EVENT_NS + "} "
-						}
+/*
+Hands the converted events over for sending, emit takes them one at a time and flush sends what's left of them
+with sync_send. The error either of them returns (if any) is what the push returns.
+*/
+func (e *cloudeventTransformExporter) newEmitter(ctx context.Context, summary *batchSummary) (emit func(*cloudeventdata) error, flush func() error) {
+	// With sync_send the events are sent right here instead of going through ceChan
+	var (
+		syncEvents []*cloudeventdata
+		syncErrs   error
+	)
 
-						if !eventCountOk {
-							overAllErrStr += "{" + ATTR_EVENT_COUNT + "} "
-						}
+	emit = func(ce *cloudeventdata) error {
+		// Coalescing events of a uid can come in quick succession, only the first one of the interval goes out.
+		// Checked before rate_limit so the suppressed ones don't use up its tokens
+		if e.uidLimit != nil && !e.uidLimit.allow(ce.uid) {
+			e.logger.Debug("Event dropped, uid emitted within uid_min_interval", zap.String("id", ce.uid))
+			return nil
+		}
 
-						return errors.New(fmt.Sprintf("Couldn't find %sattributes in the log", overAllErrStr))
-					}
+		// Global cap across every reason, on_full decides between waiting for it and dropping the event
+		if e.rateLimit != nil && !e.rateLimit.take(ctx, e.config.OnFull == ON_FULL_BLOCK, e.done) {
+			e.releaseUid(ce)
+			select {
+			case <-e.done:
+				return errShuttingDown
+			default:
+			}
+			// The push got cancelled while waiting for a token
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
-					ce = cloudeventdata{
-						count:     int(eventCount.Int()),
-						message:   currentMessage.AsString(),
-						name:      eventName.AsString(),
-						namespace: eventNs.AsString(),
-						reason:    reason.AsString(),
-						startTime: startTime.AsString(),
-						uid:       eventUid.AsString(),
-					}
-				} else {
-					// Useful case for testing but this can be totally removed
-					// Though it can be utilized if expansion is required later
-					ce = cloudeventdata{
-						count:     0,
-						message:   currentMessage.AsString(),
-						name:      "name",
-						namespace: "ns",
-						reason:    "TestReason",
-						startTime: "",
-						uid:       "fhapohnea-afj-ajfa",
-					}
-				}
+			e.logger.Warn("Event dropped, rate_limit reached", zap.String("id", ce.uid))
+			return nil
+		}
 
-				// Send the message to channel so that it can be processed in parallel
-				e.ceChan <- &ce
+		// Fixed extensions go first, they never replace a value the event got from the conversion or here
+		for name, val := range e.config.Ce.Extensions {
+			if _, ok := ce.extensions[name]; !ok {
+				ce.setExtension(name, val)
 			}
 		}
+
+		// Assigned once the event is past the drops, so the sequence only has gaps for events which got lost,
+		// and once only, so the retries of the event keep its id and sequence
+		if e.config.IdStrategy == ID_STRATEGY_UID_SEQ || e.config.SequenceExtension {
+			ce.seq = e.sequence.Add(1)
+		}
+		if e.config.SequenceExtension {
+			ce.setExtension(EXTENSION_SEQUENCE, strconv.FormatUint(ce.seq, 10))
+			ce.setExtension(EXTENSION_SEQUENCE_TYPE, SEQUENCE_TYPE_INTEGER)
+		}
+
+		if e.hostname != "" {
+			ce.setExtension(e.config.HostnameExtension, e.hostname)
+		}
+
+		if e.config.SyncSend {
+			syncEvents = append(syncEvents, ce)
+			summary.enqueued++
+
+			// Send what's converted so far rather than holding the whole batch, the events are
+			// delivered by the time sendSync returns so their slice can be reused
+			if e.config.StreamSize > 0 && len(syncEvents) >= e.config.StreamSize {
+				syncErrs = multierr.Append(syncErrs, e.sendSync(ctx, syncEvents))
+				syncEvents = syncEvents[:0]
+
+				if ctx.Err() != nil || errors.Is(syncErrs, errShuttingDown) {
+					return syncErrs
+				}
+			}
+			return nil
+		}
+
+		// Send the message to channel so that it can be processed in parallel, it blocks
+		// while the workers are busy so the batch is never converted all at once
+		if err := e.enqueue(ce); err != nil {
+			return err
+		}
+		summary.enqueued++
+		return nil
 	}
 
-	return nil
+	flush = func() error {
+		if e.config.SyncSend && len(syncEvents) > 0 {
+			syncErrs = multierr.Append(syncErrs, e.sendSync(ctx, syncEvents))
+		}
+		return syncErrs
+	}
+	return emit, flush
 }
 
-func (e *cloudeventTransformExporter) exportMessage() {
-	for ce := range e.ceChan {
-		// Correct JSON message if it has quotes
-		msg := strings.ReplaceAll(ce.message, "\"", "\\\"")
+// Orders the events by their time, the ones without it go last and the events keep their order otherwise
+func sortByTime(events []*cloudeventdata) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[j].time.IsZero() {
+			return !events[i].time.IsZero()
+		}
+		return !events[i].time.IsZero() && events[i].time.Before(events[j].time)
+	})
+}
 
-		// Prepare JSON body
-		json_body := fmt.Sprintf(CE_DATA_META_BODY,
-			ce.reason,
-			ce.startTime,
-			ce.name,
-			ce.namespace,
-			ce.count,
-			msg,
-		)
+// Returned (as permanent error) by doRequest when the server rejects the request with 413 Payload Too Large,
+// sending it unchanged again would fail the same way
+type payloadTooLargeError struct {
+	err error
+}
 
-		// Create new request body and configure it with required things
-		req, err := http.NewRequest(http.MethodPost, e.config.Endpoint, bytes.NewReader([]byte(json_body)))
+func (p *payloadTooLargeError) Error() string {
+	return p.err.Error()
+}
 
-		if err != nil {
-			e.logger.Error(err.Error())
+func (p *payloadTooLargeError) Unwrap() error {
+	return p.err
+}
+
+// Returned by sendMessage when the server asks to slow down, retryAfter holds
+// the wait asked by server in Retry-After header
+type throttledError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (t *throttledError) Error() string {
+	return t.err.Error()
+}
+
+func (t *throttledError) Unwrap() error {
+	return t.err
+}
+
+// Worker which sends the cloud-events dropped in ceChan till the exporter shuts down
+func (e *cloudeventTransformExporter) exportMessage(logger *zap.Logger, sender Sender) {
+	for {
+		var ce *cloudeventdata
+
+		select {
+		case <-e.done:
+			return
+		case ce = <-e.ceChan:
+		}
+
+		if e.expired(logger, ce) {
+			e.dequeued(ce)
 			continue
 		}
 
-		// Add all the required headers
-		req.Header.Add(HEADER_CE_ID, ce.uid)
-		req.Header.Add(HEADER_CE_TYPE, configureCeType(e.config.Ce.AppendType, ce.reason))
-		req.Header.Add(HEADER_CE_SOURCE, e.config.Ce.Source)
-		req.Header.Add(HEADER_CE_SPECVERSION, e.config.Ce.SpecVersion)
-		req.Header.Add(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+		err := sender.Send(context.Background(), ce)
+		e.dequeued(ce)
+		if err == nil {
+			logger.Debug("Cloud-event sent", zap.String("id", ce.uid))
+			e.recordDelivered(ce)
+			continue
+		}
 
-		res, err := e.client.Do(req)
+		// If enabled, retry for throttled messages, otherwise print error and leave
+		if throttled, ok := e.retryable(ce, err); ok {
+			logger.Error(exporterhelper.NewThrottleRetry(throttled.err, throttled.retryAfter).Error(), zap.String("id", ce.uid))
+			e.requeue(logger, ce, throttled.retryAfter)
+			continue
+		}
 
+		logger.Error(err.Error(), zap.String("id", ce.uid))
+		e.releaseUid(ce)
+		e.deadLetter(logger, ce, err)
+	}
+}
+
+// Takes back the uid_min_interval slot of an event which wasn't delivered
+func (e *cloudeventTransformExporter) releaseUid(ce *cloudeventdata) {
+	if e.uidLimit != nil {
+		e.uidLimit.release(ce.uid)
+	}
+}
+
+// Puts the cloud-event back in ceChan after retryAfter. It's done in a separate go-routine
+// so the worker keeps draining ceChan, otherwise workers re-enqueueing on a full ceChan block
+// each other. Gives up on the event if the exporter starts shutting down meanwhile.
+func (e *cloudeventTransformExporter) requeue(logger *zap.Logger, ce *cloudeventdata, retryAfter time.Duration) {
+	e.workers.Add(1)
+	go func() {
+		defer e.workers.Done()
+
+		timer := time.NewTimer(retryAfter)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-e.done:
+			logger.Debug("Abandoning retry of the event, exporter is shutting down", zap.String("id", ce.uid))
+			return
+		}
+
+		if err := e.enqueue(ce); err != nil {
+			logger.Debug("Abandoning retry of the event, exporter is shutting down", zap.String("id", ce.uid))
+		}
+	}()
+}
+
+// Sends the cloud-event using the configured transport, with the client of the worker
+func (e *cloudeventTransformExporter) send(client *http.Client, ce *cloudeventdata) error {
+	switch e.config.Transport {
+	case TRANSPORT_EVENTBRIDGE:
+		return e.sendEventBridge(client, ce)
+	case TRANSPORT_SYSLOG:
+		return e.sendSyslog(ce)
+	case TRANSPORT_PUBSUB:
+		return e.sendPubSub(client, ce)
+	case TRANSPORT_GRPC:
+		return e.sendGRPC(client, ce)
+	case TRANSPORT_KAFKA:
+		return e.sendKafka(ce)
+	case TRANSPORT_NATS:
+		return e.sendNATS(ce)
+	case TRANSPORT_MQTT:
+		return e.sendMQTT(ce)
+	case TRANSPORT_AMQP:
+		return e.sendAMQP(ce)
+	default:
+		return e.sendMessage(client, ce)
+	}
+}
+
+// Converts the cloud-event into HTTP request and sends it to the endpoints, encoded in their content mode
+func (e *cloudeventTransformExporter) sendMessage(client *http.Client, ce *cloudeventdata) error {
+	if err := e.offloadData(ce); err != nil {
+		return err
+	}
+
+	sendTo := func(target endpointTarget) error {
+		headers, body, err := ce.encodeFor(target.contentMode, e.config)
 		if err != nil {
-			e.logger.Error(err.Error())
-			continue
+			return err
 		}
 
-		// Check if the status code is acceptable and continue for next requests
-		if res.StatusCode >= 200 && res.StatusCode <= 299 {
-			continue
+		endpoint, err := withQuery(target.url, ce.query)
+		if err != nil {
+			return err
 		}
 
-		var formattedErr error = fmt.Errorf("error exporting items, request to %s responded with HTTP Status Code %d",
-			e.config.Endpoint, res.StatusCode)
+		// Create new request body and configure it with required things
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header = headers
 
-		// If enabled, retry for errors, otherwise print error and leave
-		if RETRY_ENABLED {
-			retryAfter := 0
+		return e.doRequest(target.authorize(client, req), req)
+	}
 
-			// Check if the server is overwhelmed.
-			// See spec https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#otlphttp-throttling
-			isThrottleError := res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
-			if val := res.Header.Get(HEADER_RETRY_AFTER); isThrottleError && val != "" {
-				if seconds, err2 := strconv.Atoi(val); err2 == nil {
-					retryAfter = seconds
-				}
-			}
-			err = exporterhelper.NewThrottleRetry(formattedErr, time.Duration(retryAfter)*time.Second)
-			e.logger.Error(err.Error())
-			continue
+	// Sent once more with the message truncated with truncate_too_large, only to the endpoints which rejected it
+	err := e.deliver([]*cloudeventdata{ce}, sendTo)
+	var tooLarge *payloadTooLargeError
+	if errors.As(err, &tooLarge) && ce.truncateMessage(e.config.TruncateTooLarge) {
+		err = e.deliver([]*cloudeventdata{ce}, sendTo)
+	}
+	return err
+}
+
+// Sends the request to the endpoint, throttled requests return throttledError
+func (e *cloudeventTransformExporter) doRequest(client *http.Client, req *http.Request) error {
+	// Asking for it explicitly turns off Go's transparent decoding, readErrorBody decodes it instead
+	req.Header.Set(HEADER_ACCEPT_ENCODING, ENCODING_GZIP)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	// Drain the body so that the connection can be re-used
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	// Check if the status code is acceptable and continue for next requests,
+	// brokers acknowledging with 204 No Content are within it as well
+	if res.StatusCode >= 200 && res.StatusCode <= 299 {
+		// Knative sinks can reply with an event of their own, it goes to reply.endpoint
+		if isReplyEvent(res) {
+			e.routeReply(req, res)
 		}
+		return nil
+	}
+
+	var formattedErr error = fmt.Errorf("error exporting items, request to %s responded with HTTP Status Code %d",
+		req.URL, res.StatusCode)
+	if msg := readErrorBody(res); msg != "" {
+		formattedErr = fmt.Errorf("%w: %s", formattedErr, msg)
+	}
 
-		e.logger.Error(formattedErr.Error())
+	if res.StatusCode == http.StatusRequestEntityTooLarge {
+		e.metrics.addPayloadTooLarge(context.Background())
+		return consumererror.NewPermanent(&payloadTooLargeError{err: formattedErr})
 	}
+
+	return e.throttledResponse(res, formattedErr)
+}
+
+/*
+Wraps the error of the response in throttledError when the server is overwhelmed (429 or 503), it's returned
+as is otherwise. Shared by the transports going over HTTP so they're all retried the same way.
+See spec https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#otlphttp-throttling
+*/
+func (e *cloudeventTransformExporter) throttledResponse(res *http.Response, err error) error {
+	isThrottleError := res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
+	if !isThrottleError {
+		return err
+	}
+
+	// Without a usable Retry-After back off for retry_on_failure.initial_interval instead of hammering the server
+	retryAfter := e.config.RetrySettings.InitialInterval
+	if val := res.Header.Get(HEADER_RETRY_AFTER); val != "" {
+		if seconds, err2 := strconv.Atoi(val); err2 == nil && seconds >= 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return &throttledError{err: err, retryAfter: retryAfter}
+}
+
+// Reads the beginning of the error response, decoding it when it's gzip encoded
+func readErrorBody(res *http.Response) string {
+	var body io.Reader = res.Body
+	if strings.EqualFold(res.Header.Get(HEADER_CONTENT_ENCODING), ENCODING_GZIP) {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return fmt.Sprintf("(couldn't decode gzip response: %v)", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// A truncated gzip stream still gives what was decoded till then
+	msg, _ := io.ReadAll(io.LimitReader(body, MAX_ERROR_BODY))
+	return strings.TrimSpace(string(msg))
+}
+
+// Parses k8s.event.start_time, besides receiver's layout RFC3339 is accepted as well
+func parseEventTime(val string) (time.Time, bool) {
+	for _, layout := range []string{EVENT_TIME_LAYOUT, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+/*
+Time of the event, k8s.event.start_time when it can be parsed. With observed_time_fallback an unparseable one
+falls back to the record's observed timestamp, ok is false when neither is there.
+*/
+func resolveEventTime(startTime string, lr plog.LogRecord, cfg *Config) (time.Time, bool) {
+	if eventTime, ok := parseEventTime(startTime); ok {
+		return eventTime, true
+	}
+	if cfg.ObservedTimeFallback && lr.ObservedTimestamp() != 0 {
+		return lr.ObservedTimestamp().AsTime(), true
+	}
+	return time.Time{}, false
+}
+
+// Go time layout for the configured time_format
+func timeLayout(format string) string {
+	if format == TIME_FORMAT_RFC3339_NANO {
+		return time.RFC3339Nano
+	}
+	return time.RFC3339
+}
+
+// Ce-Type of the event, type_overrides or the reason appended to append_type truncated to max_type_length if it's set
+func (cfg *Config) ceType(reason string) string {
+	// Explicit types are used as they are
+	if override, ok := cfg.TypeOverrides[reason]; ok {
+		return override
+	}
+
+	version := cfg.typeVersion()
+	ceType := configureCeType(cfg.Ce.AppendType, version, reason)
+	if cfg.MaxTypeLength == 0 || len(ceType) <= cfg.MaxTypeLength {
+		return ceType
+	}
+
+	return truncateCeType(ceType, len(cfg.Ce.AppendType)+len(version)+2, cfg.MaxTypeLength)
+}
+
+// Version part of Ce-Type, it'll define the body type of CloudEvent. Empty for a spec version which isn't supported
+func (cfg *Config) typeVersion() string {
+	return specTypeVersions[cfg.specVersion()]
+}
+
+/*
+The one place the spec version of the events comes from, binary mode's Ce-Specversion, structured mode's
+specversion and the version in Ce-Type are all derived from it so they can't diverge
+*/
+func (cfg *Config) specVersion() string {
+	return cfg.Ce.SpecVersion
+}
+
+/*
+Truncates the reason portion (everything after prefixLen) of the type so that it fits in maxLength,
+a hash of the complete reason is appended so that long reasons sharing the beginning stay distinct
+Ex: `com.company.event.v1.AVeryLongReason` truncated to 32 becomes `com.company.event.v1.A-1a2b3c4d`
+*/
+func truncateCeType(ceType string, prefixLen int, maxLength int) string {
+	reason := ceType[prefixLen:]
+	sum := sha256.Sum256([]byte(reason))
+	hash := hex.EncodeToString(sum[:])[:TYPE_HASH_LEN]
+
+	// Cut the reason at a rune boundary, leaving space for the `-hash` suffix
+	cut := maxLength - prefixLen - TYPE_HASH_LEN - 1
+	for cut > 0 && !utf8.RuneStart(reason[cut]) {
+		cut--
+	}
+
+	return ceType[:prefixLen] + reason[:cut] + "-" + hash
 }
 
 // Configures Ce-Type header's value, using the given reason (removes any spaces present)
-func configureCeType(pretext string, reason string) string {
+func configureCeType(pretext string, version string, reason string) string {
 	var ret strings.Builder
 	ret.Grow(len(pretext) + len(reason))
 
 	ret.WriteString(pretext)
 	ret.WriteRune('.')
-	ret.WriteString(typeVersion) // It'll define the version
+	ret.WriteString(version) // It'll define the version
 	ret.WriteRune('.')
 
 	for _, ch := range reason {
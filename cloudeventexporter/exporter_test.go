@@ -1 +1,993 @@
 package cloudeventexporter
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Returns a config which passes validation, tests can tweak it further
+func testConfig() *Config {
+	cfg := CreateDefaultConfig().(*Config)
+	cfg.Ce.AppendType = "com.test.event"
+	cfg.Ce.Source = "test-source"
+	cfg.Filter = "*"
+	return cfg
+}
+
+// Creates the exporter with a logger whose entries can be inspected by the test
+func newTestExporter(t *testing.T, cfg *Config) (*cloudeventTransformExporter, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	set := exportertest.NewNopCreateSettings()
+	set.Logger = zap.New(core)
+
+	e, err := newExporter(cfg, set)
+	require.NoError(t, err)
+	return e, logs
+}
+
+// Same as newTestExporter but also starts the workers, they're stopped when the test ends
+func startTestExporter(t *testing.T, cfg *Config) (*cloudeventTransformExporter, *observer.ObservedLogs) {
+	e, logs := newTestExporter(t, cfg)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	return e, logs
+}
+
+// Request received by the capture server
+type capturedRequest struct {
+	header http.Header
+	query  url.Values
+	body   []byte
+}
+
+// Starts a server which accepts everything and hands over the received requests to the test
+func newCaptureServer(t *testing.T) (*httptest.Server, chan capturedRequest) {
+	requests := make(chan capturedRequest, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests <- capturedRequest{header: r.Header.Clone(), query: r.URL.Query(), body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// Waits for the next request received by the capture server
+func nextRequest(t *testing.T, requests chan capturedRequest) capturedRequest {
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the cloud-event")
+	}
+	return capturedRequest{}
+}
+
+// Returns logs carrying n events with the given reason
+func testEvents(n int, reason string) plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for i := 0; i < n; i++ {
+		fillEvent(records.AppendEmpty(), reason, "pod")
+	}
+	return ld
+}
+
+func fillEvent(lr plog.LogRecord, reason string, name string) {
+	timestamp := pcommon.NewTimestampFromTime(time.Now())
+	lr.Body().SetStr("Test event message")
+	lr.SetTimestamp(timestamp)
+	lr.SetObservedTimestamp(timestamp)
+	lr.Attributes().PutStr(ATTR_EVENT_REASON, reason)
+	lr.Attributes().PutStr(ATTR_EVENT_NAME, name)
+	lr.Attributes().PutStr(ATTR_EVENT_NS, "testns")
+	lr.Attributes().PutStr(ATTR_EVENT_UID, "uid-"+name)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, timestamp.String())
+	lr.Attributes().PutInt(ATTR_EVENT_COUNT, 1)
+}
+
+func TestLogFilteredSamples(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Created"
+	cfg.LogFilteredSamples = 3
+
+	e, logs := newTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(9, "Deleted")))
+
+	sampled := logs.FilterMessage("Event dropped by filter").All()
+	assert.Len(t, sampled, 3)
+	for _, entry := range sampled {
+		assert.Equal(t, "Deleted", entry.ContextMap()["reason"])
+		assert.Equal(t, "pod", entry.ContextMap()["name"])
+	}
+}
+
+func TestLogFilteredSamplesDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Created"
+
+	e, logs := newTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Deleted")))
+	assert.Equal(t, 0, logs.FilterMessage("Event dropped by filter").Len())
+}
+
+func TestRetryDuringShutdown(t *testing.T) {
+	// Server keeps throttling so the events keep getting re-enqueued
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_RETRY_AFTER, "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.RetrySettings.Enabled = true
+
+	e, _ := newTestExporter(t, cfg)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := e.pushLogs(context.Background(), testEvents(5, "Created")); err != nil {
+					assert.ErrorIs(t, err, errShuttingDown)
+					return
+				}
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		assert.NoError(t, e.shutdown(context.Background()))
+		close(shutdownDone)
+	}()
+
+	select {
+	case <-shutdownDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown deadlocked with retries in flight")
+	}
+	wg.Wait()
+
+	// Nothing should panic or block once the exporter is down
+	assert.ErrorIs(t, e.pushLogs(context.Background(), testEvents(1, "Created")), errShuttingDown)
+	assert.NoError(t, e.shutdown(context.Background()))
+}
+
+func TestIncludeOtelAttributes(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.IncludeOtelAttributes = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	attrs := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes()
+	attrs.PutDouble("cpu.usage", 0.5)
+	attrs.PutBool("node.ready", true)
+	attrs.PutEmptyMap("labels").PutStr("app", "web")
+	attrs.PutEmptySlice("ports").AppendEmpty().SetInt(8080)
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+
+	// Mapped fields stay at the top level
+	assert.Equal(t, "Created", data["reason"])
+	assert.Equal(t, "pod", data["name"])
+	assert.Equal(t, "testns", data["namespace"])
+	assert.Equal(t, float64(1), data["count"])
+	assert.Equal(t, "Test event message", data["message"])
+
+	otel := data["otel"].(map[string]interface{})
+	otelAttrs := otel["attributes"].(map[string]interface{})
+	assert.Equal(t, "Created", otelAttrs[ATTR_EVENT_REASON])
+	assert.Equal(t, float64(1), otelAttrs[ATTR_EVENT_COUNT])
+	assert.Equal(t, 0.5, otelAttrs["cpu.usage"])
+	assert.Equal(t, true, otelAttrs["node.ready"])
+	assert.Equal(t, map[string]interface{}{"app": "web"}, otelAttrs["labels"])
+	assert.Equal(t, []interface{}{float64(8080)}, otelAttrs["ports"])
+}
+
+func TestOtelAttributesOmittedByDefault(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+	assert.NotContains(t, data, "otel")
+}
+
+func TestTimeFormat(t *testing.T) {
+	instant := time.Date(2023, 3, 21, 10, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		format    string
+		expected  string
+		startTime string // data's start_time, expected when empty
+	}{
+		{format: TIME_FORMAT_RFC3339, expected: "2023-03-21T10:00:00Z"},
+		{format: TIME_FORMAT_RFC3339_NANO, expected: "2023-03-21T10:00:00.123456789Z"},
+		// Unset keeps the start_time of the record, Ce-Time is in seconds
+		{format: "", expected: "2023-03-21T10:00:00Z", startTime: instant.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			server, requests := newCaptureServer(t)
+
+			cfg := testConfig()
+			cfg.Endpoint = server.URL
+			cfg.TimeFormat = tt.format
+
+			e, _ := startTestExporter(t, cfg)
+
+			ld := testEvents(1, "Created")
+			ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().
+				PutStr(ATTR_EVENT_START_TIME, instant.String())
+			require.NoError(t, e.pushLogs(context.Background(), ld))
+
+			req := nextRequest(t, requests)
+			assert.Equal(t, tt.expected, req.header.Get(HEADER_CE_TIME))
+
+			var data map[string]interface{}
+			require.NoError(t, json.Unmarshal(req.body, &data))
+			if tt.startTime == "" {
+				tt.startTime = tt.expected
+			}
+			assert.Equal(t, tt.startTime, data["start_time"])
+		})
+	}
+}
+
+func TestUnparseableStartTime(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().
+		PutStr(ATTR_EVENT_START_TIME, "yesterday")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Empty(t, req.header.Get(HEADER_CE_TIME))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "yesterday", data["start_time"])
+}
+
+func TestObservedTimeFallback(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ObservedTimeFallback = true
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	observed := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "yesterday")
+	lr.SetObservedTimestamp(pcommon.NewTimestampFromTime(observed))
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "2023-04-01T10:00:00Z", req.header.Get(HEADER_CE_TIME))
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "2023-04-01T10:00:00Z", data["start_time"])
+
+	// Without the observed timestamp there's nothing to fall back to
+	lr.SetObservedTimestamp(0)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	req = nextRequest(t, requests)
+	assert.Empty(t, req.header.Get(HEADER_CE_TIME))
+
+	// A parseable start time wins over the observed timestamp
+	lr.SetObservedTimestamp(pcommon.NewTimestampFromTime(observed))
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "2023-03-31T08:00:00Z")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "2023-03-31T08:00:00Z", nextRequest(t, requests).header.Get(HEADER_CE_TIME))
+}
+
+func TestOptionalCount(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.OptionalCount = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Remove(ATTR_EVENT_COUNT)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+	assert.Equal(t, float64(1), data["count"])
+}
+
+func TestOmitMissingCount(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.OptionalCount = true
+	cfg.OmitMissingCount = true
+	cfg.FieldNames = map[string]string{DATA_FIELD_COUNT: "occurrences"}
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	// The one-off event goes without the count
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Remove(ATTR_EVENT_COUNT)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+	assert.NotContains(t, data, "occurrences")
+	assert.NotContains(t, data, DATA_FIELD_COUNT)
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+
+	// The coalesced one keeps its count
+	ld = testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutInt(ATTR_EVENT_COUNT, 3)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	data = nil
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+	assert.Equal(t, float64(3), data["occurrences"])
+
+	// Omitting it isn't possible without optional_count
+	cfg.OptionalCount = false
+	assert.Error(t, cfg.Validate())
+}
+
+func TestRequiredCount(t *testing.T) {
+	e, _ := newTestExporter(t, testConfig())
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Remove(ATTR_EVENT_COUNT)
+
+	err := e.pushLogs(context.Background(), ld)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), ATTR_EVENT_COUNT)
+}
+
+func TestFieldNames(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.FieldNames = map[string]string{
+		DATA_FIELD_START_TIME: "startTime",
+		DATA_FIELD_NAMESPACE:  "ns",
+	}
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &data))
+
+	assert.Equal(t, "testns", data["ns"])
+	assert.NotEmpty(t, data["startTime"])
+	assert.NotContains(t, data, DATA_FIELD_NAMESPACE)
+	assert.NotContains(t, data, DATA_FIELD_START_TIME)
+
+	// Not renamed ones keep their names
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+	assert.Equal(t, "Test event message", data[DATA_FIELD_MESSAGE])
+}
+
+func TestWorkerIdInLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(4, "Created")))
+
+	require.Eventually(t, func() bool {
+		return logs.FilterLevelExact(zapcore.ErrorLevel).Len() == 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, entry := range logs.FilterLevelExact(zapcore.ErrorLevel).All() {
+		workerID, ok := entry.ContextMap()["worker_id"]
+		require.True(t, ok, "error log without worker_id: %s", entry.Message)
+		assert.GreaterOrEqual(t, workerID, int64(0))
+		assert.Less(t, workerID, int64(CHAN_SZ))
+	}
+}
+
+func TestFilterReasonAtScopeAndResource(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Created"
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	ld := plog.NewLogs()
+
+	// Reason only at scope level
+	rl := ld.ResourceLogs().AppendEmpty()
+	for _, reason := range []string{"Created", "Deleted"} {
+		sl := rl.ScopeLogs().AppendEmpty()
+		sl.Scope().Attributes().PutStr(ATTR_EVENT_REASON, reason)
+		lr := sl.LogRecords().AppendEmpty()
+		fillEvent(lr, reason, "scope-"+reason)
+		lr.Attributes().Remove(ATTR_EVENT_REASON)
+	}
+
+	// Reason only at resource level
+	for _, reason := range []string{"Created", "Deleted"} {
+		rl := ld.ResourceLogs().AppendEmpty()
+		rl.Resource().Attributes().PutStr(ATTR_EVENT_REASON, reason)
+		lr := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+		fillEvent(lr, reason, "resource-"+reason)
+		lr.Attributes().Remove(ATTR_EVENT_REASON)
+	}
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	require.Len(t, e.ceChan, 2)
+
+	names := []string{(<-e.ceChan).name, (<-e.ceChan).name}
+	assert.ElementsMatch(t, []string{"scope-Created", "resource-Created"}, names)
+}
+
+func TestCeTypeAppendType(t *testing.T) {
+	tests := []struct {
+		name          string
+		appendType    string
+		reason        string
+		maxTypeLength int
+		expected      string
+		invalid       bool
+	}{
+		{name: "append type", appendType: "com.test.event", reason: "Created", expected: "com.test.event.v1.Created"},
+		{name: "spaces in reason", appendType: "com.test.event", reason: "Back Off", expected: "com.test.event.v1.BackOff"},
+		// Only the reason is truncated, append_type and the version are kept whole
+		{name: "truncated", appendType: "com.test.event", reason: "AVeryLongReasonIndeed", maxTypeLength: 30, expected: "com.test.event.v1.AVe-"},
+		{name: "empty append type", appendType: "", reason: "Created", invalid: true},
+		{name: "spaces in append type", appendType: "com.test event", reason: "Created", invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Ce.AppendType = tt.appendType
+			cfg.MaxTypeLength = tt.maxTypeLength
+			if tt.invalid {
+				assert.Error(t, cfg.Validate())
+				return
+			}
+
+			require.NoError(t, cfg.Validate())
+			ceType := cfg.ceType(tt.reason)
+			if tt.maxTypeLength > 0 {
+				assert.Len(t, ceType, tt.maxTypeLength)
+				assert.True(t, strings.HasPrefix(ceType, tt.expected), ceType)
+				return
+			}
+			assert.Equal(t, tt.expected, ceType)
+		})
+	}
+}
+
+func TestMaxTypeLength(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxTypeLength = 40
+
+	e, _ := newTestExporter(t, cfg)
+
+	// Short reasons are left alone
+	assert.Equal(t, "com.test.event.v1.Created", e.config.ceType("Created"))
+
+	longA := e.config.ceType("FailedToPullImageBecauseTheRegistryIsUnreachable")
+	longB := e.config.ceType("FailedToPullImageBecauseTheRegistryRefusedTheCredentials")
+
+	assert.Len(t, longA, 40)
+	assert.Len(t, longB, 40)
+	assert.True(t, strings.HasPrefix(longA, "com.test.event.v1.FailedToPullI-"), longA)
+
+	// Same beginning but different reasons stay distinct
+	assert.NotEqual(t, longA, longB)
+
+	// And the same reason always maps to the same type
+	assert.Equal(t, longA, e.config.ceType("FailedToPullImageBecauseTheRegistryIsUnreachable"))
+}
+
+func TestMaxTypeLengthMultiByteReason(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxTypeLength = 30
+
+	e, _ := newTestExporter(t, cfg)
+
+	ceType := e.config.ceType("ÄÖÜÄÖÜÄÖÜÄÖÜ")
+	assert.LessOrEqual(t, len(ceType), 30)
+	assert.True(t, utf8.ValidString(ceType), ceType)
+}
+
+func TestTypeOverrides(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.TypeOverrides = map[string]string{"OOMKilling": "com.example.oom"}
+
+	e, _ := startTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "OOMKilling")))
+	assert.Equal(t, "com.example.oom", nextRequest(t, requests).header.Get(HEADER_CE_TYPE))
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Equal(t, "com.test.event.v1.Created", nextRequest(t, requests).header.Get(HEADER_CE_TYPE))
+}
+
+func TestDefaultClientTimeout(t *testing.T) {
+	hang := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	defaultTimeout := defaultClientTimeout
+	defaultClientTimeout = 100 * time.Millisecond
+	defer func() { defaultClientTimeout = defaultTimeout }()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, logs := startTestExporter(t, cfg)
+	assert.Equal(t, 1, logs.FilterMessage("No timeout configured for the endpoint, using the default").Len())
+
+	// More events than workers, every one of them has to give up instead of blocking the rest
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(2*CHAN_SZ, "Created")))
+	require.Eventually(t, func() bool {
+		return logs.FilterLevelExact(zapcore.ErrorLevel).Len() == 2*CHAN_SZ
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, entry := range logs.FilterLevelExact(zapcore.ErrorLevel).All() {
+		assert.Contains(t, entry.Message, "Client.Timeout exceeded")
+	}
+}
+
+func TestConfiguredClientTimeoutKept(t *testing.T) {
+	cfg := testConfig()
+	cfg.Timeout = 5 * time.Second
+
+	e, logs := startTestExporter(t, cfg)
+	assert.Equal(t, 5*time.Second, e.client.Timeout)
+	assert.Equal(t, 0, logs.FilterMessage("No timeout configured for the endpoint, using the default").Len())
+}
+
+func TestThrottleWithoutRetryAfterBacksOff(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, time.Now())
+		first := len(received) == 1
+		mu.Unlock()
+
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.RetrySettings.Enabled = true
+	cfg.RetrySettings.InitialInterval = 300 * time.Millisecond
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.GreaterOrEqual(t, received[1].Sub(received[0]), 300*time.Millisecond)
+}
+
+func TestUidSeqIdStrategy(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.IdStrategy = ID_STRATEGY_UID_SEQ
+	cfg.UidMinInterval = time.Minute
+
+	e, logs := startTestExporter(t, cfg)
+
+	// Pushed concurrently like the queue consumers of exporterhelper do, every event comes twice and
+	// uid_min_interval drops the duplicates
+	const pushers, events = 4, 20
+	var wg sync.WaitGroup
+	for p := 0; p < pushers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			ld := plog.NewLogs()
+			records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+			for i := 0; i < events; i++ {
+				fillEvent(records.AppendEmpty(), "Created", fmt.Sprintf("pusher%d-%02d", p, i))
+				fillEvent(records.AppendEmpty(), "Created", fmt.Sprintf("pusher%d-%02d", p, i))
+			}
+			assert.NoError(t, e.pushLogs(context.Background(), ld))
+		}(p)
+	}
+	wg.Wait()
+	assert.Equal(t, pushers*events, logs.FilterMessage("Event dropped, uid emitted within uid_min_interval").Len())
+
+	seqs := make(map[uint64]bool)
+	lastSeq := make(map[string]uint64) // pusher -> sequence number of its previous event
+	lastName := make(map[string]string)
+	for i := 0; i < pushers*events; i++ {
+		id := nextRequest(t, requests).header.Get(HEADER_CE_ID)
+
+		sep := strings.LastIndex(id, "-")
+		seq, err := strconv.ParseUint(id[sep+1:], 10, 64)
+		require.NoError(t, err, id)
+		assert.False(t, seqs[seq], "sequence number %d repeated", seq)
+		seqs[seq] = true
+
+		// Workers may send them out of order, but events of a pusher got increasing sequence numbers
+		name := strings.TrimPrefix(id[:sep], "uid-")
+		pusher := name[:strings.Index(name, "-")]
+		assert.Equal(t, name > lastName[pusher], seq > lastSeq[pusher], id)
+		lastName[pusher], lastSeq[pusher] = name, seq
+	}
+
+	// The drops don't leave gaps in the delivered sequence
+	for seq := uint64(1); seq <= pushers*events; seq++ {
+		assert.True(t, seqs[seq], "sequence number %d missing", seq)
+	}
+}
+
+func TestGzipErrorResponse(t *testing.T) {
+	acceptEncoding := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding <- r.Header.Get(HEADER_ACCEPT_ENCODING)
+
+		w.Header().Set(HEADER_CONTENT_ENCODING, ENCODING_GZIP)
+		w.WriteHeader(http.StatusBadRequest)
+		gz := gzip.NewWriter(w)
+		_, _ = gz.Write([]byte("invalid cloud-event: unknown source\n"))
+		_ = gz.Close()
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	assert.Equal(t, ENCODING_GZIP, <-acceptEncoding)
+	require.Eventually(t, func() bool {
+		return logs.FilterLevelExact(zapcore.ErrorLevel).Len() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, strings.HasSuffix(logs.FilterLevelExact(zapcore.ErrorLevel).All()[0].Message,
+		"HTTP Status Code 400: invalid cloud-event: unknown source"))
+}
+
+func TestPlainErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid cloud-event", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.True(t, strings.HasSuffix(err.Error(), "HTTP Status Code 400: invalid cloud-event"), err.Error())
+}
+
+func TestStartupDelayHoldsSends(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.StartupDelay = 300 * time.Millisecond
+
+	e, _ := startTestExporter(t, cfg)
+	started := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	select {
+	case <-requests:
+		t.Fatal("cloud-event sent before the startup delay elapsed")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	nextRequest(t, requests)
+	assert.GreaterOrEqual(t, time.Since(started), cfg.StartupDelay)
+}
+
+func TestStartupDelayShutdown(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:1"
+	cfg.StartupDelay = time.Hour
+
+	e, _ := newTestExporter(t, cfg)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	require.NoError(t, e.shutdown(context.Background()))
+}
+
+func TestShutdownBeforeStart(t *testing.T) {
+	e, _ := newTestExporter(t, testConfig())
+	assert.NotPanics(t, func() {
+		assert.NoError(t, e.shutdown(context.Background()))
+	})
+}
+
+func TestShutdownTwice(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:1"
+	cfg.QuarantineFile = filepath.Join(t.TempDir(), "quarantine.jsonl")
+
+	e, _ := newTestExporter(t, cfg)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	assert.NotPanics(t, func() {
+		assert.NoError(t, e.shutdown(context.Background()))
+		assert.NoError(t, e.shutdown(context.Background()))
+	})
+}
+
+func TestShutdownAfterFailedStart(t *testing.T) {
+	t.Setenv(ENV_AWS_ACCESS_KEY_ID, "")
+	t.Setenv(ENV_AWS_SECRET_ACCESS_KEY, "")
+
+	// Fails for the missing credentials
+	cfg := eventBridgeConfig("http://localhost:1")
+	cfg.EventBridge.AccessKeyID = ""
+	cfg.EventBridge.SecretAccessKey = ""
+	cfg.StartupDelay = time.Hour
+
+	e, _ := newTestExporter(t, cfg)
+	require.Error(t, e.start(context.Background(), componenttest.NewNopHost()))
+	assert.NotPanics(t, func() {
+		assert.NoError(t, e.shutdown(context.Background()))
+	})
+
+	// Pushing after shutdown fails instead of blocking on the workers which never ran
+	assert.ErrorIs(t, e.pushLogs(context.Background(), testEvents(1, "Created")), errShuttingDown)
+}
+
+func TestSortByTime(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SortByTime = true
+	cfg.SyncSend = true
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Hour}
+
+	e, _ := startTestExporter(t, cfg)
+
+	base := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for name, offset := range map[string]time.Duration{"a": 2 * time.Minute, "b": 0, "c": -1, "d": time.Minute, "e": -1} {
+		lr := records.AppendEmpty()
+		fillEvent(lr, "Created", name)
+		if offset < 0 {
+			lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "yesterday")
+		} else {
+			lr.Attributes().PutStr(ATTR_EVENT_START_TIME, base.Add(offset).Format(time.RFC3339))
+		}
+	}
+	records.Sort(func(a, b plog.LogRecord) bool {
+		nameA, _ := a.Attributes().Get(ATTR_EVENT_NAME)
+		nameB, _ := b.Attributes().Get(ATTR_EVENT_NAME)
+		return nameA.Str() < nameB.Str()
+	})
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &events))
+	var ids []string
+	for _, event := range events {
+		ids = append(ids, event["id"].(string))
+	}
+	// Events without a time go last in the order of their records
+	assert.Equal(t, []string{"uid-b", "uid-d", "uid-a", "uid-c", "uid-e"}, ids)
+}
+
+func TestDedupBatch(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+	cfg.DedupBatch = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	// Three records of uid-pod and one of uid-other
+	ld := testEvents(3, "Created")
+	fillEvent(ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty(), "Created", "other")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	require.Len(t, requests, 2)
+	assert.ElementsMatch(t, []string{"uid-pod", "uid-other"},
+		[]string{(<-requests).header.Get(HEADER_CE_ID), (<-requests).header.Get(HEADER_CE_ID)})
+
+	// Only duplicates of the same batch are dropped
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(2, "Created")))
+	require.Len(t, requests, 1)
+	assert.Equal(t, "uid-pod", (<-requests).header.Get(HEADER_CE_ID))
+}
+
+func TestDedupBatchDisabled(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(3, "Created")))
+	assert.Len(t, requests, 3)
+}
+
+func TestResponseStatusMatrix(t *testing.T) {
+	tests := []struct {
+		status    int
+		delivered bool
+		throttled bool
+	}{
+		{status: http.StatusOK, delivered: true},
+		{status: http.StatusCreated, delivered: true},
+		{status: http.StatusAccepted, delivered: true},
+		{status: http.StatusNoContent, delivered: true},
+		{status: http.StatusMultipleChoices},
+		{status: http.StatusBadRequest},
+		{status: http.StatusRequestEntityTooLarge},
+		{status: http.StatusTooManyRequests, throttled: true},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusServiceUnavailable, throttled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			var received atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			cfg := testConfig()
+			cfg.Endpoint = server.URL
+			cfg.RetrySettings.Enabled = true
+
+			e, _ := startTestExporter(t, cfg)
+			lr, sl, rl := testRecord(time.Now())
+			ce, err := toCloudEvent(lr, sl, rl, cfg)
+			require.NoError(t, err)
+
+			err = e.send(e.client, ce)
+			assert.Equal(t, int32(1), received.Load())
+			if tt.delivered {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			var throttled *throttledError
+			assert.Equal(t, tt.throttled, errors.As(err, &throttled))
+		})
+	}
+}
+
+func TestClientPerWorker(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ClientPerWorker = true
+	cfg.MaxConcurrentStreams = 4
+
+	e, _ := startTestExporter(t, cfg)
+
+	// Every worker has a client and a connection pool of its own, the streams are bounded across all of them
+	require.Len(t, e.workerClients, CHAN_SZ)
+	limiter := e.client.Transport.(*streamLimiter)
+	for i, client := range e.workerClients {
+		assert.NotSame(t, e.client, client)
+		workerLimiter := client.Transport.(*streamLimiter)
+		assert.NotSame(t, limiter.next, workerLimiter.next)
+		assert.Equal(t, limiter.slots, workerLimiter.slots)
+		for _, other := range e.workerClients[i+1:] {
+			assert.NotSame(t, client, other)
+			assert.NotSame(t, workerLimiter.next, other.Transport.(*streamLimiter).next)
+		}
+	}
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(10, "Created")))
+	for i := 0; i < 10; i++ {
+		nextRequest(t, requests)
+	}
+}
+
+func TestSharedClientByDefault(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:1"
+
+	e, _ := startTestExporter(t, cfg)
+	assert.Nil(t, e.workerClients)
+}
@@ -0,0 +1,163 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+const (
+	// Prefix of the headers carrying the extension attributes in binary mode
+	HEADER_CE_PREFIX = "Ce-"
+
+	// Extension carrying the digest of the data with data_digest
+	EXTENSION_DATA_DIGEST = "datadigest"
+	DIGEST_PREFIX_SHA256  = "sha256:"
+
+	// Sequence extension, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/extensions/sequence.md
+	EXTENSION_SEQUENCE      = "sequence"
+	EXTENSION_SEQUENCE_TYPE = "sequencetype"
+	SEQUENCE_TYPE_INTEGER   = "Integer"
+
+	// Extension correlating the events of a workflow, its value comes from correlation_attribute
+	EXTENSION_CORRELATION_ID = "correlationid"
+
+	// Partitioning extension, its value comes from partitioning_attribute. Knative's Kafka broker keys its records by it,
+	// see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/extensions/partitioning.md
+	EXTENSION_PARTITION_KEY = "partitionkey"
+
+	// Types attribute_extensions can be coerced to
+	EXTENSION_TYPE_STRING  = "string"
+	EXTENSION_TYPE_INTEGER = "integer"
+	EXTENSION_TYPE_BOOLEAN = "boolean"
+
+	// Set by the downward API in the collector's pod, preferred over the hostname
+	ENV_POD_NAME = "POD_NAME"
+)
+
+// Attributes defined by the spec, they can't be used as extension names
+var reservedAttributes = map[string]bool{
+	"id": true, "source": true, "specversion": true, "type": true, "datacontenttype": true,
+	"dataschema": true, "subject": true, "time": true, "data": true, "data_base64": true,
+}
+
+// Extension names are lower case ASCII letters or digits, see
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md#attribute-naming-convention
+func validateExtensionName(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("extension name can not be empty")
+	}
+	for _, ch := range name {
+		if !(ch >= 'a' && ch <= 'z') && !(ch >= '0' && ch <= '9') {
+			return fmt.Errorf("extension name %s can only have lower case letters and digits", name)
+		}
+	}
+	if reservedAttributes[name] {
+		return fmt.Errorf("extension name %s is a cloud-event attribute", name)
+	}
+	return nil
+}
+
+// Adds the extension attribute to the cloud-event, it's sent as Ce-<name> or as top level attribute in structured mode
+func (ce *cloudeventdata) setExtension(name string, val interface{}) {
+	if ce.extensions == nil {
+		ce.extensions = make(map[string]interface{})
+	}
+	ce.extensions[name] = val
+}
+
+/*
+Coerces the attribute to the extension type, ok is false when it can't be. Integers are 32 bit signed as per the spec,
+they can come from whole doubles or strings like "42". Booleans can come from "true" and "false". Anything else
+is a string with the attribute's string form.
+*/
+func coerceExtension(val pcommon.Value, extType string) (interface{}, bool) {
+	switch extType {
+	case EXTENSION_TYPE_INTEGER:
+		var n int64
+		switch val.Type() {
+		case pcommon.ValueTypeInt:
+			n = val.Int()
+		case pcommon.ValueTypeDouble:
+			if val.Double() != math.Trunc(val.Double()) {
+				return nil, false
+			}
+			n = int64(val.Double())
+		case pcommon.ValueTypeStr:
+			parsed, err := strconv.ParseInt(strings.TrimSpace(val.Str()), 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			n = parsed
+		default:
+			return nil, false
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return nil, false
+		}
+		return n, true
+	case EXTENSION_TYPE_BOOLEAN:
+		switch val.Type() {
+		case pcommon.ValueTypeBool:
+			return val.Bool(), true
+		case pcommon.ValueTypeStr:
+			switch strings.TrimSpace(val.Str()) {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			}
+		}
+		return nil, false
+	}
+	return val.AsString(), true
+}
+
+// SHA-256 of the data prefixed with the algorithm, like sha256:9f86d08...
+func dataDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return DIGEST_PREFIX_SHA256 + hex.EncodeToString(sum[:])
+}
+
+// Name of the collector's replica, the pod name when it's exposed to the collector, otherwise the hostname
+func collectorHostname() (string, error) {
+	if podName := os.Getenv(ENV_POD_NAME); podName != "" {
+		return podName, nil
+	}
+	return os.Hostname()
+}
+
+// Marshals the event with its extensions as top level attributes, sorted so the output is stable
+func (s *structuredCloudEvent) MarshalJSON() ([]byte, error) {
+	type plain structuredCloudEvent
+	body, err := json.Marshal((*plain)(s))
+	if err != nil || len(s.Extensions) == 0 {
+		return body, err
+	}
+
+	names := make([]string, 0, len(s.Extensions))
+	for name := range s.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(body[:len(body)-1])
+	for _, name := range names {
+		buf.WriteByte(',')
+		if err := writeJsonField(&buf, name, s.Extensions[name]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
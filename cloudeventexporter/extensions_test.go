@@ -0,0 +1,358 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestHostnameExtension(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	t.Setenv(ENV_POD_NAME, "")
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.HostnameExtension = "collectorhost"
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, hostname, req.header.Get("Ce-Collectorhost"))
+}
+
+func TestHostnameExtensionPrefersPodName(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	t.Setenv(ENV_POD_NAME, "collector-7d4b9-x2x9z")
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.HostnameExtension = "collectorhost"
+	cfg.Batch.Enabled = true
+	cfg.Batch.MaxSize = 1
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	var events []map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, "collector-7d4b9-x2x9z", events[0]["collectorhost"])
+}
+
+func TestValidateExtensionName(t *testing.T) {
+	assert.NoError(t, validateExtensionName("collectorhost"))
+	assert.NoError(t, validateExtensionName("replica2"))
+	assert.Error(t, validateExtensionName(""))
+	assert.Error(t, validateExtensionName("collector-host"))
+	assert.Error(t, validateExtensionName("CollectorHost"))
+	assert.Error(t, validateExtensionName("source"))
+}
+
+func TestDataDigest(t *testing.T) {
+	ce := &cloudeventdata{reason: "Created", uid: "uid-pod", message: "Pulled image \"nginx\""}
+
+	cfg := testConfig()
+	cfg.DataDigest = true
+
+	headers, body, err := ce.encode(cfg)
+	require.NoError(t, err)
+
+	sum := sha256.Sum256(body)
+	digest := headers.Get("Ce-Datadigest")
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), digest)
+
+	// Structured mode carries the same digest of the same data
+	event, err := ce.structured(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, digest, event.Extensions[EXTENSION_DATA_DIGEST])
+	assert.Nil(t, ce.extensions)
+
+	headers, _, err = ce.encode(testConfig())
+	require.NoError(t, err)
+	assert.Empty(t, headers.Get("Ce-Datadigest"))
+}
+
+func TestStaticExtensions(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Ce.Extensions = map[string]string{"env": "prod", "team": "platform"}
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "prod", req.header.Get("Ce-Env"))
+	assert.Equal(t, "platform", req.header.Get("Ce-Team"))
+}
+
+func TestStaticExtensionsDontReplaceComputed(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SequenceExtension = true
+	cfg.CorrelationAttribute = "workflow"
+	e, _ := startTestExporter(t, cfg)
+
+	// Even past the validation the computed values are sent
+	cfg.Ce.Extensions = map[string]string{"sequence": "fixed", "correlationid": "fixed"}
+	require.Error(t, cfg.Validate())
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr("workflow", "wf-1")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "1", req.header.Get("Ce-Sequence"))
+	assert.Equal(t, "wf-1", req.header.Get("Ce-Correlationid"))
+}
+
+func TestSequenceExtension(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SequenceExtension = true
+	cfg.UidMinInterval = time.Minute
+
+	e, logs := startTestExporter(t, cfg)
+
+	// Every event comes twice, the duplicates are dropped by uid_min_interval
+	const events = 40
+	for i := 0; i < events; i += 10 {
+		ld := plog.NewLogs()
+		records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+		for j := i; j < i+10; j++ {
+			fillEvent(records.AppendEmpty(), "Created", "pod-"+strconv.Itoa(j))
+			fillEvent(records.AppendEmpty(), "Created", "pod-"+strconv.Itoa(j))
+		}
+		require.NoError(t, e.pushLogs(context.Background(), ld))
+	}
+	assert.Equal(t, events, logs.FilterMessage("Event dropped, uid emitted within uid_min_interval").Len())
+
+	// Workers send them concurrently, but every delivered event got its own number from 1 to events without gaps
+	seqs := make(map[uint64]bool)
+	for i := 0; i < events; i++ {
+		req := nextRequest(t, requests)
+		assert.Equal(t, SEQUENCE_TYPE_INTEGER, req.header.Get("Ce-Sequencetype"))
+
+		seq, err := strconv.ParseUint(req.header.Get("Ce-Sequence"), 10, 64)
+		require.NoError(t, err)
+		assert.False(t, seqs[seq], "sequence %d repeated", seq)
+		seqs[seq] = true
+	}
+	for seq := uint64(1); seq <= events; seq++ {
+		assert.True(t, seqs[seq], "sequence %d missing", seq)
+	}
+
+	// And the ones after are greater
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	seq, err := strconv.ParseUint(nextRequest(t, requests).header.Get("Ce-Sequence"), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(events+1), seq)
+}
+
+func TestSchemaUrlExtension(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SchemaUrlExtension = "schemaurl"
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).SetSchemaUrl("https://opentelemetry.io/schemas/1.21.0")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "https://opentelemetry.io/schemas/1.21.0", nextRequest(t, requests).header.Get("Ce-Schemaurl"))
+
+	// Resources without schema URL don't get the extension
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.NotContains(t, nextRequest(t, requests).header, "Ce-Schemaurl")
+}
+
+func TestCorrelationIdExtension(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.CorrelationAttribute = "k8s.event.involved_object.uid"
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().
+		PutStr("k8s.event.involved_object.uid", "5d3c1b9e-0b6f-4a4b-9d7e-6b1f0c2a8e11")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "5d3c1b9e-0b6f-4a4b-9d7e-6b1f0c2a8e11", nextRequest(t, requests).header.Get("Ce-Correlationid"))
+
+	// Events without the attribute don't get the extension
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.NotContains(t, nextRequest(t, requests).header, "Ce-Correlationid")
+}
+
+func TestAttributeExtensions(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.AttributeExtensions = []AttributeExtension{
+		{Name: "count", Attribute: "k8s.event.count", Type: EXTENSION_TYPE_INTEGER},
+		{Name: "critical", Attribute: "critical", Type: EXTENSION_TYPE_BOOLEAN},
+		{Name: "team", Attribute: "team"},
+	}
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	attrs := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes()
+	attrs.PutStr("k8s.event.count", "42")
+	attrs.PutBool("critical", true)
+	attrs.PutInt("team", 7)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "42", req.header.Get("Ce-Count"))
+	assert.Equal(t, "true", req.header.Get("Ce-Critical"))
+	assert.Equal(t, "7", req.header.Get("Ce-Team"))
+
+	// Values which can't be coerced are left out
+	ld = testEvents(1, "Created")
+	attrs = ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes()
+	attrs.PutStr("k8s.event.count", "many")
+	attrs.PutStr("critical", "yes")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req = nextRequest(t, requests)
+	assert.NotContains(t, req.header, "Ce-Count")
+	assert.NotContains(t, req.header, "Ce-Critical")
+	assert.NotContains(t, req.header, "Ce-Team")
+}
+
+func TestExtensionsFromAttributes(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ExtensionsFromAttributes = map[string]string{
+		"namespace": ATTR_EVENT_NS,
+		"cluster":   "k8s.cluster.name",
+		"node":      "k8s.node.name",
+	}
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).Resource().Attributes().PutStr("k8s.cluster.name", "prod-eu")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "testns", req.header.Get("Ce-Namespace"))
+	assert.Equal(t, "prod-eu", req.header.Get("Ce-Cluster"))
+	assert.NotContains(t, req.header, "Ce-Node")
+}
+
+func TestAttributeExtensionsStructured(t *testing.T) {
+	ce := &cloudeventdata{uid: "uid", reason: "Created"}
+	ce.setExtension("count", int64(42))
+	ce.setExtension("critical", false)
+	ce.setExtension("team", "7")
+
+	headers, body, err := ce.encodeFor(CONTENT_MODE_STRUCTURED, testConfig())
+	require.NoError(t, err)
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, headers.Get(HEADER_CONTENT_TYPE))
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, float64(42), event["count"])
+	assert.Equal(t, false, event["critical"])
+	assert.Equal(t, "7", event["team"])
+}
+
+func TestBrokerExtensions(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	cfg.BrokerExtensions = []BrokerExtension{
+		{Name: "knativebrokerttl", Value: 255, Attribute: "cloudevents.knativebrokerttl", Decrement: true},
+		{Name: "priority", Value: 3},
+	}
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	// Integers in structured mode, the TTL starts at value without the attribute
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &event))
+	assert.Equal(t, float64(255), event["knativebrokerttl"])
+	assert.Equal(t, float64(3), event["priority"])
+
+	// An event which came through the broker before goes with one less
+	ld := testEvents(1, "Created")
+	attrs := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes()
+	attrs.PutStr("cloudevents.knativebrokerttl", "10")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	require.NoError(t, json.Unmarshal(nextRequest(t, requests).body, &event))
+	assert.Equal(t, float64(9), event["knativebrokerttl"])
+
+	// It's dropped once the TTL runs out
+	attrs.PutInt("cloudevents.knativebrokerttl", 1)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Len(t, requests, 0)
+}
+
+func TestCoerceExtension(t *testing.T) {
+	tests := []struct {
+		name     string
+		val      pcommon.Value
+		extType  string
+		expected interface{}
+		ok       bool
+	}{
+		{"int", pcommon.NewValueInt(42), EXTENSION_TYPE_INTEGER, int64(42), true},
+		{"whole double", pcommon.NewValueDouble(3), EXTENSION_TYPE_INTEGER, int64(3), true},
+		{"fraction double", pcommon.NewValueDouble(3.5), EXTENSION_TYPE_INTEGER, nil, false},
+		{"numeric string", pcommon.NewValueStr(" -12 "), EXTENSION_TYPE_INTEGER, int64(-12), true},
+		{"text string", pcommon.NewValueStr("twelve"), EXTENSION_TYPE_INTEGER, nil, false},
+		{"over int32", pcommon.NewValueInt(1 << 31), EXTENSION_TYPE_INTEGER, nil, false},
+		{"bool as integer", pcommon.NewValueBool(true), EXTENSION_TYPE_INTEGER, nil, false},
+		{"bool", pcommon.NewValueBool(true), EXTENSION_TYPE_BOOLEAN, true, true},
+		{"bool string", pcommon.NewValueStr("false"), EXTENSION_TYPE_BOOLEAN, false, true},
+		{"other string", pcommon.NewValueStr("no"), EXTENSION_TYPE_BOOLEAN, nil, false},
+		{"int as boolean", pcommon.NewValueInt(1), EXTENSION_TYPE_BOOLEAN, nil, false},
+		{"string", pcommon.NewValueStr("team-a"), EXTENSION_TYPE_STRING, "team-a", true},
+		{"int as string", pcommon.NewValueInt(7), "", "7", true},
+		{"bool as string", pcommon.NewValueBool(true), EXTENSION_TYPE_STRING, "true", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val, ok := coerceExtension(tt.val, tt.extType)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, val)
+		})
+	}
+}
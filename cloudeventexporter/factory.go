@@ -3,6 +3,7 @@ package cloudeventexporter
 import (
 	"context"
 	"errors"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
@@ -24,13 +25,55 @@ func NewFactory() exporter.Factory {
 		typeStr,
 		CreateDefaultConfig,
 		exporter.WithLogs(createLogsExporter, stability),
+		exporter.WithTraces(createTracesExporter, stability),
+		exporter.WithMetrics(createMetricsExporter, stability),
 	)
 }
 
 func CreateDefaultConfig() component.Config {
 	return &Config{
 		Ce: CloudEventSpec{
-			SpecVersion: "1.0",
+			SpecVersion: SPEC_VERSION_1_0,
+		},
+		IdStrategy:          ID_STRATEGY_UID,
+		MessageSource:       MESSAGE_SOURCE_BODY,
+		MissingMessage:      MISSING_MESSAGE_EMPTY,
+		EmptyReason:         EMPTY_REASON_PLACEHOLDER,
+		ReasonPlaceholder:   REASON_PLACEHOLDER,
+		SingleLineSeparator: " ",
+		FilterOrder:         FILTER_ORDER_FILTER_THEN_CONVERT,
+		Match:               MATCH_ALL,
+		ContentMode:         CONTENT_MODE_BINARY,
+		Format:              FORMAT_JSON,
+		Transport:           TRANSPORT_HTTP,
+		OnFull:              ON_FULL_BLOCK,
+		Mode:                MODE_K8S_EVENTS,
+		Mapping: MappingSettings{
+			Reason:    ATTR_EVENT_REASON,
+			StartTime: ATTR_EVENT_START_TIME,
+			Name:      ATTR_EVENT_NAME,
+			Namespace: ATTR_EVENT_NS,
+			Count:     ATTR_EVENT_COUNT,
+			UID:       ATTR_EVENT_UID,
+		},
+		SplitEvents: SplitEventsSettings{
+			MessageKey: "message",
+		},
+		Traces: TracesSettings{
+			Source: TRACES_SOURCE_SPAN_EVENTS,
+		},
+		Syslog: SyslogSettings{
+			Network:  SYSLOG_NETWORK_TCP,
+			Facility: 1, // user-level messages
+			AppName:  SYSLOG_APP_NAME,
+		},
+		Batch: BatchSettings{
+			MaxSize:       100,
+			FlushInterval: 5 * time.Second,
+		},
+		// Backoff of throttled events when the server doesn't say how long to wait
+		RetrySettings: exporterhelper.RetrySettings{
+			InitialInterval: 5 * time.Second,
 		},
 	}
 }
@@ -60,3 +103,55 @@ func createLogsExporter(
 		exporterhelper.WithQueue(eCfg.QueueSettings),
 	)
 }
+
+func createTracesExporter(
+	ctx context.Context,
+	set exporter.CreateSettings,
+	cfg component.Config,
+) (exporter.Traces, error) {
+
+	eCfg, ok := cfg.(*Config)
+	if !ok {
+		return nil, errors.New("could not initialize cloud-event transform exporter")
+	}
+
+	ceExporter, err := newSignalExporter(cfg, set, SIGNAL_TRACES)
+	if err != nil {
+		return nil, errors.New("Failed to create cloud-event exporter")
+	}
+
+	return exporterhelper.NewTracesExporter(ctx, set, eCfg, ceExporter.pushTraces,
+		exporterhelper.WithStart(ceExporter.start),
+		exporterhelper.WithShutdown(ceExporter.shutdown),
+		exporterhelper.WithCapabilities(exporterCapabilities),
+		exporterhelper.WithTimeout(exporterhelper.TimeoutSettings{Timeout: 0}),
+		exporterhelper.WithRetry(eCfg.RetrySettings),
+		exporterhelper.WithQueue(eCfg.QueueSettings),
+	)
+}
+
+func createMetricsExporter(
+	ctx context.Context,
+	set exporter.CreateSettings,
+	cfg component.Config,
+) (exporter.Metrics, error) {
+
+	eCfg, ok := cfg.(*Config)
+	if !ok {
+		return nil, errors.New("could not initialize cloud-event transform exporter")
+	}
+
+	ceExporter, err := newSignalExporter(cfg, set, SIGNAL_METRICS)
+	if err != nil {
+		return nil, errors.New("Failed to create cloud-event exporter")
+	}
+
+	return exporterhelper.NewMetricsExporter(ctx, set, eCfg, ceExporter.pushMetrics,
+		exporterhelper.WithStart(ceExporter.start),
+		exporterhelper.WithShutdown(ceExporter.shutdown),
+		exporterhelper.WithCapabilities(exporterCapabilities),
+		exporterhelper.WithTimeout(exporterhelper.TimeoutSettings{Timeout: 0}),
+		exporterhelper.WithRetry(eCfg.RetrySettings),
+		exporterhelper.WithQueue(eCfg.QueueSettings),
+	)
+}
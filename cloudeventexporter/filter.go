@@ -0,0 +1,254 @@
+package cloudeventexporter
+
+import (
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+)
+
+const (
+	// Operators of attribute_filters
+	FILTER_OP_EQUALS   = "equals"
+	FILTER_OP_CONTAINS = "contains"
+	FILTER_OP_REGEX    = "regex"
+	FILTER_OP_EXISTS   = "exists"
+
+	// Derived fields of the event, only known after conversion
+	DERIVED_FIELD_TYPE    = "ce.type"
+	DERIVED_FIELD_SOURCE  = "ce.source"
+	DERIVED_FIELD_ID      = "ce.id"
+	DERIVED_FIELD_MESSAGE = "ce.message"
+
+	// What happens to the events matching an attribute filter
+	FILTER_ACTION_KEEP = "keep"
+	FILTER_ACTION_DROP = "drop"
+)
+
+// Attribute filter with its regex compiled once in newExporter
+type attributeFilter struct {
+	AttributeFilter
+	regex *regexp.Regexp // only for op regex
+}
+
+// Compiles the regexes of the filters, they're already validated so the errors are only for completeness
+func newAttributeFilters(filters []AttributeFilter) ([]attributeFilter, error) {
+	compiled := make([]attributeFilter, 0, len(filters))
+	for _, f := range filters {
+		af := attributeFilter{AttributeFilter: f}
+		if f.Op == FILTER_OP_REGEX {
+			regex, err := regexp.Compile(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			af.regex = regex
+		}
+		compiled = append(compiled, af)
+	}
+	return compiled, nil
+}
+
+/*
+Decides if the record passes the reason filter, the namespace_filter and the attribute_filters. With filter_order convert_then_filter
+the converted event is given as well and the filters can use its derived fields (ce.type, ce.source, ce.id, ce.message)
+*/
+func (e *cloudeventTransformExporter) keepRecord(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs, ce *cloudeventdata) bool {
+	e.filterChecks.Add(1)
+	reason, ok := e.recordFiltersKeep(lr, sl, rl)
+	if !ok {
+		return false
+	}
+
+	lookup := func(key string) (string, bool) {
+		if ce != nil {
+			if val, ok := ce.derivedField(key, e.config); ok {
+				return val, true
+			}
+		}
+		if val, ok := lookupAttr(key, lr, sl, rl); ok {
+			return val.AsString(), true
+		}
+		return "", false
+	}
+
+	if !e.attributeFiltersKeep(lookup) {
+		e.logFilteredSample(lr, reason.AsString())
+		return false
+	}
+
+	return true
+}
+
+/*
+With filter_order convert_then_filter, tells if a record which couldn't be converted would've been dropped by the filters
+anyway, so it doesn't fail the push. Only the filters which don't need the converted event are applied, the attribute_filters
+are left out when any of them is on a derived field.
+*/
+func (e *cloudeventTransformExporter) droppedWithoutConversion(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs) bool {
+	e.filterChecks.Add(1)
+	reason, ok := e.recordFiltersKeep(lr, sl, rl)
+	if !ok {
+		return true
+	}
+
+	for _, f := range e.attributeFilters {
+		if isDerivedField(f.Attribute) {
+			return false
+		}
+	}
+
+	lookup := func(key string) (string, bool) {
+		if val, ok := lookupAttr(key, lr, sl, rl); ok {
+			return val.AsString(), true
+		}
+		return "", false
+	}
+
+	if !e.attributeFiltersKeep(lookup) {
+		e.logFilteredSample(lr, reason.AsString())
+		return true
+	}
+	return false
+}
+
+// Applies the reason filter and the namespace_filter, gives back the reason of the record for the drop logs
+func (e *cloudeventTransformExporter) recordFiltersKeep(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs) (pcommon.Value, bool) {
+	reason, reasonOk := lookupField(e.config.Mapping.Reason, lr, sl, rl)
+
+	// Records without a reason aren't filtered by it
+	if !e.filterAllowAll && reasonOk {
+		reasonFound := false
+		for _, r := range e.filters {
+			if r == reason.AsString() {
+				reasonFound = true
+				break
+			}
+		}
+
+		if !reasonFound {
+			e.logFilteredSample(lr, reason.AsString())
+			return reason, false
+		}
+	}
+
+	// Records without a namespace aren't filtered by it either
+	if e.namespaces != nil {
+		if ns, ok := lookupField(e.config.Mapping.Namespace, lr, sl, rl); ok && !e.namespaces[ns.AsString()] {
+			e.logFilteredSample(lr, reason.AsString())
+			return reason, false
+		}
+	}
+
+	return reason, true
+}
+
+/*
+Combines the attribute filters as per match, the outcome only depends on the order of the filters:
+  - all: every filter is evaluated, the event is kept when all of the keep filters match and none of the drop ones
+  - first: filters are evaluated in order and the first matching one decides, when nothing matches
+    the event is kept only if there are no keep filters (a list of drops lets everything else through)
+*/
+func (e *cloudeventTransformExporter) attributeFiltersKeep(lookup func(key string) (string, bool)) bool {
+	hasKeep := false
+
+	for i := range e.attributeFilters {
+		f := &e.attributeFilters[i]
+		keep := f.Action != FILTER_ACTION_DROP
+		hasKeep = hasKeep || keep
+
+		matched := f.matches(lookup)
+		if e.config.Match == MATCH_FIRST {
+			if matched {
+				return keep
+			}
+			continue
+		}
+
+		if matched != keep {
+			return false
+		}
+	}
+
+	if e.config.Match == MATCH_FIRST {
+		return !hasKeep
+	}
+	return true
+}
+
+// Checks the predicate against the value of its attribute
+func (f *attributeFilter) matches(lookup func(key string) (string, bool)) bool {
+	val, ok := lookup(f.Attribute)
+
+	switch f.Op {
+	case FILTER_OP_EXISTS:
+		return ok
+	case FILTER_OP_EQUALS:
+		return ok && val == f.Value
+	case FILTER_OP_CONTAINS:
+		return ok && strings.Contains(val, f.Value)
+	case FILTER_OP_REGEX:
+		return ok && f.regex.MatchString(val)
+	}
+
+	return false
+}
+
+// Fields of the converted event which can be filtered on with filter_order convert_then_filter
+func (ce *cloudeventdata) derivedField(key string, cfg *Config) (string, bool) {
+	switch key {
+	case DERIVED_FIELD_TYPE:
+		return cfg.ceType(ce.reason), true
+	case DERIVED_FIELD_SOURCE:
+		return ce.sourceOf(cfg), true
+	case DERIVED_FIELD_ID:
+		return ce.id(cfg), true
+	case DERIVED_FIELD_MESSAGE:
+		return ce.message, true
+	}
+	return "", false
+}
+
+func isDerivedField(key string) bool {
+	switch key {
+	case DERIVED_FIELD_TYPE, DERIVED_FIELD_SOURCE, DERIVED_FIELD_ID, DERIVED_FIELD_MESSAGE:
+		return true
+	}
+	return false
+}
+
+// Looks up the attribute in the log record, then in its scope and then in its resource.
+// Some receivers put attributes like k8s.event.reason at scope or resource level.
+func lookupAttr(key string, lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs) (pcommon.Value, bool) {
+	if val, ok := lr.Attributes().Get(key); ok {
+		return val, true
+	}
+	if val, ok := sl.Scope().Attributes().Get(key); ok {
+		return val, true
+	}
+	return rl.Resource().Attributes().Get(key)
+}
+
+// Logs one of every LogFilteredSamples events dropped by the filter, helps in debugging aggressive filters
+func (e *cloudeventTransformExporter) logFilteredSample(lr plog.LogRecord, reason string) {
+	if e.config.LogFilteredSamples == 0 {
+		return
+	}
+
+	dropped := e.filteredCount.Add(1)
+	if dropped%uint64(e.config.LogFilteredSamples) != 0 {
+		return
+	}
+
+	name := ""
+	if eventName, ok := recordField(e.config.Mapping.Name, lr); ok {
+		name = eventName.AsString()
+	}
+
+	e.logger.Info("Event dropped by filter",
+		zap.String("reason", reason),
+		zap.String("name", name),
+		zap.Uint64("dropped_so_far", dropped),
+	)
+}
@@ -0,0 +1,285 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Events named after their namespace, one of them without any namespace
+func namespacedEvents() plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+
+	for _, ns := range []string{"prod", "prod-eu", "staging", ""} {
+		lr := records.AppendEmpty()
+		fillEvent(lr, "Created", "event-"+ns)
+		if ns == "" {
+			lr.Attributes().Remove(ATTR_EVENT_NS)
+		} else {
+			lr.Attributes().PutStr(ATTR_EVENT_NS, ns)
+		}
+	}
+	return ld
+}
+
+// Pushes the logs and returns the names of the events which made it through the filters
+func filteredNames(t *testing.T, cfg *Config, ld plog.Logs) []string {
+	cfg.OptionalCount = true
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	// Missing namespace fails conversion, it's only expected when filters let it through
+	_ = e.pushLogs(context.Background(), ld)
+
+	var names []string
+	for len(e.ceChan) > 0 {
+		names = append(names, (<-e.ceChan).name)
+	}
+	return names
+}
+
+func TestAttributeFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  []AttributeFilter
+		expected []string
+	}{
+		{
+			name:     "equals",
+			filters:  []AttributeFilter{{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_EQUALS, Value: "prod"}},
+			expected: []string{"event-prod"},
+		},
+		{
+			name:     "contains",
+			filters:  []AttributeFilter{{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_CONTAINS, Value: "prod"}},
+			expected: []string{"event-prod", "event-prod-eu"},
+		},
+		{
+			name:     "exists",
+			filters:  []AttributeFilter{{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_EXISTS}},
+			expected: []string{"event-prod", "event-prod-eu", "event-staging"},
+		},
+		{
+			name: "all of them have to match",
+			filters: []AttributeFilter{
+				{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_CONTAINS, Value: "prod"},
+				{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_CONTAINS, Value: "eu"},
+			},
+			expected: []string{"event-prod-eu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.AttributeFilters = tt.filters
+			require.NoError(t, cfg.Validate())
+
+			assert.ElementsMatch(t, tt.expected, filteredNames(t, cfg, namespacedEvents()))
+		})
+	}
+}
+
+func TestAttributeFiltersWithReasonFilter(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Deleted"
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_EXISTS}}
+
+	// Every event passes the attribute filter but none is Deleted
+	assert.Empty(t, filteredNames(t, cfg, namespacedEvents()))
+}
+
+func TestAttributeFiltersMatch(t *testing.T) {
+	keepProd := AttributeFilter{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_REGEX, Value: "^prod"}
+	dropEu := AttributeFilter{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_CONTAINS, Value: "eu", Action: FILTER_ACTION_DROP}
+	dropStaging := AttributeFilter{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_EQUALS, Value: "staging", Action: FILTER_ACTION_DROP}
+
+	tests := []struct {
+		name     string
+		match    string
+		filters  []AttributeFilter
+		expected []string
+	}{
+		{
+			name:     "all, keep before drop",
+			match:    MATCH_ALL,
+			filters:  []AttributeFilter{keepProd, dropEu},
+			expected: []string{"event-prod"},
+		},
+		{
+			name:     "all, drop before keep",
+			match:    MATCH_ALL,
+			filters:  []AttributeFilter{dropEu, keepProd},
+			expected: []string{"event-prod"},
+		},
+		{
+			name:     "first, keep before drop",
+			match:    MATCH_FIRST,
+			filters:  []AttributeFilter{keepProd, dropEu},
+			expected: []string{"event-prod", "event-prod-eu"},
+		},
+		{
+			name:     "first, drop before keep",
+			match:    MATCH_FIRST,
+			filters:  []AttributeFilter{dropEu, keepProd},
+			expected: []string{"event-prod"},
+		},
+		{
+			name:     "all, only drops",
+			match:    MATCH_ALL,
+			filters:  []AttributeFilter{dropStaging, dropEu},
+			expected: []string{"event-prod"},
+		},
+		{
+			name:     "first, only drops",
+			match:    MATCH_FIRST,
+			filters:  []AttributeFilter{dropStaging, dropEu},
+			expected: []string{"event-prod"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Match = tt.match
+			cfg.AttributeFilters = tt.filters
+			require.NoError(t, cfg.Validate())
+
+			// Event without namespace fails conversion when it's let through, it's the last one so it's left out
+			assert.ElementsMatch(t, tt.expected, filteredNames(t, cfg, namespacedEvents()))
+		})
+	}
+}
+
+func TestFilterOrder(t *testing.T) {
+	// Only the events whose type got overridden, a field which doesn't exist before conversion
+	logs := func() plog.Logs {
+		ld := plog.NewLogs()
+		records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+		fillEvent(records.AppendEmpty(), "OOMKilling", "oom")
+		fillEvent(records.AppendEmpty(), "Created", "created")
+		return ld
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{order: FILTER_ORDER_FILTER_THEN_CONVERT, expected: nil},
+		{order: FILTER_ORDER_CONVERT_THEN_FILTER, expected: []string{"oom"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FilterOrder = tt.order
+			cfg.TypeOverrides = map[string]string{"OOMKilling": "com.example.oom"}
+			cfg.AttributeFilters = []AttributeFilter{{Attribute: DERIVED_FIELD_TYPE, Op: FILTER_OP_REGEX, Value: `^com\.example\.`}}
+			require.NoError(t, cfg.Validate())
+
+			assert.Equal(t, tt.expected, filteredNames(t, cfg, logs()))
+		})
+	}
+}
+
+func TestFilterOrderConvertThenFilterReason(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Created"
+	cfg.FilterOrder = FILTER_ORDER_CONVERT_THEN_FILTER
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: ATTR_EVENT_NS, Op: FILTER_OP_CONTAINS, Value: "prod"}}
+
+	// Same outcome as filtering first for the filters on attributes
+	assert.ElementsMatch(t, []string{"event-prod", "event-prod-eu"}, filteredNames(t, cfg, namespacedEvents()))
+}
+
+func TestFilterOrderConvertThenFilterUnconvertible(t *testing.T) {
+	// The event without a namespace can't be converted, the filters drop it before that matters
+	logs := func() plog.Logs {
+		ld := plog.NewLogs()
+		records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+		fillEvent(records.AppendEmpty(), "Created", "created")
+		lr := records.AppendEmpty()
+		fillEvent(lr, "Killing", "killing")
+		lr.Attributes().Remove(ATTR_EVENT_NS)
+		return ld
+	}
+
+	tests := []struct {
+		name   string
+		config func(cfg *Config)
+	}{
+		{
+			name:   "reason filter",
+			config: func(cfg *Config) { cfg.Filter = "Created" },
+		},
+		{
+			name: "attribute filter",
+			config: func(cfg *Config) {
+				cfg.AttributeFilters = []AttributeFilter{{Attribute: ATTR_EVENT_REASON, Op: FILTER_OP_EQUALS, Value: "Killing", Action: FILTER_ACTION_DROP}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.FilterOrder = FILTER_ORDER_CONVERT_THEN_FILTER
+			tt.config(cfg)
+			require.NoError(t, cfg.Validate())
+
+			e, _ := newTestExporter(t, cfg)
+			e.ceChan = make(chan *cloudeventdata, 10)
+			require.NoError(t, e.pushLogs(context.Background(), logs()))
+
+			require.Len(t, e.ceChan, 1)
+			assert.Equal(t, "created", (<-e.ceChan).name)
+		})
+	}
+
+	// A filter on a derived field needs the conversion, the record still fails the push then
+	cfg := testConfig()
+	cfg.FilterOrder = FILTER_ORDER_CONVERT_THEN_FILTER
+	cfg.AttributeFilters = []AttributeFilter{{Attribute: DERIVED_FIELD_TYPE, Op: FILTER_OP_CONTAINS, Value: "Created"}}
+	require.NoError(t, cfg.Validate())
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+	assert.Error(t, e.pushLogs(context.Background(), logs()))
+}
+
+func TestNamespaceFilter(t *testing.T) {
+	cfg := testConfig()
+	cfg.NamespaceFilter = "prod|staging"
+
+	assert.ElementsMatch(t, []string{"event-prod", "event-staging"}, filteredNames(t, cfg, namespacedEvents()))
+}
+
+func TestAllowAllFiltersSkipRecords(t *testing.T) {
+	for _, namespaceFilter := range []string{"", "*"} {
+		cfg := testConfig()
+		cfg.Filter = "*"
+		cfg.NamespaceFilter = namespaceFilter
+
+		e, _ := newTestExporter(t, cfg)
+		e.ceChan = make(chan *cloudeventdata, 10)
+		require.NoError(t, e.pushLogs(context.Background(), testEvents(5, "Created")))
+
+		// Every event gets through without any of them being looked at
+		assert.Len(t, e.ceChan, 5)
+		assert.Equal(t, uint64(0), e.filterChecks.Load())
+	}
+
+	cfg := testConfig()
+	cfg.Filter = "*"
+	cfg.NamespaceFilter = "testns"
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(5, "Created")))
+	assert.Len(t, e.ceChan, 5)
+	assert.Equal(t, uint64(5), e.filterChecks.Load())
+}
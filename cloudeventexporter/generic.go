@@ -0,0 +1,103 @@
+package cloudeventexporter
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+/*
+Converts any log record into a cloud-event with mode generic, nothing is required of it. The body is the data,
+the reason comes from generic.reason_attribute or the severity text and the time is the record's timestamp (its
+observed timestamp without one). The namespace is the one of mapping when the record has it.
+*/
+func toGenericCloudEvent(lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs, cfg *Config) (*cloudeventdata, error) {
+	reason := lr.SeverityText()
+	if cfg.Generic.ReasonAttribute != "" {
+		if val, ok := lookupAttr(cfg.Generic.ReasonAttribute, lr, sl, rl); ok && strings.TrimSpace(val.AsString()) != "" {
+			reason = val.AsString()
+		}
+	}
+	if strings.TrimSpace(reason) == "" {
+		if cfg.EmptyReason == EMPTY_REASON_FAIL {
+			return nil, fmt.Errorf("%w, reason: %q", errEmptyReason, reason)
+		}
+		reason = cfg.ReasonPlaceholder
+	}
+
+	ce := &cloudeventdata{
+		count:   1,
+		reason:  reason,
+		uid:     genericUid(lr, rl),
+		generic: true,
+	}
+
+	body := lr.Body()
+	if body.Type() != pcommon.ValueTypeEmpty {
+		ce.body = body.AsRaw()
+		ce.message = body.AsString()
+	} else {
+		ce.messageMissing = true
+		switch cfg.MissingMessage {
+		case MISSING_MESSAGE_FAIL:
+			return nil, fmt.Errorf("%w, mode: %s", errMissingMessage, MODE_GENERIC)
+		case MISSING_MESSAGE_FALLBACK:
+			ce.body = cfg.MessageFallback
+			ce.message = cfg.MessageFallback
+		}
+	}
+
+	// Invalid sequences of a string body become the replacement character
+	if str, ok := ce.body.(string); ok && !utf8.ValidString(str) {
+		ce.body = strings.ToValidUTF8(str, string(utf8.RuneError))
+		ce.message = ce.body.(string)
+	}
+
+	if ns, ok := lookupField(cfg.Mapping.Namespace, lr, sl, rl); ok {
+		ce.namespace = ns.AsString()
+	}
+
+	timestamp := lr.Timestamp()
+	if timestamp == 0 {
+		timestamp = lr.ObservedTimestamp()
+	}
+	if timestamp != 0 {
+		ce.startTime = timestamp.AsTime().Format(time.RFC3339Nano)
+	}
+
+	ce.applyRecordOptions(lr, sl, rl, cfg)
+
+	// On top of every attribute of the record with include_otel_attributes
+	for _, attribute := range cfg.Generic.Attributes {
+		if val, ok := lookupAttr(attribute, lr, sl, rl); ok {
+			if ce.attributes == nil {
+				ce.attributes = make(map[string]interface{}, len(cfg.Generic.Attributes))
+			}
+			ce.attributes[attribute] = val.AsRaw()
+		}
+	}
+
+	return ce, nil
+}
+
+/*
+Uid of a generic record, which doesn't have one of its own. It's a hash of the record (its resource, timestamps,
+body and attributes) formatted as UUID, so a record sent again, like by a retry upstream, keeps its id.
+*/
+func genericUid(lr plog.LogRecord, rl plog.ResourceLogs) string {
+	record, _ := json.Marshal([]interface{}{
+		rl.Resource().Attributes().AsRaw(),
+		uint64(lr.Timestamp()),
+		uint64(lr.ObservedTimestamp()),
+		lr.Body().AsRaw(),
+		lr.Attributes().AsRaw(),
+	})
+	sum := sha256.Sum256(record)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,152 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Application log record, without any of the k8s event attributes
+func testAppRecord() (plog.LogRecord, plog.ScopeLogs, plog.ResourceLogs) {
+	rl := plog.NewResourceLogs()
+	rl.Resource().Attributes().PutStr("service.name", "checkout")
+	sl := rl.ScopeLogs().AppendEmpty()
+	lr := sl.LogRecords().AppendEmpty()
+	lr.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)))
+	lr.SetSeverityText("ERROR")
+	lr.Body().SetStr("payment declined")
+	lr.Attributes().PutStr("order.id", "42")
+	return lr, sl, rl
+}
+
+func genericConfig() *Config {
+	cfg := testConfig()
+	cfg.Mode = MODE_GENERIC
+	return cfg
+}
+
+func TestGenericCloudEvent(t *testing.T) {
+	lr, sl, rl := testAppRecord()
+	cfg := genericConfig()
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "ERROR", ce.reason)
+	assert.Equal(t, "payment declined", ce.message)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), ce.time)
+
+	data, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `"payment declined"`, string(data))
+
+	// The same record keeps its id, another one gets its own
+	again, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, ce.uid, again.uid)
+	assert.Len(t, ce.uid, 36)
+
+	lr.Body().SetStr("payment accepted")
+	other, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.NotEqual(t, ce.uid, other.uid)
+}
+
+func TestGenericCloudEventAttributes(t *testing.T) {
+	lr, sl, rl := testAppRecord()
+	lr.Body().SetEmptyMap().PutStr("msg", "payment declined")
+	lr.Attributes().PutStr("level", "critical")
+	cfg := genericConfig()
+	cfg.Generic = GenericSettings{ReasonAttribute: "level", Attributes: []string{"order.id", "service.name", "missing"}}
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "critical", ce.reason)
+
+	data, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"body":{"msg":"payment declined"},"attributes":{"order.id":"42","service.name":"checkout"}}`, string(data))
+
+	cfg.DataRootKey = "log"
+	data, err = ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"log":{"body":{"msg":"payment declined"},"attributes":{"order.id":"42","service.name":"checkout"}}}`, string(data))
+}
+
+func TestGenericCloudEventResourceAttributes(t *testing.T) {
+	lr, sl, rl := testAppRecord()
+	cfg := genericConfig()
+	cfg.IncludeResourceAttributes = []string{"service.name"}
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+
+	data, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"body":"payment declined","resource":{"service.name":"checkout"}}`, string(data))
+}
+
+func TestGenericCloudEventMissing(t *testing.T) {
+	lr, sl, rl := testAppRecord()
+	lr.SetSeverityText("")
+	plog.NewLogRecord().Body().CopyTo(lr.Body())
+	cfg := genericConfig()
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, REASON_PLACEHOLDER, ce.reason)
+	assert.True(t, ce.messageMissing)
+	data, err := ce.dataBody(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+
+	cfg.MissingMessage = MISSING_MESSAGE_FAIL
+	_, err = toCloudEvent(lr, sl, rl, cfg)
+	assert.True(t, errors.Is(err, errMissingMessage))
+
+	cfg.MissingMessage = MISSING_MESSAGE_EMPTY
+	cfg.EmptyReason = EMPTY_REASON_FAIL
+	_, err = toCloudEvent(lr, sl, rl, cfg)
+	assert.True(t, errors.Is(err, errEmptyReason))
+}
+
+func TestGenericPushLogs(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	cfg := genericConfig()
+	cfg.Endpoint = server.URL
+	cfg.CorrelationAttribute = "order.id"
+	e, _ := startTestExporter(t, cfg)
+
+	ld := plog.NewLogs()
+	lr, _, rl := testAppRecord()
+	rl.CopyTo(ld.ResourceLogs().AppendEmpty())
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "com.test.event.v1.ERROR", req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "2023-04-01T10:00:00Z", req.header.Get(HEADER_CE_TIME))
+	assert.Equal(t, "42", req.header.Get(HEADER_CE_PREFIX+EXTENSION_CORRELATION_ID))
+	assert.Equal(t, genericUid(lr, rl), req.header.Get(HEADER_CE_ID))
+
+	var data string
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "payment declined", data)
+}
+
+func TestValidateMode(t *testing.T) {
+	cfg := genericConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Generic.Attributes = []string{""}
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Mode = "k8s"
+	assert.Error(t, cfg.Validate())
+}
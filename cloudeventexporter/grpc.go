@@ -0,0 +1,73 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// Publish of the CloudEvents gRPC service, see https://github.com/cloudevents/spec/blob/main/cloudevents/bindings/grpc-protocol-binding.md
+	GRPC_PUBLISH_METHOD = "/io.cloudevents.v1.CloudEventService/Publish"
+
+	// Field number of the event in PublishRequest
+	PROTO_PUBLISH_EVENT protowire.Number = 1
+)
+
+// Codec passing the hand encoded messages through as they are, there's no generated code for the service
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec can't marshal %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec can't unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Same name as the protobuf codec, so the requests go as application/grpc+proto
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+/*
+Publishes the cloud-event in protobuf format to the CloudEvents gRPC service of grpc.endpoint. The call is bound
+by the timeout of the exporter, an unavailable or exhausted service throttles the events like 429/503 do with http.
+*/
+func (e *cloudeventTransformExporter) sendGRPC(client *http.Client, ce *cloudeventdata) error {
+	event, err := ce.structured(e.config)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), client.Timeout)
+	defer cancel()
+
+	req := appendProtoBytes(nil, PROTO_PUBLISH_EVENT, event.protobuf(ce.time))
+	var res []byte
+	err = e.grpcConn.Invoke(ctx, GRPC_PUBLISH_METHOD, &req, &res, grpc.ForceCodec(rawCodec{}))
+	if err == nil {
+		return nil
+	}
+
+	formattedErr := fmt.Errorf("error exporting items, publishing to %s failed: %w", e.config.GRPC.Endpoint, err)
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return &throttledError{err: formattedErr, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return formattedErr
+}
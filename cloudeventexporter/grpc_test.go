@@ -0,0 +1,121 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configgrpc"
+	"go.opentelemetry.io/collector/config/configtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Starts an in-process CloudEvents gRPC service handing over the published events (CloudEvent messages) to the test,
+// every call fails with fail when it's set
+func newGRPCServer(t *testing.T, fail error) (string, chan []byte) {
+	events := make(chan []byte, 100)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		if method != GRPC_PUBLISH_METHOD {
+			return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+		}
+
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if fail != nil {
+			return fail
+		}
+
+		num, typ, n := protowire.ConsumeTag(req)
+		if num != PROTO_PUBLISH_EVENT || typ != protowire.BytesType {
+			return status.Error(codes.InvalidArgument, "no event in the request")
+		}
+		event, m := protowire.ConsumeBytes(req[n:])
+		if m < 0 {
+			return status.Error(codes.InvalidArgument, "malformed event")
+		}
+		events <- event
+
+		empty := []byte{}
+		return stream.SendMsg(&empty)
+	}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis.Addr().String(), events
+}
+
+func grpcConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_GRPC
+	cfg.GRPC = configgrpc.GRPCClientSettings{
+		Endpoint:   endpoint,
+		TLSSetting: configtls.TLSClientSetting{Insecure: true},
+	}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func TestGRPCTransport(t *testing.T) {
+	endpoint, events := newGRPCServer(t, nil)
+
+	cfg := grpcConfig(endpoint)
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "2023-04-01T10:00:00Z")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var body []byte
+	select {
+	case body = <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the cloud-event")
+	}
+
+	event := decodeProtobufEvent(t, body)
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "test-source", event["source"])
+	assert.Equal(t, "1.0", event["spec_version"])
+	assert.Equal(t, "com.test.event.v1.Created", event["type"])
+	assert.Equal(t, map[string]interface{}{"ce_timestamp": "2023-04-01T10:00:00Z"}, event["attributes"].(map[string]interface{})["time"])
+	assert.Contains(t, event["text_data"], `"reason":"Created"`)
+}
+
+func TestGRPCTransportThrottled(t *testing.T) {
+	endpoint, _ := newGRPCServer(t, status.Error(codes.Unavailable, "draining"))
+
+	e, _ := startTestExporter(t, grpcConfig(endpoint))
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "draining")
+
+	var throttled *throttledError
+	assert.ErrorAs(t, e.sendGRPC(e.client, &cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+}
+
+func TestValidateGRPC(t *testing.T) {
+	cfg := grpcConfig("")
+	assert.Error(t, cfg.Validate())
+
+	cfg.GRPC.Endpoint = "localhost:4317"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+}
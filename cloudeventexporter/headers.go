@@ -0,0 +1,46 @@
+package cloudeventexporter
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.uber.org/zap"
+)
+
+/*
+Adds the headers of the HTTP settings to the requests in place of confighttp, which would override the headers
+of the request with them. A configured header the request already has is left out, so the event's Ce-* attributes
+and the endpoint's own headers (endpoints[i].headers, bearer_token, auth) always win. A warning is logged the first
+time a Ce-* header collides, the endpoint's headers are meant to take over the global ones.
+*/
+type configuredHeaders struct {
+	next    http.RoundTripper
+	headers map[string]configopaque.String
+	logger  *zap.Logger
+	warned  sync.Map // Ce-* headers whose collision is already logged
+}
+
+func newConfiguredHeaders(next http.RoundTripper, headers map[string]configopaque.String, logger *zap.Logger) *configuredHeaders {
+	return &configuredHeaders{next: next, headers: headers, logger: logger}
+}
+
+func (h *configuredHeaders) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, val := range h.headers {
+		canonical := http.CanonicalHeaderKey(key)
+		if req.Header.Get(canonical) == "" {
+			req.Header.Set(key, string(val))
+			continue
+		}
+
+		if strings.HasPrefix(canonical, HEADER_CE_PREFIX) {
+			if _, warned := h.warned.LoadOrStore(canonical, true); !warned {
+				h.logger.Warn("Configured header collides with the cloud-event's, the cloud-event's value is sent",
+					zap.String("header", canonical))
+			}
+		}
+	}
+	return h.next.RoundTrip(req)
+}
@@ -0,0 +1,77 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configopaque"
+)
+
+func TestConfiguredHeadersCollision(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Headers = map[string]configopaque.String{
+		"ce-type":   "com.example.overridden",
+		"Ce-Tenant": "team-a",
+		"X-Api-Key": "secret",
+	}
+	cfg.SyncSend = true
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(2, "Created")))
+
+	for i := 0; i < 2; i++ {
+		req := nextRequest(t, requests)
+		assert.Equal(t, "com.test.event.v1.Created", req.header.Get(HEADER_CE_TYPE))
+		assert.Equal(t, []string{"com.test.event.v1.Created"}, req.header.Values(HEADER_CE_TYPE))
+
+		// Headers the event doesn't have are sent as configured
+		assert.Equal(t, "team-a", req.header.Get("Ce-Tenant"))
+		assert.Equal(t, "secret", req.header.Get("X-Api-Key"))
+	}
+
+	// Logged once, not for every request
+	entries := logs.FilterMessage("Configured header collides with the cloud-event's, the cloud-event's value is sent").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, HEADER_CE_TYPE, entries[0].ContextMap()["header"])
+}
+
+func TestConfiguredHeadersEndpointWins(t *testing.T) {
+	tokenServer, tokenRequests := newCaptureServer(t)
+	headerServer, headerRequests := newCaptureServer(t)
+	plainServer, plainRequests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Headers = map[string]configopaque.String{
+		HEADER_AUTHORIZATION: "Bearer global",
+		"X-Tenant":           "global",
+	}
+	cfg.Endpoints = []EndpointSettings{
+		{Endpoint: tokenServer.URL, BearerToken: "token-a"},
+		{Endpoint: headerServer.URL, Headers: map[string]configopaque.String{"X-Tenant": "b"}},
+		{Endpoint: plainServer.URL},
+	}
+	cfg.Delivery = DELIVERY_FANOUT
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	req := nextRequest(t, tokenRequests)
+	assert.Equal(t, "Bearer token-a", req.header.Get(HEADER_AUTHORIZATION))
+	assert.Equal(t, "global", req.header.Get("X-Tenant"))
+
+	req = nextRequest(t, headerRequests)
+	assert.Equal(t, "Bearer global", req.header.Get(HEADER_AUTHORIZATION))
+	assert.Equal(t, "b", req.header.Get("X-Tenant"))
+
+	// Endpoints without headers of their own get the global ones
+	req = nextRequest(t, plainRequests)
+	assert.Equal(t, "Bearer global", req.header.Get(HEADER_AUTHORIZATION))
+	assert.Equal(t, "global", req.header.Get("X-Tenant"))
+}
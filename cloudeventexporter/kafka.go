@@ -0,0 +1,123 @@
+package cloudeventexporter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+const (
+	// Kafka binding names the attribute headers ce_<name> and keeps content-type as is,
+	// see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md
+	KAFKA_HEADER_PREFIX       = "ce_"
+	KAFKA_HEADER_CONTENT_TYPE = "content-type"
+
+	KAFKA_SASL_PLAIN         = "PLAIN"
+	KAFKA_SASL_SCRAM_SHA_256 = "SCRAM-SHA-256"
+	KAFKA_SASL_SCRAM_SHA_512 = "SCRAM-SHA-512"
+)
+
+// Creates the producer of the kafka transport, the brokers are reached right away for the metadata of the topic
+func newKafkaProducer(cfg *KafkaSettings, timeout time.Duration) (sarama.SyncProducer, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true // the sync producer waits for them
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Timeout = timeout
+	// The exporter retries the failed events itself
+	config.Producer.Retry.Max = 0
+
+	if cfg.ProtocolVersion != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.ProtocolVersion)
+		if err != nil {
+			return nil, err
+		}
+		config.Version = version
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if cfg.SASL != nil {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = cfg.SASL.Username
+		config.Net.SASL.Password = string(cfg.SASL.Password)
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(cfg.SASL.Mechanism)
+		switch cfg.SASL.Mechanism {
+		case KAFKA_SASL_SCRAM_SHA_256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: scram.SHA256} }
+		case KAFKA_SASL_SCRAM_SHA_512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: scram.SHA512} }
+		}
+	}
+
+	return sarama.NewSyncProducer(cfg.Brokers, config)
+}
+
+// SCRAM conversation of the SASL handshake with the brokers
+type scramClient struct {
+	*scram.ClientConversation
+	hashGen scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hashGen.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+/*
+Headers of the Kafka record, the Ce-* headers of binary mode become ce_<name> (ce_id, ce_type...) and
+Content-Type content-type. Structured mode has only content-type.
+*/
+func kafkaHeaders(headers http.Header) []sarama.RecordHeader {
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for key := range headers {
+		name := strings.ToLower(key)
+		if strings.HasPrefix(name, strings.ToLower(HEADER_CE_PREFIX)) {
+			name = KAFKA_HEADER_PREFIX + strings.TrimPrefix(name, strings.ToLower(HEADER_CE_PREFIX))
+		}
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(name), Value: []byte(headers.Get(key))})
+	}
+	return recordHeaders
+}
+
+/*
+Publishes the cloud-event to kafka.topic in the configured content mode, bound by the timeout of the exporter.
+Brokers which are out of reach or lacking replicas throttle the events like 429/503 do with http.
+*/
+func (e *cloudeventTransformExporter) sendKafka(ce *cloudeventdata) error {
+	headers, body, err := ce.encodeFor(e.config.ContentMode, e.config)
+	if err != nil {
+		return err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:   e.config.Kafka.Topic,
+		Key:     sarama.StringEncoder(ce.recordKey()),
+		Value:   sarama.ByteEncoder(body),
+		Headers: kafkaHeaders(headers),
+	}
+	if _, _, err = e.kafka.SendMessage(msg); err == nil {
+		return nil
+	}
+
+	formattedErr := fmt.Errorf("error exporting items, publishing to %s failed: %w", e.config.Kafka.Topic, err)
+	if errors.Is(err, sarama.ErrOutOfBrokers) || errors.Is(err, sarama.ErrLeaderNotAvailable) || errors.Is(err, sarama.ErrNotEnoughReplicas) {
+		return &throttledError{err: formattedErr, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return formattedErr
+}
@@ -0,0 +1,166 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+)
+
+func kafkaConfig() *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_KAFKA
+	cfg.Kafka = KafkaSettings{Brokers: []string{"localhost:9092"}, Topic: "k8s-events"}
+	cfg.SyncSend = true
+	return cfg
+}
+
+// Starts the exporter with a mock producer handing over the sent records to the test, every send fails with fail when it's set
+func startKafkaExporter(t *testing.T, cfg *Config, sends int, fail error) (*cloudeventTransformExporter, chan *sarama.ProducerMessage) {
+	producer := mocks.NewSyncProducer(t, nil)
+	messages := make(chan *sarama.ProducerMessage, 100)
+	for i := 0; i < sends; i++ {
+		if fail != nil {
+			producer.ExpectSendMessageAndFail(fail)
+			continue
+		}
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			messages <- msg
+			return nil
+		})
+	}
+
+	e, _ := newTestExporter(t, cfg)
+	e.kafka = producer
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	return e, messages
+}
+
+func nextKafkaMessage(t *testing.T, messages chan *sarama.ProducerMessage) (key string, value []byte, headers map[string]string) {
+	select {
+	case msg := <-messages:
+		keyBytes, err := msg.Key.Encode()
+		require.NoError(t, err)
+		value, err = msg.Value.Encode()
+		require.NoError(t, err)
+		headers = make(map[string]string, len(msg.Headers))
+		for _, header := range msg.Headers {
+			headers[string(header.Key)] = string(header.Value)
+		}
+		assert.Equal(t, "k8s-events", msg.Topic)
+		return string(keyBytes), value, headers
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the kafka record")
+	}
+	return "", nil, nil
+}
+
+func TestKafkaTransportBinary(t *testing.T) {
+	cfg := kafkaConfig()
+	cfg.Kafka.PartitionKeyAttribute = ATTR_EVENT_NS
+	require.NoError(t, cfg.Validate())
+
+	e, messages := startKafkaExporter(t, cfg, 1, nil)
+
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "2023-04-01T10:00:00Z")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	key, value, headers := nextKafkaMessage(t, messages)
+	assert.Equal(t, "testns", key)
+	assert.Equal(t, "uid-pod", headers["ce_id"])
+	assert.Equal(t, "test-source", headers["ce_source"])
+	assert.Equal(t, "1.0", headers["ce_specversion"])
+	assert.Equal(t, "com.test.event.v1.Created", headers["ce_type"])
+	assert.Equal(t, "2023-04-01T10:00:00Z", headers["ce_time"])
+	assert.Equal(t, CONTENT_TYPE, headers[KAFKA_HEADER_CONTENT_TYPE])
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(value, &data))
+	assert.Equal(t, "Created", data["reason"])
+}
+
+func TestKafkaTransportStructured(t *testing.T) {
+	cfg := kafkaConfig()
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+
+	e, messages := startKafkaExporter(t, cfg, 1, nil)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// Keyed by the uid without a partition key attribute
+	key, value, headers := nextKafkaMessage(t, messages)
+	assert.Equal(t, "uid-pod", key)
+	assert.Equal(t, map[string]string{KAFKA_HEADER_CONTENT_TYPE: CONTENT_TYPE_STRUCTURED}, headers)
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(value, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "com.test.event.v1.Created", event["type"])
+}
+
+func TestKafkaTransportThrottled(t *testing.T) {
+	e, _ := startKafkaExporter(t, kafkaConfig(), 2, sarama.ErrOutOfBrokers)
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "k8s-events")
+
+	var throttled *throttledError
+	assert.ErrorAs(t, e.sendKafka(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+}
+
+func TestKafkaProducer(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("k8s-events", 0, broker.BrokerID()),
+		// Produce requests of the default protocol_version, 1.0.0, are v3
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	cfg := kafkaConfig()
+	cfg.Kafka.Brokers = []string{broker.Addr()}
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+}
+
+func TestValidateKafka(t *testing.T) {
+	cfg := kafkaConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Kafka.ProtocolVersion = "2.0.0"
+	assert.NoError(t, cfg.Validate())
+	cfg.Kafka.ProtocolVersion = "latest"
+	assert.Error(t, cfg.Validate())
+	cfg.Kafka.ProtocolVersion = ""
+
+	cfg.Kafka.SASL = &KafkaSASLSettings{Mechanism: KAFKA_SASL_SCRAM_SHA_512, Username: "exporter", Password: "secret"}
+	assert.NoError(t, cfg.Validate())
+	cfg.Kafka.SASL.Mechanism = "GSSAPI"
+	assert.Error(t, cfg.Validate())
+	cfg.Kafka.SASL = &KafkaSASLSettings{Mechanism: KAFKA_SASL_PLAIN}
+	assert.Error(t, cfg.Validate())
+	cfg.Kafka.SASL = nil
+
+	cfg.Kafka.Topic = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Kafka.Brokers = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+}
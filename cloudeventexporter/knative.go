@@ -0,0 +1,169 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// API server as seen from the collector's pod, authenticated with its service account
+	KUBERNETES_API_SERVER      = "https://kubernetes.default.svc"
+	KUBERNETES_SERVICE_ACCOUNT = "/var/run/secrets/kubernetes.io/serviceaccount"
+	KNATIVE_BROKERS_PATH       = "/apis/eventing.knative.dev/v1/namespaces/%s/brokers/%s"
+	KNATIVE_RESOLVE_TIMEOUT    = 10 * time.Second
+
+	// Largest reply event forwarded to reply.endpoint, larger ones are dropped
+	MAX_REPLY_BODY = 1 << 20
+)
+
+// Addressable status of the broker, its ingress URL is there once it's ready
+type knativeBroker struct {
+	Status struct {
+		Address struct {
+			URL string `json:"url"`
+		} `json:"address"`
+	} `json:"status"`
+}
+
+// Client of the API server, trusting the cluster's CA and sending the service account's token when they're mounted
+func kubernetesClient(serviceAccount string) (*http.Client, string, error) {
+	client := &http.Client{Timeout: KNATIVE_RESOLVE_TIMEOUT}
+
+	token, err := os.ReadFile(serviceAccount + "/token")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+
+	ca, err := os.ReadFile(serviceAccount + "/ca.crt")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, "", err
+	}
+	if len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, "", fmt.Errorf("couldn't parse the CA of %s", serviceAccount)
+		}
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+	}
+	return client, strings.TrimSpace(string(token)), nil
+}
+
+/*
+Resolves the ingress URL of the Knative Broker from its Addressable status (status.address.url), read from the
+API server with the collector's service account which needs get on brokers.eventing.knative.dev. A broker which
+isn't ready yet doesn't have the URL, so it fails the start rather than sending the events nowhere.
+*/
+func resolveKnativeBroker(cfg *KnativeBrokerSettings, serviceAccount string) (string, error) {
+	client, token, err := kubernetesClient(serviceAccount)
+	if err != nil {
+		return "", err
+	}
+
+	apiServer := cfg.APIServer
+	if apiServer == "" {
+		apiServer = KUBERNETES_API_SERVER
+	}
+	brokerURL := strings.TrimSuffix(apiServer, "/") + fmt.Sprintf(KNATIVE_BROKERS_PATH, cfg.Namespace, cfg.Name)
+
+	req, err := http.NewRequest(http.MethodGet, brokerURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set(HEADER_AUTHORIZATION, "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("request to %s responded with HTTP Status Code %d: %s", brokerURL, res.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var broker knativeBroker
+	if err = json.Unmarshal(body, &broker); err != nil {
+		return "", fmt.Errorf("couldn't parse the broker %s/%s: %w", cfg.Namespace, cfg.Name, err)
+	}
+	if broker.Status.Address.URL == "" {
+		return "", fmt.Errorf("broker %s/%s doesn't have an address, it isn't ready", cfg.Namespace, cfg.Name)
+	}
+	return broker.Status.Address.URL, nil
+}
+
+// Whether the response of an endpoint is a reply event, in binary (Ce-Id) or structured mode
+func isReplyEvent(res *http.Response) bool {
+	return res.Header.Get(HEADER_CE_ID) != "" || strings.HasPrefix(res.Header.Get(HEADER_CONTENT_TYPE), CONTENT_TYPE_STRUCTURED)
+}
+
+/*
+Forwards the reply event of the endpoint to reply.endpoint as it is, its Ce-* headers, content type and body
+(encoding included), without reply.endpoint it's logged at debug and dropped. The event it replies to was
+delivered, so a reply which can't be forwarded is only logged and isn't retried.
+*/
+func (e *cloudeventTransformExporter) routeReply(req *http.Request, res *http.Response) {
+	replyID := res.Header.Get(HEADER_CE_ID)
+	logger := e.logger.With(zap.String("endpoint", req.URL.String()), zap.String("id", replyID),
+		zap.String("type", res.Header.Get(HEADER_CE_TYPE)))
+	if e.config.Reply.Endpoint == "" {
+		logger.Debug("Reply event of the endpoint dropped")
+		return
+	}
+
+	if err := e.forwardReply(res); err != nil {
+		logger.Warn("Couldn't forward the reply event of the endpoint", zap.Error(err))
+		return
+	}
+	logger.Debug("Reply event of the endpoint forwarded")
+}
+
+func (e *cloudeventTransformExporter) forwardReply(res *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(res.Body, MAX_REPLY_BODY+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > MAX_REPLY_BODY {
+		return fmt.Errorf("the reply is larger than %d bytes", MAX_REPLY_BODY)
+	}
+
+	fwd, err := http.NewRequest(http.MethodPost, e.config.Reply.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range res.Header {
+		if strings.HasPrefix(key, HEADER_CE_PREFIX) || key == HEADER_CONTENT_TYPE || key == HEADER_CONTENT_ENCODING {
+			fwd.Header[key] = values
+		}
+	}
+
+	// Not through doRequest, a reply of reply.endpoint isn't forwarded again
+	fwdRes, err := e.replyClient.Do(fwd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, fwdRes.Body)
+		fwdRes.Body.Close()
+	}()
+	if fwdRes.StatusCode < 200 || fwdRes.StatusCode > 299 {
+		return fmt.Errorf("%s responded with HTTP Status Code %d", e.config.Reply.Endpoint, fwdRes.StatusCode)
+	}
+	return nil
+}
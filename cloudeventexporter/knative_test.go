@@ -0,0 +1,155 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configopaque"
+)
+
+// Fake API server with the broker k8s/default, ready when its address is set
+func newKnativeAPIServer(t *testing.T, address string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/eventing.knative.dev/v1/namespaces/k8s/brokers/default" {
+			http.Error(w, `{"kind":"Status","reason":"NotFound"}`, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"apiVersion":"eventing.knative.dev/v1","kind":"Broker","status":{"address":{"url":"` + address + `"}}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestKnativeBroker(t *testing.T) {
+	broker, requests := newCaptureServer(t)
+	apiServer := newKnativeAPIServer(t, broker.URL)
+
+	cfg := testConfig()
+	cfg.KnativeBroker = KnativeBrokerSettings{Namespace: "k8s", Name: "default", APIServer: apiServer.URL}
+	cfg.PartitioningAttribute = "k8s.event.involved_object.uid"
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().
+		PutStr("k8s.event.involved_object.uid", "5d3c1b9e-0b6f-4a4b-9d7e-6b1f0c2a8e11")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "5d3c1b9e-0b6f-4a4b-9d7e-6b1f0c2a8e11", nextRequest(t, requests).header.Get("Ce-Partitionkey"))
+
+	// Events without the attribute don't get the extension
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.NotContains(t, nextRequest(t, requests).header, "Ce-Partitionkey")
+}
+
+func TestResolveKnativeBroker(t *testing.T) {
+	apiServer := newKnativeAPIServer(t, "http://broker-ingress.knative-eventing.svc.cluster.local/k8s/default")
+
+	url, err := resolveKnativeBroker(&KnativeBrokerSettings{Namespace: "k8s", Name: "default", APIServer: apiServer.URL}, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "http://broker-ingress.knative-eventing.svc.cluster.local/k8s/default", url)
+
+	_, err = resolveKnativeBroker(&KnativeBrokerSettings{Namespace: "k8s", Name: "missing", APIServer: apiServer.URL}, t.TempDir())
+	assert.ErrorContains(t, err, "404")
+
+	// Not ready yet
+	notReady := newKnativeAPIServer(t, "")
+	_, err = resolveKnativeBroker(&KnativeBrokerSettings{Namespace: "k8s", Name: "default", APIServer: notReady.URL}, t.TempDir())
+	assert.ErrorContains(t, err, "isn't ready")
+}
+
+func TestReplyEventDropped(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_CE_ID, "reply-1")
+		w.Header().Set(HEADER_CE_TYPE, "com.example.reply")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(sink.Close)
+
+	cfg := testConfig()
+	cfg.Endpoint = sink.URL
+	cfg.SyncSend = true
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	replies := logs.FilterMessage("Reply event of the endpoint dropped").All()
+	require.Len(t, replies, 1)
+	assert.Equal(t, "reply-1", replies[0].ContextMap()["id"])
+	assert.Equal(t, "com.example.reply", replies[0].ContextMap()["type"])
+}
+
+func TestReplyEventForwarded(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_CE_ID, "reply-1")
+		w.Header().Set(HEADER_CE_TYPE, "com.example.reply")
+		w.Header().Set(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"handled":true}`))
+	}))
+	t.Cleanup(sink.Close)
+	replies, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = sink.URL
+	cfg.Headers = map[string]configopaque.String{"Authorization": "Bearer sink-token"}
+	cfg.Reply = ReplySettings{Endpoint: replies.URL}
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	// The reply goes as it is, without the credentials of the sink
+	req := nextRequest(t, requests)
+	assert.Equal(t, "reply-1", req.header.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.example.reply", req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, CONTENT_TYPE, req.header.Get(HEADER_CONTENT_TYPE))
+	assert.Empty(t, req.header.Get("Authorization"))
+	assert.JSONEq(t, `{"handled":true}`, string(req.body))
+}
+
+func TestReplyEventNotForwarded(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HEADER_CE_ID, "reply-1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(sink.Close)
+	replies := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(replies.Close)
+
+	cfg := testConfig()
+	cfg.Endpoint = sink.URL
+	cfg.Reply = ReplySettings{Endpoint: replies.URL}
+	cfg.SyncSend = true
+
+	// The event was delivered, only the reply is lost
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Len(t, logs.FilterMessage("Couldn't forward the reply event of the endpoint").All(), 1)
+}
+
+func TestValidateKnativeBroker(t *testing.T) {
+	cfg := testConfig()
+	cfg.KnativeBroker = KnativeBrokerSettings{Namespace: "k8s", Name: "default"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.KnativeBroker.Name = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg.KnativeBroker.Name = "default"
+	cfg.Endpoint = "http://localhost:8080"
+	assert.Error(t, cfg.Validate())
+
+	cfg.Endpoint = ""
+	cfg.Transport = TRANSPORT_SYSLOG
+	cfg.Syslog.Endpoint = "localhost:514"
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,43 @@
+package cloudeventexporter
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Prefix of the mapping values which are fields of the record's body instead of attributes, like body.object.reason
+const MAPPING_BODY_PREFIX = "body."
+
+// Value at the dot separated path of the body, like object.reason of the records of the k8sobjects receiver
+func bodyField(body pcommon.Value, path string) (pcommon.Value, bool) {
+	val := body
+	for _, key := range strings.Split(path, ".") {
+		if val.Type() != pcommon.ValueTypeMap {
+			return pcommon.Value{}, false
+		}
+		next, ok := val.Map().Get(key)
+		if !ok {
+			return pcommon.Value{}, false
+		}
+		val = next
+	}
+	return val, true
+}
+
+// Looks up a field of mapping, in the body for the body.<path> ones and in the log record's attributes otherwise
+func recordField(key string, lr plog.LogRecord) (pcommon.Value, bool) {
+	if strings.HasPrefix(key, MAPPING_BODY_PREFIX) {
+		return bodyField(lr.Body(), strings.TrimPrefix(key, MAPPING_BODY_PREFIX))
+	}
+	return lr.Attributes().Get(key)
+}
+
+// Like recordField, though an attribute is looked up in the log record, then in its scope and then in its resource
+func lookupField(key string, lr plog.LogRecord, sl plog.ScopeLogs, rl plog.ResourceLogs) (pcommon.Value, bool) {
+	if strings.HasPrefix(key, MAPPING_BODY_PREFIX) {
+		return bodyField(lr.Body(), strings.TrimPrefix(key, MAPPING_BODY_PREFIX))
+	}
+	return lookupAttr(key, lr, sl, rl)
+}
@@ -0,0 +1,93 @@
+package cloudeventexporter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestMappingAttributes(t *testing.T) {
+	rl := plog.NewResourceLogs()
+	sl := rl.ScopeLogs().AppendEmpty()
+	lr := sl.LogRecords().AppendEmpty()
+	lr.Body().SetStr("Back-off restarting failed container")
+	attrs := lr.Attributes()
+	attrs.PutStr("my.reason", "BackOff")
+	attrs.PutStr("my.time", "2023-04-01T10:00:00Z")
+	attrs.PutStr("my.name", "pod")
+	attrs.PutStr("my.ns", "testns")
+	attrs.PutInt("my.count", 4)
+	attrs.PutStr("my.uid", "uid-pod")
+
+	cfg := testConfig()
+	cfg.Mapping = MappingSettings{Reason: "my.reason", StartTime: "my.time", Name: "my.name", Namespace: "my.ns", Count: "my.count", UID: "my.uid"}
+	require.NoError(t, cfg.Validate())
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "BackOff", ce.reason)
+	assert.Equal(t, "pod", ce.name)
+	assert.Equal(t, "testns", ce.namespace)
+	assert.Equal(t, 4, ce.count)
+	assert.Equal(t, "uid-pod", ce.uid)
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), ce.time)
+
+	// The default k8s.event.* attributes aren't looked at anymore, the missing ones are reported by their mapping
+	attrs.Remove("my.uid")
+	attrs.PutStr(ATTR_EVENT_UID, "uid-pod")
+	_, err = toCloudEvent(lr, sl, rl, cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "{my.uid}")
+}
+
+func TestMappingBodyFields(t *testing.T) {
+	// Watch records of the k8sobjects receiver carry the event object in their body
+	rl := plog.NewResourceLogs()
+	sl := rl.ScopeLogs().AppendEmpty()
+	lr := sl.LogRecords().AppendEmpty()
+	object := lr.Body().SetEmptyMap().PutEmptyMap("object")
+	object.PutStr("reason", "Scheduled")
+	object.PutStr("firstTimestamp", "2023-04-01T10:00:00Z")
+	object.PutInt("count", 2)
+	metadata := object.PutEmptyMap("metadata")
+	metadata.PutStr("uid", "uid-event")
+	metadata.PutStr("namespace", "testns")
+	object.PutEmptyMap("involvedObject").PutStr("name", "pod")
+
+	cfg := testConfig()
+	cfg.Mapping = MappingSettings{
+		Reason:    "body.object.reason",
+		StartTime: "body.object.firstTimestamp",
+		Name:      "body.object.involvedObject.name",
+		Namespace: "body.object.metadata.namespace",
+		Count:     "body.object.count",
+		UID:       "body.object.metadata.uid",
+	}
+	require.NoError(t, cfg.Validate())
+
+	ce, err := toCloudEvent(lr, sl, rl, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "Scheduled", ce.reason)
+	assert.Equal(t, "pod", ce.name)
+	assert.Equal(t, "testns", ce.namespace)
+	assert.Equal(t, 2, ce.count)
+	assert.Equal(t, "uid-event", ce.uid)
+	assert.Equal(t, "2023-04-01T10:00:00Z", ce.startTime)
+
+	// A path through something which isn't a map isn't there
+	_, ok := bodyField(lr.Body(), "object.reason.code")
+	assert.False(t, ok)
+}
+
+func TestValidateMapping(t *testing.T) {
+	cfg := testConfig()
+	cfg.Mapping.Reason = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Mapping.UID = MAPPING_BODY_PREFIX
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,223 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.uber.org/zap"
+)
+
+const (
+	// Name of the meter every metric of the exporter is created with
+	METER_NAME = "github.com/hv/akash.chandra/cloudeventtransform"
+
+	METRIC_EVENT_LATENCY = "cloudevent_exporter_event_latency"
+	METRIC_EMPTY_BATCHES = "cloudevent_exporter_empty_batches"
+
+	METRIC_MISSING_MESSAGES = "cloudevent_exporter_missing_messages"
+	METRIC_EXPIRED_EVENTS   = "cloudevent_exporter_expired_events"
+
+	METRIC_PERMANENT_FAILURES = "cloudevent_exporter_permanent_failures"
+
+	// Funnel of the pushed records with batch_summary
+	METRIC_RECORDS_RECEIVED  = "cloudevent_exporter_records_received"
+	METRIC_RECORDS_FILTERED  = "cloudevent_exporter_records_filtered"
+	METRIC_RECORDS_CONVERTED = "cloudevent_exporter_records_converted"
+	METRIC_RECORDS_ENQUEUED  = "cloudevent_exporter_records_enqueued"
+
+	// Every metric has the signal the exporter consumes, so the signals it may consume are told apart
+	METRIC_ATTR_SIGNAL = "signal"
+	SIGNAL_LOGS        = "logs"
+	SIGNAL_TRACES      = "traces"
+	SIGNAL_METRICS     = "metrics"
+)
+
+/*
+Instruments reported through the collector's telemetry. Embedded and test usage can come without a meter
+provider, the instruments are nil then and recording them is a no-op, so use the methods below instead of
+the instruments directly.
+*/
+type exporterMetrics struct {
+	eventLatency instrument.Float64Histogram // seconds from the event's start time till it got delivered
+	emptyBatches instrument.Int64Counter     // pushed logs without any record, only with count_empty_batches
+
+	missingMessages instrument.Int64Counter // records without any message in message_source
+	expiredEvents   instrument.Int64Counter // events skipped as their deadline_attribute passed before sending
+
+	permanentFailures instrument.Int64Counter // requests rejected with 413 Payload Too Large, retrying them is pointless
+
+	recordsReceived  instrument.Int64Counter // records of the pushed logs, only with batch_summary
+	recordsFiltered  instrument.Int64Counter // records dropped by the filters
+	recordsConverted instrument.Int64Counter // records converted into cloud-events
+	recordsEnqueued  instrument.Int64Counter // cloud-events handed to the workers, or sent with sync_send
+
+	attrs []attribute.KeyValue // recorded with every measurement
+}
+
+// Funnel of a single pushLogs, the records which didn't make it to the next stage were dropped
+// (quarantined, duplicates, rate limited...) or failed the logs
+type batchSummary struct {
+	received  int
+	filtered  int
+	converted int
+	enqueued  int
+}
+
+func newExporterMetrics(provider metric.MeterProvider, signal string) (*exporterMetrics, error) {
+	attrs := []attribute.KeyValue{attribute.String(METRIC_ATTR_SIGNAL, signal)}
+	if provider == nil {
+		return &exporterMetrics{attrs: attrs}, nil
+	}
+	meter := provider.Meter(METER_NAME)
+
+	eventLatency, err := meter.Float64Histogram(METRIC_EVENT_LATENCY,
+		instrument.WithDescription("Time from the event's k8s.event.start_time till it got delivered"),
+		instrument.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	emptyBatches, err := meter.Int64Counter(METRIC_EMPTY_BATCHES,
+		instrument.WithDescription("Logs pushed to the exporter without any record"))
+	if err != nil {
+		return nil, err
+	}
+
+	missingMessages, err := meter.Int64Counter(METRIC_MISSING_MESSAGES,
+		instrument.WithDescription("Records without any message, as opposed to an empty one, in message_source"))
+	if err != nil {
+		return nil, err
+	}
+
+	expiredEvents, err := meter.Int64Counter(METRIC_EXPIRED_EVENTS,
+		instrument.WithDescription("Events skipped as their deadline passed before they could be sent"))
+	if err != nil {
+		return nil, err
+	}
+
+	permanentFailures, err := meter.Int64Counter(METRIC_PERMANENT_FAILURES,
+		instrument.WithDescription("Requests the endpoint rejected for good (413 Payload Too Large), they aren't retried"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsReceived, err := meter.Int64Counter(METRIC_RECORDS_RECEIVED,
+		instrument.WithDescription("Records of the logs pushed to the exporter"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsFiltered, err := meter.Int64Counter(METRIC_RECORDS_FILTERED,
+		instrument.WithDescription("Records dropped by filter, namespace_filter or attribute_filters"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsConverted, err := meter.Int64Counter(METRIC_RECORDS_CONVERTED,
+		instrument.WithDescription("Records converted into cloud-events"))
+	if err != nil {
+		return nil, err
+	}
+
+	recordsEnqueued, err := meter.Int64Counter(METRIC_RECORDS_ENQUEUED,
+		instrument.WithDescription("Cloud-events handed over for sending"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &exporterMetrics{
+		eventLatency:      eventLatency,
+		emptyBatches:      emptyBatches,
+		missingMessages:   missingMessages,
+		expiredEvents:     expiredEvents,
+		permanentFailures: permanentFailures,
+		recordsReceived:   recordsReceived,
+		recordsFiltered:   recordsFiltered,
+		recordsConverted:  recordsConverted,
+		recordsEnqueued:   recordsEnqueued,
+		attrs:             attrs,
+	}, nil
+}
+
+func (m *exporterMetrics) addEmptyBatch(ctx context.Context) {
+	if m != nil && m.emptyBatches != nil {
+		m.emptyBatches.Add(ctx, 1, m.attrs...)
+	}
+}
+
+func (m *exporterMetrics) addMissingMessage(ctx context.Context) {
+	if m != nil && m.missingMessages != nil {
+		m.missingMessages.Add(ctx, 1, m.attrs...)
+	}
+}
+
+func (m *exporterMetrics) addExpiredEvent(ctx context.Context) {
+	if m != nil && m.expiredEvents != nil {
+		m.expiredEvents.Add(ctx, 1, m.attrs...)
+	}
+}
+
+func (m *exporterMetrics) addPayloadTooLarge(ctx context.Context) {
+	if m != nil && m.permanentFailures != nil {
+		m.permanentFailures.Add(ctx, 1, m.attrs...)
+	}
+}
+
+func (m *exporterMetrics) recordLatency(ctx context.Context, latency time.Duration) {
+	if m != nil && m.eventLatency != nil {
+		m.eventLatency.Record(ctx, latency.Seconds(), m.attrs...)
+	}
+}
+
+func (m *exporterMetrics) addBatchSummary(ctx context.Context, summary *batchSummary) {
+	if m == nil || m.recordsReceived == nil {
+		return
+	}
+	m.recordsReceived.Add(ctx, int64(summary.received), m.attrs...)
+	m.recordsFiltered.Add(ctx, int64(summary.filtered), m.attrs...)
+	m.recordsConverted.Add(ctx, int64(summary.converted), m.attrs...)
+	m.recordsEnqueued.Add(ctx, int64(summary.enqueued), m.attrs...)
+}
+
+// Logs and counts the funnel of the pushed logs with batch_summary
+func (e *cloudeventTransformExporter) recordBatchSummary(ctx context.Context, summary *batchSummary) {
+	if !e.config.BatchSummary {
+		return
+	}
+
+	e.logger.Debug("Batch summary",
+		zap.Int("received", summary.received),
+		zap.Int("filtered", summary.filtered),
+		zap.Int("converted", summary.converted),
+		zap.Int("enqueued", summary.enqueued))
+	e.metrics.addBatchSummary(ctx, summary)
+}
+
+// Records how late the event got delivered, events without a parseable start time are left out
+func (e *cloudeventTransformExporter) recordDelivered(ce *cloudeventdata) {
+	if ce.time.IsZero() {
+		return
+	}
+
+	// Clocks of the cluster and the collector can disagree, a negative latency isn't useful to anyone
+	latency := time.Since(ce.time)
+	if latency < 0 {
+		latency = 0
+	}
+
+	e.metrics.recordLatency(context.Background(), latency)
+}
+
+// Counts and logs the event if its deadline passed, sending it is pointless then
+func (e *cloudeventTransformExporter) expired(logger *zap.Logger, ce *cloudeventdata) bool {
+	if ce.deadline.IsZero() || time.Now().Before(ce.deadline) {
+		return false
+	}
+
+	logger.Debug("Event dropped, deadline passed", zap.String("id", ce.uid), zap.Time("deadline", ce.deadline))
+	e.metrics.addExpiredEvent(context.Background())
+	return true
+}
@@ -0,0 +1,489 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Starts the exporter with a meter provider whose metrics can be collected by the test
+func startMeteredTestExporter(t *testing.T, cfg *Config) (*cloudeventTransformExporter, sdkmetric.Reader) {
+	reader := sdkmetric.NewManualReader()
+	set := exportertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	e, err := newExporter(cfg, set)
+	require.NoError(t, err)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	return e, reader
+}
+
+// Collects the metric with the given name, nil if nothing got recorded for it
+func collectMetric(t *testing.T, reader sdkmetric.Reader, name string) *metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	for _, sm := range rm.ScopeMetrics {
+		for i := range sm.Metrics {
+			if sm.Metrics[i].Name == name {
+				return &sm.Metrics[i]
+			}
+		}
+	}
+	return nil
+}
+
+func TestEventLatencyRecorded(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	eventTime := pcommon.NewTimestampFromTime(time.Now().Add(-2 * time.Second))
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr(ATTR_EVENT_START_TIME, eventTime.String())
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	nextRequest(t, requests)
+
+	var histogram metricdata.Histogram
+	require.Eventually(t, func() bool {
+		m := collectMetric(t, reader, METRIC_EVENT_LATENCY)
+		if m == nil {
+			return false
+		}
+		histogram = m.Data.(metricdata.Histogram)
+		return len(histogram.DataPoints) == 1 && histogram.DataPoints[0].Count == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Start time only has a precision of seconds with the default time format
+	assert.GreaterOrEqual(t, histogram.DataPoints[0].Sum, 1.0)
+	assert.Less(t, histogram.DataPoints[0].Sum, 10.0)
+}
+
+func TestEventLatencySkipsUnparseableTime(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr(ATTR_EVENT_START_TIME, "yesterday")
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	nextRequest(t, requests)
+
+	assert.Nil(t, collectMetric(t, reader, METRIC_EVENT_LATENCY))
+}
+
+func TestEmptyBatchCounted(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.CountEmptyBatches = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), plog.NewLogs()))
+	require.NoError(t, e.pushLogs(context.Background(), plog.NewLogs()))
+
+	m := collectMetric(t, reader, METRIC_EMPTY_BATCHES)
+	require.NotNil(t, m)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(2), sum.DataPoints[0].Value)
+
+	select {
+	case <-requests:
+		t.Fatal("empty logs shouldn't be sent")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEmptyBatchNotCountedByDefault(t *testing.T) {
+	cfg := testConfig()
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), plog.NewLogs()))
+	assert.Nil(t, collectMetric(t, reader, METRIC_EMPTY_BATCHES))
+}
+
+func TestMissingMessagesCounted(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	ld := testEvents(3, "Created")
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	records.At(0).Body().SetStr("")
+	pcommon.NewValueEmpty().CopyTo(records.At(1).Body())
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	for i := 0; i < 3; i++ {
+		nextRequest(t, requests)
+	}
+
+	m := collectMetric(t, reader, METRIC_MISSING_MESSAGES)
+	require.NotNil(t, m)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+}
+
+func TestExpiredEventSkipped(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.DeadlineAttribute = "event.deadline"
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	records.At(0).Attributes().PutStr("event.deadline", time.Now().Add(-time.Minute).Format(time.RFC3339))
+	fillEvent(records.AppendEmpty(), "Created", "live")
+	records.At(1).Attributes().PutInt("event.deadline", time.Now().Add(time.Hour).Unix())
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "uid-live", nextRequest(t, requests).header.Get(HEADER_CE_ID))
+
+	require.Eventually(t, func() bool {
+		return collectMetric(t, reader, METRIC_EXPIRED_EVENTS) != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	sum := collectMetric(t, reader, METRIC_EXPIRED_EVENTS).Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+
+	select {
+	case req := <-requests:
+		t.Fatalf("expired event %s shouldn't be sent", req.header.Get(HEADER_CE_ID))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMetricsWithoutMeter(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.CountEmptyBatches = true
+	cfg.DeadlineAttribute = "event.deadline"
+	cfg.SyncSend = true
+
+	set := exportertest.NewNopCreateSettings()
+	set.MeterProvider = nil
+
+	e, err := newExporter(cfg, set)
+	require.NoError(t, err)
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+
+	// Every metric gets recorded without a meter to record it to
+	require.NoError(t, e.pushLogs(context.Background(), plog.NewLogs()))
+
+	ld := testEvents(2, "Created")
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	pcommon.NewValueEmpty().CopyTo(records.At(0).Body())
+	records.At(0).Attributes().PutStr(ATTR_EVENT_START_TIME, pcommon.NewTimestampFromTime(time.Now()).String())
+	records.At(1).Attributes().PutStr("event.deadline", time.Now().Add(-time.Minute).Format(time.RFC3339))
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	nextRequest(t, requests)
+
+	// Exporters built without the metrics at all record nothing as well
+	var m *exporterMetrics
+	assert.NotPanics(t, func() {
+		m.addEmptyBatch(context.Background())
+		m.addMissingMessage(context.Background())
+		m.addExpiredEvent(context.Background())
+		m.recordLatency(context.Background(), time.Second)
+	})
+}
+
+func TestMetricsSignal(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.CountEmptyBatches = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	// Metrics of another signal on the same provider don't mix with the ones of logs
+	other, err := newExporterMetrics(e.settings.MeterProvider, SIGNAL_METRICS)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, e.pushLogs(context.Background(), plog.NewLogs()))
+		assert.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			other.addEmptyBatch(context.Background())
+		}
+	}()
+	wg.Wait()
+	nextRequest(t, requests)
+
+	m := collectMetric(t, reader, METRIC_EMPTY_BATCHES)
+	require.NotNil(t, m)
+	bySignal := map[string]int64{}
+	for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+		signal, ok := dp.Attributes.Value(METRIC_ATTR_SIGNAL)
+		require.True(t, ok)
+		bySignal[signal.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{SIGNAL_LOGS: 1, SIGNAL_METRICS: 3}, bySignal)
+}
+
+// Mixed batch of uid-pod twice and uid-other as Created, and uid-pod as Deleted
+func summaryEvents() plog.Logs {
+	ld := testEvents(2, "Created")
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	fillEvent(records.AppendEmpty(), "Created", "other")
+	fillEvent(records.AppendEmpty(), "Deleted", "pod")
+	return ld
+}
+
+func TestBatchSummaryCounted(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Filter = "Created"
+	cfg.DedupBatch = true
+	cfg.BatchSummary = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), summaryEvents()))
+	nextRequest(t, requests)
+	nextRequest(t, requests)
+
+	for name, expected := range map[string]int64{
+		METRIC_RECORDS_RECEIVED:  4,
+		METRIC_RECORDS_FILTERED:  1,
+		METRIC_RECORDS_CONVERTED: 3,
+		METRIC_RECORDS_ENQUEUED:  2, // the duplicate is dropped
+	} {
+		m := collectMetric(t, reader, name)
+		require.NotNil(t, m, name)
+		sum := m.Data.(metricdata.Sum[int64])
+		require.Len(t, sum.DataPoints, 1)
+		assert.Equal(t, expected, sum.DataPoints[0].Value, name)
+	}
+}
+
+func TestBatchSummaryLogged(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Filter = "Created"
+	cfg.FilterOrder = FILTER_ORDER_CONVERT_THEN_FILTER
+	cfg.DedupBatch = true
+	cfg.BatchSummary = true
+	cfg.SyncSend = true
+
+	e, logs := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), summaryEvents()))
+	nextRequest(t, requests)
+	nextRequest(t, requests)
+
+	// Filtered after the conversion, so every record is converted
+	entries := logs.FilterMessage("Batch summary").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{
+		"received":  int64(4),
+		"filtered":  int64(1),
+		"converted": int64(4),
+		"enqueued":  int64(2),
+	}, entries[0].ContextMap())
+}
+
+func TestBatchSummaryOff(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	nextRequest(t, requests)
+	assert.Nil(t, collectMetric(t, reader, METRIC_RECORDS_RECEIVED))
+}
+
+func TestPayloadTooLargeNotRetried(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.RetrySettings.Enabled = true
+	cfg.SyncSend = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.Equal(t, int32(1), received.Load())
+
+	m := collectMetric(t, reader, METRIC_PERMANENT_FAILURES)
+	require.NotNil(t, m)
+	sum := m.Data.(metricdata.Sum[int64])
+	require.Len(t, sum.DataPoints, 1)
+	assert.Equal(t, int64(1), sum.DataPoints[0].Value)
+}
+
+func TestPayloadTooLargeTruncated(t *testing.T) {
+	var received atomic.Int32
+	messages := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		var data map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&data))
+		if r.ContentLength > 300 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		messages <- data[DATA_FIELD_MESSAGE].(string)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.TruncateTooLarge = 99
+	cfg.SyncSend = true
+
+	e, reader := startMeteredTestExporter(t, cfg)
+
+	// The two byte é at the cut isn't split
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().SetStr(strings.Repeat("x", 98) + "é" + strings.Repeat("y", 500))
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, int32(2), received.Load())
+	assert.Equal(t, strings.Repeat("x", 98), <-messages)
+	assert.NotNil(t, collectMetric(t, reader, METRIC_PERMANENT_FAILURES))
+}
+
+/*
+Logs and metrics exporters of the same config, built like the factory does for the pipelines of an exporter
+consuming both, pushed concurrently. The log filters don't apply to the threshold events, metrics.rules don't
+apply to the logs and every metric is recorded under the signal of the exporter.
+*/
+func TestLogsAndMetricsConcurrently(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := thresholdConfig(server.URL)
+	cfg.Filter = "Created"
+	cfg.BatchSummary = true
+	cfg.SyncSend = true
+	before := *cfg
+
+	reader := sdkmetric.NewManualReader()
+	set := exportertest.NewNopCreateSettings()
+	set.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	exporters := map[string]*cloudeventTransformExporter{}
+	for _, signal := range []string{SIGNAL_LOGS, SIGNAL_METRICS} {
+		e, err := newSignalExporter(cfg, set, signal)
+		require.NoError(t, err)
+		require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+		t.Cleanup(func() {
+			require.NoError(t, e.shutdown(context.Background()))
+		})
+		exporters[signal] = e
+	}
+
+	const rounds = 5
+	at := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			ld := plog.NewLogs()
+			records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+			fillEvent(records.AppendEmpty(), "Created", fmt.Sprintf("pod-%d", i))
+			fillEvent(records.AppendEmpty(), "Deleted", fmt.Sprintf("pod-%d", i))
+			assert.NoError(t, exporters[SIGNAL_LOGS].pushLogs(context.Background(), ld))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			at := at.Add(time.Duration(2*i) * time.Minute)
+			assert.NoError(t, exporters[SIGNAL_METRICS].pushMetrics(context.Background(), testMetrics(500, at)))
+			assert.NoError(t, exporters[SIGNAL_METRICS].pushMetrics(context.Background(), testMetrics(1500, at.Add(time.Minute))))
+		}
+	}()
+	wg.Wait()
+
+	types := map[string]int{}
+	for i := 0; i < 2*rounds; i++ {
+		types[nextRequest(t, requests).header.Get(HEADER_CE_TYPE)]++
+	}
+	assert.Equal(t, map[string]int{"com.test.event.v1.Created": rounds, "com.test.event.v1.MemoryHigh": rounds}, types)
+	assert.Equal(t, before, *cfg, "the exporters changed their shared config")
+
+	// Logs: Created and Deleted of every round, Deleted filtered. Metrics: a datapoint below and one above the
+	// threshold every round, the ones below don't cross it
+	for name, expected := range map[string]map[string]int64{
+		METRIC_RECORDS_RECEIVED:  {SIGNAL_LOGS: 2 * rounds, SIGNAL_METRICS: 2 * rounds},
+		METRIC_RECORDS_FILTERED:  {SIGNAL_LOGS: rounds, SIGNAL_METRICS: rounds},
+		METRIC_RECORDS_CONVERTED: {SIGNAL_LOGS: rounds, SIGNAL_METRICS: rounds},
+		METRIC_RECORDS_ENQUEUED:  {SIGNAL_LOGS: rounds, SIGNAL_METRICS: rounds},
+	} {
+		m := collectMetric(t, reader, name)
+		require.NotNil(t, m, name)
+		bySignal := map[string]int64{}
+		for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+			signal, ok := dp.Attributes.Value(METRIC_ATTR_SIGNAL)
+			require.True(t, ok)
+			bySignal[signal.AsString()] = dp.Value
+		}
+		assert.Equal(t, expected, bySignal, name)
+	}
+}
@@ -0,0 +1,231 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	MQTT_CLIENT_ID_PREFIX = "cloudeventexporter-"
+
+	MQTT_VERSION_311 = "3.1.1"
+	MQTT_VERSION_5   = "5"
+
+	// Keep alive of the MQTT 5 connection in seconds, the same as the 3.1.1 client has
+	MQTT_KEEP_ALIVE = 30
+	// Reason codes of the PUBACK or PUBREC of MQTT 5, from 0x80 on the broker refused the message
+	MQTT_REASON_FAILURE        = 0x80
+	MQTT_REASON_QUOTA_EXCEEDED = 0x97
+
+	// Placeholders of mqtt.topic, replaced with the fields of the event
+	MQTT_TOPIC_NAMESPACE = "{namespace}"
+	MQTT_TOPIC_NAME      = "{name}"
+	MQTT_TOPIC_REASON    = "{reason}"
+)
+
+// Topic levels can't have the wildcards, and a '/' in a value would split it across levels
+var mqttTopicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// Client identifier of the connection, mqtt.client_id or cloudeventexporter-<hostname>
+func mqttClientID(cfg *MQTTSettings) (string, error) {
+	if cfg.ClientID != "" {
+		return cfg.ClientID, nil
+	}
+	hostname, err := collectorHostname()
+	if err != nil {
+		return "", fmt.Errorf("couldn't get the hostname for mqtt.client_id: %w", err)
+	}
+	return MQTT_CLIENT_ID_PREFIX + hostname, nil
+}
+
+// Connects to the broker of the mqtt transport, the client reconnects on its own when the connection is lost
+func newMQTTClient(cfg *MQTTSettings, timeout time.Duration) (mqtt.Client, error) {
+	clientID, err := mqttClientID(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetProtocolVersion(4). // 3.1.1
+		SetConnectTimeout(timeout).
+		SetWriteTimeout(timeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(false)
+	if cfg.Username != "" {
+		opts.SetUsername(cfg.Username)
+		opts.SetPassword(string(cfg.Password))
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return nil, fmt.Errorf("timed out connecting to %s", cfg.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+/*
+Connects to the broker of the mqtt transport with MQTT 5, the connection manager reconnects on its own when the
+connection is lost and the events published meanwhile fail with autopaho.ConnectionDownError.
+*/
+func newMQTT5Client(cfg *MQTTSettings, timeout time.Duration) (*autopaho.ConnectionManager, error) {
+	clientID, err := mqttClientID(cfg)
+	if err != nil {
+		return nil, err
+	}
+	broker, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := autopaho.ClientConfig{
+		BrokerUrls:     []*url.URL{broker},
+		KeepAlive:      MQTT_KEEP_ALIVE,
+		ConnectTimeout: timeout,
+		// The connection is tried again and again, the events published meanwhile are throttled
+		OnConnectError: func(error) {},
+		ClientConfig:   paho.ClientConfig{ClientID: clientID, PacketTimeout: timeout},
+	}
+	if cfg.Username != "" {
+		opts.SetUsernamePassword(cfg.Username, []byte(cfg.Password))
+	}
+	if cfg.TLS != nil {
+		if opts.TlsCfg, err = cfg.TLS.LoadTLSConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := autopaho.NewConnection(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = client.AwaitConnection(ctx); err != nil {
+		_ = client.Disconnect(ctx)
+		return nil, fmt.Errorf("timed out connecting to %s", cfg.Broker)
+	}
+	return client, nil
+}
+
+/*
+MQTT 5 message of the cloud-event in the content mode, the Ce-* headers of binary mode become user properties named
+after the attributes (id, type, source...) and content-type becomes the content type of the message
+*/
+func mqtt5Publish(headers http.Header, body []byte) *paho.Publish {
+	msg := &paho.Publish{Payload: body, Properties: &paho.PublishProperties{}}
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if strings.EqualFold(key, HEADER_CONTENT_TYPE) {
+			msg.Properties.ContentType = headers.Get(key)
+			continue
+		}
+		msg.Properties.User.Add(strings.ToLower(strings.TrimPrefix(key, HEADER_CE_PREFIX)), headers.Get(key))
+	}
+	return msg
+}
+
+// Topic of the event, mqtt.topic with its placeholders replaced
+func (ce *cloudeventdata) mqttTopic(topic string) string {
+	return strings.NewReplacer(
+		MQTT_TOPIC_NAMESPACE, mqttTopicEscaper.Replace(ce.namespace),
+		MQTT_TOPIC_NAME, mqttTopicEscaper.Replace(ce.name),
+		MQTT_TOPIC_REASON, mqttTopicEscaper.Replace(ce.reason),
+	).Replace(topic)
+}
+
+/*
+Publishes the cloud-event in structured mode to its topic, MQTT 3.1.1 doesn't have any headers for binary mode so
+the content mode is only followed with MQTT 5. With qos 1 and 2 it waits for the broker to take it, bound by the
+timeout of the exporter. A broker which is out of reach or doesn't take it in time throttles the events like
+429/503 do with http.
+*/
+func (e *cloudeventTransformExporter) sendMQTT(ce *cloudeventdata) error {
+	if e.mqtt5 != nil {
+		return e.sendMQTT5(ce)
+	}
+
+	_, body, err := ce.encodeFor(CONTENT_MODE_STRUCTURED, e.config)
+	if err != nil {
+		return err
+	}
+
+	topic := ce.mqttTopic(e.config.MQTT.Topic)
+	throttled := func(err error) error {
+		return &throttledError{
+			err:        fmt.Errorf("error exporting items, publishing to %s failed: %w", topic, err),
+			retryAfter: e.config.RetrySettings.InitialInterval,
+		}
+	}
+	if !e.mqtt.IsConnectionOpen() {
+		return throttled(errors.New("not connected to the broker"))
+	}
+
+	token := e.mqtt.Publish(topic, e.config.MQTT.QoS, false, body)
+	if !token.WaitTimeout(e.client.Timeout) {
+		return throttled(errors.New("timed out waiting for the broker"))
+	}
+	if err = token.Error(); err != nil {
+		return fmt.Errorf("error exporting items, publishing to %s failed: %w", topic, err)
+	}
+	return nil
+}
+
+// Publishes the cloud-event in the content mode with MQTT 5, a broker over its quota throttles the events as well
+func (e *cloudeventTransformExporter) sendMQTT5(ce *cloudeventdata) error {
+	headers, body, err := ce.encodeFor(e.config.ContentMode, e.config)
+	if err != nil {
+		return err
+	}
+
+	msg := mqtt5Publish(headers, body)
+	msg.Topic = ce.mqttTopic(e.config.MQTT.Topic)
+	msg.QoS = e.config.MQTT.QoS
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.client.Timeout)
+	defer cancel()
+	res, err := e.mqtt5.Publish(ctx, msg)
+	if res != nil && res.ReasonCode >= MQTT_REASON_FAILURE {
+		err = fmt.Errorf("the broker refused it with reason code 0x%x", res.ReasonCode)
+	}
+	if err == nil {
+		return nil
+	}
+
+	formattedErr := fmt.Errorf("error exporting items, publishing to %s failed: %w", msg.Topic, err)
+	var netErr net.Error
+	quota := res != nil && res.ReasonCode == MQTT_REASON_QUOTA_EXCEEDED
+	lost := errors.Is(err, autopaho.ConnectionDownError) || errors.As(err, &netErr)
+	if quota || lost || errors.Is(err, context.DeadlineExceeded) {
+		return &throttledError{err: formattedErr, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return formattedErr
+}
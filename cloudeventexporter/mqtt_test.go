@@ -0,0 +1,302 @@
+package cloudeventexporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Message published to the test MQTT broker, MQTT 5 messages have a content type and user properties
+type mqttMessage struct {
+	topic       string
+	qos         byte
+	payload     []byte
+	contentType string
+	user        map[string]string
+}
+
+// Starts an MQTT 3.1.1 and 5 broker speaking just enough of the protocol for the exporter, it hands over the
+// published messages to the test and acks them unless ack is false
+func newMQTTBroker(t *testing.T, ack bool) (string, chan mqttMessage) {
+	return newMQTTBrokerWithReason(t, ack, 0)
+}
+
+// Broker acking the MQTT 5 messages with the reason code
+func newMQTTBrokerWithReason(t *testing.T, ack bool, reason byte) (string, chan mqttMessage) {
+	messages := make(chan mqttMessage, 100)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go serveMQTT(conn, messages, ack, reason)
+		}
+	}()
+	return "tcp://" + lis.Addr().String(), messages
+}
+
+func serveMQTT(conn net.Conn, messages chan mqttMessage, ack bool, reason byte) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	v5 := false
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := binary.ReadUvarint(r) // same encoding as the remaining length
+		if err != nil {
+			return
+		}
+		packet := make([]byte, length)
+		if _, err = io.ReadFull(r, packet); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			v5 = packet[6] == 5 // protocol level after the protocol name
+			if v5 {
+				_, _ = conn.Write([]byte{0x20, 0x03, 0x00, 0x00, 0x00})
+				continue
+			}
+			_, _ = conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3: // PUBLISH
+			qos := (header >> 1) & 0x03
+			topicLen := int(binary.BigEndian.Uint16(packet))
+			msg := mqttMessage{topic: string(packet[2 : 2+topicLen]), qos: qos}
+			rest := packet[2+topicLen:]
+			var id []byte
+			if qos > 0 {
+				id, rest = rest[:2], rest[2:]
+			}
+			if v5 {
+				rest = readMQTTProperties(rest, &msg)
+			}
+			msg.payload = rest
+			messages <- msg
+
+			ackPacket := append([]byte{0x02}, id...)
+			if v5 {
+				ackPacket = append([]byte{0x03}, append(id, reason)...)
+			}
+			if ack && qos == 1 {
+				_, _ = conn.Write(append([]byte{0x40}, ackPacket...)) // PUBACK
+			}
+			if ack && qos == 2 {
+				_, _ = conn.Write(append([]byte{0x50}, ackPacket...)) // PUBREC
+			}
+		case 6: // PUBREL
+			_, _ = conn.Write(append([]byte{0x70, 0x02}, packet[:2]...)) // PUBCOMP
+		case 12: // PINGREQ
+			_, _ = conn.Write([]byte{0xd0, 0x00})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+// Reads the content type and the user properties of an MQTT 5 PUBLISH, returning the payload after the properties
+func readMQTTProperties(packet []byte, msg *mqttMessage) []byte {
+	length, n := binary.Uvarint(packet)
+	props, payload := packet[n:n+int(length)], packet[n+int(length):]
+	readString := func() string {
+		strLen := int(binary.BigEndian.Uint16(props))
+		s := string(props[2 : 2+strLen])
+		props = props[2+strLen:]
+		return s
+	}
+
+	msg.user = map[string]string{}
+	for len(props) > 0 {
+		id := props[0]
+		props = props[1:]
+		switch id {
+		case 0x03: // content type
+			msg.contentType = readString()
+		case 0x26: // user property
+			key := readString()
+			msg.user[key] = readString()
+		default:
+			return payload
+		}
+	}
+	return payload
+}
+
+func mqttConfig(broker string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_MQTT
+	cfg.MQTT = MQTTSettings{Broker: broker, Topic: "k8s/{namespace}/{reason}", QoS: 1, ClientID: "test"}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func TestMQTTTransport(t *testing.T) {
+	broker, messages := newMQTTBroker(t, true)
+
+	// Structured mode whatever content_mode is
+	cfg := mqttConfig(broker)
+	cfg.ContentMode = CONTENT_MODE_BINARY
+	require.NoError(t, cfg.Validate())
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Back/Off")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var msg mqttMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the mqtt message")
+	}
+	assert.Equal(t, "k8s/testns/Back_Off", msg.topic)
+	assert.Equal(t, byte(1), msg.qos)
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.payload, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "test-source", event["source"])
+	assert.Equal(t, CONTENT_TYPE, event["datacontenttype"])
+	assert.Equal(t, "Back/Off", event["data"].(map[string]interface{})["reason"])
+}
+
+func TestMQTTTransportNoAck(t *testing.T) {
+	broker, _ := newMQTTBroker(t, false)
+
+	cfg := mqttConfig(broker)
+	cfg.Timeout = 200 * time.Millisecond
+	e, _ := startTestExporter(t, cfg)
+
+	var throttled *throttledError
+	assert.ErrorAs(t, e.sendMQTT(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+}
+
+func TestMQTT5TransportBinary(t *testing.T) {
+	broker, messages := newMQTTBroker(t, true)
+
+	cfg := mqttConfig(broker)
+	cfg.MQTT.Version = MQTT_VERSION_5
+	cfg.ContentMode = CONTENT_MODE_BINARY
+	require.NoError(t, cfg.Validate())
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Back/Off")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	var msg mqttMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the mqtt message")
+	}
+	assert.Equal(t, "k8s/testns/Back_Off", msg.topic)
+	assert.Equal(t, byte(1), msg.qos)
+
+	// The attributes are user properties named after them, the payload is the data
+	assert.Equal(t, CONTENT_TYPE, msg.contentType)
+	assert.Equal(t, "uid-pod", msg.user["id"])
+	assert.Equal(t, "test-source", msg.user["source"])
+	assert.Equal(t, "1.0", msg.user["specversion"])
+	assert.Equal(t, "com.test.event.v1.Back/Off", msg.user["type"])
+	assert.NotContains(t, msg.user, "content-type")
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.payload, &data))
+	assert.Equal(t, "Back/Off", data["reason"])
+}
+
+func TestMQTT5TransportStructured(t *testing.T) {
+	broker, messages := newMQTTBroker(t, true)
+
+	cfg := mqttConfig(broker)
+	cfg.MQTT.Version = MQTT_VERSION_5
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	e, _ := startTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	var msg mqttMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the mqtt message")
+	}
+	assert.Equal(t, CONTENT_TYPE_STRUCTURED, msg.contentType)
+	assert.Empty(t, msg.user)
+
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.payload, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+}
+
+func TestMQTT5TransportRefused(t *testing.T) {
+	var throttled *throttledError
+
+	// A broker over its quota throttles the events
+	broker, _ := newMQTTBrokerWithReason(t, true, MQTT_REASON_QUOTA_EXCEEDED)
+	cfg := mqttConfig(broker)
+	cfg.MQTT.Version = MQTT_VERSION_5
+	e, _ := startTestExporter(t, cfg)
+	assert.ErrorAs(t, e.sendMQTT(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+
+	// Other refusals fail the events for good
+	broker, _ = newMQTTBrokerWithReason(t, true, 0x87) // not authorized
+	cfg = mqttConfig(broker)
+	cfg.MQTT.Version = MQTT_VERSION_5
+	e, _ = startTestExporter(t, cfg)
+	err := e.sendMQTT(&cloudeventdata{uid: "uid", reason: "Created"})
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &throttled))
+
+	// A broker which doesn't ack in time throttles them like with 3.1.1
+	broker, _ = newMQTTBroker(t, false)
+	cfg = mqttConfig(broker)
+	cfg.MQTT.Version = MQTT_VERSION_5
+	cfg.Timeout = 200 * time.Millisecond
+	e, _ = startTestExporter(t, cfg)
+	assert.ErrorAs(t, e.sendMQTT(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+}
+
+func TestValidateMQTT(t *testing.T) {
+	cfg := mqttConfig("tcp://localhost:1883")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.MQTT.QoS = 3
+	assert.Error(t, cfg.Validate())
+
+	cfg = mqttConfig("tcp://localhost:1883")
+	cfg.MQTT.Version = MQTT_VERSION_5
+	assert.NoError(t, cfg.Validate())
+	cfg.MQTT.Version = MQTT_VERSION_311
+	assert.NoError(t, cfg.Validate())
+	cfg.MQTT.Version = "3.1"
+	assert.Error(t, cfg.Validate())
+
+	cfg = mqttConfig("tcp://localhost:1883")
+	cfg.MQTT.Topic = "k8s/#"
+	assert.Error(t, cfg.Validate())
+	cfg.MQTT.Topic = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = mqttConfig("")
+	assert.Error(t, cfg.Validate())
+
+	cfg = mqttConfig("tcp://localhost:1883")
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,106 @@
+package cloudeventexporter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// NATS binding names the attribute headers ce-<name> and keeps content-type as is,
+	// see https://github.com/cloudevents/spec/blob/main/cloudevents/bindings/nats-protocol-binding.md
+	NATS_HEADER_CONTENT_TYPE = "content-type"
+
+	NATS_CLIENT_NAME = "cloudeventexporter"
+)
+
+// Connects to the NATS servers of the nats transport, the connection reconnects on its own when it's lost
+func newNATSConn(cfg *NATSSettings, timeout time.Duration) (*nats.Conn, error) {
+	opts := []nats.Option{
+		nats.Name(NATS_CLIENT_NAME),
+		nats.Timeout(timeout),
+		// Keeps reconnecting for good, the events wait in the workers meanwhile
+		nats.MaxReconnects(-1),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, string(cfg.Password)))
+	}
+	if cfg.Token != "" {
+		opts = append(opts, nats.Token(string(cfg.Token)))
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	return nats.Connect(cfg.URL, opts...)
+}
+
+/*
+Creates the JetStream stream of nats.jetstream.stream capturing the subject, unless it's already there.
+A stream which is already there is left as it is, even if its configuration differs.
+*/
+func ensureNATSStream(js nats.JetStreamContext, cfg *NATSSettings) error {
+	_, err := js.StreamInfo(cfg.JetStream.Stream)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:     cfg.JetStream.Stream,
+		Subjects: []string{cfg.Subject},
+		Storage:  nats.FileStorage,
+		MaxAge:   cfg.JetStream.MaxAge,
+	})
+	return err
+}
+
+// Headers of the NATS message, the Ce-* headers of binary mode lower cased (ce-id, ce-type...) along with content-type
+func natsHeaders(headers http.Header) nats.Header {
+	natsHeader := make(nats.Header, len(headers))
+	for key := range headers {
+		natsHeader.Set(strings.ToLower(key), headers.Get(key))
+	}
+	return natsHeader
+}
+
+/*
+Publishes the cloud-event to nats.subject in the configured content mode. With jetstream it waits for the ack of the stream,
+bound by the timeout of the exporter, a stream which isn't there or doesn't ack throttles the events like 429/503 do with http.
+*/
+func (e *cloudeventTransformExporter) sendNATS(ce *cloudeventdata) error {
+	headers, body, err := ce.encodeFor(e.config.ContentMode, e.config)
+	if err != nil {
+		return err
+	}
+
+	msg := &nats.Msg{
+		Subject: e.config.NATS.Subject,
+		Header:  natsHeaders(headers),
+		Data:    body,
+	}
+	if e.natsJS == nil {
+		err = e.natsConn.PublishMsg(msg)
+	} else {
+		_, err = e.natsJS.PublishMsg(msg, nats.AckWait(e.client.Timeout))
+	}
+	if err == nil {
+		return nil
+	}
+
+	formattedErr := fmt.Errorf("error exporting items, publishing to %s failed: %w", e.config.NATS.Subject, err)
+	if errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) || errors.Is(err, nats.ErrNoStreamResponse) {
+		return &throttledError{err: formattedErr, retryAfter: e.config.RetrySettings.InitialInterval}
+	}
+	return formattedErr
+}
@@ -0,0 +1,240 @@
+package cloudeventexporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Message published to the test NATS server
+type natsMessage struct {
+	subject string
+	header  map[string]string
+	data    []byte
+}
+
+/*
+Starts a NATS server speaking just enough of the protocol for the exporter, it hands over the published messages
+to the test and answers the requests (JetStream API calls and acked publishes) with what reply returns, nil doesn't answer
+*/
+func newNATSServer(t *testing.T, reply func(msg natsMessage) []byte) (string, chan natsMessage) {
+	messages := make(chan natsMessage, 100)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go serveNATS(conn, messages, reply)
+		}
+	}()
+	return "nats://" + lis.Addr().String(), messages
+}
+
+func serveNATS(conn net.Conn, messages chan natsMessage, reply func(msg natsMessage) []byte) {
+	defer conn.Close()
+	var mu sync.Mutex
+	write := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(conn, format, args...)
+	}
+	write("INFO {\"server_id\":\"test\",\"version\":\"2.9.15\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+
+	subs := map[string]string{} // subject (prefix of the wildcard ones) to sid
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			write("PONG\r\n")
+		case "SUB":
+			subs[strings.TrimSuffix(fields[1], "*")] = fields[len(fields)-1]
+		case "PUB", "HPUB":
+			// PUB <subject> [reply] <size>, HPUB <subject> [reply] <header size> <total size>
+			hpub := strings.EqualFold(fields[0], "HPUB")
+			sizes := 1
+			if hpub {
+				sizes = 2
+			}
+			replyTo := ""
+			if len(fields) == sizes+3 {
+				replyTo = fields[2]
+			}
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			headerSize := 0
+			if hpub {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+
+			payload := make([]byte, total+2)
+			if _, err = io.ReadFull(r, payload); err != nil {
+				return
+			}
+
+			msg := natsMessage{subject: fields[1], header: map[string]string{}, data: payload[headerSize:total]}
+			for _, headerLine := range strings.Split(string(payload[:headerSize]), "\r\n")[1:] {
+				if key, val, ok := strings.Cut(headerLine, ": "); ok {
+					msg.header[key] = val
+				}
+			}
+			messages <- msg
+
+			if replyTo == "" || reply == nil {
+				continue
+			}
+			if res := reply(msg); res != nil {
+				for prefix, sid := range subs {
+					if strings.HasPrefix(replyTo, prefix) {
+						write("MSG %s %s %d\r\n%s\r\n", replyTo, sid, len(res), res)
+					}
+				}
+			}
+		}
+	}
+}
+
+func natsConfig(url string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_NATS
+	cfg.NATS = NATSSettings{URL: url, Subject: "k8s.events"}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func nextNATSMessage(t *testing.T, messages chan natsMessage, subject string) natsMessage {
+	for {
+		select {
+		case msg := <-messages:
+			if msg.subject == subject {
+				return msg
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for a message of %s", subject)
+		}
+	}
+}
+
+func TestNATSTransport(t *testing.T) {
+	url, messages := newNATSServer(t, nil)
+
+	cfg := natsConfig(url)
+	require.NoError(t, cfg.Validate())
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, "2023-04-01T10:00:00Z")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	msg := nextNATSMessage(t, messages, "k8s.events")
+	assert.Equal(t, "uid-pod", msg.header["ce-id"])
+	assert.Equal(t, "test-source", msg.header["ce-source"])
+	assert.Equal(t, "1.0", msg.header["ce-specversion"])
+	assert.Equal(t, "com.test.event.v1.Created", msg.header["ce-type"])
+	assert.Equal(t, "2023-04-01T10:00:00Z", msg.header["ce-time"])
+	assert.Equal(t, CONTENT_TYPE, msg.header[NATS_HEADER_CONTENT_TYPE])
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.data, &data))
+	assert.Equal(t, "Created", data["reason"])
+}
+
+func TestNATSTransportJetStream(t *testing.T) {
+	url, messages := newNATSServer(t, func(msg natsMessage) []byte {
+		switch {
+		case msg.subject == "$JS.API.STREAM.INFO.EVENTS":
+			return []byte(`{"type":"io.nats.jetstream.api.v1.stream_info_response","error":{"code":404,"err_code":10059,"description":"stream not found"}}`)
+		case msg.subject == "$JS.API.STREAM.CREATE.EVENTS":
+			return []byte(fmt.Sprintf(`{"type":"io.nats.jetstream.api.v1.stream_create_response","config":%s,"created":"2023-04-01T10:00:00Z"}`, msg.data))
+		case msg.subject == "k8s.events":
+			return []byte(`{"stream":"EVENTS","seq":1}`)
+		}
+		return nil
+	})
+
+	cfg := natsConfig(url)
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	cfg.NATS.JetStream = NATSJetStreamSettings{Enabled: true, Stream: "EVENTS", MaxAge: time.Hour}
+	require.NoError(t, cfg.Validate())
+	e, _ := startTestExporter(t, cfg)
+
+	// The stream isn't there, so it's created for the subject
+	msg := nextNATSMessage(t, messages, "$JS.API.STREAM.CREATE.EVENTS")
+	var stream map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.data, &stream))
+	assert.Equal(t, []interface{}{"k8s.events"}, stream["subjects"])
+	assert.Equal(t, "file", stream["storage"])
+	assert.Equal(t, float64(time.Hour), stream["max_age"])
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	msg = nextNATSMessage(t, messages, "k8s.events")
+	assert.Equal(t, map[string]string{NATS_HEADER_CONTENT_TYPE: CONTENT_TYPE_STRUCTURED}, msg.header)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.data, &event))
+	assert.Equal(t, "uid-pod", event["id"])
+}
+
+func TestNATSTransportJetStreamNoAck(t *testing.T) {
+	url, _ := newNATSServer(t, nil)
+
+	cfg := natsConfig(url)
+	cfg.Timeout = 200 * time.Millisecond
+	cfg.NATS.JetStream.Enabled = true
+	e, _ := startTestExporter(t, cfg)
+
+	var throttled *throttledError
+	assert.ErrorAs(t, e.sendNATS(&cloudeventdata{uid: "uid", reason: "Created"}), &throttled)
+}
+
+func TestValidateNATS(t *testing.T) {
+	cfg := natsConfig("nats://localhost:4222")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.NATS.Subject = "k8s.*"
+	assert.Error(t, cfg.Validate())
+	cfg.NATS.Subject = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = natsConfig("nats://localhost:4222")
+	cfg.NATS.Username = "exporter"
+	cfg.NATS.Token = "secret"
+	assert.Error(t, cfg.Validate())
+
+	cfg = natsConfig("nats://localhost:4222")
+	cfg.NATS.JetStream.Stream = "EVENTS"
+	assert.Error(t, cfg.Validate())
+	cfg.NATS.JetStream.Enabled = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg = natsConfig("")
+	assert.Error(t, cfg.Validate())
+
+	cfg = natsConfig("nats://localhost:4222")
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 10, FlushInterval: time.Second}
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,113 @@
+package cloudeventexporter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// Event format of the structured mode body, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/protobuf-format.md
+	FORMAT_JSON     = "json"
+	FORMAT_PROTOBUF = "protobuf"
+
+	CONTENT_TYPE_PROTOBUF = "application/cloudevents+protobuf"
+)
+
+// Field numbers of CloudEvent and CloudEventAttributeValue in https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/cloudevents.proto
+const (
+	PROTO_EVENT_ID           protowire.Number = 1
+	PROTO_EVENT_SOURCE       protowire.Number = 2
+	PROTO_EVENT_SPEC_VERSION protowire.Number = 3
+	PROTO_EVENT_TYPE         protowire.Number = 4
+	PROTO_EVENT_ATTRIBUTES   protowire.Number = 5
+	PROTO_EVENT_TEXT_DATA    protowire.Number = 7
+
+	PROTO_MAP_KEY   protowire.Number = 1
+	PROTO_MAP_VALUE protowire.Number = 2
+
+	PROTO_ATTR_BOOLEAN   protowire.Number = 1
+	PROTO_ATTR_INTEGER   protowire.Number = 2
+	PROTO_ATTR_STRING    protowire.Number = 3
+	PROTO_ATTR_TIMESTAMP protowire.Number = 7
+
+	PROTO_TIMESTAMP_SECONDS protowire.Number = 1
+	PROTO_TIMESTAMP_NANOS   protowire.Number = 2
+)
+
+/*
+Encodes the structured cloud-event as CloudEvent protobuf message. The required attributes have fields of their
+own, time (from eventTime, the format of time_format doesn't apply), datacontenttype and the extensions go in the
+attributes map with their type and the JSON data is text_data.
+*/
+func (event *structuredCloudEvent) protobuf(eventTime time.Time) []byte {
+	var b []byte
+	b = appendProtoString(b, PROTO_EVENT_ID, event.ID)
+	b = appendProtoString(b, PROTO_EVENT_SOURCE, event.Source)
+	b = appendProtoString(b, PROTO_EVENT_SPEC_VERSION, event.SpecVersion)
+	b = appendProtoString(b, PROTO_EVENT_TYPE, event.Type)
+
+	attributes := make(map[string][]byte, len(event.Extensions)+2)
+	attributes["datacontenttype"] = appendProtoString(nil, PROTO_ATTR_STRING, event.DataContentType)
+	if !eventTime.IsZero() {
+		var ts []byte
+		ts = protowire.AppendTag(ts, PROTO_TIMESTAMP_SECONDS, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(eventTime.Unix()))
+		ts = protowire.AppendTag(ts, PROTO_TIMESTAMP_NANOS, protowire.VarintType)
+		ts = protowire.AppendVarint(ts, uint64(eventTime.Nanosecond()))
+		attributes["time"] = appendProtoBytes(nil, PROTO_ATTR_TIMESTAMP, ts)
+	}
+	for name, val := range event.Extensions {
+		attributes[name] = protoAttributeValue(val)
+	}
+
+	// Sorted so the output is stable
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := appendProtoString(nil, PROTO_MAP_KEY, name)
+		entry = appendProtoBytes(entry, PROTO_MAP_VALUE, attributes[name])
+		b = appendProtoBytes(b, PROTO_EVENT_ATTRIBUTES, entry)
+	}
+
+	if event.Data == nil {
+		return b
+	}
+	return appendProtoBytes(b, PROTO_EVENT_TEXT_DATA, event.Data)
+}
+
+// CloudEventAttributeValue of the extension, booleans and integers keep their type and the rest are strings
+func protoAttributeValue(val interface{}) []byte {
+	switch v := val.(type) {
+	case bool:
+		b := protowire.AppendTag(nil, PROTO_ATTR_BOOLEAN, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case int64:
+		return appendProtoInt32(nil, PROTO_ATTR_INTEGER, int32(v))
+	case string:
+		return appendProtoString(nil, PROTO_ATTR_STRING, v)
+	}
+	return appendProtoString(nil, PROTO_ATTR_STRING, fmt.Sprint(val))
+}
+
+func appendProtoString(b []byte, num protowire.Number, val string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, val)
+}
+
+func appendProtoBytes(b []byte, num protowire.Number, val []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, val)
+}
+
+// int32 fields are sign extended to 64 bits, so negative ones take 10 bytes
+func appendProtoInt32(b []byte, num protowire.Number, val int32) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(val)))
+}
@@ -0,0 +1,167 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb" // registers google/protobuf/timestamp.proto
+)
+
+// CloudEvent message of cloudevents.proto (without proto_data), for decoding what the exporter sent
+func cloudEventDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, oneof *int32) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:       proto.String(name),
+			Number:     proto.Int32(number),
+			Label:      descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:       typ.Enum(),
+			OneofIndex: oneof,
+			JsonName:   proto.String(name),
+		}
+	}
+	message := func(f *descriptorpb.FieldDescriptorProto, typeName string) *descriptorpb.FieldDescriptorProto {
+		f.TypeName = proto.String(typeName)
+		return f
+	}
+
+	attributes := message(field("attributes", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, nil), ".io.cloudevents.v1.CloudEvent.AttributesEntry")
+	attributes.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("cloudevents.proto"),
+		Package:    proto.String("io.cloudevents.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("CloudEvent"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+					field("source", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+					field("spec_version", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+					field("type", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+					attributes,
+					field("binary_data", 6, descriptorpb.FieldDescriptorProto_TYPE_BYTES, proto.Int32(0)),
+					field("text_data", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, proto.Int32(0)),
+				},
+				NestedType: []*descriptorpb.DescriptorProto{{
+					Name: proto.String("AttributesEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, nil),
+						message(field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, nil), ".io.cloudevents.v1.CloudEventAttributeValue"),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				}},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("data")}},
+			},
+			{
+				Name: proto.String("CloudEventAttributeValue"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("ce_boolean", 1, descriptorpb.FieldDescriptorProto_TYPE_BOOL, proto.Int32(0)),
+					field("ce_integer", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32, proto.Int32(0)),
+					field("ce_string", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, proto.Int32(0)),
+					field("ce_bytes", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES, proto.Int32(0)),
+					field("ce_uri", 5, descriptorpb.FieldDescriptorProto_TYPE_STRING, proto.Int32(0)),
+					field("ce_uri_ref", 6, descriptorpb.FieldDescriptorProto_TYPE_STRING, proto.Int32(0)),
+					message(field("ce_timestamp", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, proto.Int32(0)), ".google.protobuf.Timestamp"),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("attr")}},
+			},
+		},
+	}
+
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().ByName("CloudEvent")
+}
+
+// Decodes the protobuf CloudEvent into its canonical JSON mapping
+func decodeProtobufEvent(t *testing.T, body []byte) map[string]interface{} {
+	msg := dynamicpb.NewMessage(cloudEventDescriptor(t))
+	require.NoError(t, proto.Unmarshal(body, msg))
+
+	out, err := protojson.Marshal(msg)
+	require.NoError(t, err)
+	var event map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &event))
+	return event
+}
+
+func TestProtobufFormat(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	cfg.Format = FORMAT_PROTOBUF
+	cfg.AttributeExtensions = []AttributeExtension{
+		{Name: "priority", Attribute: "priority", Type: EXTENSION_TYPE_INTEGER},
+		{Name: "critical", Attribute: "critical", Type: EXTENSION_TYPE_BOOLEAN},
+	}
+	cfg.CorrelationAttribute = "k8s.event.involved_object.uid"
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(1, "Created")
+	lr := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	eventTime := time.Date(2023, 4, 1, 10, 0, 0, 500, time.UTC)
+	lr.Attributes().PutStr(ATTR_EVENT_START_TIME, eventTime.Format(time.RFC3339Nano))
+	lr.Attributes().PutInt("priority", -3)
+	lr.Attributes().PutBool("critical", true)
+	lr.Attributes().PutStr("k8s.event.involved_object.uid", "object-uid")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, CONTENT_TYPE_PROTOBUF, req.header.Get(HEADER_CONTENT_TYPE))
+
+	event := decodeProtobufEvent(t, req.body)
+	assert.Equal(t, "uid-pod", event["id"])
+	assert.Equal(t, "test-source", event["source"])
+	assert.Equal(t, "1.0", event["spec_version"])
+	assert.Equal(t, "com.test.event.v1.Created", event["type"])
+	assert.Equal(t, map[string]interface{}{
+		"datacontenttype": map[string]interface{}{"ce_string": CONTENT_TYPE},
+		"time":            map[string]interface{}{"ce_timestamp": "2023-04-01T10:00:00.000000500Z"},
+		"priority":        map[string]interface{}{"ce_integer": float64(-3)},
+		"critical":        map[string]interface{}{"ce_boolean": true},
+		"correlationid":   map[string]interface{}{"ce_string": "object-uid"},
+	}, event["attributes"])
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(event["text_data"].(string)), &data))
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+	assert.Equal(t, "pod", data[DATA_FIELD_NAME])
+}
+
+func TestValidateFormat(t *testing.T) {
+	cfg := testConfig()
+	cfg.Format = FORMAT_PROTOBUF
+	assert.Error(t, cfg.Validate())
+
+	cfg.ContentMode = CONTENT_MODE_STRUCTURED
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ContentMode = ""
+	cfg.Endpoints = []EndpointSettings{{Endpoint: "http://a.local"}, {Endpoint: "http://b.local", ContentMode: CONTENT_MODE_STRUCTURED}}
+	cfg.Delivery = DELIVERY_FANOUT
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Batch.Enabled = true
+	assert.Error(t, cfg.Validate())
+
+	cfg = testConfig()
+	cfg.Format = "avro"
+	assert.Error(t, cfg.Validate())
+}
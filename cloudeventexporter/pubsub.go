@@ -0,0 +1,113 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Google Pub/Sub publish API, see https://cloud.google.com/pubsub/docs/reference/rest/v1/projects.topics/publish
+	PUBSUB_ENDPOINT = "https://pubsub.googleapis.com"
+
+	// Pub/Sub binding maps the content type to this attribute, the rest of the headers go as ce-<name>,
+	// see https://github.com/google/knative-gcp/blob/main/docs/spec/pubsub-protocol-binding.md
+	PUBSUB_ATTR_CONTENT_TYPE = "content-type"
+
+	// Scope of the Application Default Credentials' tokens
+	PUBSUB_SCOPE = "https://www.googleapis.com/auth/pubsub"
+)
+
+type pubSubMessage struct {
+	Data        []byte            `json:"data"` // base64 encoded by encoding/json as the API expects
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+type pubSubPublishRequest struct {
+	Messages []pubSubMessage `json:"messages"`
+}
+
+type pubSubPublishResponse struct {
+	MessageIds []string `json:"messageIds"`
+}
+
+// Publish URL of the configured topic, the endpoint can be overridden for the emulator
+func pubSubPublishURL(cfg *PubSubSettings) string {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = PUBSUB_ENDPOINT
+	}
+	return fmt.Sprintf("%s/v1/projects/%s/topics/%s:publish", strings.TrimSuffix(endpoint, "/"), cfg.Project, cfg.Topic)
+}
+
+// Attributes of the Pub/Sub message in binary content mode, the Ce-* headers lower cased (ce-id, ce-type...)
+func pubSubAttributes(headers http.Header) map[string]string {
+	attributes := make(map[string]string, len(headers))
+	for key := range headers {
+		attributes[strings.ToLower(key)] = headers.Get(key)
+	}
+	return attributes
+}
+
+// Publishes the cloud-event to the Pub/Sub topic, authenticated by the auth extension of the exporter or the
+// Application Default Credentials with pubsub.default_credentials
+func (e *cloudeventTransformExporter) sendPubSub(client *http.Client, ce *cloudeventdata) error {
+	headers, data, err := ce.encode(e.config)
+	if err != nil {
+		return err
+	}
+
+	msg := pubSubMessage{Data: data, Attributes: pubSubAttributes(headers)}
+	if e.config.PubSub.OrderingKey {
+		msg.OrderingKey = ce.recordKey()
+	}
+
+	body, err := json.Marshal(&pubSubPublishRequest{Messages: []pubSubMessage{msg}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, pubSubPublishURL(&e.config.PubSub), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE)
+	if e.pubSubTokens != nil {
+		token, err := e.pubSubTokens.Token()
+		if err != nil {
+			return fmt.Errorf("couldn't get a token of the default credentials: %w", err)
+		}
+		token.SetAuthHeader(req)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, MAX_ERROR_BODY))
+	if err != nil {
+		return err
+	}
+
+	// RESOURCE_EXHAUSTED (429) and UNAVAILABLE (503) are retried like with http
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return e.throttledResponse(res, fmt.Errorf("error exporting items, request to %s responded with HTTP Status Code %d: %s",
+			req.URL, res.StatusCode, strings.TrimSpace(string(resBody))))
+	}
+
+	var pubRes pubSubPublishResponse
+	if err = json.Unmarshal(resBody, &pubRes); err != nil {
+		return fmt.Errorf("couldn't parse Pub/Sub publish response: %w", err)
+	}
+	if len(pubRes.MessageIds) != 1 {
+		return fmt.Errorf("Pub/Sub didn't publish the event %s", ce.uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/configauth"
+	"golang.org/x/oauth2"
+)
+
+type publishedRequest struct {
+	path          string
+	authorization string
+	request       pubSubPublishRequest
+}
+
+// Fake Pub/Sub publisher handing over the publish requests to the test, rejected makes it fail them
+func newPubSubServer(t *testing.T, rejected bool) (*httptest.Server, chan publishedRequest) {
+	requests := make(chan publishedRequest, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		var req pubSubPublishRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+		requests <- publishedRequest{path: r.URL.Path, authorization: r.Header.Get(HEADER_AUTHORIZATION), request: req}
+
+		if rejected {
+			http.Error(w, `{"error":{"code":404,"message":"Resource not found"}}`, http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"messageIds":["4219281937213847"]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func pubSubConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_PUBSUB
+	cfg.PubSub = PubSubSettings{Project: "k8s-prod", Topic: "events", Endpoint: endpoint}
+	cfg.SyncSend = true
+	return cfg
+}
+
+func TestPubSubAttributeMapping(t *testing.T) {
+	server, requests := newPubSubServer(t, false)
+
+	cfg := pubSubConfig(server.URL)
+	cfg.SequenceExtension = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	published := <-requests
+	assert.Equal(t, "/v1/projects/k8s-prod/topics/events:publish", published.path)
+	require.Len(t, published.request.Messages, 1)
+
+	msg := published.request.Messages[0]
+	assert.Equal(t, "uid-pod", msg.Attributes["ce-id"])
+	assert.Equal(t, "com.test.event.v1.Created", msg.Attributes["ce-type"])
+	assert.Equal(t, "test-source", msg.Attributes["ce-source"])
+	assert.Equal(t, "1.0", msg.Attributes["ce-specversion"])
+	assert.NotEmpty(t, msg.Attributes["ce-time"])
+	assert.Equal(t, "1", msg.Attributes["ce-sequence"])
+	assert.Equal(t, CONTENT_TYPE, msg.Attributes[PUBSUB_ATTR_CONTENT_TYPE])
+	assert.Empty(t, msg.OrderingKey)
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Data, &data))
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+}
+
+func TestPubSubOrderingKey(t *testing.T) {
+	server, requests := newPubSubServer(t, false)
+
+	cfg := pubSubConfig(server.URL)
+	cfg.PubSub.OrderingKey = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Equal(t, "uid-pod", (<-requests).request.Messages[0].OrderingKey)
+
+	// Keyed by the attribute instead of the uid
+	cfg = pubSubConfig(server.URL)
+	cfg.PubSub.OrderingKey = true
+	cfg.PubSub.OrderingKeyAttribute = ATTR_EVENT_NS
+	e, _ = startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Equal(t, "testns", (<-requests).request.Messages[0].OrderingKey)
+}
+
+func TestPubSubDefaultCredentials(t *testing.T) {
+	server, requests := newPubSubServer(t, false)
+
+	cfg := pubSubConfig(server.URL)
+	cfg.PubSub.DefaultCredentials = true
+	require.NoError(t, cfg.Validate())
+
+	// The token source of the default credentials, which isn't there in tests
+	e, _ := newTestExporter(t, cfg)
+	e.pubSubTokens = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "adc-token", TokenType: "Bearer"})
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	assert.Equal(t, "Bearer adc-token", (<-requests).authorization)
+}
+
+func TestPubSubPublishFailure(t *testing.T) {
+	server, _ := newPubSubServer(t, true)
+
+	e, _ := startTestExporter(t, pubSubConfig(server.URL))
+	err := e.pushLogs(context.Background(), testEvents(1, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP Status Code 404")
+}
+
+func TestPubSubThrottled(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(HEADER_RETRY_AFTER, "3")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error":{"code":429,"status":"RESOURCE_EXHAUSTED"}}`))
+		}))
+
+		e, _ := startTestExporter(t, pubSubConfig(server.URL))
+		err := e.sendPubSub(e.client, &cloudeventdata{reason: "Created", uid: "abc"})
+		var throttled *throttledError
+		require.ErrorAs(t, err, &throttled, "status %d", status)
+		assert.Equal(t, 3*time.Second, throttled.retryAfter)
+		server.Close()
+	}
+}
+
+func TestPubSubPublishURL(t *testing.T) {
+	assert.Equal(t, "https://pubsub.googleapis.com/v1/projects/p/topics/t:publish",
+		pubSubPublishURL(&PubSubSettings{Project: "p", Topic: "t"}))
+	assert.Equal(t, "http://localhost:8085/v1/projects/p/topics/t:publish",
+		pubSubPublishURL(&PubSubSettings{Project: "p", Topic: "t", Endpoint: "http://localhost:8085/"}))
+}
+
+func TestValidatePubSub(t *testing.T) {
+	cfg := pubSubConfig("")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.PubSub.Topic = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = pubSubConfig("")
+	cfg.PubSub.Project = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = pubSubConfig("")
+	cfg.PubSub.OrderingKeyAttribute = ATTR_EVENT_NS
+	assert.Error(t, cfg.Validate())
+	cfg.PubSub.OrderingKey = true
+	assert.NoError(t, cfg.Validate())
+
+	cfg = pubSubConfig("")
+	cfg.PubSub.DefaultCredentials = true
+	cfg.Auth = &configauth.Authentication{AuthenticatorID: component.NewID("oauth2client")}
+	assert.Error(t, cfg.Validate())
+}
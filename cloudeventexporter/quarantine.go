@@ -0,0 +1,68 @@
+package cloudeventexporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.uber.org/zap"
+)
+
+// Line of the quarantine file, the record as it was received and why it couldn't be converted
+type quarantineEntry struct {
+	Time       string                 `json:"time"`
+	Error      string                 `json:"error"`
+	Body       interface{}            `json:"body"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// Quarantine file where invalid events are appended as JSON lines, writes are serialized as pushLogs runs concurrently
+type quarantine struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openQuarantine(path string) (*quarantine, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open quarantine_file: %w", err)
+	}
+	return &quarantine{file: file}, nil
+}
+
+func (q *quarantine) write(lr plog.LogRecord, reason error) error {
+	line, err := json.Marshal(&quarantineEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Error:      reason.Error(),
+		Body:       lr.Body().AsRaw(),
+		Attributes: lr.Attributes().AsRaw(),
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err = q.file.Write(line)
+	return err
+}
+
+func (q *quarantine) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+// Puts the record which failed conversion in quarantine, it's dropped either way
+func (e *cloudeventTransformExporter) quarantineRecord(lr plog.LogRecord, reason error) {
+	if err := e.quarantine.write(lr, reason); err != nil {
+		e.logger.Error("Couldn't write the invalid event to quarantine_file, dropping it",
+			zap.Error(err), zap.NamedError("reason", reason))
+		return
+	}
+	e.logger.Debug("Invalid event written to quarantine_file", zap.NamedError("reason", reason))
+}
@@ -0,0 +1,61 @@
+package cloudeventexporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantineFile(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	path := filepath.Join(t.TempDir(), "quarantine.jsonl")
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.QuarantineFile = path
+
+	e, _ := startTestExporter(t, cfg)
+
+	ld := testEvents(2, "Created")
+	invalid := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	invalid.Attributes().Remove(ATTR_EVENT_UID)
+	invalid.Attributes().PutStr(ATTR_EVENT_NAME, "invalid")
+
+	// The valid event still goes through
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, "uid-pod", nextRequest(t, requests).header.Get(HEADER_CE_ID))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []quarantineEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry quarantineEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0].Error, ATTR_EVENT_UID)
+	assert.Equal(t, "Test event message", entries[0].Body)
+	assert.Equal(t, "invalid", entries[0].Attributes[ATTR_EVENT_NAME])
+}
+
+func TestInvalidEventFailsWithoutQuarantine(t *testing.T) {
+	e, _ := newTestExporter(t, testConfig())
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().Remove(ATTR_EVENT_UID)
+
+	assert.Error(t, e.pushLogs(context.Background(), ld))
+}
@@ -0,0 +1,69 @@
+package cloudeventexporter
+
+import (
+	"sync"
+)
+
+const (
+	// What enqueue does when max_queue_bytes is reached
+	ON_FULL_BLOCK = "block"
+	ON_FULL_DROP  = "drop"
+)
+
+// Serialized size of the event's data, what mostly varies from event to event
+func (ce *cloudeventdata) queuedSize(cfg *Config) int {
+	body, err := ce.dataBody(cfg)
+	if err != nil {
+		return len(ce.message)
+	}
+	return len(body)
+}
+
+// Bounds the serialized size of the events between enqueue and their send, see max_queue_bytes
+type byteLimiter struct {
+	mu    sync.Mutex
+	used  int
+	limit int
+	freed chan struct{} // closed and replaced every time bytes are released, wakes up the blocked acquires
+}
+
+func newByteLimiter(limit int) *byteLimiter {
+	return &byteLimiter{limit: limit, freed: make(chan struct{})}
+}
+
+/*
+Takes n bytes from the limit, waiting for them to be released if block is set. An event bigger than
+the limit on its own is let through when nothing else is queued, otherwise it could never be sent.
+Returns false when the bytes couldn't be taken without blocking or done got closed while waiting.
+*/
+func (l *byteLimiter) acquire(n int, block bool, done <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.used == 0 || l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return true
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		if !block {
+			return false
+		}
+
+		select {
+		case <-freed:
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (l *byteLimiter) release(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.used -= n
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,98 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Server holding every request till the test ends, so the events stay queued
+func newHangingServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server, release
+}
+
+// Events with a message of the given size
+func largeEvents(n int, size int) plog.Logs {
+	ld := testEvents(n, "Created")
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	for i := 0; i < records.Len(); i++ {
+		records.At(i).Body().SetStr(strings.Repeat("x", size))
+	}
+	return ld
+}
+
+func TestMaxQueueBytesDrop(t *testing.T) {
+	server, release := newHangingServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.MaxQueueBytes = 2500
+	cfg.OnFull = ON_FULL_DROP
+
+	e, logs := startTestExporter(t, cfg)
+	t.Cleanup(func() { close(release) })
+
+	// ceChan and the workers hold 2*CHAN_SZ events, but only 2 of these fit in max_queue_bytes
+	require.NoError(t, e.pushLogs(context.Background(), largeEvents(10, 1000)))
+	assert.Equal(t, 8, logs.FilterMessage("Event dropped, max_queue_bytes reached").Len())
+}
+
+func TestMaxQueueBytesBlock(t *testing.T) {
+	server, release := newHangingServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.MaxQueueBytes = 2500
+
+	e, _ := startTestExporter(t, cfg)
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- e.pushLogs(context.Background(), largeEvents(3, 1000))
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("pushLogs should wait for the queued bytes to be sent")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-pushed:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushLogs didn't resume after the queued events got sent")
+	}
+}
+
+func TestByteLimiter(t *testing.T) {
+	done := make(chan struct{})
+	l := newByteLimiter(100)
+
+	// An event bigger than the limit goes through when nothing else is queued
+	assert.True(t, l.acquire(150, false, done))
+	assert.False(t, l.acquire(10, false, done))
+
+	l.release(150)
+	assert.True(t, l.acquire(60, false, done))
+	assert.True(t, l.acquire(40, false, done))
+	assert.False(t, l.acquire(1, false, done))
+
+	// A blocked acquire gives up on done
+	close(done)
+	assert.False(t, l.acquire(1, true, done))
+}
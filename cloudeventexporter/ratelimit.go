@@ -0,0 +1,65 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+Token bucket capping the events per second across every reason, see rate_limit. It starts full so
+a burst of burst events goes through right away, then tokens come back at eventsPerSecond.
+*/
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // tokens per second
+	burst    float64
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(eventsPerSecond float64, burst int) *tokenBucket {
+	return &tokenBucket{
+		rate:     eventsPerSecond,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		lastFill: time.Now(),
+	}
+}
+
+// Takes a token, waiting for one if block is set. Returns false when there's none
+// without blocking, or done got closed or ctx got cancelled while waiting.
+func (b *tokenBucket) take(ctx context.Context, block bool, done <-chan struct{}) bool {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.lastFill).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.lastFill = now
+
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return true
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if !block {
+			return false
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return false
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Events alternating between a few reasons
+func mixedReasonEvents(n int) plog.Logs {
+	ld := plog.NewLogs()
+	records := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	reasons := []string{"Created", "Started", "Killing", "BackOff"}
+	for i := 0; i < n; i++ {
+		fillEvent(records.AppendEmpty(), reasons[i%len(reasons)], "pod")
+	}
+	return ld
+}
+
+func TestRateLimitDrop(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = RateLimitSettings{EventsPerSecond: 10, Burst: 5}
+	cfg.OnFull = ON_FULL_DROP
+
+	e, logs := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 100)
+
+	start := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), mixedReasonEvents(40)))
+	elapsed := time.Since(start)
+
+	// The burst, plus whatever came back while pushing
+	allowed := 5 + int(elapsed.Seconds()*10)
+	assert.GreaterOrEqual(t, len(e.ceChan), 5)
+	assert.LessOrEqual(t, len(e.ceChan), allowed)
+	assert.Equal(t, 40-len(e.ceChan), logs.FilterMessage("Event dropped, rate_limit reached").Len())
+}
+
+func TestRateLimitBlock(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = RateLimitSettings{EventsPerSecond: 50, Burst: 5}
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 100)
+
+	// 5 go right away, the other 10 come at 50 per second
+	start := time.Now()
+	require.NoError(t, e.pushLogs(context.Background(), mixedReasonEvents(15)))
+	elapsed := time.Since(start)
+
+	assert.Len(t, e.ceChan, 15)
+	assert.GreaterOrEqual(t, elapsed, 190*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestTokenBucketGivesUpOnDone(t *testing.T) {
+	b := newTokenBucket(0.001, 1)
+	done := make(chan struct{})
+
+	assert.True(t, b.take(context.Background(), true, done))
+	close(done)
+	assert.False(t, b.take(context.Background(), true, done))
+}
+
+func TestTokenBucketGivesUpOnCancelledContext(t *testing.T) {
+	b := newTokenBucket(0.001, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.True(t, b.take(ctx, true, nil))
+	cancel()
+	assert.False(t, b.take(ctx, true, nil))
+}
+
+func TestRateLimitBlockStopsOnCancelledPush(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = RateLimitSettings{EventsPerSecond: 0.001, Burst: 1}
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := e.pushLogs(ctx, mixedReasonEvents(2))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, e.ceChan, 1)
+}
@@ -0,0 +1,77 @@
+package cloudeventexporter
+
+import (
+	"net/http"
+	"sync"
+)
+
+/*
+Replaces the transport (and its connection pool) of a client once reset_connections_after requests in a row
+failed with a connection error. Pooled connections which went stale (like ones to a broker behind a load
+balancer which restarted) can keep failing every request they get, the new transport only has fresh ones.
+Responses, 5xx ones included, come from a live connection so they don't count: a 503 asks the client to back
+off, not to reconnect. The idle connections of the old one are closed, the requests still using it finish on
+their own.
+*/
+type reconnectingTransport struct {
+	mu       sync.RWMutex
+	current  http.RoundTripper
+	failures int
+
+	threshold int
+	build     func() (http.RoundTripper, error)
+}
+
+func newReconnectingTransport(current http.RoundTripper, threshold int, build func() (http.RoundTripper, error)) *reconnectingTransport {
+	return &reconnectingTransport{current: current, threshold: threshold, build: build}
+}
+
+func (r *reconnectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.RLock()
+	current := r.current
+	r.mu.RUnlock()
+
+	res, err := current.RoundTrip(req)
+	r.record(current, err == nil)
+	return res, err
+}
+
+// Counts the failures of the transport in a row and replaces it once they reach the threshold
+func (r *reconnectingTransport) record(used http.RoundTripper, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Outcome of a request sent before the transport was replaced, it says nothing about the new one
+	if used != r.current {
+		return
+	}
+	if ok {
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.failures < r.threshold {
+		return
+	}
+
+	// Keeps failing on the old one if a new one can't be built, it's tried again on the next failure
+	fresh, err := r.build()
+	if err != nil {
+		return
+	}
+	closeIdleConnections(r.current)
+	r.current = fresh
+	r.failures = 0
+}
+
+func (r *reconnectingTransport) CloseIdleConnections() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	closeIdleConnections(r.current)
+}
+
+// Closes the idle connections of the transport, if it (or http.Client for it) can
+func closeIdleConnections(rt http.RoundTripper) {
+	(&http.Client{Transport: rt}).CloseIdleConnections()
+}
@@ -0,0 +1,118 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Server failing every request on the connections it saw before stale() was called, only fresh ones get through
+type freshConnServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	seen     map[string]bool
+	rejected map[string]bool
+}
+
+func newFreshConnServer(t *testing.T) *freshConnServer {
+	s := &freshConnServer{seen: map[string]bool{}, rejected: map[string]bool{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.seen[r.RemoteAddr] = true
+		if s.rejected[r.RemoteAddr] {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *freshConnServer) stale() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for addr := range s.seen {
+		s.rejected[addr] = true
+	}
+}
+
+// Transport answering every request with the status, or failing it with err like a stale connection
+type stubTransport struct {
+	status int
+	err    error
+	calls  int
+}
+
+func (s *stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &http.Response{StatusCode: s.status, Body: http.NoBody, Request: req}, nil
+}
+
+func TestResetConnectionsAfter(t *testing.T) {
+	stale := &stubTransport{err: errors.New("connection reset by peer")}
+	fresh := &stubTransport{status: http.StatusAccepted}
+	builds := 0
+	rt := newReconnectingTransport(stale, 2, func() (http.RoundTripper, error) {
+		builds++
+		return fresh, nil
+	})
+
+	// The stale transport keeps failing till the failures reach the threshold
+	client := &http.Client{Transport: rt}
+	for i := 0; i < 2; i++ {
+		_, err := client.Post("http://sink.local", CONTENT_TYPE, http.NoBody)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1, builds)
+
+	// Then the requests go on the fresh one
+	res, err := client.Post("http://sink.local", CONTENT_TYPE, http.NoBody)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, 2, stale.calls)
+	assert.Equal(t, 1, fresh.calls)
+}
+
+func TestResetConnectionsAfterKeepsThrottledTransport(t *testing.T) {
+	throttled := &stubTransport{status: http.StatusServiceUnavailable}
+	rt := newReconnectingTransport(throttled, 2, func() (http.RoundTripper, error) {
+		t.Fatal("transport replaced for 503 responses")
+		return nil, nil
+	})
+
+	// The sink answering with 503 is live and asks to back off, the connections stay
+	client := &http.Client{Transport: rt}
+	for i := 0; i < 5; i++ {
+		res, err := client.Post("http://sink.local", CONTENT_TYPE, http.NoBody)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	}
+	assert.Equal(t, 5, throttled.calls)
+}
+
+func TestStaleConnectionsKeptByDefault(t *testing.T) {
+	server := newFreshConnServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	server.stale()
+	for i := 0; i < 3; i++ {
+		assert.Error(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	}
+}
@@ -0,0 +1,36 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net/http"
+)
+
+/*
+Sends a converted cloud-event. The workers and sync_send go through it, the configured transport (see
+transportSender) by default. Tests can inject a fake one and look at the events without any server.
+*/
+type Sender interface {
+	Send(ctx context.Context, ce *cloudeventdata) error
+}
+
+// Sends the cloud-event with the configured transport, using the client of the worker
+type transportSender struct {
+	exporter *cloudeventTransformExporter
+	client   *http.Client
+}
+
+// The requests aren't bound to ctx, the client's timeout bounds them instead
+func (s *transportSender) Send(ctx context.Context, ce *cloudeventdata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.exporter.send(s.client, ce)
+}
+
+// Sender sending with the client, unless one is injected
+func (e *cloudeventTransformExporter) senderFor(client *http.Client) Sender {
+	if e.sender != nil {
+		return e.sender
+	}
+	return &transportSender{exporter: e, client: client}
+}
@@ -0,0 +1,83 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+)
+
+// Sender handing over the events to the test instead of sending them, failing with err if set
+type fakeSender struct {
+	events chan *cloudeventdata
+	err    error
+}
+
+func (f *fakeSender) Send(_ context.Context, ce *cloudeventdata) error {
+	f.events <- ce
+	return f.err
+}
+
+// Starts the exporter with a fake sender, no server is needed
+func startFakeSenderExporter(t *testing.T, cfg *Config, err error) (*cloudeventTransformExporter, *fakeSender) {
+	sender := &fakeSender{events: make(chan *cloudeventdata, 100), err: err}
+
+	e, _ := newTestExporter(t, cfg)
+	e.sender = sender
+	require.NoError(t, e.start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, e.shutdown(context.Background()))
+	})
+	return e, sender
+}
+
+// Waits for the next event handed to the fake sender
+func nextEvent(t *testing.T, events chan *cloudeventdata) *cloudeventdata {
+	select {
+	case ce := <-events:
+		return ce
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the cloud-event")
+	}
+	return nil
+}
+
+func TestFakeSender(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:1" // never dialled
+	cfg.SequenceExtension = true
+
+	e, sender := startFakeSenderExporter(t, cfg, nil)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	ce := nextEvent(t, sender.events)
+	headers, body, err := ce.encode(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "uid-pod", headers.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.test.event.v1.Created", headers.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "test-source", headers.Get(HEADER_CE_SOURCE))
+	assert.Equal(t, "1", headers.Get("Ce-"+EXTENSION_SEQUENCE))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &data))
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+	assert.Equal(t, "pod", data[DATA_FIELD_NAME])
+	assert.Equal(t, "testns", data[DATA_FIELD_NAMESPACE])
+	assert.Equal(t, "Test event message", data[DATA_FIELD_MESSAGE])
+}
+
+func TestFakeSenderSyncError(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:1"
+	cfg.SyncSend = true
+
+	failure := errors.New("rejected")
+	e, sender := startFakeSenderExporter(t, cfg, failure)
+	assert.ErrorIs(t, e.pushLogs(context.Background(), testEvents(1, "Created")), failure)
+	assert.Equal(t, "uid-pod", nextEvent(t, sender.events).uid)
+}
@@ -0,0 +1,113 @@
+package cloudeventexporter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SIGV4_ALGORITHM   = "AWS4-HMAC-SHA256"
+	SIGV4_DATE_LAYOUT = "20060102T150405Z"
+
+	HEADER_AMZ_DATE           = "X-Amz-Date"
+	HEADER_AMZ_SECURITY_TOKEN = "X-Amz-Security-Token"
+	HEADER_AUTHORIZATION      = "Authorization"
+)
+
+// AWS credentials used for signing the requests
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+/*
+Signs the request with AWS Signature Version 4, every header present in the request at this point gets signed
+so anything added later (like confighttp headers) isn't part of the signature.
+See https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+*/
+func signV4(req *http.Request, body []byte, creds awsCredentials, region string, service string, now time.Time) {
+	amzDate := now.UTC().Format(SIGV4_DATE_LAYOUT)
+	date := amzDate[:8]
+
+	req.Header.Set(HEADER_AMZ_DATE, amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set(HEADER_AMZ_SECURITY_TOKEN, creds.sessionToken)
+	}
+
+	// Canonical headers are lower cased, sorted and always carry the host
+	headers := map[string]string{"host": req.URL.Host}
+	for key, vals := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(vals, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteRune(':')
+		canonicalHeaders.WriteString(headers[name])
+		canonicalHeaders.WriteRune('\n')
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		SIGV4_ALGORITHM,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	req.Header.Set(HEADER_AUTHORIZATION, SIGV4_ALGORITHM+
+		" Credential="+creds.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+hex.EncodeToString(hmacSHA256(signingKey, stringToSign)))
+}
+
+// Query of the canonical request, sorted by key and with spaces as %20 where url.Values.Encode gives +.
+// A literal + is already escaped as %2B so replacing them afterwards is safe
+func canonicalQuery(u *url.URL) string {
+	return strings.ReplaceAll(u.Query().Encode(), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,61 @@
+package cloudeventexporter
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Vectors from the AWS Signature Version 4 test suite (get-vanilla and post-vanilla)
+func TestSignV4(t *testing.T) {
+	creds := awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		method    string
+		signature string
+	}{
+		{method: http.MethodGet, signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{method: http.MethodPost, signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "https://example.amazonaws.com/", nil)
+			require.NoError(t, err)
+
+			signV4(req, nil, creds, "us-east-1", "service", now)
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get(HEADER_AMZ_DATE))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders=host;x-amz-date, Signature="+tt.signature, req.Header.Get(HEADER_AUTHORIZATION))
+		})
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{query: "", expected: ""},
+		{query: "Param2=value2&Param1=value1", expected: "Param1=value1&Param2=value2"},
+		{query: "Param1=a%20b&Param2=a+b", expected: "Param1=a%20b&Param2=a%20b"},
+		{query: "Param1=a%2Bb&Param2=-_.~*", expected: "Param1=a%2Bb&Param2=-_.~%2A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			u, err := url.Parse("https://example.amazonaws.com/?" + tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, canonicalQuery(u))
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package cloudeventexporter
+
+import (
+	"fmt"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+/*
+Replaces the records carrying several events in an array body with a record per event. Every element
+of the array is a map whose keys are taken as attributes of its event on top of the record's attributes,
+so the attributes common to all of them (like k8s.namespace.name) can stay on the record. The message of
+the event is the element's split_events.message_key. Ex: with the record attributes {k8s.namespace.name: ns}
+[{"k8s.event.reason": "Created", "k8s.event.uid": "1", "message": "..."}, {"k8s.event.reason": "Started", ...}]
+*/
+func splitRecords(sl plog.ScopeLogs, cfg *SplitEventsSettings) error {
+	records := sl.LogRecords()
+
+	hasArray := false
+	for i := 0; i < records.Len(); i++ {
+		if records.At(i).Body().Type() == pcommon.ValueTypeSlice {
+			hasArray = true
+			break
+		}
+	}
+	if !hasArray {
+		return nil
+	}
+
+	split := plog.NewLogRecordSlice()
+	for i := 0; i < records.Len(); i++ {
+		lr := records.At(i)
+		if lr.Body().Type() != pcommon.ValueTypeSlice {
+			lr.CopyTo(split.AppendEmpty())
+			continue
+		}
+
+		events := lr.Body().Slice()
+		for j := 0; j < events.Len(); j++ {
+			if events.At(j).Type() != pcommon.ValueTypeMap {
+				return fmt.Errorf("element %d of the log record body is a %s instead of a map", j, events.At(j).Type())
+			}
+			event := events.At(j).Map()
+
+			eventRecord := split.AppendEmpty()
+			lr.CopyTo(eventRecord)
+			eventRecord.Body().SetStr("")
+
+			event.Range(func(k string, v pcommon.Value) bool {
+				if k == cfg.MessageKey {
+					v.CopyTo(eventRecord.Body())
+				} else {
+					v.CopyTo(eventRecord.Attributes().PutEmpty(k))
+				}
+				return true
+			})
+		}
+	}
+
+	split.CopyTo(records)
+	return nil
+}
@@ -0,0 +1,92 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Record carrying the common attributes and an array of events with their own reason, name and uid
+func arrayEvents(reasons ...string) plog.Logs {
+	ld := plog.NewLogs()
+	lr := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	fillEvent(lr, "", "")
+	lr.Attributes().Remove(ATTR_EVENT_REASON)
+	lr.Attributes().Remove(ATTR_EVENT_NAME)
+	lr.Attributes().Remove(ATTR_EVENT_UID)
+
+	events := lr.Body().SetEmptySlice()
+	for _, reason := range reasons {
+		event := events.AppendEmpty().SetEmptyMap()
+		event.PutStr(ATTR_EVENT_REASON, reason)
+		event.PutStr(ATTR_EVENT_NAME, "pod-"+reason)
+		event.PutStr(ATTR_EVENT_UID, "uid-"+reason)
+		event.PutStr("message", reason+" the pod")
+	}
+	return ld
+}
+
+func TestSplitEvents(t *testing.T) {
+	cfg := testConfig()
+	cfg.SplitEvents.Enabled = true
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	require.NoError(t, e.pushLogs(context.Background(), arrayEvents("Created", "Started", "Killing")))
+	require.Len(t, e.ceChan, 3)
+
+	for _, reason := range []string{"Created", "Started", "Killing"} {
+		ce := <-e.ceChan
+		assert.Equal(t, reason, ce.reason)
+		assert.Equal(t, "pod-"+reason, ce.name)
+		assert.Equal(t, "uid-"+reason, ce.uid)
+		assert.Equal(t, reason+" the pod", ce.message)
+		assert.Equal(t, "testns", ce.namespace)
+	}
+}
+
+func TestSplitEventsFiltered(t *testing.T) {
+	cfg := testConfig()
+	cfg.Filter = "Started"
+	cfg.SplitEvents.Enabled = true
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	require.NoError(t, e.pushLogs(context.Background(), arrayEvents("Created", "Started", "Killing")))
+	require.Len(t, e.ceChan, 1)
+	assert.Equal(t, "Started", (<-e.ceChan).reason)
+}
+
+func TestSplitEventsKeepsPlainRecords(t *testing.T) {
+	cfg := testConfig()
+	cfg.SplitEvents.Enabled = true
+
+	e, _ := newTestExporter(t, cfg)
+	e.ceChan = make(chan *cloudeventdata, 10)
+
+	ld := arrayEvents("Created")
+	fillEvent(ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty(), "Deleted", "plain")
+
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	require.Len(t, e.ceChan, 2)
+	assert.Equal(t, "Created", (<-e.ceChan).reason)
+	assert.Equal(t, "Deleted", (<-e.ceChan).reason)
+}
+
+func TestSplitEventsRejectsNonMapElements(t *testing.T) {
+	cfg := testConfig()
+	cfg.SplitEvents.Enabled = true
+
+	e, _ := newTestExporter(t, cfg)
+
+	ld := plog.NewLogs()
+	lr := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	lr.Body().SetEmptySlice().AppendEmpty().SetStr("Created")
+
+	assert.Error(t, e.pushLogs(context.Background(), ld))
+}
@@ -0,0 +1,62 @@
+package cloudeventexporter
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+/*
+Bounds the requests in flight to max_concurrent_streams. With HTTP/2 every request is a stream on the
+same connection, a broker can advertise a high limit and still get overwhelmed. A request holds its
+slot till its response body is closed, as the stream stays open till then.
+*/
+type streamLimiter struct {
+	next  http.RoundTripper
+	slots chan struct{}
+}
+
+func newStreamLimiter(next http.RoundTripper, maxStreams int) *streamLimiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &streamLimiter{next: next, slots: make(chan struct{}, maxStreams)}
+}
+
+// Limiter for the round tripper sharing the slots with this one, so the limit holds across clients
+func (s *streamLimiter) wrap(next http.RoundTripper) *streamLimiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &streamLimiter{next: next, slots: s.slots}
+}
+
+func (s *streamLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case s.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+
+	res, err := s.next.RoundTrip(req)
+	if err != nil {
+		<-s.slots
+		return nil, err
+	}
+
+	res.Body = &streamBody{ReadCloser: res.Body, release: func() { <-s.slots }}
+	return res, nil
+}
+
+// Response body giving back the slot of its stream on close
+type streamBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
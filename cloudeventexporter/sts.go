@@ -0,0 +1,134 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// AWS STS AssumeRole API, see https://docs.aws.amazon.com/STS/latest/APIReference/API_AssumeRole.html
+	STS_SERVICE           = "sts"
+	STS_ACTION            = "AssumeRole"
+	STS_VERSION           = "2011-06-15"
+	STS_CONTENT_TYPE      = "application/x-www-form-urlencoded; charset=utf-8"
+	STS_SESSION_NAME      = "cloudeventexporter"
+	STS_SESSION_DURATION  = time.Hour
+	STS_EXPIRATION_WINDOW = 5 * time.Minute // credentials are renewed this long before they expire
+	STS_MAX_RESPONSE      = 64 << 10        // bytes of an AssumeRole response read at most, the credentials take a few KiB
+)
+
+type assumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleResult>Credentials"`
+}
+
+// Temporary credentials of eventbridge.role_arn, assumed on the first event and renewed before they expire
+type awsAssumedRole struct {
+	cfg   *EventBridgeSettings
+	base  awsCredentials // signs the AssumeRole requests
+	mu    sync.Mutex
+	creds awsCredentials
+	until time.Time
+}
+
+// STS endpoint for the configured region unless it's overridden
+func stsEndpoint(cfg *EventBridgeSettings) string {
+	if cfg.STSEndpoint != "" {
+		return cfg.STSEndpoint
+	}
+	return fmt.Sprintf("https://sts.%s.amazonaws.com/", cfg.Region)
+}
+
+// Credentials of the role, assumed again when they're about to expire
+func (r *awsAssumedRole) get(client *http.Client, now time.Time) (awsCredentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.Before(r.until) {
+		return r.creds, nil
+	}
+
+	res, err := r.assume(client, now)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("couldn't assume role %s: %w", r.cfg.RoleARN, err)
+	}
+
+	r.creds = awsCredentials{
+		accessKeyID:     res.Credentials.AccessKeyID,
+		secretAccessKey: res.Credentials.SecretAccessKey,
+		sessionToken:    res.Credentials.SessionToken,
+	}
+	r.until = res.Credentials.Expiration.Add(-STS_EXPIRATION_WINDOW)
+	return r.creds, nil
+}
+
+func (r *awsAssumedRole) assume(client *http.Client, now time.Time) (*assumeRoleResponse, error) {
+	sessionName := r.cfg.RoleSessionName
+	if sessionName == "" {
+		sessionName = STS_SESSION_NAME
+	}
+
+	form := url.Values{
+		"Action":          {STS_ACTION},
+		"Version":         {STS_VERSION},
+		"RoleArn":         {r.cfg.RoleARN},
+		"RoleSessionName": {sessionName},
+		"DurationSeconds": {strconv.Itoa(int(STS_SESSION_DURATION.Seconds()))},
+	}
+	if r.cfg.ExternalID != "" {
+		form.Set("ExternalId", r.cfg.ExternalID)
+	}
+	body := []byte(form.Encode())
+
+	endpoint := stsEndpoint(r.cfg)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(HEADER_CONTENT_TYPE, STS_CONTENT_TYPE)
+	signV4(req, body, r.base, r.cfg.Region, STS_SERVICE, now)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drain the body so that the connection can be re-used
+	defer func() {
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("request to %s responded with HTTP Status Code %d: %s", endpoint, res.StatusCode, readErrorBody(res))
+	}
+
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, STS_MAX_RESPONSE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(resBody) > STS_MAX_RESPONSE {
+		return nil, fmt.Errorf("AssumeRole response of %s is larger than %d bytes", endpoint, STS_MAX_RESPONSE)
+	}
+
+	var assumed assumeRoleResponse
+	if err = xml.Unmarshal(resBody, &assumed); err != nil {
+		return nil, fmt.Errorf("couldn't parse AssumeRole response: %w", err)
+	}
+	if assumed.Credentials.AccessKeyID == "" || assumed.Credentials.SecretAccessKey == "" {
+		return nil, errors.New("AssumeRole response has no credentials")
+	}
+	return &assumed, nil
+}
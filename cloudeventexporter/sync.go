@@ -0,0 +1,124 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.uber.org/multierr"
+)
+
+/*
+Sends the events of a pushLogs call before returning, up to CHAN_SZ requests at a time, so that the
+pipeline gets to know about failures. Nothing is sent till startup_delay elapses. Throttled sends are
+returned as throttle retry for exporterhelper to retry the logs after the wait asked by the server.
+With batch enabled events go in batches of max_size.
+*/
+func (e *cloudeventTransformExporter) sendSync(ctx context.Context, events []*cloudeventdata) error {
+	// The events which didn't make it are released from uid_min_interval, exporterhelper's retry of the push
+	// converts and emits them again
+	var (
+		deliveredMu sync.Mutex
+		delivered   = make(map[*cloudeventdata]bool, len(events))
+	)
+	markDelivered := func(ce *cloudeventdata) {
+		e.recordDelivered(ce)
+		deliveredMu.Lock()
+		delivered[ce] = true
+		deliveredMu.Unlock()
+	}
+	defer func() {
+		for _, ce := range events {
+			if !delivered[ce] {
+				e.releaseUid(ce)
+			}
+		}
+	}()
+
+	select {
+	case <-e.ready:
+	case <-e.done:
+		return errShuttingDown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	live := make([]*cloudeventdata, 0, len(events))
+	for _, ce := range events {
+		if !e.expired(e.logger, ce) {
+			live = append(live, ce)
+		}
+	}
+	events = live
+
+	var sends []func() error
+
+	if e.config.Batch.Enabled {
+		for start := 0; start < len(events); start += e.config.Batch.MaxSize {
+			end := start + e.config.Batch.MaxSize
+			if end > len(events) {
+				end = len(events)
+			}
+
+			batch := events[start:end]
+			sends = append(sends, func() error {
+				err := e.sendBatch(e.client, batch)
+				for _, ce := range deliveredOf(batch, err) {
+					markDelivered(ce)
+				}
+				return err
+			})
+		}
+	} else {
+		sender := e.senderFor(e.client)
+		for _, ce := range events {
+			ce := ce
+			sends = append(sends, func() error {
+				if err := sender.Send(ctx, ce); err != nil {
+					return err
+				}
+				markDelivered(ce)
+				return nil
+			})
+		}
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs error
+	)
+	slots := make(chan struct{}, CHAN_SZ)
+
+	for _, send := range sends {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return multierr.Append(errs, ctx.Err())
+		}
+
+		wg.Add(1)
+		go func(send func() error) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			if err := send(); err != nil {
+				var throttled *throttledError
+				if errors.As(err, &throttled) {
+					err = exporterhelper.NewThrottleRetry(throttled.err, throttled.retryAfter)
+				}
+
+				mu.Lock()
+				errs = multierr.Append(errs, err)
+				mu.Unlock()
+			}
+		}(send)
+	}
+
+	wg.Wait()
+	return errs
+}
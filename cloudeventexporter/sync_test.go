@@ -0,0 +1,145 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncSendWaitsForDelivery(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slow server, an async pushLogs would return long before it's done
+		time.Sleep(20 * time.Millisecond)
+		received.Add(1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(5, "Created")))
+	assert.Equal(t, int32(5), received.Load())
+}
+
+func TestSyncSendReturnsFailures(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every other event fails
+		if received.Add(1)%2 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	err := e.pushLogs(context.Background(), testEvents(4, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP Status Code 500")
+	assert.Equal(t, int32(4), received.Load())
+}
+
+func TestSyncSendBatches(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+	cfg.Batch = BatchSettings{Enabled: true, MaxSize: 2, FlushInterval: time.Hour}
+
+	e, _ := startTestExporter(t, cfg)
+
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(5, "Created")))
+
+	// 5 events in batches of 2, everything is delivered before pushLogs returns
+	assert.Len(t, requests, 3)
+}
+
+func TestSyncSendStreamsLargeBatch(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case arrived <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+	cfg.StreamSize = 50
+	cfg.SequenceExtension = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	const events = 5000
+	ld := largeEvents(events, 1024)
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- e.pushLogs(context.Background(), ld)
+	}()
+
+	// The conversion waits for the first events to be delivered, the sequence counts the converted ones
+	select {
+	case <-arrived:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the cloud-event")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, uint64(cfg.StreamSize), e.sequence.Load())
+
+	close(release)
+	select {
+	case err := <-pushed:
+		require.NoError(t, err)
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for the batch to be sent")
+	}
+	assert.Equal(t, uint64(events), e.sequence.Load())
+}
+
+func TestSyncSendStreamReturnsFailures(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the first event fails, the rest of the batch is still sent
+		if received.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.SyncSend = true
+	cfg.StreamSize = 2
+
+	e, _ := startTestExporter(t, cfg)
+
+	err := e.pushLogs(context.Background(), testEvents(5, "Created"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP Status Code 500")
+	assert.Equal(t, int32(5), received.Load())
+}
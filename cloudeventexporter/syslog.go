@@ -0,0 +1,144 @@
+package cloudeventexporter
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RFC5424 syslog, see https://www.rfc-editor.org/rfc/rfc5424
+	SYSLOG_VERSION     = 1
+	SYSLOG_SEVERITY    = 6 // informational
+	SYSLOG_NIL         = "-"
+	SYSLOG_TIME_LAYOUT = "2006-01-02T15:04:05.999999Z07:00" // RFC3339 with at most 6 fraction digits
+	SYSLOG_SD_ID       = "cloudevent@32473"                 // 32473 is the enterprise number reserved for examples
+	SYSLOG_APP_NAME    = "cloudeventexporter"
+
+	SYSLOG_NETWORK_TCP = "tcp"
+	SYSLOG_NETWORK_UDP = "udp"
+)
+
+// Escapes '"', '\' and ']' as required in structured data parameter values
+var syslogParamEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+/*
+Formats the cloud-event as RFC5424 syslog message, its attributes and extensions go in the structured data
+and the data is the message. Looks like
+<14>1 2023-04-01T10:00:00Z host cloudeventexporter - - [cloudevent@32473 id="" source="" specversion="1.0" type=""] {"reason":"",...}
+*/
+func (ce *cloudeventdata) syslogMessage(cfg *Config, hostname string) ([]byte, error) {
+	event, err := ce.structured(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := SYSLOG_NIL
+	if !ce.time.IsZero() {
+		timestamp = ce.time.Format(SYSLOG_TIME_LAYOUT)
+	}
+	if hostname == "" {
+		hostname = SYSLOG_NIL
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>%d %s %s %s %s %s [%s",
+		cfg.Syslog.Facility*8+SYSLOG_SEVERITY, SYSLOG_VERSION, timestamp, hostname, cfg.Syslog.AppName, SYSLOG_NIL, SYSLOG_NIL, SYSLOG_SD_ID)
+
+	params := map[string]interface{}{
+		"id":          event.ID,
+		"source":      event.Source,
+		"type":        event.Type,
+		"specversion": event.SpecVersion,
+	}
+	if event.Time != "" {
+		params["time"] = event.Time
+	}
+	for name, val := range event.Extensions {
+		params[name] = val
+	}
+
+	// Sorted so the output is stable
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&buf, ` %s="%s"`, name, syslogParamEscaper.Replace(fmt.Sprint(params[name])))
+	}
+
+	buf.WriteString("] ")
+	buf.Write(event.Data)
+	return buf.Bytes(), nil
+}
+
+// Connection to the syslog endpoint shared by the workers, re-dialled after a failed write
+type syslogConn struct {
+	mu       sync.Mutex
+	network  string
+	address  string
+	timeout  time.Duration
+	hostname string // HOSTNAME of the messages
+	conn     net.Conn
+}
+
+/*
+Writes the message, octet counted ("<length> <message>") over tcp as per RFC6587 and
+a datagram per message over udp. The connection is dropped on failure so the next
+message dials again instead of writing to a broken one.
+*/
+func (s *syslogConn) write(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+		if err != nil {
+			return fmt.Errorf("couldn't connect to syslog endpoint %s: %w", s.address, err)
+		}
+		s.conn = conn
+	}
+
+	if s.network == SYSLOG_NETWORK_TCP {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	err := s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if err == nil {
+		_, err = s.conn.Write(msg)
+	}
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("error exporting items to syslog endpoint %s: %w", s.address, err)
+	}
+	return nil
+}
+
+func (s *syslogConn) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// Formats the cloud-event as syslog message and writes it to the syslog endpoint
+func (e *cloudeventTransformExporter) sendSyslog(ce *cloudeventdata) error {
+	msg, err := ce.syslogMessage(e.config, e.syslog.hostname)
+	if err != nil {
+		return err
+	}
+	return e.syslog.write(msg)
+}
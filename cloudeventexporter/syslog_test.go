@@ -0,0 +1,151 @@
+package cloudeventexporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+var syslogPattern = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) - - \[cloudevent@32473 ([^\]]*)\] (.*)$`)
+
+// Fake syslog server reading octet counted messages, hands them over to the test
+func newSyslogTCPListener(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	messages := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					length, err := reader.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, err := strconv.Atoi(length[:len(length)-1])
+					if !assert.NoError(t, err) {
+						return
+					}
+					msg := make([]byte, n)
+					if _, err = io.ReadFull(reader, msg); err != nil {
+						return
+					}
+					messages <- string(msg)
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), messages
+}
+
+func nextSyslogMessage(t *testing.T, messages chan string) string {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the syslog message")
+	}
+	return ""
+}
+
+func syslogConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Transport = TRANSPORT_SYSLOG
+	cfg.Syslog.Endpoint = endpoint
+	return cfg
+}
+
+func TestSyslogMessageFormat(t *testing.T) {
+	endpoint, messages := newSyslogTCPListener(t)
+	t.Setenv(ENV_POD_NAME, "collector-0")
+
+	cfg := syslogConfig(endpoint)
+	cfg.Syslog.Facility = 16 // local0
+	cfg.SequenceExtension = true
+	require.NoError(t, cfg.Validate())
+
+	e, _ := startTestExporter(t, cfg)
+	ld := testEvents(1, "Created")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Body().SetStr(`say "hi" [now]`)
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	msg := nextSyslogMessage(t, messages)
+	parts := syslogPattern.FindStringSubmatch(msg)
+	require.NotNil(t, parts, msg)
+
+	assert.Equal(t, "134", parts[1]) // 16*8 + informational
+	_, err := time.Parse(time.RFC3339Nano, parts[2])
+	assert.NoError(t, err)
+	assert.Equal(t, "collector-0", parts[3])
+	assert.Equal(t, SYSLOG_APP_NAME, parts[4])
+	assert.Regexp(t, `^id="[^"]+" sequence="1" sequencetype="Integer" source="test-source" specversion="1.0" time="[^"]+" type="com.test.event.v1.Created"$`, parts[5])
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(parts[6]), &data))
+	assert.Equal(t, "Created", data[DATA_FIELD_REASON])
+	assert.Equal(t, `say "hi" [now]`, data[DATA_FIELD_MESSAGE])
+}
+
+func TestSyslogParamEscaping(t *testing.T) {
+	ce := &cloudeventdata{uid: `a"b]c\d`, reason: "Created"}
+	msg, err := ce.syslogMessage(syslogConfig("localhost:514"), "")
+	require.NoError(t, err)
+	assert.Contains(t, string(msg), ` - `+SYSLOG_APP_NAME+` - - `)
+	assert.Contains(t, string(msg), `id="a\"b\]c\\d"`)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cfg := syslogConfig(conn.LocalAddr().String())
+	cfg.Syslog.Network = SYSLOG_NETWORK_UDP
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+
+	buf := make([]byte, 64*1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	// A datagram per message, without the octet count
+	assert.Regexp(t, syslogPattern, string(buf[:n]))
+}
+
+func TestSyslogReconnects(t *testing.T) {
+	endpoint, messages := newSyslogTCPListener(t)
+
+	cfg := syslogConfig(endpoint)
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	nextSyslogMessage(t, messages)
+
+	// A broken connection is dialled again on the next event
+	e.syslog.conn.Close()
+	require.Error(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Created")))
+	nextSyslogMessage(t, messages)
+}
@@ -0,0 +1,238 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Length of the series hash in the id of the threshold events
+const SERIES_HASH_LEN = 16
+
+// How the message of a threshold event words the op, like "k8s.pod.memory.usage is 1.2e+09, above 1e+09"
+var thresholdOpWords = map[string]string{
+	THRESHOLD_OP_GT:  "above",
+	THRESHOLD_OP_GTE: "at or above",
+	THRESHOLD_OP_LT:  "below",
+	THRESHOLD_OP_LTE: "at or below",
+}
+
+// Datapoint which crossed the threshold of a rule, the metric key of the data
+type thresholdCrossing struct {
+	Name       string                 `json:"name"`
+	Value      float64                `json:"value"`
+	Op         string                 `json:"op"`
+	Threshold  float64                `json:"threshold"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"` // of the datapoint
+	Resource   map[string]interface{} `json:"resource,omitempty"`   // attributes of the resource
+}
+
+// Whether the rule holds for the value
+func (rule *ThresholdRule) holds(value float64) bool {
+	switch rule.Op {
+	case THRESHOLD_OP_GT:
+		return value > rule.Value
+	case THRESHOLD_OP_GTE:
+		return value >= rule.Value
+	case THRESHOLD_OP_LT:
+		return value < rule.Value
+	case THRESHOLD_OP_LTE:
+		return value <= rule.Value
+	}
+	return false
+}
+
+/*
+Series (rule, resource and datapoint attributes) whose last datapoint was beyond the threshold. A series is only
+exported when it crosses the threshold, the datapoints staying beyond it don't send anything till it's back.
+Series of a collector restart start below the threshold, so the ones already beyond it are exported once more.
+*/
+type thresholdState struct {
+	mu     sync.Mutex
+	beyond map[string]bool
+}
+
+func newThresholdState() *thresholdState {
+	return &thresholdState{beyond: make(map[string]bool)}
+}
+
+// Records whether the series is beyond the threshold, true when it just crossed it
+func (s *thresholdState) crossed(series string, beyond bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	was := s.beyond[series]
+	if beyond {
+		s.beyond[series] = true
+	} else {
+		delete(s.beyond, series)
+	}
+	return beyond && !was
+}
+
+// Key of the rule's series, its attributes are marshalled with sorted keys so it's stable
+func seriesKey(ruleIndex int, resource map[string]interface{}, attrs map[string]interface{}) string {
+	resourceJSON, _ := json.Marshal(resource)
+	attrsJSON, _ := json.Marshal(attrs)
+	return strconv.Itoa(ruleIndex) + "\x00" + string(resourceJSON) + "\x00" + string(attrsJSON)
+}
+
+// Value of the datapoint whatever its type
+func numberValue(dp pmetric.NumberDataPoint) (float64, bool) {
+	switch dp.ValueType() {
+	case pmetric.NumberDataPointValueTypeInt:
+		return float64(dp.IntValue()), true
+	case pmetric.NumberDataPointValueTypeDouble:
+		return dp.DoubleValue(), true
+	}
+	return 0, false
+}
+
+// Gauge and sum datapoints of the metric, the other types don't have a single value to compare
+func numberDataPoints(m pmetric.Metric) (pmetric.NumberDataPointSlice, bool) {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints(), true
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints(), true
+	}
+	return pmetric.NumberDataPointSlice{}, false
+}
+
+/*
+Converts the datapoint which crossed the rule's threshold into a cloud-event. The reason is the rule's (the metric's
+name when it doesn't have one), the namespace the resource's mapping.namespace and the uid a hash of the series
+with the datapoint's timestamp, so every crossing has an id of its own.
+*/
+func thresholdToCloudEvent(rule *ThresholdRule, series string, value float64, dp pmetric.NumberDataPoint, resource pcommon.Map, cfg *Config) *cloudeventdata {
+	reason := rule.Reason
+	if reason == "" {
+		reason = rule.Metric
+	}
+
+	crossing := &thresholdCrossing{
+		Name:       rule.Metric,
+		Value:      value,
+		Op:         rule.Op,
+		Threshold:  rule.Value,
+		Attributes: dp.Attributes().AsRaw(),
+		Resource:   resource.AsRaw(),
+	}
+
+	sum := sha256.Sum256([]byte(series))
+	ce := &cloudeventdata{
+		count:   1,
+		name:    rule.Metric,
+		reason:  reason,
+		uid:     hex.EncodeToString(sum[:])[:SERIES_HASH_LEN] + "-" + strconv.FormatUint(uint64(dp.Timestamp()), 10),
+		message: fmt.Sprintf("%s is %v, %s %v", rule.Metric, value, thresholdOpWords[rule.Op], rule.Value),
+		metric:  crossing,
+	}
+
+	if ns, ok := resource.Get(cfg.Mapping.Namespace); ok {
+		ce.namespace = ns.AsString()
+	}
+
+	if dp.Timestamp() != 0 {
+		ce.time = dp.Timestamp().AsTime()
+		ce.startTime = ce.time.Format(timeLayout(cfg.TimeFormat))
+	}
+
+	if cfg.Ce.SourceAttribute != "" {
+		if source, ok := resource.Get(cfg.Ce.SourceAttribute); ok && source.AsString() != "" {
+			ce.source = source.AsString()
+		}
+	}
+
+	// Looked up in the datapoint's attributes and then the resource's
+	if attribute := cfg.partitionKeyAttribute(); attribute != "" {
+		for _, m := range []pcommon.Map{dp.Attributes(), resource} {
+			if key, ok := m.Get(attribute); ok {
+				ce.partitionKey = key.AsString()
+				break
+			}
+		}
+	}
+	return ce
+}
+
+/*
+Evaluates metrics.rules on the gauge and sum datapoints, the ones crossing a threshold are exported as cloud-events
+through the same sending as the converted log records. Nothing is exported without rules.
+*/
+func (e *cloudeventTransformExporter) pushMetrics(ctx context.Context, md pmetric.Metrics) error {
+	if md.DataPointCount() == 0 {
+		if e.config.CountEmptyBatches {
+			e.logger.Debug("Received metrics without any datapoint")
+			e.metrics.addEmptyBatch(ctx)
+		}
+		return nil
+	}
+
+	var summary batchSummary
+	defer e.recordBatchSummary(ctx, &summary)
+
+	var converted []*cloudeventdata
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		resource := rm.Resource().Attributes()
+		var resourceRaw map[string]interface{}
+
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			metrics := rm.ScopeMetrics().At(j).Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				m := metrics.At(k)
+				dps, ok := numberDataPoints(m)
+				if !ok {
+					continue
+				}
+
+				for r := range e.config.Metrics.Rules {
+					rule := &e.config.Metrics.Rules[r]
+					if rule.Metric != m.Name() {
+						continue
+					}
+					if resourceRaw == nil {
+						resourceRaw = resource.AsRaw()
+					}
+
+					for d := 0; d < dps.Len(); d++ {
+						dp := dps.At(d)
+						value, ok := numberValue(dp)
+						if !ok {
+							continue
+						}
+						summary.received++
+
+						series := seriesKey(r, resourceRaw, dp.Attributes().AsRaw())
+						if !e.thresholds.crossed(series, rule.holds(value)) {
+							summary.filtered++
+							continue
+						}
+						converted = append(converted, thresholdToCloudEvent(rule, series, value, dp, resource, e.config))
+					}
+				}
+			}
+		}
+	}
+	summary.converted = len(converted)
+
+	if e.config.SortByTime {
+		sortByTime(converted)
+	}
+
+	emit, flush := e.newEmitter(ctx, &summary)
+	for _, ce := range converted {
+		if err := emit(ce); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
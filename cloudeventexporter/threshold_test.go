@@ -0,0 +1,138 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Returns metrics with a memory usage gauge datapoint of the pod
+func testMetrics(usage int64, at time.Time) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr(ATTR_EVENT_NS, "testns")
+	rm.Resource().Attributes().PutStr("k8s.pod.name", "pod")
+	m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("k8s.pod.memory.usage")
+	dp := m.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetIntValue(usage)
+	dp.SetTimestamp(pcommon.NewTimestampFromTime(at))
+	dp.Attributes().PutStr("container", "app")
+	return md
+}
+
+func thresholdConfig(endpoint string) *Config {
+	cfg := testConfig()
+	cfg.Endpoint = endpoint
+	cfg.Metrics.Rules = []ThresholdRule{{Metric: "k8s.pod.memory.usage", Op: THRESHOLD_OP_GT, Value: 1000, Reason: "MemoryHigh"}}
+	return cfg
+}
+
+func TestPushMetricsThresholdCrossed(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	e, _ := startTestExporter(t, thresholdConfig(server.URL))
+
+	at := time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, e.pushMetrics(context.Background(), testMetrics(500, at)))
+	require.NoError(t, e.pushMetrics(context.Background(), testMetrics(1500, at.Add(time.Minute))))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "com.test.event.v1.MemoryHigh", req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "2023-04-01T10:01:00Z", req.header.Get(HEADER_CE_TIME))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "k8s.pod.memory.usage", data["name"])
+	assert.Equal(t, "testns", data["namespace"])
+	assert.Equal(t, "k8s.pod.memory.usage is 1500, above 1000", data["message"])
+	assert.Equal(t, map[string]interface{}{
+		"name":       "k8s.pod.memory.usage",
+		"value":      1500.0,
+		"op":         THRESHOLD_OP_GT,
+		"threshold":  1000.0,
+		"attributes": map[string]interface{}{"container": "app"},
+		"resource":   map[string]interface{}{ATTR_EVENT_NS: "testns", "k8s.pod.name": "pod"},
+	}, data["metric"])
+
+	// Staying above the threshold doesn't send anything, crossing it again does
+	require.NoError(t, e.pushMetrics(context.Background(), testMetrics(1600, at.Add(2*time.Minute))))
+	require.NoError(t, e.pushMetrics(context.Background(), testMetrics(900, at.Add(3*time.Minute))))
+	require.NoError(t, e.pushMetrics(context.Background(), testMetrics(1700, at.Add(4*time.Minute))))
+
+	req = nextRequest(t, requests)
+	assert.Equal(t, "2023-04-01T10:04:00Z", req.header.Get(HEADER_CE_TIME))
+	select {
+	case req := <-requests:
+		t.Fatalf("unexpected cloud-event %s", req.header.Get(HEADER_CE_TIME))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestThresholdSeries(t *testing.T) {
+	e, sender := startFakeSenderExporter(t, thresholdConfig("http://localhost"), nil)
+
+	// Every pod is a series of its own, the other metrics aren't looked at
+	md := testMetrics(1500, time.Now())
+	other := md.ResourceMetrics().AppendEmpty()
+	other.Resource().Attributes().PutStr("k8s.pod.name", "other")
+	metrics := other.ScopeMetrics().AppendEmpty().Metrics()
+	gauge := metrics.AppendEmpty()
+	gauge.SetName("k8s.pod.memory.usage")
+	gauge.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(2000.5)
+	cpu := metrics.AppendEmpty()
+	cpu.SetName("k8s.pod.cpu.usage")
+	cpu.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(5000)
+
+	require.NoError(t, e.pushMetrics(context.Background(), md))
+
+	values := map[float64]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case ce := <-sender.events:
+			assert.Equal(t, "MemoryHigh", ce.reason)
+			values[ce.metric.Value] = ce.uid
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the cloud-event")
+		}
+	}
+	require.Len(t, values, 2)
+	assert.NotEqual(t, values[1500], values[2000.5])
+}
+
+func TestThresholdRuleHolds(t *testing.T) {
+	rule := ThresholdRule{Value: 10}
+	for op, want := range map[string][3]bool{
+		THRESHOLD_OP_GT:  {false, false, true},
+		THRESHOLD_OP_GTE: {false, true, true},
+		THRESHOLD_OP_LT:  {true, false, false},
+		THRESHOLD_OP_LTE: {true, true, false},
+	} {
+		rule.Op = op
+		assert.Equal(t, want, [3]bool{rule.holds(9), rule.holds(10), rule.holds(11)}, op)
+	}
+}
+
+func TestCreateMetricsExporter(t *testing.T) {
+	exp, err := NewFactory().CreateMetricsExporter(context.Background(), exportertest.NewNopCreateSettings(), thresholdConfig("http://localhost:8080"))
+	require.NoError(t, err)
+	assert.NotNil(t, exp)
+}
+
+func TestValidateMetrics(t *testing.T) {
+	cfg := thresholdConfig("http://localhost:8080")
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Metrics.Rules[0].Op = ">"
+	assert.Error(t, cfg.Validate())
+
+	cfg = thresholdConfig("http://localhost:8080")
+	cfg.Metrics.Rules[0].Metric = ""
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,56 @@
+package cloudeventexporter
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+When every uid was last emitted, see uid_min_interval. A uid is suppressed till the interval passes since it
+was last emitted. Entries are only needed for the interval, the expired ones are swept once every interval
+so the map doesn't grow with every uid ever seen.
+*/
+type uidThrottle struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	lastSent  map[string]time.Time
+	lastSweep time.Time
+}
+
+func newUidThrottle(interval time.Duration) *uidThrottle {
+	return &uidThrottle{
+		interval:  interval,
+		lastSent:  make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// Returns false if the uid was emitted within the interval, otherwise takes it as emitted now
+func (t *uidThrottle) allow(uid string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.lastSweep) >= t.interval {
+		for id, sent := range t.lastSent {
+			if now.Sub(sent) >= t.interval {
+				delete(t.lastSent, id)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	if sent, ok := t.lastSent[uid]; ok && now.Sub(sent) < t.interval {
+		return false
+	}
+	t.lastSent[uid] = now
+	return true
+}
+
+// Forgets that the uid was emitted, the event didn't go out after all so the next one of the uid (like the retry
+// of a failed push) isn't suppressed
+func (t *uidThrottle) release(uid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.lastSent, uid)
+}
@@ -0,0 +1,114 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUidMinInterval(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.UidMinInterval = 300 * time.Millisecond
+	cfg.SyncSend = true
+	require.NoError(t, cfg.Validate())
+
+	e, logs := startTestExporter(t, cfg)
+
+	// Within the interval only the first one of uid-pod goes out, other uids aren't affected
+	ld := testEvents(2, "Created")
+	fillEvent(ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty(), "Created", "other")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Updated")))
+
+	ids := []string{nextRequest(t, requests).header.Get(HEADER_CE_ID), nextRequest(t, requests).header.Get(HEADER_CE_ID)}
+	assert.ElementsMatch(t, []string{"uid-pod", "uid-other"}, ids)
+	assert.Len(t, requests, 0)
+	assert.Equal(t, 2, logs.FilterMessage("Event dropped, uid emitted within uid_min_interval").Len())
+
+	// Past the interval it's emitted again
+	time.Sleep(cfg.UidMinInterval)
+	require.NoError(t, e.pushLogs(context.Background(), testEvents(1, "Updated")))
+	assert.Equal(t, "com.test.event.v1.Updated", nextRequest(t, requests).header.Get(HEADER_CE_TYPE))
+}
+
+func TestUidMinIntervalRetryOfFailedSend(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.UidMinInterval = time.Minute
+	cfg.SyncSend = true
+
+	e, logs := startTestExporter(t, cfg)
+
+	// exporterhelper pushes the logs again after the failure, within the interval
+	ld := testEvents(1, "Created")
+	require.Error(t, e.pushLogs(context.Background(), ld))
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, int32(2), attempts.Load())
+	assert.Equal(t, 0, logs.FilterMessage("Event dropped, uid emitted within uid_min_interval").Len())
+
+	// Once delivered the uid is suppressed
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestUidMinIntervalBeforeRateLimit(t *testing.T) {
+	server, requests := newCaptureServer(t)
+
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.UidMinInterval = time.Minute
+	cfg.RateLimit = RateLimitSettings{EventsPerSecond: 0.001, Burst: 2}
+	cfg.OnFull = ON_FULL_DROP
+	cfg.SyncSend = true
+
+	e, _ := startTestExporter(t, cfg)
+
+	// The suppressed duplicates of uid-pod leave the second token to uid-other
+	ld := testEvents(3, "Created")
+	fillEvent(ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().AppendEmpty(), "Created", "other")
+	require.NoError(t, e.pushLogs(context.Background(), ld))
+
+	ids := []string{nextRequest(t, requests).header.Get(HEADER_CE_ID), nextRequest(t, requests).header.Get(HEADER_CE_ID)}
+	assert.ElementsMatch(t, []string{"uid-pod", "uid-other"}, ids)
+}
+
+func TestUidThrottleSweeps(t *testing.T) {
+	throttle := newUidThrottle(50 * time.Millisecond)
+	assert.True(t, throttle.allow("a"))
+	assert.True(t, throttle.allow("b"))
+	assert.False(t, throttle.allow("a"))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, throttle.allow("c"))
+
+	// Only the uid emitted within the interval is kept
+	throttle.mu.Lock()
+	defer throttle.mu.Unlock()
+	assert.Len(t, throttle.lastSent, 1)
+	assert.Contains(t, throttle.lastSent, "c")
+}
+
+func TestValidateUidMinInterval(t *testing.T) {
+	cfg := testConfig()
+	cfg.UidMinInterval = -time.Second
+	assert.Error(t, cfg.Validate())
+}
@@ -0,0 +1,176 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+const (
+	// Distributed tracing extension, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/extensions/distributed-tracing.md
+	EXTENSION_TRACE_PARENT = "traceparent"
+	EXTENSION_TRACE_STATE  = "tracestate"
+
+	// Ids of the span as extensions of their own, brokers can filter on them without parsing traceparent
+	EXTENSION_TRACE_ID = "traceid"
+	EXTENSION_SPAN_ID  = "spanid"
+
+	// W3C trace context version and trace flags. The spans of this pdata version don't have their flags (Span.Flags
+	// comes with pdata v1.3), the spans reaching an exporter are taken as sampled
+	TRACE_PARENT_VERSION = "00"
+	TRACE_FLAGS_SAMPLED  = "01"
+
+	// Message of the exception span events as per the semantic conventions
+	ATTR_EXCEPTION_MESSAGE = "exception.message"
+)
+
+/*
+Converts the span into a cloud-event, its name is the reason and its status message the message. The namespace
+comes from the resource's mapping.namespace and the uid is the span id, so the updates of a span keep their key.
+*/
+func spanToCloudEvent(span ptrace.Span, rs ptrace.ResourceSpans, cfg *Config) *cloudeventdata {
+	ce := spanCloudEvent(span, rs, span.Name(), span.StartTimestamp(), span.Attributes(), cfg)
+	ce.uid = span.SpanID().String()
+	ce.message = span.Status().Message()
+	ce.messageMissing = ce.message == ""
+	return ce
+}
+
+// Converts the index-th event of the span into a cloud-event, like spanToCloudEvent with the event's name,
+// time and attributes, its exception.message is the message
+func spanEventToCloudEvent(event ptrace.SpanEvent, index int, span ptrace.Span, rs ptrace.ResourceSpans, cfg *Config) *cloudeventdata {
+	ce := spanCloudEvent(span, rs, event.Name(), event.Timestamp(), event.Attributes(), cfg)
+	ce.uid = span.SpanID().String() + "-" + strconv.Itoa(index)
+	if message, ok := event.Attributes().Get(ATTR_EXCEPTION_MESSAGE); ok {
+		ce.message = message.AsString()
+	} else {
+		ce.messageMissing = true
+	}
+	return ce
+}
+
+// Fields and extensions shared by the spans and their events
+func spanCloudEvent(span ptrace.Span, rs ptrace.ResourceSpans, reason string, timestamp pcommon.Timestamp, attrs pcommon.Map, cfg *Config) *cloudeventdata {
+	if reason == "" {
+		reason = cfg.ReasonPlaceholder
+	}
+
+	ce := &cloudeventdata{
+		count:  1,
+		name:   span.Name(),
+		reason: reason,
+	}
+
+	resource := rs.Resource().Attributes()
+	if ns, ok := resource.Get(cfg.Mapping.Namespace); ok {
+		ce.namespace = ns.AsString()
+	}
+
+	if timestamp != 0 {
+		ce.time = timestamp.AsTime()
+		ce.startTime = ce.time.Format(timeLayout(cfg.TimeFormat))
+	}
+
+	if cfg.Ce.SourceAttribute != "" {
+		if source, ok := resource.Get(cfg.Ce.SourceAttribute); ok && source.AsString() != "" {
+			ce.source = source.AsString()
+		}
+	}
+
+	// Looked up in the event's (or span's) attributes, then the span's and then the resource's
+	if attribute := cfg.partitionKeyAttribute(); attribute != "" {
+		for _, m := range []pcommon.Map{attrs, span.Attributes(), resource} {
+			if key, ok := m.Get(attribute); ok {
+				ce.partitionKey = key.AsString()
+				break
+			}
+		}
+	}
+
+	traceID, spanID := span.TraceID().String(), span.SpanID().String()
+	ce.setExtension(EXTENSION_TRACE_ID, traceID)
+	ce.setExtension(EXTENSION_SPAN_ID, spanID)
+	ce.setExtension(EXTENSION_TRACE_PARENT, fmt.Sprintf("%s-%s-%s-%s", TRACE_PARENT_VERSION, traceID, spanID, TRACE_FLAGS_SAMPLED))
+	if state := span.TraceState().AsRaw(); state != "" {
+		ce.setExtension(EXTENSION_TRACE_STATE, state)
+	}
+
+	if cfg.IncludeOtelAttributes {
+		ce.attributes = attrs.AsRaw()
+	}
+	ce.resource = cfg.resourceAttributes(resource)
+	return ce
+}
+
+// Span events exported with traces.event_names, every one of them without it
+func (e *cloudeventTransformExporter) exportedSpanEvent(name string) bool {
+	if len(e.config.Traces.EventNames) == 0 {
+		return true
+	}
+	for _, exported := range e.config.Traces.EventNames {
+		if exported == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Exports the span events (or the spans with traces.source spans) as cloud-events, they go through the same
+sending as the converted log records. The filters on log records (filter, namespace_filter, attribute_filters)
+don't apply to them, traces.event_names picks the span events instead.
+*/
+func (e *cloudeventTransformExporter) pushTraces(ctx context.Context, td ptrace.Traces) error {
+	if td.SpanCount() == 0 {
+		if e.config.CountEmptyBatches {
+			e.logger.Debug("Received traces without any span")
+			e.metrics.addEmptyBatch(ctx)
+		}
+		return nil
+	}
+
+	var summary batchSummary
+	defer e.recordBatchSummary(ctx, &summary)
+
+	var converted []*cloudeventdata
+	for i := 0; i < td.ResourceSpans().Len(); i++ {
+		rs := td.ResourceSpans().At(i)
+		for j := 0; j < rs.ScopeSpans().Len(); j++ {
+			spans := rs.ScopeSpans().At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				if e.config.Traces.Source == TRACES_SOURCE_SPANS {
+					summary.received++
+					converted = append(converted, spanToCloudEvent(span, rs, e.config))
+					continue
+				}
+
+				for l := 0; l < span.Events().Len(); l++ {
+					event := span.Events().At(l)
+					summary.received++
+					if !e.exportedSpanEvent(event.Name()) {
+						summary.filtered++
+						continue
+					}
+					converted = append(converted, spanEventToCloudEvent(event, l, span, rs, e.config))
+				}
+			}
+		}
+	}
+	summary.converted = len(converted)
+
+	if e.config.SortByTime {
+		sortByTime(converted)
+	}
+
+	emit, flush := e.newEmitter(ctx, &summary)
+	for _, ce := range converted {
+		if err := emit(ce); err != nil {
+			return err
+		}
+	}
+	return flush()
+}
@@ -0,0 +1,127 @@
+package cloudeventexporter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/exporter/exportertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+var (
+	testTraceID = pcommon.TraceID([16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36})
+	testSpanID  = pcommon.SpanID([8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7})
+)
+
+// Returns traces with a deploy span carrying a deployment and an exception event
+func testTraces() ptrace.Traces {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr(ATTR_EVENT_NS, "testns")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("deploy")
+	span.SetTraceID(testTraceID)
+	span.SetSpanID(testSpanID)
+	span.SetStartTimestamp(pcommon.NewTimestampFromTime(time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC)))
+	span.Status().SetMessage("rollout failed")
+
+	deployment := span.Events().AppendEmpty()
+	deployment.SetName("deployment")
+	deployment.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2023, 4, 1, 10, 0, 1, 0, time.UTC)))
+	deployment.Attributes().PutStr("version", "1.2.0")
+
+	exception := span.Events().AppendEmpty()
+	exception.SetName("exception")
+	exception.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2023, 4, 1, 10, 0, 2, 0, time.UTC)))
+	exception.Attributes().PutStr(ATTR_EXCEPTION_MESSAGE, "image pull failed")
+	return td
+}
+
+func TestPushTracesSpanEvents(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Traces.EventNames = []string{"exception"}
+	e, _ := startTestExporter(t, cfg)
+
+	require.NoError(t, e.pushTraces(context.Background(), testTraces()))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "00f067aa0ba902b7-1", req.header.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.test.event.v1.exception", req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "2023-04-01T10:00:02Z", req.header.Get(HEADER_CE_TIME))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", req.header.Get(HEADER_CE_PREFIX+EXTENSION_TRACE_ID))
+	assert.Equal(t, "00f067aa0ba902b7", req.header.Get(HEADER_CE_PREFIX+EXTENSION_SPAN_ID))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", req.header.Get(HEADER_CE_PREFIX+EXTENSION_TRACE_PARENT))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "exception", data["reason"])
+	assert.Equal(t, "deploy", data["name"])
+	assert.Equal(t, "testns", data["namespace"])
+	assert.Equal(t, "image pull failed", data["message"])
+
+	// The deployment event isn't in event_names
+	select {
+	case req := <-requests:
+		t.Fatalf("unexpected cloud-event %s", req.header.Get(HEADER_CE_ID))
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPushTracesSpans(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	cfg := testConfig()
+	cfg.Endpoint = server.URL
+	cfg.Traces.Source = TRACES_SOURCE_SPANS
+	cfg.IncludeOtelAttributes = true
+	e, _ := startTestExporter(t, cfg)
+
+	td := testTraces()
+	td.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0).TraceState().FromRaw("vendor=value")
+	require.NoError(t, e.pushTraces(context.Background(), td))
+
+	req := nextRequest(t, requests)
+	assert.Equal(t, "00f067aa0ba902b7", req.header.Get(HEADER_CE_ID))
+	assert.Equal(t, "com.test.event.v1.deploy", req.header.Get(HEADER_CE_TYPE))
+	assert.Equal(t, "vendor=value", req.header.Get(HEADER_CE_PREFIX+EXTENSION_TRACE_STATE))
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(req.body, &data))
+	assert.Equal(t, "rollout failed", data["message"])
+	assert.Equal(t, "2023-04-01T10:00:00Z", data["start_time"])
+}
+
+func TestPushTracesEmpty(t *testing.T) {
+	e, _ := newTestExporter(t, testConfig())
+	assert.NoError(t, e.pushTraces(context.Background(), ptrace.NewTraces()))
+}
+
+func TestCreateTracesExporter(t *testing.T) {
+	cfg := testConfig()
+	cfg.Endpoint = "http://localhost:8080"
+	exp, err := NewFactory().CreateTracesExporter(context.Background(), exportertest.NewNopCreateSettings(), cfg)
+	require.NoError(t, err)
+	assert.NotNil(t, exp)
+}
+
+func TestValidateTraces(t *testing.T) {
+	cfg := testConfig()
+	cfg.Traces.EventNames = []string{"exception"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Traces.EventNames = []string{""}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Traces.EventNames = []string{"exception"}
+	cfg.Traces.Source = TRACES_SOURCE_SPANS
+	assert.Error(t, cfg.Validate())
+
+	cfg.Traces = TracesSettings{Source: "links"}
+	assert.Error(t, cfg.Validate())
+}
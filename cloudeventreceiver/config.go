@@ -0,0 +1,112 @@
+package cloudeventreceiver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/config/configopaque"
+	"go.opentelemetry.io/collector/config/configtls"
+)
+
+type Config struct {
+	confighttp.HTTPServerSettings `mapstructure:",squash"` // squash ensures fields are correctly decoded in embedded struct.
+
+	// Path the cloud-events are POSTed to
+	Path string `mapstructure:"path"`
+
+	// Origins (like eventgrid.azure.net) allowed by the abuse protection handshake of webhooks, empty allows all of them
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+
+	// Where the cloud-events come from, http (default) or kafka
+	Transport string        `mapstructure:"transport"`
+	Kafka     KafkaSettings `mapstructure:"kafka"`
+}
+
+const (
+	TRANSPORT_HTTP  = "http"
+	TRANSPORT_KAFKA = "kafka"
+
+	KAFKA_OFFSET_LATEST   = "latest"
+	KAFKA_OFFSET_EARLIEST = "earliest"
+)
+
+// Settings for the kafka transport, the records of the topics are cloud-events as per the Kafka binding
+type KafkaSettings struct {
+	Brokers         []string                    `mapstructure:"brokers"`
+	Topics          []string                    `mapstructure:"topics"`
+	GroupID         string                      `mapstructure:"group_id"`
+	InitialOffset   string                      `mapstructure:"initial_offset"`   // where a group without committed offsets starts, latest or earliest
+	ProtocolVersion string                      `mapstructure:"protocol_version"` // like 2.0.0, 1.0.0 when empty
+	TLS             *configtls.TLSClientSetting `mapstructure:"tls"`              // plaintext connections when nil
+	SASL            *KafkaSASLSettings          `mapstructure:"sasl"`
+}
+
+type KafkaSASLSettings struct {
+	Mechanism string              `mapstructure:"mechanism"` // PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	Username  string              `mapstructure:"username"`
+	Password  configopaque.String `mapstructure:"password"`
+}
+
+var _ component.Config = (*Config)(nil)
+
+// Validate checks if the receiver configuration is valid
+func (cfg *Config) Validate() error {
+	switch cfg.Transport {
+	case "", TRANSPORT_HTTP:
+		if len(cfg.Endpoint) == 0 {
+			return errors.New("endpoint field can not be empty")
+		}
+		if !strings.HasPrefix(cfg.Path, "/") {
+			return errors.New("path must start with /")
+		}
+		for _, origin := range cfg.AllowedOrigins {
+			if len(origin) == 0 {
+				return errors.New("allowed_origins can not have empty origins")
+			}
+		}
+	case TRANSPORT_KAFKA:
+		return cfg.Kafka.validate()
+	default:
+		return fmt.Errorf("transport must be %s or %s, provided: %s", TRANSPORT_HTTP, TRANSPORT_KAFKA, cfg.Transport)
+	}
+
+	return nil
+}
+
+func (cfg *KafkaSettings) validate() error {
+	if len(cfg.Brokers) == 0 {
+		return errors.New("kafka.brokers field can not be empty")
+	}
+	if len(cfg.Topics) == 0 {
+		return errors.New("kafka.topics field can not be empty")
+	}
+	if len(cfg.GroupID) == 0 {
+		return errors.New("kafka.group_id field can not be empty")
+	}
+	switch cfg.InitialOffset {
+	case KAFKA_OFFSET_LATEST, KAFKA_OFFSET_EARLIEST:
+	default:
+		return fmt.Errorf("kafka.initial_offset must be %s or %s, provided: %s", KAFKA_OFFSET_LATEST, KAFKA_OFFSET_EARLIEST, cfg.InitialOffset)
+	}
+	if cfg.ProtocolVersion != "" {
+		if _, err := sarama.ParseKafkaVersion(cfg.ProtocolVersion); err != nil {
+			return fmt.Errorf("kafka.protocol_version must be a valid Kafka version, provided: %s", cfg.ProtocolVersion)
+		}
+	}
+	if cfg.SASL != nil {
+		switch cfg.SASL.Mechanism {
+		case KAFKA_SASL_PLAIN, KAFKA_SASL_SCRAM_SHA_256, KAFKA_SASL_SCRAM_SHA_512:
+		default:
+			return fmt.Errorf("kafka.sasl.mechanism must be %s, %s or %s, provided: %s",
+				KAFKA_SASL_PLAIN, KAFKA_SASL_SCRAM_SHA_256, KAFKA_SASL_SCRAM_SHA_512, cfg.SASL.Mechanism)
+		}
+		if len(cfg.SASL.Username) == 0 {
+			return errors.New("kafka.sasl.username field can not be empty")
+		}
+	}
+	return nil
+}
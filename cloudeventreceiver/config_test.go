@@ -0,0 +1,94 @@
+package cloudeventreceiver
+
+import (
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/confmap/confmaptest"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cm, err := confmaptest.LoadConf(filepath.Join("testdata", "config.yaml"))
+	require.NoError(t, err)
+
+	cloudEventConfig := Config{
+		HTTPServerSettings: confighttp.HTTPServerSettings{Endpoint: "0.0.0.0:9090"},
+		Path:               "/events",
+		AllowedOrigins:     []string{"eventgrid.azure.net"},
+		Transport:          TRANSPORT_KAFKA,
+		Kafka: KafkaSettings{
+			Brokers:       []string{"kafka-0:9092", "kafka-1:9092"},
+			Topics:        []string{"k8s-events"},
+			GroupID:       "collector",
+			InitialOffset: KAFKA_OFFSET_EARLIEST,
+			SASL:          &KafkaSASLSettings{Mechanism: KAFKA_SASL_SCRAM_SHA_512, Username: "collector", Password: "secret"},
+		},
+	}
+
+	unmarsheledConf := Config{}
+	err = cm.Unmarshal(&unmarsheledConf)
+
+	if err != nil {
+		log.Panicln("Couldn't convert the passed config.yaml to valid YAML", err)
+	}
+
+	assert.Equal(t, unmarsheledConf, cloudEventConfig)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := CreateDefaultConfig().(*Config)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Path = "events"
+	assert.Error(t, cfg.Validate())
+
+	cfg = CreateDefaultConfig().(*Config)
+	cfg.Endpoint = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = CreateDefaultConfig().(*Config)
+	cfg.AllowedOrigins = []string{""}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Transport = "grpc"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateKafka(t *testing.T) {
+	cfg := kafkaConfig()
+	// The http settings don't matter with kafka
+	cfg.Endpoint = ""
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Kafka.Topics = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Kafka.Brokers = nil
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Kafka.GroupID = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Kafka.InitialOffset = "oldest"
+	assert.Error(t, cfg.Validate())
+
+	cfg = kafkaConfig()
+	cfg.Kafka.ProtocolVersion = "two"
+	assert.Error(t, cfg.Validate())
+	cfg.Kafka.ProtocolVersion = "2.0.0"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Kafka.SASL = &KafkaSASLSettings{Mechanism: "GSSAPI", Username: "user"}
+	assert.Error(t, cfg.Validate())
+	cfg.Kafka.SASL.Mechanism = KAFKA_SASL_SCRAM_SHA_512
+	assert.NoError(t, cfg.Validate())
+	cfg.Kafka.SASL.Username = ""
+	assert.Error(t, cfg.Validate())
+}
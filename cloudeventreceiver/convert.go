@@ -0,0 +1,306 @@
+package cloudeventreceiver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+const (
+	SPEC_VERSION_1_0 = "1.0"
+
+	// Prefix of the headers carrying the attributes in binary mode
+	HEADER_CE_PREFIX = "Ce-"
+
+	// Log attributes of the required attributes and subject, as per the semantic conventions of CloudEvents,
+	// see https://github.com/open-telemetry/semantic-conventions/blob/main/docs/cloudevents/cloudevents-spans.md
+	ATTR_EVENT_ID           = "cloudevents.event_id"
+	ATTR_EVENT_SOURCE       = "cloudevents.event_source"
+	ATTR_EVENT_SPEC_VERSION = "cloudevents.event_spec_version"
+	ATTR_EVENT_TYPE         = "cloudevents.event_type"
+	ATTR_EVENT_SUBJECT      = "cloudevents.event_subject"
+
+	// The other attributes (datacontenttype, dataschema) and the extensions are log attributes cloudevents.<name>
+	ATTR_PREFIX = "cloudevents."
+)
+
+// Cloud-event received in any of the content modes, data is nil, a string, bytes or the decoded JSON
+type cloudEvent struct {
+	id          string
+	source      string
+	specVersion string
+	eventType   string
+	subject     string
+	time        time.Time
+	attributes  map[string]interface{}
+	data        interface{}
+}
+
+// Sets an attribute of the event by its name, the ones with fields of their own go there
+func (ce *cloudEvent) set(name string, val interface{}) error {
+	str, isStr := val.(string)
+	switch name {
+	case "id", "source", "specversion", "type", "subject", "time":
+		if !isStr {
+			return fmt.Errorf("%s must be a string", name)
+		}
+	}
+
+	switch name {
+	case "id":
+		ce.id = str
+	case "source":
+		ce.source = str
+	case "specversion":
+		ce.specVersion = str
+	case "type":
+		ce.eventType = str
+	case "subject":
+		ce.subject = str
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return fmt.Errorf("time must be RFC3339, provided: %s", str)
+		}
+		ce.time = t
+	default:
+		if ce.attributes == nil {
+			ce.attributes = make(map[string]interface{})
+		}
+		ce.attributes[name] = val
+	}
+	return nil
+}
+
+// The required attributes are there and the spec version is the supported one
+func (ce *cloudEvent) validate() error {
+	if ce.specVersion != SPEC_VERSION_1_0 {
+		return fmt.Errorf("specversion must be %s, provided: %s", SPEC_VERSION_1_0, ce.specVersion)
+	}
+	if ce.id == "" {
+		return errors.New("id can not be empty")
+	}
+	if ce.source == "" {
+		return errors.New("source can not be empty")
+	}
+	if ce.eventType == "" {
+		return errors.New("type can not be empty")
+	}
+	return nil
+}
+
+// JSON data is decoded, a missing content type means JSON as well
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Decodes JSON keeping the numbers apart, integers stay integers instead of becoming floats
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var val interface{}
+	if err := decoder.Decode(&val); err != nil {
+		return nil, err
+	}
+	return normalize(val), nil
+}
+
+// Numbers of the decoded JSON as int64 or float64, the types pcommon takes
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalize(elem)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalize(elem)
+		}
+	}
+	return val
+}
+
+// Data of the body, decoded when it's JSON, text when it's valid UTF-8, the bytes otherwise
+func dataOf(contentType string, body []byte) (interface{}, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if isJSON(contentType) {
+		data, err := decodeJSON(body)
+		if err != nil {
+			return nil, fmt.Errorf("data isn't valid JSON: %w", err)
+		}
+		return data, nil
+	}
+	if utf8.Valid(body) {
+		return string(body), nil
+	}
+	return body, nil
+}
+
+// Binary content mode, the attributes are Ce-* headers (percent-encoded) and the body is the data
+func parseBinary(headers http.Header, body []byte) (*cloudEvent, error) {
+	attrs := make(map[string]string)
+	for key := range headers {
+		if len(key) <= len(HEADER_CE_PREFIX) || !strings.EqualFold(key[:len(HEADER_CE_PREFIX)], HEADER_CE_PREFIX) {
+			continue
+		}
+		val := headers.Get(key)
+		if unescaped, err := url.PathUnescape(val); err == nil {
+			val = unescaped
+		}
+		attrs[strings.ToLower(key[len(HEADER_CE_PREFIX):])] = val
+	}
+	return binaryEvent(attrs, headers.Get(HEADER_CONTENT_TYPE), body)
+}
+
+// Cloud-event of the attributes (by their name) and the data of a binary mode message, of any transport
+func binaryEvent(attrs map[string]string, contentType string, body []byte) (*cloudEvent, error) {
+	ce := &cloudEvent{}
+	for name, val := range attrs {
+		if err := ce.set(name, val); err != nil {
+			return nil, err
+		}
+	}
+
+	if contentType != "" {
+		_ = ce.set("datacontenttype", contentType)
+	}
+	if err := ce.validate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if ce.data, err = dataOf(contentType, body); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+// Structured content mode, the attributes and the data are members of the JSON object
+func parseStructured(body []byte) (*cloudEvent, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, fmt.Errorf("cloud-event isn't a JSON object: %w", err)
+	}
+	return structuredEvent(members)
+}
+
+// JSON batch, an array of structured cloud-events
+func parseBatch(body []byte) ([]*cloudEvent, error) {
+	var batch []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("batch isn't a JSON array of objects: %w", err)
+	}
+
+	events := make([]*cloudEvent, 0, len(batch))
+	for i, members := range batch {
+		ce, err := structuredEvent(members)
+		if err != nil {
+			return nil, fmt.Errorf("cloud-event %d of the batch: %w", i, err)
+		}
+		events = append(events, ce)
+	}
+	return events, nil
+}
+
+func structuredEvent(members map[string]json.RawMessage) (*cloudEvent, error) {
+	ce := &cloudEvent{}
+	for name, raw := range members {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		val, err := decodeJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s isn't valid JSON: %w", name, err)
+		}
+		if val == nil {
+			continue
+		}
+		if err = ce.set(name, val); err != nil {
+			return nil, err
+		}
+	}
+	if err := ce.validate(); err != nil {
+		return nil, err
+	}
+
+	if raw, ok := members["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return nil, errors.New("data_base64 must be a string")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("data_base64 isn't valid base64: %w", err)
+		}
+		ce.data = data
+		return ce, nil
+	}
+
+	if raw, ok := members["data"]; ok {
+		data, err := decodeJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("data isn't valid JSON: %w", err)
+		}
+		ce.data = data
+	}
+	return ce, nil
+}
+
+// Log records of the events, the attributes become log attributes and the data the body
+func toLogs(events []*cloudEvent) plog.Logs {
+	ld := plog.NewLogs()
+	sl := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty()
+	sl.Scope().SetName(typeStr)
+
+	now := pcommon.NewTimestampFromTime(time.Now())
+	for _, ce := range events {
+		lr := sl.LogRecords().AppendEmpty()
+		lr.SetObservedTimestamp(now)
+		if !ce.time.IsZero() {
+			lr.SetTimestamp(pcommon.NewTimestampFromTime(ce.time))
+		}
+
+		attrs := lr.Attributes()
+		attrs.PutStr(ATTR_EVENT_ID, ce.id)
+		attrs.PutStr(ATTR_EVENT_SOURCE, ce.source)
+		attrs.PutStr(ATTR_EVENT_SPEC_VERSION, ce.specVersion)
+		attrs.PutStr(ATTR_EVENT_TYPE, ce.eventType)
+		if ce.subject != "" {
+			attrs.PutStr(ATTR_EVENT_SUBJECT, ce.subject)
+		}
+		for name, val := range ce.attributes {
+			_ = attrs.PutEmpty(ATTR_PREFIX + name).FromRaw(val)
+		}
+
+		if ce.data != nil {
+			_ = lr.Body().FromRaw(ce.data)
+		}
+	}
+	return ld
+}
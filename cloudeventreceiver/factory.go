@@ -0,0 +1,58 @@
+package cloudeventreceiver
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/receiver"
+)
+
+const (
+	// The value of "type" key in configuration.
+	typeStr   = "cloudeventreceiver"
+	stability = component.StabilityLevelAlpha
+
+	DEFAULT_ENDPOINT       = "0.0.0.0:8080"
+	DEFAULT_PATH           = "/"
+	DEFAULT_KAFKA_GROUP_ID = "cloudeventreceiver"
+)
+
+// NewFactory creates a factory for the cloud-event receiver.
+func NewFactory() receiver.Factory {
+	return receiver.NewFactory(
+		typeStr,
+		CreateDefaultConfig,
+		receiver.WithLogs(createLogsReceiver, stability),
+	)
+}
+
+func CreateDefaultConfig() component.Config {
+	return &Config{
+		HTTPServerSettings: confighttp.HTTPServerSettings{
+			Endpoint: DEFAULT_ENDPOINT,
+		},
+		Path:      DEFAULT_PATH,
+		Transport: TRANSPORT_HTTP,
+		Kafka: KafkaSettings{
+			GroupID:       DEFAULT_KAFKA_GROUP_ID,
+			InitialOffset: KAFKA_OFFSET_LATEST,
+		},
+	}
+}
+
+func createLogsReceiver(
+	_ context.Context,
+	set receiver.CreateSettings,
+	cfg component.Config,
+	nextConsumer consumer.Logs) (receiver.Logs, error) {
+
+	rCfg, ok := cfg.(*Config)
+	if !ok {
+		return nil, errors.New("could not initialize cloud-event receiver")
+	}
+
+	return newReceiver(set, rCfg, nextConsumer), nil
+}
@@ -0,0 +1,176 @@
+package cloudeventreceiver
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
+)
+
+const (
+	// Kafka binding names the attribute headers ce_<name> and keeps content-type as is,
+	// see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/kafka-protocol-binding.md
+	KAFKA_HEADER_PREFIX       = "ce_"
+	KAFKA_HEADER_CONTENT_TYPE = "content-type"
+
+	KAFKA_SASL_PLAIN         = "PLAIN"
+	KAFKA_SASL_SCRAM_SHA_256 = "SCRAM-SHA-256"
+	KAFKA_SASL_SCRAM_SHA_512 = "SCRAM-SHA-512"
+
+	// Wait before joining the group again when a session fails
+	KAFKA_REJOIN_BACKOFF = time.Second
+)
+
+// Creates the consumer group of the kafka transport, the brokers are reached right away for the metadata
+func newKafkaConsumerGroup(cfg *KafkaSettings) (sarama.ConsumerGroup, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	if cfg.InitialOffset == KAFKA_OFFSET_EARLIEST {
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+
+	if cfg.ProtocolVersion != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.ProtocolVersion)
+		if err != nil {
+			return nil, err
+		}
+		config.Version = version
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.LoadTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if cfg.SASL != nil {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = cfg.SASL.Username
+		config.Net.SASL.Password = string(cfg.SASL.Password)
+		config.Net.SASL.Mechanism = sarama.SASLMechanism(cfg.SASL.Mechanism)
+		switch cfg.SASL.Mechanism {
+		case KAFKA_SASL_SCRAM_SHA_256:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: scram.SHA256} }
+		case KAFKA_SASL_SCRAM_SHA_512:
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hashGen: scram.SHA512} }
+		}
+	}
+
+	return sarama.NewConsumerGroup(cfg.Brokers, cfg.GroupID, config)
+}
+
+// SCRAM conversation of the SASL handshake with the brokers
+type scramClient struct {
+	*scram.ClientConversation
+	hashGen scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(username, password, authzID string) error {
+	client, err := c.hashGen.NewClient(username, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+/*
+Cloud-event of the Kafka record, structured when its content-type is application/cloudevents+json and binary
+otherwise, with the attributes in ce_<name> headers (not percent-encoded unlike http) and the value as the data.
+*/
+func parseKafkaMessage(msg *sarama.ConsumerMessage) (*cloudEvent, error) {
+	contentType := ""
+	attrs := make(map[string]string)
+	for _, header := range msg.Headers {
+		if header == nil {
+			continue
+		}
+		key := strings.ToLower(string(header.Key))
+		switch {
+		case key == KAFKA_HEADER_CONTENT_TYPE:
+			contentType = string(header.Value)
+		case len(key) > len(KAFKA_HEADER_PREFIX) && strings.HasPrefix(key, KAFKA_HEADER_PREFIX):
+			attrs[key[len(KAFKA_HEADER_PREFIX):]] = string(header.Value)
+		}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == CONTENT_TYPE_STRUCTURED {
+		return parseStructured(msg.Value)
+	}
+	return binaryEvent(attrs, contentType, msg.Value)
+}
+
+/*
+Joins the consumer group until the receiver shuts down, a new session starts after a rebalance or a failure. Sessions
+ended by a failing pipeline wait as well before rejoining, sarama's Consume returns nil for them and rejoining right
+away would rebalance the group in a tight loop while the pipeline keeps failing.
+*/
+func (r *cloudEventReceiver) consumeKafka(ctx context.Context) {
+	handler := &kafkaHandler{receiver: r}
+	for {
+		err := r.kafka.Consume(ctx, r.config.Kafka.Topics, handler)
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.logger.Error("Consuming the kafka topics failed", zap.Strings("topics", r.config.Kafka.Topics), zap.Error(err))
+		}
+		if err != nil || handler.failed.Swap(false) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(KAFKA_REJOIN_BACKOFF):
+			}
+		}
+	}
+}
+
+type kafkaHandler struct {
+	receiver *cloudEventReceiver
+	failed   atomic.Bool // A claim of the session ended with an error of the pipeline
+}
+
+func (h *kafkaHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *kafkaHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+/*
+Passes the cloud-events of the claim on to the pipeline one record at a time. Invalid records and the ones failing
+with a permanent error are dropped, any other error ends the session so the records are consumed again from the
+last committed offset.
+*/
+func (h *kafkaHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	logger := h.receiver.logger
+	for msg := range claim.Messages() {
+		ce, err := parseKafkaMessage(msg)
+		if err != nil {
+			logger.Warn("Dropped the kafka record with an invalid cloud-event",
+				zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+			session.MarkMessage(msg, "")
+			continue
+		}
+
+		if err = h.receiver.next.ConsumeLogs(session.Context(), toLogs([]*cloudEvent{ce})); err != nil {
+			if !consumererror.IsPermanent(err) {
+				logger.Error("Consuming the kafka record failed, rejoining the group to consume it again",
+					zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+				h.failed.Store(true)
+				return err
+			}
+			logger.Error("Dropped the kafka record rejected by the pipeline",
+				zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(err))
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package cloudeventreceiver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Session of the consumer group recording the offsets marked as consumed
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return context.Background() }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func newFakeClaim(messages ...*sarama.ConsumerMessage) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(messages))}
+	for _, msg := range messages {
+		claim.messages <- msg
+	}
+	close(claim.messages)
+	return claim
+}
+
+// Consumer group claiming the messages in the first session, the next ones wait until the context is done
+type fakeConsumerGroup struct {
+	sarama.ConsumerGroup
+	messages []*sarama.ConsumerMessage
+	session  *fakeSession
+	closed   bool
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	if g.session == nil {
+		g.session = &fakeSession{}
+		return handler.ConsumeClaim(g.session, newFakeClaim(g.messages...))
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (g *fakeConsumerGroup) Close() error {
+	g.closed = true
+	return nil
+}
+
+func kafkaConfig() *Config {
+	cfg := CreateDefaultConfig().(*Config)
+	cfg.Transport = TRANSPORT_KAFKA
+	cfg.Kafka.Brokers = []string{"localhost:9092"}
+	cfg.Kafka.Topics = []string{"k8s-events"}
+	return cfg
+}
+
+func newKafkaHandler(t *testing.T, next consumer.Logs) *kafkaHandler {
+	cfg := kafkaConfig()
+	require.NoError(t, cfg.Validate())
+	return &kafkaHandler{receiver: newReceiver(receivertest.NewNopCreateSettings(), cfg, next)}
+}
+
+func binaryMessage(offset int64, id string) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{
+		Topic:  "k8s-events",
+		Offset: offset,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("ce_id"), Value: []byte(id)},
+			{Key: []byte("ce_source"), Value: []byte("test-source")},
+			{Key: []byte("ce_specversion"), Value: []byte("1.0")},
+			{Key: []byte("ce_type"), Value: []byte("com.test.event.v1.Created")},
+			{Key: []byte("ce_subject"), Value: []byte("pods/test%20pod")},
+			{Key: []byte("content-type"), Value: []byte("application/json")},
+		},
+		Value: []byte(`{"reason":"Created"}`),
+	}
+}
+
+func TestKafkaBinaryContentMode(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	session := &fakeSession{}
+	require.NoError(t, newKafkaHandler(t, sink).ConsumeClaim(session, newFakeClaim(binaryMessage(7, "1"))))
+
+	lr := receivedRecord(t, sink)
+	attrs := lr.Attributes().AsRaw()
+	assert.Equal(t, "1", attrs[ATTR_EVENT_ID])
+	assert.Equal(t, "com.test.event.v1.Created", attrs[ATTR_EVENT_TYPE])
+	// Kafka headers aren't percent-encoded
+	assert.Equal(t, "pods/test%20pod", attrs[ATTR_EVENT_SUBJECT])
+	assert.Equal(t, "application/json", attrs[ATTR_PREFIX+"datacontenttype"])
+	assert.Equal(t, map[string]interface{}{"reason": "Created"}, lr.Body().Map().AsRaw())
+	assert.Equal(t, []int64{7}, session.marked)
+}
+
+func TestKafkaStructuredContentMode(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	msg := &sarama.ConsumerMessage{
+		Headers: []*sarama.RecordHeader{{Key: []byte("content-type"), Value: []byte(CONTENT_TYPE_STRUCTURED + "; charset=utf-8")}},
+		Value:   []byte(`{"specversion":"1.0","id":"1","source":"test-source","type":"com.test.event.v1.Created","data":"hello"}`),
+	}
+	require.NoError(t, newKafkaHandler(t, sink).ConsumeClaim(&fakeSession{}, newFakeClaim(msg)))
+
+	lr := receivedRecord(t, sink)
+	assert.Equal(t, "test-source", lr.Attributes().AsRaw()[ATTR_EVENT_SOURCE])
+	assert.Equal(t, "hello", lr.Body().Str())
+}
+
+func TestKafkaInvalidCloudEvent(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	invalid := binaryMessage(1, "")
+	session := &fakeSession{}
+	require.NoError(t, newKafkaHandler(t, sink).ConsumeClaim(session, newFakeClaim(invalid, binaryMessage(2, "2"))))
+
+	// The invalid record is dropped, the next one still goes through
+	assert.Equal(t, 1, sink.LogRecordCount())
+	assert.Equal(t, []int64{1, 2}, session.marked)
+}
+
+func TestKafkaConsumerErrors(t *testing.T) {
+	// Retryable errors end the session without marking the record, it's consumed again
+	session := &fakeSession{}
+	handler := newKafkaHandler(t, consumertest.NewErr(errors.New("queue is full")))
+	assert.Error(t, handler.ConsumeClaim(session, newFakeClaim(binaryMessage(1, "1"))))
+	assert.Empty(t, session.marked)
+
+	// Permanent ones drop it
+	handler = newKafkaHandler(t, consumertest.NewErr(consumererror.NewPermanent(errors.New("bad event"))))
+	assert.NoError(t, handler.ConsumeClaim(session, newFakeClaim(binaryMessage(1, "1"), binaryMessage(2, "2"))))
+	assert.Equal(t, []int64{1, 2}, session.marked)
+}
+
+// Consumer group whose every session claims the messages, like sarama does after a handler error
+type rejoiningConsumerGroup struct {
+	sarama.ConsumerGroup
+	messages []*sarama.ConsumerMessage
+	sessions atomic.Int32
+}
+
+func (g *rejoiningConsumerGroup) Consume(_ context.Context, _ []string, handler sarama.ConsumerGroupHandler) error {
+	g.sessions.Add(1)
+	_ = handler.ConsumeClaim(&fakeSession{}, newFakeClaim(g.messages...))
+	return nil
+}
+
+func (g *rejoiningConsumerGroup) Close() error { return nil }
+
+func TestKafkaPipelineFailureBacksOff(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	set := receivertest.NewNopCreateSettings()
+	set.Logger = zap.New(core)
+
+	group := &rejoiningConsumerGroup{messages: []*sarama.ConsumerMessage{binaryMessage(1, "1")}}
+	r := newReceiver(set, kafkaConfig(), consumertest.NewErr(errors.New("queue is full")))
+	r.kafka = group
+
+	require.NoError(t, r.Start(context.Background(), componenttest.NewNopHost()))
+	time.Sleep(KAFKA_REJOIN_BACKOFF / 2)
+	require.NoError(t, r.Shutdown(context.Background()))
+
+	// Not rejoined within the backoff, and the failure is logged
+	assert.Equal(t, int32(1), group.sessions.Load())
+	assert.Equal(t, 1, logs.FilterMessage("Consuming the kafka record failed, rejoining the group to consume it again").Len())
+}
+
+func TestKafkaStartShutdown(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	group := &fakeConsumerGroup{messages: []*sarama.ConsumerMessage{binaryMessage(1, "1")}}
+	r := newReceiver(receivertest.NewNopCreateSettings(), kafkaConfig(), sink)
+	r.kafka = group
+
+	require.NoError(t, r.Start(context.Background(), componenttest.NewNopHost()))
+	assert.Eventually(t, func() bool { return sink.LogRecordCount() == 1 }, time.Second, 10*time.Millisecond)
+	require.NoError(t, r.Shutdown(context.Background()))
+	assert.True(t, group.closed)
+}
@@ -0,0 +1,215 @@
+package cloudeventreceiver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/receiver"
+	"go.uber.org/zap"
+)
+
+const (
+	HEADER_CONTENT_TYPE = "Content-Type"
+	HEADER_ALLOW        = "Allow"
+
+	// Abuse protection handshake of webhooks, see
+	// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/http-webhook.md#4-abuse-protection
+	HEADER_WEBHOOK_REQUEST_ORIGIN = "WebHook-Request-Origin"
+	HEADER_WEBHOOK_ALLOWED_ORIGIN = "WebHook-Allowed-Origin"
+	HEADER_WEBHOOK_ALLOWED_RATE   = "WebHook-Allowed-Rate"
+
+	CONTENT_TYPE_STRUCTURED = "application/cloudevents+json"
+	CONTENT_TYPE_BATCH      = "application/cloudevents-batch+json"
+)
+
+type cloudEventReceiver struct {
+	config   *Config
+	settings receiver.CreateSettings
+	logger   *zap.Logger
+	next     consumer.Logs
+
+	server     *http.Server
+	kafka      sarama.ConsumerGroup
+	cancel     context.CancelFunc
+	shutdownWG sync.WaitGroup
+}
+
+func newReceiver(set receiver.CreateSettings, cfg *Config, next consumer.Logs) *cloudEventReceiver {
+	return &cloudEventReceiver{
+		config:   cfg,
+		settings: set,
+		logger:   set.Logger,
+		next:     next,
+	}
+}
+
+func (r *cloudEventReceiver) Start(_ context.Context, host component.Host) error {
+	if r.config.Transport == TRANSPORT_KAFKA {
+		return r.startKafka()
+	}
+
+	listener, err := r.config.ToListener()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(r.config.Path, r)
+	if r.server, err = r.config.ToServer(host, r.settings.TelemetrySettings, mux); err != nil {
+		listener.Close()
+		return err
+	}
+
+	r.logger.Info("Starting the cloud-event receiver", zap.String("endpoint", listener.Addr().String()))
+	r.shutdownWG.Add(1)
+	go func() {
+		defer r.shutdownWG.Done()
+		if err := r.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			host.ReportFatalError(err)
+		}
+	}()
+	return nil
+}
+
+// Consumes kafka.topics with the consumer group, unless it's set already
+func (r *cloudEventReceiver) startKafka() error {
+	if r.kafka == nil {
+		group, err := newKafkaConsumerGroup(&r.config.Kafka)
+		if err != nil {
+			return err
+		}
+		r.kafka = group
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+
+	r.logger.Info("Starting the cloud-event receiver", zap.Strings("topics", r.config.Kafka.Topics), zap.String("group_id", r.config.Kafka.GroupID))
+	r.shutdownWG.Add(1)
+	go func() {
+		defer r.shutdownWG.Done()
+		r.consumeKafka(ctx)
+	}()
+	return nil
+}
+
+func (r *cloudEventReceiver) Shutdown(ctx context.Context) error {
+	if r.kafka != nil {
+		if r.cancel != nil {
+			r.cancel()
+		}
+		r.shutdownWG.Wait()
+		return r.kafka.Close()
+	}
+	if r.server == nil {
+		return nil
+	}
+	err := r.server.Shutdown(ctx)
+	r.shutdownWG.Wait()
+	return err
+}
+
+func (r *cloudEventReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+	case http.MethodOptions:
+		r.handshake(w, req)
+		return
+	default:
+		w.Header().Set(HEADER_ALLOW, http.MethodPost+", "+http.MethodOptions)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		// Bodies above max_request_body_size fail to read as well
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var events []*cloudEvent
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get(HEADER_CONTENT_TYPE))
+	switch mediaType {
+	case CONTENT_TYPE_STRUCTURED:
+		var event *cloudEvent
+		if event, err = parseStructured(body); err == nil {
+			events = []*cloudEvent{event}
+		}
+	case CONTENT_TYPE_BATCH:
+		events, err = parseBatch(body)
+	default:
+		var event *cloudEvent
+		if event, err = parseBinary(req.Header, body); err == nil {
+			events = []*cloudEvent{event}
+		}
+	}
+	if err != nil {
+		r.logger.Debug("Rejected the request with an invalid cloud-event", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = r.next.ConsumeLogs(req.Context(), toLogs(events)); err != nil {
+		// Permanent errors won't go away with a retry, the sender should drop the events
+		if consumererror.IsPermanent(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Answers the abuse protection handshake, senders like Event Grid validate the webhook with it before delivering
+func (r *cloudEventReceiver) handshake(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get(HEADER_WEBHOOK_REQUEST_ORIGIN)
+	if origin == "" {
+		w.Header().Set(HEADER_ALLOW, http.MethodPost+", "+http.MethodOptions)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !r.allowedOrigin(origin) {
+		r.logger.Warn("Rejected the webhook handshake of an origin which isn't allowed", zap.String("origin", origin))
+		http.Error(w, "origin isn't allowed", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set(HEADER_WEBHOOK_ALLOWED_ORIGIN, origin)
+	w.Header().Set(HEADER_WEBHOOK_ALLOWED_RATE, "*")
+	w.Header().Set(HEADER_ALLOW, http.MethodPost+", "+http.MethodOptions)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *cloudEventReceiver) allowedOrigin(origin string) bool {
+	if len(r.config.AllowedOrigins) == 0 {
+		return true
+	}
+	host := origin
+	if h, _, err := net.SplitHostPort(origin); err == nil {
+		host = h
+	}
+	for _, allowed := range r.config.AllowedOrigins {
+		if allowed == origin || allowed == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package cloudeventreceiver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/receiver/receivertest"
+)
+
+func newTestReceiver(t *testing.T, next consumer.Logs) *cloudEventReceiver {
+	cfg := CreateDefaultConfig().(*Config)
+	require.NoError(t, cfg.Validate())
+	return newReceiver(receivertest.NewNopCreateSettings(), cfg, next)
+}
+
+// Serves the request and returns the response code
+func serve(r *cloudEventReceiver, req *http.Request) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	return res
+}
+
+// The only log record the sink got
+func receivedRecord(t *testing.T, sink *consumertest.LogsSink) plog.LogRecord {
+	require.Len(t, sink.AllLogs(), 1)
+	ld := sink.AllLogs()[0]
+	require.Equal(t, 1, ld.LogRecordCount())
+	return ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+}
+
+func TestBinaryContentMode(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"reason":"Created","count":2}`))
+	req.Header.Set("Ce-Id", "uid-pod")
+	req.Header.Set("Ce-Source", "test-source")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Type", "com.test.event.v1.Created")
+	req.Header.Set("Ce-Time", "2023-04-01T10:00:00Z")
+	req.Header.Set("Ce-Subject", "pod")
+	req.Header.Set("Ce-Correlationid", "caf%C3%A9")
+	req.Header.Set(HEADER_CONTENT_TYPE, "application/json")
+	assert.Equal(t, http.StatusAccepted, serve(r, req).Code)
+
+	lr := receivedRecord(t, sink)
+	assert.Equal(t, map[string]interface{}{
+		ATTR_EVENT_ID:                 "uid-pod",
+		ATTR_EVENT_SOURCE:             "test-source",
+		ATTR_EVENT_SPEC_VERSION:       "1.0",
+		ATTR_EVENT_TYPE:               "com.test.event.v1.Created",
+		ATTR_EVENT_SUBJECT:            "pod",
+		"cloudevents.correlationid":   "café",
+		"cloudevents.datacontenttype": "application/json",
+	}, lr.Attributes().AsRaw())
+	assert.Equal(t, time.Date(2023, 4, 1, 10, 0, 0, 0, time.UTC), lr.Timestamp().AsTime())
+	assert.NotZero(t, lr.ObservedTimestamp())
+	assert.Equal(t, map[string]interface{}{"reason": "Created", "count": int64(2)}, lr.Body().Map().AsRaw())
+}
+
+func TestBinaryContentModeText(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("Started container"))
+	req.Header.Set("Ce-Id", "1")
+	req.Header.Set("Ce-Source", "test-source")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Type", "com.test.event.v1.Started")
+	req.Header.Set(HEADER_CONTENT_TYPE, "text/plain")
+	assert.Equal(t, http.StatusAccepted, serve(r, req).Code)
+
+	lr := receivedRecord(t, sink)
+	assert.Equal(t, "Started container", lr.Body().Str())
+	assert.Zero(t, lr.Timestamp())
+}
+
+func TestStructuredContentMode(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	body := `{"specversion":"1.0","id":"uid-pod","source":"test-source","type":"com.test.event.v1.Created",` +
+		`"datacontenttype":"application/json","sequence":3,"critical":true,"data":{"reason":"Created"}}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_STRUCTURED+"; charset=utf-8")
+	assert.Equal(t, http.StatusAccepted, serve(r, req).Code)
+
+	lr := receivedRecord(t, sink)
+	assert.Equal(t, map[string]interface{}{
+		ATTR_EVENT_ID:                 "uid-pod",
+		ATTR_EVENT_SOURCE:             "test-source",
+		ATTR_EVENT_SPEC_VERSION:       "1.0",
+		ATTR_EVENT_TYPE:               "com.test.event.v1.Created",
+		"cloudevents.datacontenttype": "application/json",
+		"cloudevents.sequence":        int64(3),
+		"cloudevents.critical":        true,
+	}, lr.Attributes().AsRaw())
+	assert.Equal(t, map[string]interface{}{"reason": "Created"}, lr.Body().Map().AsRaw())
+}
+
+func TestStructuredContentModeBase64(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	body := `{"specversion":"1.0","id":"1","source":"test-source","type":"com.test.event.v1.Created","data_base64":"AAEC"}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_STRUCTURED)
+	assert.Equal(t, http.StatusAccepted, serve(r, req).Code)
+
+	lr := receivedRecord(t, sink)
+	assert.Equal(t, pcommon.ValueTypeBytes, lr.Body().Type())
+	assert.Equal(t, []byte{0, 1, 2}, lr.Body().Bytes().AsRaw())
+}
+
+func TestBatch(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	body := `[{"specversion":"1.0","id":"1","source":"test-source","type":"com.test.event.v1.Created","data":"first"},` +
+		`{"specversion":"1.0","id":"2","source":"test-source","type":"com.test.event.v1.Deleted","data":"second"}]`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_BATCH)
+	assert.Equal(t, http.StatusAccepted, serve(r, req).Code)
+
+	require.Len(t, sink.AllLogs(), 1)
+	records := sink.AllLogs()[0].ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	require.Equal(t, 2, records.Len())
+	assert.Equal(t, "second", records.At(1).Body().Str())
+	id, _ := records.At(1).Attributes().Get(ATTR_EVENT_ID)
+	assert.Equal(t, "2", id.Str())
+}
+
+func TestInvalidCloudEvents(t *testing.T) {
+	sink := &consumertest.LogsSink{}
+	r := newTestReceiver(t, sink)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		headers     map[string]string
+	}{
+		{name: "missing type", contentType: "application/json", body: `{}`,
+			headers: map[string]string{"Ce-Id": "1", "Ce-Source": "s", "Ce-Specversion": "1.0"}},
+		{name: "unsupported spec version", contentType: "application/json", body: `{}`,
+			headers: map[string]string{"Ce-Id": "1", "Ce-Source": "s", "Ce-Specversion": "0.3", "Ce-Type": "t"}},
+		{name: "invalid JSON data", contentType: "application/json", body: `{`,
+			headers: map[string]string{"Ce-Id": "1", "Ce-Source": "s", "Ce-Specversion": "1.0", "Ce-Type": "t"}},
+		{name: "invalid time", contentType: "application/json", body: `{}`,
+			headers: map[string]string{"Ce-Id": "1", "Ce-Source": "s", "Ce-Specversion": "1.0", "Ce-Type": "t", "Ce-Time": "yesterday"}},
+		{name: "structured not an object", contentType: CONTENT_TYPE_STRUCTURED, body: `[]`},
+		{name: "structured id not a string", contentType: CONTENT_TYPE_STRUCTURED,
+			body: `{"specversion":"1.0","id":1,"source":"s","type":"t"}`},
+		{name: "batch event without source", contentType: CONTENT_TYPE_BATCH,
+			body: `[{"specversion":"1.0","id":"1","type":"t"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(HEADER_CONTENT_TYPE, tt.contentType)
+			for key, val := range tt.headers {
+				req.Header.Set(key, val)
+			}
+			assert.Equal(t, http.StatusBadRequest, serve(r, req).Code)
+		})
+	}
+	assert.Empty(t, sink.AllLogs())
+}
+
+func TestConsumerErrors(t *testing.T) {
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(
+			`{"specversion":"1.0","id":"1","source":"test-source","type":"com.test.event.v1.Created"}`))
+		req.Header.Set(HEADER_CONTENT_TYPE, CONTENT_TYPE_STRUCTURED)
+		return req
+	}
+
+	// Retryable errors ask the sender to try again
+	r := newTestReceiver(t, consumertest.NewErr(errors.New("queue is full")))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(r, newRequest()).Code)
+
+	r = newTestReceiver(t, consumertest.NewErr(consumererror.NewPermanent(errors.New("bad event"))))
+	assert.Equal(t, http.StatusBadRequest, serve(r, newRequest()).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	res := serve(r, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, "POST, OPTIONS", res.Header().Get(HEADER_ALLOW))
+}
+
+func TestWebhookHandshake(t *testing.T) {
+	r := newTestReceiver(t, consumertest.NewNop())
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set(HEADER_WEBHOOK_REQUEST_ORIGIN, "eventgrid.azure.net")
+	res := serve(r, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "eventgrid.azure.net", res.Header().Get(HEADER_WEBHOOK_ALLOWED_ORIGIN))
+	assert.Equal(t, "*", res.Header().Get(HEADER_WEBHOOK_ALLOWED_RATE))
+
+	// Only the allowed origins get through
+	r.config.AllowedOrigins = []string{"eventgrid.azure.net"}
+	assert.Equal(t, http.StatusOK, serve(r, req).Code)
+
+	req.Header.Set(HEADER_WEBHOOK_REQUEST_ORIGIN, "example.com")
+	res = serve(r, req)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Empty(t, res.Header().Get(HEADER_WEBHOOK_ALLOWED_ORIGIN))
+}
+
+func TestStartShutdown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	endpoint := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	sink := &consumertest.LogsSink{}
+	cfg := CreateDefaultConfig().(*Config)
+	cfg.Endpoint = endpoint
+	cfg.Path = "/events"
+
+	r, err := NewFactory().CreateLogsReceiver(context.Background(), receivertest.NewNopCreateSettings(), cfg, sink)
+	require.NoError(t, err)
+	require.NoError(t, r.Start(context.Background(), componenttest.NewNopHost()))
+	t.Cleanup(func() {
+		require.NoError(t, r.Shutdown(context.Background()))
+	})
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+endpoint+"/events", strings.NewReader(`"hello"`))
+	require.NoError(t, err)
+	req.Header.Set("Ce-Id", "1")
+	req.Header.Set("Ce-Source", "test-source")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Type", "com.test.event.v1.Created")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	assert.Equal(t, "hello", receivedRecord(t, sink).Body().Str())
+}